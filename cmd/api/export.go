@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/config"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+)
+
+// runExport implements the export subcommand, which dumps the inference logs of
+// every user, or of one user with -user, without going through the API:
+//
+//	server export -format parquet -from 2026-01-01T00:00:00Z -o logs.parquet
+func runExport(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", string(service.ExportCSV), "output format: csv, ndjson or parquet")
+	from := fs.String("from", "", "start of the request time range, RFC 3339 (default: 7 days before -to)")
+	to := fs.String("to", "", "end of the request time range, RFC 3339 (default: now)")
+	model := fs.String("model", "", "only export predictions of this model")
+	userID := fs.Int64("user", 0, "only export predictions of this user")
+	apiKeyID := fs.Int64("api-key", 0, "only export predictions made with this API key")
+	output := fs.String("o", "", "output file (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	exportFormat, err := service.ParseExportFormat(*format)
+	if err != nil {
+		return err
+	}
+	filter := service.ExportFilter{To: time.Now().UTC(), Model: *model}
+	if *to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	filter.From = filter.To.Add(-7 * 24 * time.Hour)
+	if *from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+	if *userID != 0 {
+		filter.UserID = userID
+	}
+	if *apiKeyID != 0 {
+		filter.APIKeyID = apiKeyID
+	}
+
+	dbConn, err := db.NewDatabase(cfg.PGDSN, cfg.PGMaxOpenConns, cfg.PGMaxIdleConns, cfg.PGConnMaxLifetime)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer func() {
+		_ = dbConn.Close()
+	}()
+	exportSvc := service.NewExportService(repo.NewExportRepository(db.New(dbConn)), int32(cfg.ExportBatchSize))
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+
+	n, err := exportSvc.Export(context.Background(), w, exportFormat, filter)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d inference logs\n", n)
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/jules-labs/go-api-prod-template/internal/config"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+)
+
+// newFallback builds the degraded mode scorer from the configuration. It
+// returns nil when the fallback is off.
+func newFallback(cfg config.Config) (*service.Fallback, error) {
+	settings := service.FallbackSettings{
+		Mode:     service.FallbackMode(cfg.FallbackMode),
+		Decision: service.Decision(cfg.FallbackDecision),
+	}
+	if settings.Mode == service.FallbackLogistic && cfg.FallbackModelFile != "" {
+		model, err := service.LoadLogisticModel(cfg.FallbackModelFile)
+		if err != nil {
+			return nil, err
+		}
+		settings.Model = model
+	}
+	return service.NewFallback(settings)
+}
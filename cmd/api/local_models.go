@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/jules-labs/go-api-prod-template/internal/config"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	"github.com/rs/zerolog"
+)
+
+// newLocalRuntime loads the configured local models. It returns nil when no
+// model is served locally.
+func newLocalRuntime(cfg config.Config, logger zerolog.Logger) (*service.LocalRuntime, error) {
+	if len(cfg.LocalModels) == 0 {
+		return nil, nil
+	}
+	specs := make([]service.LocalModelSpec, len(cfg.LocalModels))
+	for i, m := range cfg.LocalModels {
+		specs[i] = service.LocalModelSpec{
+			Name:      m.Name,
+			Format:    service.LocalFormat(m.Format),
+			Path:      m.Path,
+			Threshold: m.Threshold,
+			BaseScore: m.BaseScore,
+		}
+	}
+	return service.NewLocalRuntime(specs, logger)
+}
@@ -26,6 +26,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(cfg, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "export failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(cfg, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "replay failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logger := observability.NewConsoleLogger(cfg.LogLevel)
 	slog.Info("starting %s service in %s mode", cfg.OtelServiceName, cfg.AppEnv)
 
@@ -49,6 +64,28 @@ func main() {
 	userRepo := repo.NewUserRepository(queries)
 	apiKeyRepo := repo.NewAPIKeyRepository(queries, redisClient, time.Hour)
 	logRepo := repo.NewInferenceLogRepository(queries)
+	logWriter, err := repo.NewInferenceLogWriter(logRepo, queries, repo.InferenceLogWriterSettings{
+		BatchSize:     cfg.InferenceLogBatchSize,
+		FlushInterval: cfg.InferenceLogFlushInterval,
+		QueueSize:     cfg.InferenceLogQueueSize,
+		Overflow:      cfg.InferenceLogOverflow,
+		BlockTimeout:  cfg.InferenceLogBlockTimeout,
+		SpillDir:      cfg.InferenceLogSpillDir,
+	}, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to start inference log writer")
+	}
+	jobRepo := repo.NewPredictionJobRepository(dbConn)
+	policyRepo := repo.NewDecisionPolicyRepository(queries)
+	ruleRepo := repo.NewFraudRuleRepository(dbConn)
+	feedbackRepo := repo.NewFeedbackRepository(queries)
+	metricsRepo := repo.NewModelMetricsRepository(queries)
+	driftRepo := repo.NewFeatureDriftRepository(queries)
+	caseRepo := repo.NewCaseRepository(dbConn)
+	webhookRepo := repo.NewWebhookRepository(queries)
+	exportRepo := repo.NewExportRepository(queries)
+	partitionRepo := repo.NewInferenceLogPartitionRepository(queries)
+	replayRepo := repo.NewReplayRepository(queries)
 
 	// Read JWT secret
 	jwtSecret, err := os.ReadFile(cfg.JWTSecretFile)
@@ -60,11 +97,136 @@ func main() {
 	profileSvc := service.NewProfileService(userRepo)
 	apiKeySvc := service.NewAPIKeyService(apiKeyRepo)
 	vendorClient := clients.NewThirdPartyClient(cfg.VendorBaseURL, cfg.VendorToken, logger)
-	vendorSvc := service.NewVendorService(vendorClient, logger)
+	ensembleStrategy, err := service.ParseEnsembleStrategy(cfg.EnsembleStrategy)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid ensemble configuration")
+	}
+	localRuntime, err := newLocalRuntime(cfg, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid local model configuration")
+	}
+	fallback, err := newFallback(cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid fallback configuration")
+	}
+	velocityFeatures := make([]service.VelocityFeature, len(cfg.VelocityFeatures))
+	for i, f := range cfg.VelocityFeatures {
+		velocityFeatures[i] = service.VelocityFeature{
+			Name:      f.Name,
+			Keys:      f.Keys,
+			Window:    f.Window,
+			Aggregate: service.VelocityAggregate(f.Aggregate),
+			Field:     f.Field,
+		}
+	}
+	velocityStore, err := service.NewVelocityStore(redisClient, velocityFeatures)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid velocity feature configuration")
+	}
+	vendorOpts := []service.VendorOption{
+		service.WithModelRegistryTTL(cfg.ModelRegistryTTL),
+		service.WithEnsemble(ensembleStrategy, cfg.EnsembleWeights),
+		service.WithDerivedFeatures(velocityStore.Names()...),
+		service.WithExplain(service.ExplainSettings{
+			TopN:              cfg.ExplainTopN,
+			MaxFeatures:       cfg.ExplainMaxFeatures,
+			Concurrency:       cfg.ExplainConcurrency,
+			GlobalConcurrency: cfg.ExplainGlobalConcurrency,
+			ReasonCodes:       cfg.ExplainReasonCodes,
+			ExcludedFeatures:  cfg.ExplainExcludedFeatures,
+			Timeout:           cfg.ExplainTimeout,
+		}, clients.NewThirdPartyClient(cfg.VendorBaseURL, cfg.VendorToken, logger,
+			clients.WithCircuitBreakerName("third-party-api-explain"),
+			clients.WithRetryCount(0),
+		)),
+		service.WithLocalRuntime(localRuntime),
+	}
+	if cfg.PredictionCacheTTL > 0 || len(cfg.PredictionCacheModelTTLs) > 0 {
+		vendorOpts = append(vendorOpts, service.WithPredictionCache(service.NewPredictionCache(redisClient, cfg.PredictionCacheTTL, cfg.PredictionCacheModelTTLs, logger)))
+	}
+	// Replays are not scored by the challenger model.
+	replayVendorSvc := service.NewVendorService(newReplayClient(cfg, logger), logger, vendorOpts...)
+	if cfg.ShadowChallengerModel != "" {
+		shadowClient := clients.NewThirdPartyClient(cfg.VendorBaseURL, cfg.VendorToken, logger,
+			clients.WithCircuitBreakerName("third-party-api-shadow"),
+			clients.WithRetryCount(0),
+		)
+		vendorOpts = append(vendorOpts, service.WithShadowModel(cfg.ShadowChallengerModel, shadowClient, cfg.ShadowTimeout, cfg.ShadowConcurrency))
+	}
+	vendorSvc := service.NewVendorService(vendorClient, logger, vendorOpts...)
+	if cfg.ShadowChallengerModel != "" {
+		validateShadowModel(vendorSvc, cfg.ShadowChallengerModel, logger)
+	}
 	authSvc := service.NewAuthService(userRepo, jwtSecret, 24*time.Hour)
+	shadowSvc := service.NewShadowService(logWriter)
+	logSvc := service.NewInferenceLogService(logRepo)
+	exportSvc := service.NewExportService(exportRepo, int32(cfg.ExportBatchSize))
+	replaySvc := service.NewReplayService(replayRepo, replayVendorSvc, replaySettings(cfg), logger)
+	policySvc := service.NewDecisionPolicyService(policyRepo, apiKeyRepo, logger)
+	ruleSvc := service.NewRuleService(ruleRepo, logger)
+	feedbackSvc := service.NewFeedbackService(feedbackRepo)
+	webhookSvc := service.NewWebhookService(webhookRepo, apiKeyRepo, clients.NewWebhookClient(cfg.WebhookTimeout, logger), service.WebhookSettings{
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		RetryBase:   cfg.WebhookRetryBase,
+		RetryMax:    cfg.WebhookRetryMax,
+		BatchSize:   int32(cfg.WebhookBatchSize),
+		Lease:       cfg.WebhookLease,
+		Concurrency: cfg.WebhookConcurrency,
+		Timeout:     cfg.WebhookTimeout,
+	}, logger)
+	caseSvc := service.NewCaseService(caseRepo, webhookSvc, logger)
+	metricsSvc := service.NewModelMetricsService(metricsRepo, cfg.ModelMetricsBucket, cfg.ModelMetricsLookback, logger)
+	driftSvc := service.NewFeatureDriftService(driftRepo, service.DriftSettings{
+		ReferenceWindow:  cfg.DriftReferenceWindow,
+		RecentWindow:     cfg.DriftRecentWindow,
+		PSIThreshold:     cfg.DriftPSIThreshold,
+		KSThreshold:      cfg.DriftKSThreshold,
+		MaxSamples:       int32(cfg.DriftMaxSamples),
+		ExcludedFeatures: cfg.DriftExcludedFeatures,
+	}, logger)
+	partitionSvc := service.NewInferenceLogPartitionService(partitionRepo, service.PartitionSettings{
+		MonthsAhead:     cfg.InferenceLogPartitionsAhead,
+		Retention:       cfg.InferenceLogRetention,
+		PlanRetention:   cfg.InferenceLogPlanRetention,
+		Archive:         cfg.InferenceLogArchive,
+		DeleteBatchSize: int32(cfg.InferenceLogRetentionBatchSize),
+	}, logger)
+	scoringSvc := service.NewScoringService(vendorSvc, policySvc, ruleSvc, velocityStore, logger, service.WithFallback(fallback))
+	var idempotencySvc service.IdempotencyService
+	if cfg.IdempotencyWindow > 0 {
+		idempotencySvc = service.NewIdempotencyService(redisClient, cfg.IdempotencyWindow, cfg.IdempotencyLockTimeout, logger)
+	}
+	// Job items do not count towards the velocity features of live traffic.
+	jobScoringSvc := service.NewScoringService(vendorSvc, policySvc, ruleSvc, velocityStore, logger, service.WithFallback(fallback), service.WithVelocityLookup())
+	jobSvc := service.NewPredictionJobService(jobRepo, logWriter, jobScoringSvc, caseSvc, redisClient, cfg.PredictBatchConcurrency, cfg.PredictionJobItemRate, cfg.PredictionJobLease, logger)
+
+	// Start background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	workers := startPredictionJobWorkers(workerCtx, jobSvc, cfg.PredictionJobWorkers, cfg.PredictionJobLease, logger)
+	startPeriodicJob(workerCtx, workers, "model_metrics", cfg.ModelMetricsInterval, exclusive(dbConn, "model_metrics", func(ctx context.Context) error {
+		return metricsSvc.Compute(ctx, time.Now())
+	}), logger)
+	startPeriodicJob(workerCtx, workers, "feature_drift", cfg.DriftInterval, exclusive(dbConn, "feature_drift", func(ctx context.Context) error {
+		_, err := driftSvc.Compute(ctx, time.Now().Truncate(cfg.DriftInterval))
+		return err
+	}), logger)
+	startPeriodicJob(workerCtx, workers, "webhook_dispatch", cfg.WebhookDispatchInterval, func(ctx context.Context) error {
+		_, err := webhookSvc.Dispatch(ctx, time.Now())
+		return err
+	}, logger)
+	startPeriodicJob(workerCtx, workers, "inference_log_partitions", cfg.InferenceLogMaintenanceInterval, exclusive(dbConn, "inference_log_partitions", func(ctx context.Context) error {
+		return partitionSvc.Maintain(ctx, time.Now())
+	}), logger)
+	startPeriodicJob(workerCtx, workers, "replays", cfg.ReplayPollInterval, func(ctx context.Context) error {
+		_, err := replaySvc.RunPending(ctx)
+		return err
+	}, logger)
+	if localRuntime != nil {
+		startPeriodicJob(workerCtx, workers, "local_models", cfg.LocalModelReloadInterval, localRuntime.Reload, logger)
+	}
 
 	// Setup router
-	router := httptransport.NewRouter(&cfg, dbConn, redisClient, userRepo, apiKeyRepo, logRepo, profileSvc, apiKeySvc, vendorSvc, authSvc, jwtSecret, logger)
+	router := httptransport.NewRouter(&cfg, dbConn, redisClient, userRepo, apiKeyRepo, logWriter, profileSvc, apiKeySvc, vendorSvc, authSvc, jobSvc, shadowSvc, policySvc, ruleSvc, scoringSvc, idempotencySvc, feedbackSvc, metricsSvc, driftSvc, caseSvc, webhookSvc, logSvc, exportSvc, replaySvc, jwtSecret, logger)
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.HTTPAddr, cfg.HTTPPort),
@@ -89,8 +251,32 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Requests still running past the deadline, such as long exports, are
+	// cut off; the queued inference logs are still written below.
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal().Err(err).Msg("server forced to shutdown")
+		logger.Error().Err(err).Msg("server forced to shutdown")
+		_ = srv.Close()
+	}
+
+	// Stop background workers; unfinished jobs are released back to the queue.
+	stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		logger.Warn().Msg("timed out waiting for background workers")
+	}
+
+	// Write the inference logs still queued, spilling them if that takes too
+	// long. The drain gets its own deadline rather than what is left of ctx.
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.InferenceLogDrainTimeout)
+	defer drainCancel()
+	if err := logWriter.Close(drainCtx); err != nil {
+		logger.Error().Err(err).Msg("failed to write queued inference logs")
 	}
 
 	slog.Info("server exiting")
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/jules-labs/go-api-prod-template/internal/config"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/observability"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	"github.com/rs/zerolog"
+)
+
+// newReplayClient returns the vendor client of replays, whose circuit breaker
+// is separate from the one of live scoring.
+func newReplayClient(cfg config.Config, logger zerolog.Logger) *clients.ThirdPartyClient {
+	return clients.NewThirdPartyClient(cfg.VendorBaseURL, cfg.VendorToken, logger,
+		clients.WithCircuitBreakerName("third-party-api-replay"),
+	)
+}
+
+func replaySettings(cfg config.Config) service.ReplaySettings {
+	return service.ReplaySettings{
+		DefaultRate: cfg.ReplayDefaultRate,
+		MaxRate:     cfg.ReplayMaxRate,
+		Concurrency: cfg.ReplayConcurrency,
+		BatchSize:   int32(cfg.ReplayBatchSize),
+		Lease:       cfg.ReplayLease,
+	}
+}
+
+// runReplay implements the replay subcommand, which re-scores the logged
+// predictions with another model in the foreground and prints the diff report
+// as JSON:
+//
+//	server replay -model xgboost -from 2026-04-01T00:00:00Z -to 2026-05-01T00:00:00Z
+//
+// With -run, it resumes an unfinished replay, or prints the report of a
+// finished one. An interrupted replay can be resumed the same way, or is
+// picked up by the API server.
+func runReplay(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	model := fs.String("model", "", "model to replay the predictions with")
+	from := fs.String("from", "", "start of the request time range, RFC 3339 (default: 30 days before -to)")
+	to := fs.String("to", "", "end of the request time range, RFC 3339 (default: now)")
+	sourceModel := fs.String("source-model", "", "only replay predictions of this model")
+	userID := fs.Int64("user", 0, "only replay predictions of this user")
+	apiKeyID := fs.Int64("api-key", 0, "only replay predictions made with this API key")
+	rate := fs.Float64("rate", 0, "predictions per second (default: REPLAY_DEFAULT_RATE)")
+	runID := fs.Int64("run", 0, "resume this replay instead of starting one")
+	changes := fs.Int("changes", 0, "number of changed predictions listed in the report (default: 50)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	params := service.ReplayParams{
+		TargetModel:   *model,
+		To:            time.Now().UTC(),
+		SourceModel:   *sourceModel,
+		RatePerSecond: *rate,
+	}
+	var err error
+	if *to != "" {
+		if params.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	params.From = params.To.AddDate(0, 0, -30)
+	if *from != "" {
+		if params.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+	if *userID != 0 {
+		params.UserID = userID
+	}
+	if *apiKeyID != 0 {
+		params.APIKeyID = apiKeyID
+	}
+
+	dbConn, err := db.NewDatabase(cfg.PGDSN, cfg.PGMaxOpenConns, cfg.PGMaxIdleConns, cfg.PGConnMaxLifetime)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer func() {
+		_ = dbConn.Close()
+	}()
+
+	logger := observability.NewConsoleLogger(cfg.LogLevel)
+	ensembleStrategy, err := service.ParseEnsembleStrategy(cfg.EnsembleStrategy)
+	if err != nil {
+		return err
+	}
+	localRuntime, err := newLocalRuntime(cfg, logger)
+	if err != nil {
+		return err
+	}
+	vendorSvc := service.NewVendorService(newReplayClient(cfg, logger), logger,
+		service.WithModelRegistryTTL(cfg.ModelRegistryTTL),
+		service.WithEnsemble(ensembleStrategy, cfg.EnsembleWeights),
+		service.WithLocalRuntime(localRuntime),
+	)
+	replaySvc := service.NewReplayService(repo.NewReplayRepository(db.New(dbConn)), vendorSvc, replaySettings(cfg), logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	id := *runID
+	if id == 0 {
+		run, err := replaySvc.Create(ctx, nil, params)
+		if err != nil {
+			return err
+		}
+		id = run.ID
+		fmt.Fprintf(os.Stderr, "replaying %d predictions as replay %d\n", run.TotalItems, id)
+	}
+	if err := replaySvc.Process(ctx, id); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("interrupted, resume with -run %d", id)
+		}
+		return err
+	}
+
+	report, err := replaySvc.Report(context.Background(), id, *changes)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	"github.com/rs/zerolog"
+)
+
+// validateShadowModel refuses to start with a challenger model that the vendor
+// does not serve, which would otherwise only fail in the background. A vendor
+// that cannot be reached at startup is logged and the model checked later by
+// every shadow call.
+func validateShadowModel(vendorSvc service.VendorService, model string, logger zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := vendorSvc.ValidateModel(ctx, model)
+	var unknown *service.UnknownModelError
+	switch {
+	case errors.As(err, &unknown):
+		logger.Fatal().Err(err).Msg("invalid shadow challenger model")
+	case err != nil:
+		logger.Warn().Err(err).Str("model", model).Msg("could not validate the shadow challenger model")
+	}
+}
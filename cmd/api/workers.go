@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	"github.com/rs/zerolog"
+)
+
+// startPredictionJobWorkers re-enqueues unfinished prediction jobs and starts n
+// workers that consume the job queue until ctx is cancelled. A reaper
+// periodically re-enqueues jobs whose lease expired, e.g. because another
+// instance crashed while processing them. The returned WaitGroup completes once
+// every goroutine has exited.
+func startPredictionJobWorkers(ctx context.Context, jobSvc service.PredictionJobService, n int, lease time.Duration, logger zerolog.Logger) *sync.WaitGroup {
+	var wg sync.WaitGroup
+
+	if resumed, err := jobSvc.Resume(ctx, time.Now()); err != nil {
+		logger.Error().Err(err).Msg("failed to resume prediction jobs")
+	} else if resumed > 0 {
+		logger.Info().Int("jobs", resumed).Msg("resumed unfinished prediction jobs")
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(lease)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := jobSvc.Resume(ctx, time.Now().Add(-lease)); err != nil && ctx.Err() == nil {
+					logger.Error().Err(err).Msg("failed to resume prediction jobs")
+				}
+			}
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				id, ok, err := jobSvc.Next(ctx, 5*time.Second)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					logger.Error().Err(err).Msg("failed to read prediction job queue")
+					time.Sleep(time.Second)
+					continue
+				}
+				if !ok {
+					continue
+				}
+
+				if err := jobSvc.Process(ctx, id); err != nil && ctx.Err() == nil {
+					logger.Error().Err(err).Str("job_id", id.String()).Msg("prediction job failed")
+				}
+			}
+		}()
+	}
+
+	return &wg
+}
+
+// startPeriodicJob runs fn now and then every interval until ctx is
+// cancelled. Every instance runs its periodic jobs; they must be safe to
+// repeat, or be wrapped with exclusive.
+func startPeriodicJob(ctx context.Context, wg *sync.WaitGroup, name string, interval time.Duration, fn func(context.Context) error, logger zerolog.Logger) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				logger.Error().Err(err).Str("job", name).Msg("periodic job failed")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// exclusive wraps the job fn so that it runs on one instance at a time: while
+// another instance holds the advisory lock of name, the run is skipped.
+func exclusive(dbConn *sql.DB, name string, fn func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := repo.RunExclusive(ctx, dbConn, "job:"+name, fn)
+		return err
+	}
+}
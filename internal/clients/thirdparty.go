@@ -3,6 +3,7 @@ package clients
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"time"
 
@@ -25,6 +26,16 @@ var (
 		Name: "vendor_errors_total",
 		Help: "Total number of errors from the vendor API.",
 	})
+	vendorRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vendor_request_duration_seconds",
+		Help:    "Latency of vendor API calls, including retries, by endpoint and model.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "model"})
+	// circuitBreakerState follows gobreaker.State: 0 closed, 1 half-open, 2 open.
+	circuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "State of the circuit breaker: 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
 )
 
 var tracer = otel.Tracer("third-party-client")
@@ -56,6 +67,8 @@ type Model struct {
 type PredictRequest struct {
 	Model    string                 `json:"model"`
 	Features map[string]interface{} `json:"features"`
+	// Explain asks the vendor for per-feature contributions to the score.
+	Explain bool `json:"explain,omitempty"`
 }
 
 // PredictResponse mirrors the full response returned by the vendor's predict endpoint.
@@ -73,15 +86,48 @@ type PredictResponse struct {
 		Prediction int     `json:"prediction"`
 		Score      float64 `json:"score"`
 		Threshold  float64 `json:"threshold"`
+		// Contributions is only set for explained requests, and only by
+		// vendor models that support explanations.
+		Contributions map[string]float64 `json:"contributions,omitempty"`
 	} `json:"result"`
 }
 
-func NewThirdPartyClient(baseURL, token string, logger zerolog.Logger) *ThirdPartyClient {
+// ThirdPartyClientOption configures a ThirdPartyClient.
+type ThirdPartyClientOption func(*thirdPartyOptions)
+
+type thirdPartyOptions struct {
+	breakerName string
+	retryCount  int
+}
+
+// WithCircuitBreakerName names the circuit breaker of the client in logs and
+// metrics. Every client has its own breaker, so clients that serve different
+// traffic need different names.
+func WithCircuitBreakerName(name string) ThirdPartyClientOption {
+	return func(o *thirdPartyOptions) {
+		o.breakerName = name
+	}
+}
+
+// WithRetryCount sets how many times a request that failed with a 5xx status
+// is retried. The default is 3.
+func WithRetryCount(count int) ThirdPartyClientOption {
+	return func(o *thirdPartyOptions) {
+		o.retryCount = count
+	}
+}
+
+func NewThirdPartyClient(baseURL, token string, logger zerolog.Logger, opts ...ThirdPartyClientOption) *ThirdPartyClient {
+	o := thirdPartyOptions{breakerName: "third-party-api", retryCount: 3}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	client := resty.New().
 		SetBaseURL(baseURL).
 		SetAuthToken(token).
 		SetTimeout(3 * time.Second).
-		SetRetryCount(3).
+		SetRetryCount(o.retryCount).
 		SetRetryWaitTime(50 * time.Millisecond).
 		SetRetryMaxWaitTime(2 * time.Second).
 		AddRetryCondition(
@@ -91,7 +137,7 @@ func NewThirdPartyClient(baseURL, token string, logger zerolog.Logger) *ThirdPar
 		)
 
 	var st gobreaker.Settings
-	st.Name = "third-party-api"
+	st.Name = o.breakerName
 	st.MaxRequests = 1
 	st.Interval = 10 * time.Second
 	st.Timeout = 5 * time.Second
@@ -99,10 +145,12 @@ func NewThirdPartyClient(baseURL, token string, logger zerolog.Logger) *ThirdPar
 		return counts.ConsecutiveFailures > 5
 	}
 	st.OnStateChange = func(name string, from, to gobreaker.State) {
+		circuitBreakerState.WithLabelValues(name).Set(float64(to))
 		logger.Info().Str("circuit_breaker", name).Str("from", from.String()).Str("to", to.String()).Msg("circuit breaker state changed")
 	}
 
 	cb := gobreaker.NewCircuitBreaker(st)
+	circuitBreakerState.WithLabelValues(st.Name).Set(float64(gobreaker.StateClosed))
 
 	return &ThirdPartyClient{
 		client: client,
@@ -116,7 +164,9 @@ func (c *ThirdPartyClient) Ping(ctx context.Context) (string, error) {
 
 	body, err := c.cb.Execute(func() (interface{}, error) {
 		vendorRequestsTotal.Inc()
+		timer := prometheus.NewTimer(vendorRequestDuration.WithLabelValues("/readyz", ""))
 		resp, err := c.client.R().SetContext(ctx).Get("/readyz")
+		timer.ObserveDuration()
 		if err != nil {
 			vendorErrorsTotal.Inc()
 			span.RecordError(err)
@@ -147,10 +197,12 @@ func (c *ThirdPartyClient) Version(ctx context.Context) (*VersionResponse, error
 	body, err := c.cb.Execute(func() (interface{}, error) {
 		vendorRequestsTotal.Inc()
 		result := &VersionResponse{}
+		timer := prometheus.NewTimer(vendorRequestDuration.WithLabelValues("/v1/version", ""))
 		resp, err := c.client.R().
 			SetContext(ctx).
 			SetResult(result).
 			Get("/v1/version")
+		timer.ObserveDuration()
 		if err != nil {
 			vendorErrorsTotal.Inc()
 			span.RecordError(err)
@@ -181,11 +233,13 @@ func (c *ThirdPartyClient) Predict(ctx context.Context, req PredictRequest) (*Pr
 	body, err := c.cb.Execute(func() (interface{}, error) {
 		vendorRequestsTotal.Inc()
 		result := &PredictResponse{}
+		timer := prometheus.NewTimer(vendorRequestDuration.WithLabelValues("/v1/predict", req.Model))
 		resp, err := c.client.R().
 			SetContext(ctx).
 			SetBody(req).
 			SetResult(result).
 			Post("/v1/predict")
+		timer.ObserveDuration()
 		if err != nil {
 			vendorErrorsTotal.Inc()
 			span.RecordError(err)
@@ -207,3 +261,14 @@ func (c *ThirdPartyClient) Predict(ctx context.Context, req PredictRequest) (*Pr
 	}
 	return body.(*PredictResponse), nil
 }
+
+// IsUnavailable reports whether err means that the vendor could not answer in
+// time: the circuit breaker rejected the call or the request timed out. Errors
+// returned by the vendor itself are not considered unavailability.
+func IsUnavailable(err error) bool {
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
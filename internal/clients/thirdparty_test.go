@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/zerolog"
 	"github.com/sony/gobreaker"
 	"github.com/stretchr/testify/assert"
@@ -98,3 +99,62 @@ func TestThirdPartyClient_CircuitBreaker(t *testing.T) {
 	assert.Equal(t, "pong", pong)
 	assert.Equal(t, 3, requestCount)
 }
+
+func TestThirdPartyClient_Metrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewThirdPartyClient(server.URL, "test-token", zerolog.Nop())
+	client.client.SetRetryCount(0)
+	assert.Equal(t, float64(gobreaker.StateClosed), testutil.ToFloat64(circuitBreakerState.WithLabelValues("third-party-api")))
+
+	// The default breaker trips after more than 5 consecutive failures.
+	for i := 0; i < 6; i++ {
+		_, err := client.Ping(context.Background())
+		require.Error(t, err)
+	}
+	assert.Equal(t, float64(gobreaker.StateOpen), testutil.ToFloat64(circuitBreakerState.WithLabelValues("third-party-api")))
+	assert.Equal(t, 1, testutil.CollectAndCount(vendorRequestDuration, "vendor_request_duration_seconds"))
+}
+
+func TestThirdPartyClient_SeparateBreakers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewThirdPartyClient(server.URL, "test-token", zerolog.Nop(), WithCircuitBreakerName("third-party-api-test-a"), WithRetryCount(0))
+	other := NewThirdPartyClient(server.URL, "test-token", zerolog.Nop(), WithCircuitBreakerName("third-party-api-test-b"), WithRetryCount(0))
+	for i := 0; i < 6; i++ {
+		_, err := client.Ping(context.Background())
+		require.Error(t, err)
+	}
+	assert.Equal(t, float64(gobreaker.StateOpen), testutil.ToFloat64(circuitBreakerState.WithLabelValues("third-party-api-test-a")))
+	assert.Equal(t, float64(gobreaker.StateClosed), testutil.ToFloat64(circuitBreakerState.WithLabelValues("third-party-api-test-b")))
+
+	// The other client still reaches the vendor.
+	_, err := other.Ping(context.Background())
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, gobreaker.ErrOpenState))
+}
+
+func TestIsUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewThirdPartyClient(server.URL, "test-token", zerolog.Nop())
+	client.client.SetRetryCount(0).SetTimeout(50 * time.Millisecond)
+	_, err := client.Predict(context.Background(), PredictRequest{Model: "slow"})
+	require.Error(t, err)
+	assert.True(t, IsUnavailable(err), "client timeout: %v", err)
+
+	assert.True(t, IsUnavailable(gobreaker.ErrOpenState))
+	assert.True(t, IsUnavailable(gobreaker.ErrTooManyRequests))
+	assert.False(t, IsUnavailable(errors.New("vendor API returned non-200 status")))
+	assert.False(t, IsUnavailable(nil))
+}
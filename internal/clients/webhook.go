@@ -0,0 +1,230 @@
+package clients
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	resty "github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Headers set on every webhook request.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// ErrWebhookTarget is returned for webhook URLs that are not https or that
+// resolve to a loopback, private, link-local or multicast address.
+var ErrWebhookTarget = errors.New("webhook target not allowed")
+
+// cgnatRange is the shared address space of carrier-grade NAT, which
+// net.IP.IsPrivate does not cover.
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+var (
+	webhookRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "webhook_requests_total",
+		Help: "Total number of webhook delivery attempts.",
+	})
+	webhookErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "webhook_errors_total",
+		Help: "Total number of failed webhook delivery attempts.",
+	})
+)
+
+// WebhookClient posts signed webhook events to tenant endpoints. Each endpoint
+// host gets its own circuit breaker so that one failing receiver does not
+// block deliveries to the others. Retries are left to the caller.
+//
+// Endpoints are tenant input, so only https URLs are called, redirects are not
+// followed and connections to non-public addresses are refused when dialing,
+// after DNS resolution.
+type WebhookClient struct {
+	client   *resty.Client
+	logger   zerolog.Logger
+	insecure bool
+
+	mu       sync.Mutex
+	breakers map[string]*gobreaker.CircuitBreaker
+}
+
+// WebhookClientOption configures a WebhookClient.
+type WebhookClientOption func(*WebhookClient)
+
+// WithInsecureWebhookTargets allows http URLs and non-public addresses. It is
+// meant for tests and local receivers only.
+func WithInsecureWebhookTargets() WebhookClientOption {
+	return func(c *WebhookClient) {
+		c.insecure = true
+	}
+}
+
+func NewWebhookClient(timeout time.Duration, logger zerolog.Logger, opts ...WebhookClientOption) *WebhookClient {
+	c := &WebhookClient{
+		logger:   logger,
+		breakers: make(map[string]*gobreaker.CircuitBreaker),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if !c.insecure {
+		dialer.Control = dialPublicOnly
+	}
+	transport := &http.Transport{
+		// A proxy would dial the endpoint on our behalf, past the check.
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	c.client = resty.NewWithClient(&http.Client{Transport: transport}).
+		SetTimeout(timeout).
+		SetRedirectPolicy(resty.NoRedirectPolicy()).
+		SetHeader("Content-Type", "application/json")
+	return c
+}
+
+// ValidateWebhookURL checks that endpoint is an absolute https URL whose host
+// is not a non-public IP address. Host names are checked when dialing.
+func ValidateWebhookURL(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return fmt.Errorf("%w: url must be an absolute https URL", ErrWebhookTarget)
+	}
+	if strings.EqualFold(u.Hostname(), "localhost") {
+		return fmt.Errorf("%w: %s is not a public host", ErrWebhookTarget, u.Hostname())
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrWebhookTarget, ip)
+	}
+	return nil
+}
+
+// dialPublicOnly is the net.Dialer.Control of webhook connections. It runs
+// with the resolved address, so host names that resolve, or are rebound, to
+// non-public addresses are refused too.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrWebhookTarget, host)
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		cgnatRange.Contains(ip))
+}
+
+// SignWebhook returns the signature header value of payload sent at timestamp:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>" keyed by secret>".
+func SignWebhook(secret string, timestamp int64, payload []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver posts payload to endpoint and returns the response status code. Any
+// status outside 2xx is an error; the status code is 0 if no response was
+// received.
+func (c *WebhookClient) Deliver(ctx context.Context, endpoint, secret string, deliveryID int64, event string, payload []byte) (int, error) {
+	ctx, span := tracer.Start(ctx, "WebhookClient.Deliver")
+	defer span.End()
+
+	if !c.insecure {
+		if err := ValidateWebhookURL(endpoint); err != nil {
+			return 0, err
+		}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := c.breaker(u.Host).Execute(func() (interface{}, error) {
+		webhookRequestsTotal.Inc()
+		resp, err := c.client.R().
+			SetContext(ctx).
+			SetHeader(WebhookSignatureHeader, SignWebhook(secret, time.Now().Unix(), payload)).
+			SetHeader(WebhookEventHeader, event).
+			SetHeader(WebhookDeliveryHeader, strconv.FormatInt(deliveryID, 10)).
+			SetBody(payload).
+			Post(endpoint)
+		if err != nil {
+			webhookErrorsTotal.Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return 0, err
+		}
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode()))
+		if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+			err := fmt.Errorf("webhook endpoint returned status %d", resp.StatusCode())
+			webhookErrorsTotal.Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return resp.StatusCode(), err
+		}
+		return resp.StatusCode(), nil
+	})
+	if status == nil {
+		return 0, err
+	}
+	return status.(int), err
+}
+
+func (c *WebhookClient) breaker(host string) *gobreaker.CircuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cb, ok := c.breakers[host]; ok {
+		return cb
+	}
+
+	var st gobreaker.Settings
+	st.Name = "webhook:" + host
+	st.MaxRequests = 1
+	st.Interval = 10 * time.Second
+	st.Timeout = 30 * time.Second
+	st.ReadyToTrip = func(counts gobreaker.Counts) bool {
+		return counts.ConsecutiveFailures > 5
+	}
+	st.OnStateChange = func(name string, from, to gobreaker.State) {
+		c.logger.Info().Str("circuit_breaker", name).Str("from", from.String()).Str("to", to.String()).Msg("circuit breaker state changed")
+	}
+
+	cb := gobreaker.NewCircuitBreaker(st)
+	c.breakers[host] = cb
+	return cb
+}
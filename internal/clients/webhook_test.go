@@ -0,0 +1,123 @@
+package clients
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookClient_Deliver(t *testing.T) {
+	payload := []byte(`{"type":"case.opened"}`)
+	var signature, event, delivery string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(WebhookSignatureHeader)
+		event = r.Header.Get(WebhookEventHeader)
+		delivery = r.Header.Get(WebhookDeliveryHeader)
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewWebhookClient(time.Second, zerolog.Nop(), WithInsecureWebhookTargets())
+	status, err := client.Deliver(context.Background(), server.URL, "secret", 42, "case.opened", payload)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, "case.opened", event)
+	assert.Equal(t, "42", delivery)
+	assert.Equal(t, payload, body)
+
+	// Receivers recompute the signature from the timestamp and the raw body.
+	require.True(t, strings.HasPrefix(signature, "t="))
+	ts, err := strconv.ParseInt(strings.TrimPrefix(strings.SplitN(signature, ",", 2)[0], "t="), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, SignWebhook("secret", ts, body), signature)
+	assert.NotEqual(t, SignWebhook("other", ts, body), signature)
+}
+
+func TestWebhookClient_DeliverNon2xx(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	client := NewWebhookClient(time.Second, zerolog.Nop(), WithInsecureWebhookTargets())
+	status, err := client.Deliver(context.Background(), server.URL, "secret", 1, "case.opened", []byte(`{}`))
+
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusGone, status)
+
+	// Unreachable endpoints report no status.
+	server.Close()
+	status, err = client.Deliver(context.Background(), server.URL, "secret", 1, "case.opened", []byte(`{}`))
+	assert.Error(t, err)
+	assert.Equal(t, 0, status)
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	assert.NoError(t, ValidateWebhookURL("https://hooks.example.com/fraud"))
+	assert.NoError(t, ValidateWebhookURL("https://93.184.216.34:8443/fraud"))
+
+	for _, endpoint := range []string{
+		"http://hooks.example.com/fraud",
+		"ftp://hooks.example.com/fraud",
+		"https:///fraud",
+		"https://localhost/fraud",
+		"https://127.0.0.1/fraud",
+		"https://10.1.2.3/fraud",
+		"https://192.168.0.10/fraud",
+		"https://169.254.169.254/latest/meta-data",
+		"https://100.64.0.1/fraud",
+		"https://[::1]/fraud",
+		"https://[fe80::1]/fraud",
+		"https://224.0.0.1/fraud",
+		"https://0.0.0.0/fraud",
+	} {
+		assert.ErrorIs(t, ValidateWebhookURL(endpoint), ErrWebhookTarget, endpoint)
+	}
+}
+
+func TestWebhookClient_RefusesPrivateTargets(t *testing.T) {
+	hits := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	client := NewWebhookClient(time.Second, zerolog.Nop())
+	_, err := client.Deliver(context.Background(), server.URL, "secret", 1, "case.opened", []byte(`{}`))
+	assert.ErrorIs(t, err, ErrWebhookTarget)
+
+	// Host names are checked after resolution.
+	err = dialPublicOnly("tcp", "127.0.0.1:443", nil)
+	assert.ErrorIs(t, err, ErrWebhookTarget)
+	assert.NoError(t, dialPublicOnly("tcp", "93.184.216.34:443", nil))
+	assert.Equal(t, 0, hits)
+}
+
+func TestWebhookClient_DoesNotFollowRedirects(t *testing.T) {
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	client := NewWebhookClient(time.Second, zerolog.Nop(), WithInsecureWebhookTargets())
+	_, err := client.Deliver(context.Background(), server.URL, "secret", 1, "case.opened", []byte(`{}`))
+	assert.Error(t, err)
+	assert.False(t, redirected)
+}
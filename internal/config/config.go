@@ -31,6 +31,66 @@ type Config struct {
 	PredictRateLimit    int           `mapstructure:"PREDICT_RATE_LIMIT"`
 	PredictRateWindow   time.Duration `mapstructure:"PREDICT_RATE_WINDOW"`
 
+	PredictBatchMaxItems    int `mapstructure:"PREDICT_BATCH_MAX_ITEMS"`
+	PredictBatchConcurrency int `mapstructure:"PREDICT_BATCH_CONCURRENCY"`
+
+	FeedbackBatchMaxItems int `mapstructure:"FEEDBACK_BATCH_MAX_ITEMS"`
+
+	ModelMetricsInterval time.Duration `mapstructure:"MODEL_METRICS_INTERVAL"`
+	ModelMetricsBucket   time.Duration `mapstructure:"MODEL_METRICS_BUCKET"`
+	ModelMetricsLookback time.Duration `mapstructure:"MODEL_METRICS_LOOKBACK"`
+
+	DriftInterval         time.Duration `mapstructure:"DRIFT_INTERVAL"`
+	DriftReferenceWindow  time.Duration `mapstructure:"DRIFT_REFERENCE_WINDOW"`
+	DriftRecentWindow     time.Duration `mapstructure:"DRIFT_RECENT_WINDOW"`
+	DriftPSIThreshold     float64       `mapstructure:"DRIFT_PSI_THRESHOLD"`
+	DriftKSThreshold      float64       `mapstructure:"DRIFT_KS_THRESHOLD"`
+	DriftMaxSamples       int           `mapstructure:"DRIFT_MAX_SAMPLES"`
+	DriftExcludedFeatures []string      `mapstructure:"DRIFT_EXCLUDED_FEATURES"`
+
+	WebhookTimeout          time.Duration `mapstructure:"WEBHOOK_TIMEOUT"`
+	WebhookDispatchInterval time.Duration `mapstructure:"WEBHOOK_DISPATCH_INTERVAL"`
+	WebhookMaxAttempts      int           `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookRetryBase        time.Duration `mapstructure:"WEBHOOK_RETRY_BASE"`
+	WebhookRetryMax         time.Duration `mapstructure:"WEBHOOK_RETRY_MAX"`
+	WebhookBatchSize        int           `mapstructure:"WEBHOOK_BATCH_SIZE"`
+	WebhookLease            time.Duration `mapstructure:"WEBHOOK_LEASE"`
+	WebhookConcurrency      int           `mapstructure:"WEBHOOK_CONCURRENCY"`
+
+	InferenceLogMaintenanceInterval time.Duration            `mapstructure:"INFERENCE_LOG_MAINTENANCE_INTERVAL"`
+	InferenceLogPartitionsAhead     int                      `mapstructure:"INFERENCE_LOG_PARTITIONS_AHEAD"`
+	InferenceLogRetention           time.Duration            `mapstructure:"INFERENCE_LOG_RETENTION"`
+	InferenceLogPlanRetention       map[string]time.Duration `mapstructure:"INFERENCE_LOG_PLAN_RETENTION"`
+	InferenceLogArchive             bool                     `mapstructure:"INFERENCE_LOG_ARCHIVE"`
+	InferenceLogRetentionBatchSize  int                      `mapstructure:"INFERENCE_LOG_RETENTION_BATCH_SIZE"`
+
+	InferenceLogBatchSize     int           `mapstructure:"INFERENCE_LOG_BATCH_SIZE"`
+	InferenceLogFlushInterval time.Duration `mapstructure:"INFERENCE_LOG_FLUSH_INTERVAL"`
+	InferenceLogQueueSize     int           `mapstructure:"INFERENCE_LOG_QUEUE_SIZE"`
+	InferenceLogOverflow      string        `mapstructure:"INFERENCE_LOG_OVERFLOW"`
+	InferenceLogBlockTimeout  time.Duration `mapstructure:"INFERENCE_LOG_BLOCK_TIMEOUT"`
+	InferenceLogSpillDir      string        `mapstructure:"INFERENCE_LOG_SPILL_DIR"`
+	InferenceLogDrainTimeout  time.Duration `mapstructure:"INFERENCE_LOG_DRAIN_TIMEOUT"`
+
+	ExportBatchSize int           `mapstructure:"EXPORT_BATCH_SIZE"`
+	ExportTimeout   time.Duration `mapstructure:"EXPORT_TIMEOUT"`
+
+	ReplayPollInterval time.Duration `mapstructure:"REPLAY_POLL_INTERVAL"`
+	ReplayDefaultRate  float64       `mapstructure:"REPLAY_DEFAULT_RATE"`
+	ReplayMaxRate      float64       `mapstructure:"REPLAY_MAX_RATE"`
+	ReplayConcurrency  int           `mapstructure:"REPLAY_CONCURRENCY"`
+	ReplayBatchSize    int           `mapstructure:"REPLAY_BATCH_SIZE"`
+	ReplayLease        time.Duration `mapstructure:"REPLAY_LEASE"`
+
+	IdempotencyWindow      time.Duration `mapstructure:"IDEMPOTENCY_WINDOW"`
+	IdempotencyLockTimeout time.Duration `mapstructure:"IDEMPOTENCY_LOCK_TIMEOUT"`
+
+	PredictionJobWorkers    int           `mapstructure:"PREDICTION_JOB_WORKERS"`
+	PredictionJobMaxItems   int           `mapstructure:"PREDICTION_JOB_MAX_ITEMS"`
+	PredictionJobLease      time.Duration `mapstructure:"PREDICTION_JOB_LEASE"`
+	PredictionJobDailyItems int           `mapstructure:"PREDICTION_JOB_DAILY_ITEMS"`
+	PredictionJobItemRate   float64       `mapstructure:"PREDICTION_JOB_ITEM_RATE"`
+
 	OtelExporterOTLPEndpoint string `mapstructure:"OTEL_EXPORTER_OTLP_ENDPOINT"`
 	OtelServiceName          string `mapstructure:"OTEL_SERVICE_NAME"`
 
@@ -39,11 +99,65 @@ type Config struct {
 	VendorBaseURL string `mapstructure:"VENDOR_BASE_URL"`
 	VendorToken   string `mapstructure:"VENDOR_TOKEN"`
 
+	ModelRegistryTTL time.Duration `mapstructure:"MODEL_REGISTRY_TTL"`
+
+	ShadowChallengerModel string        `mapstructure:"SHADOW_CHALLENGER_MODEL"`
+	ShadowTimeout         time.Duration `mapstructure:"SHADOW_TIMEOUT"`
+	ShadowConcurrency     int           `mapstructure:"SHADOW_CONCURRENCY"`
+
+	EnsembleStrategy string             `mapstructure:"ENSEMBLE_STRATEGY"`
+	EnsembleWeights  map[string]float64 `mapstructure:"ENSEMBLE_WEIGHTS"`
+
+	PredictionCacheTTL       time.Duration            `mapstructure:"PREDICTION_CACHE_TTL"`
+	PredictionCacheModelTTLs map[string]time.Duration `mapstructure:"PREDICTION_CACHE_MODEL_TTLS"`
+
+	LocalModels              []LocalModelConfig `mapstructure:"LOCAL_MODELS"`
+	LocalModelReloadInterval time.Duration      `mapstructure:"LOCAL_MODEL_RELOAD_INTERVAL"`
+
+	FallbackMode      string `mapstructure:"FALLBACK_MODE"`
+	FallbackModelFile string `mapstructure:"FALLBACK_MODEL_FILE"`
+	FallbackDecision  string `mapstructure:"FALLBACK_DECISION"`
+
+	ExplainTopN        int               `mapstructure:"EXPLAIN_TOP_N"`
+	ExplainMaxFeatures int               `mapstructure:"EXPLAIN_MAX_FEATURES"`
+	ExplainReasonCodes map[string]string `mapstructure:"EXPLAIN_REASON_CODES"`
+	// ExplainConcurrency and ExplainGlobalConcurrency bound the occlusion
+	// calls in flight per request and per instance.
+	ExplainConcurrency       int      `mapstructure:"EXPLAIN_CONCURRENCY"`
+	ExplainGlobalConcurrency int      `mapstructure:"EXPLAIN_GLOBAL_CONCURRENCY"`
+	ExplainExcludedFeatures  []string `mapstructure:"EXPLAIN_EXCLUDED_FEATURES"`
+	// ExplainTimeout bounds the occlusion calls of a request, which also stop
+	// shortly before its deadline. ExplainRateCost is the number of predict
+	// rate limit units an explained prediction is charged.
+	ExplainTimeout  time.Duration `mapstructure:"EXPLAIN_TIMEOUT"`
+	ExplainRateCost int           `mapstructure:"EXPLAIN_RATE_COST"`
+
+	VelocityFeatures []VelocityFeatureConfig `mapstructure:"VELOCITY_FEATURES"`
+
 	LogLevel string `mapstructure:"LOG_LEVEL"`
 
 	Debug bool `mapstructure:"DEBUG"`
 }
 
+// VelocityFeatureConfig describes a sliding-window feature computed in Redis
+// for every prediction. Keys are feature names or "identity" for the caller.
+type VelocityFeatureConfig struct {
+	Name      string        `mapstructure:"name"`
+	Keys      []string      `mapstructure:"keys"`
+	Window    time.Duration `mapstructure:"window"`
+	Aggregate string        `mapstructure:"aggregate"`
+	Field     string        `mapstructure:"field"`
+}
+
+// LocalModelConfig routes a model type to a model file evaluated in process.
+type LocalModelConfig struct {
+	Name      string  `mapstructure:"name"`
+	Format    string  `mapstructure:"format"`
+	Path      string  `mapstructure:"path"`
+	Threshold float64 `mapstructure:"threshold"`
+	BaseScore float64 `mapstructure:"base_score"`
+}
+
 // LoadConfig reads configuration from file or environment variables.
 func LoadConfig() (config Config, err error) {
 	viper.SetConfigName("config")
@@ -66,6 +180,68 @@ func LoadConfig() (config Config, err error) {
 	viper.SetDefault("RATE_LIMIT_RPM_DEFAULT", 100)
 	viper.SetDefault("PREDICT_RATE_LIMIT", 60)
 	viper.SetDefault("PREDICT_RATE_WINDOW", "1m")
+	viper.SetDefault("PREDICT_BATCH_MAX_ITEMS", 50)
+	viper.SetDefault("PREDICT_BATCH_CONCURRENCY", 8)
+	viper.SetDefault("FEEDBACK_BATCH_MAX_ITEMS", 1000)
+	viper.SetDefault("MODEL_METRICS_INTERVAL", "5m")
+	viper.SetDefault("MODEL_METRICS_BUCKET", "24h")
+	viper.SetDefault("MODEL_METRICS_LOOKBACK", "720h")
+	viper.SetDefault("DRIFT_INTERVAL", "1h")
+	viper.SetDefault("DRIFT_REFERENCE_WINDOW", "168h")
+	viper.SetDefault("DRIFT_RECENT_WINDOW", "24h")
+	viper.SetDefault("DRIFT_PSI_THRESHOLD", 0.2)
+	viper.SetDefault("DRIFT_KS_THRESHOLD", 0.1)
+	viper.SetDefault("DRIFT_MAX_SAMPLES", 50000)
+	viper.SetDefault("WEBHOOK_TIMEOUT", "5s")
+	viper.SetDefault("WEBHOOK_DISPATCH_INTERVAL", "5s")
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 8)
+	viper.SetDefault("WEBHOOK_RETRY_BASE", "30s")
+	viper.SetDefault("WEBHOOK_RETRY_MAX", "1h")
+	viper.SetDefault("WEBHOOK_BATCH_SIZE", 50)
+	viper.SetDefault("WEBHOOK_LEASE", "1m")
+	viper.SetDefault("WEBHOOK_CONCURRENCY", 10)
+	viper.SetDefault("INFERENCE_LOG_MAINTENANCE_INTERVAL", "1h")
+	viper.SetDefault("INFERENCE_LOG_PARTITIONS_AHEAD", 3)
+	viper.SetDefault("INFERENCE_LOG_RETENTION", "0")
+	viper.SetDefault("INFERENCE_LOG_ARCHIVE", false)
+	viper.SetDefault("INFERENCE_LOG_RETENTION_BATCH_SIZE", 10000)
+	viper.SetDefault("INFERENCE_LOG_BATCH_SIZE", 500)
+	viper.SetDefault("INFERENCE_LOG_FLUSH_INTERVAL", "500ms")
+	viper.SetDefault("INFERENCE_LOG_QUEUE_SIZE", 10000)
+	viper.SetDefault("INFERENCE_LOG_OVERFLOW", "block")
+	viper.SetDefault("INFERENCE_LOG_BLOCK_TIMEOUT", "100ms")
+	viper.SetDefault("INFERENCE_LOG_SPILL_DIR", "")
+	viper.SetDefault("INFERENCE_LOG_DRAIN_TIMEOUT", "10s")
+	viper.SetDefault("EXPORT_BATCH_SIZE", 1000)
+	viper.SetDefault("EXPORT_TIMEOUT", "30m")
+	viper.SetDefault("REPLAY_POLL_INTERVAL", "30s")
+	viper.SetDefault("REPLAY_DEFAULT_RATE", 10)
+	viper.SetDefault("REPLAY_MAX_RATE", 100)
+	viper.SetDefault("REPLAY_CONCURRENCY", 4)
+	viper.SetDefault("REPLAY_BATCH_SIZE", 100)
+	viper.SetDefault("REPLAY_LEASE", "2m")
+	viper.SetDefault("IDEMPOTENCY_WINDOW", "24h")
+	viper.SetDefault("IDEMPOTENCY_LOCK_TIMEOUT", "5s")
+	viper.SetDefault("PREDICTION_JOB_WORKERS", 2)
+	viper.SetDefault("PREDICTION_JOB_MAX_ITEMS", 50000)
+	viper.SetDefault("PREDICTION_JOB_LEASE", "2m")
+	viper.SetDefault("PREDICTION_JOB_DAILY_ITEMS", 500000)
+	viper.SetDefault("PREDICTION_JOB_ITEM_RATE", 20)
+	viper.SetDefault("MODEL_REGISTRY_TTL", "30s")
+	viper.SetDefault("SHADOW_TIMEOUT", "5s")
+	viper.SetDefault("SHADOW_CONCURRENCY", 50)
+	viper.SetDefault("ENSEMBLE_STRATEGY", "mean")
+	viper.SetDefault("PREDICTION_CACHE_TTL", "0s")
+	viper.SetDefault("LOCAL_MODEL_RELOAD_INTERVAL", "10s")
+	viper.SetDefault("FALLBACK_MODE", "off")
+	viper.SetDefault("FALLBACK_DECISION", "review")
+	viper.SetDefault("EXPLAIN_TOP_N", 3)
+	viper.SetDefault("EXPLAIN_MAX_FEATURES", 32)
+	viper.SetDefault("EXPLAIN_CONCURRENCY", 4)
+	viper.SetDefault("EXPLAIN_GLOBAL_CONCURRENCY", 32)
+	viper.SetDefault("EXPLAIN_EXCLUDED_FEATURES", []string{"transaction_id"})
+	viper.SetDefault("EXPLAIN_TIMEOUT", "2s")
+	viper.SetDefault("EXPLAIN_RATE_COST", 5)
 	viper.SetDefault("OTEL_SERVICE_NAME", "go-api")
 	viper.SetDefault("LOG_LEVEL", "info")
 	viper.SetDefault("DEBUG", false)
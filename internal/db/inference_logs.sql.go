@@ -14,12 +14,14 @@ import (
 	"github.com/sqlc-dev/pqtype"
 )
 
-const createInferenceLog = `-- name: CreateInferenceLog :exec
+const createInferenceLog = `-- name: CreateInferenceLog :one
 INSERT INTO inference_logs (
-  user_id, api_key_id, request_payload, response_payload, error, request_time, response_time
+  user_id, api_key_id, request_payload, response_payload, error, request_time, response_time,
+  decision, policy_id, policy_version, fired_rules, explanation, scoring_path
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
 )
+RETURNING id
 `
 
 type CreateInferenceLogParams struct {
@@ -30,10 +32,16 @@ type CreateInferenceLogParams struct {
 	Error           sql.NullString        `json:"error"`
 	RequestTime     time.Time             `json:"request_time"`
 	ResponseTime    time.Time             `json:"response_time"`
+	Decision        sql.NullString        `json:"decision"`
+	PolicyID        sql.NullInt64         `json:"policy_id"`
+	PolicyVersion   sql.NullInt32         `json:"policy_version"`
+	FiredRules      pqtype.NullRawMessage `json:"fired_rules"`
+	Explanation     pqtype.NullRawMessage `json:"explanation"`
+	ScoringPath     sql.NullString        `json:"scoring_path"`
 }
 
-func (q *Queries) CreateInferenceLog(ctx context.Context, arg CreateInferenceLogParams) error {
-	_, err := q.db.ExecContext(ctx, createInferenceLog,
+func (q *Queries) CreateInferenceLog(ctx context.Context, arg CreateInferenceLogParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, createInferenceLog,
 		arg.UserID,
 		arg.ApiKeyID,
 		arg.RequestPayload,
@@ -41,6 +49,327 @@ func (q *Queries) CreateInferenceLog(ctx context.Context, arg CreateInferenceLog
 		arg.Error,
 		arg.RequestTime,
 		arg.ResponseTime,
+		arg.Decision,
+		arg.PolicyID,
+		arg.PolicyVersion,
+		arg.FiredRules,
+		arg.Explanation,
+		arg.ScoringPath,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getInferenceLog = `-- name: GetInferenceLog :one
+-- api_key_id restricts the lookup to the logs of one API key if set.
+SELECT id, user_id, api_key_id, request_payload, response_payload, error, request_time, response_time, created_at,
+  shadow_model, shadow_response_payload, shadow_error, decision, policy_id, policy_version, fired_rules, explanation,
+  scoring_path
+FROM inference_logs
+WHERE id = $1
+  AND user_id = $2
+  AND ($3::bigint IS NULL OR api_key_id = $3)
+`
+
+type GetInferenceLogParams struct {
+	ID       int64         `json:"id"`
+	UserID   int64         `json:"user_id"`
+	ApiKeyID sql.NullInt64 `json:"api_key_id"`
+}
+
+// api_key_id restricts the lookup to the logs of one API key if set.
+func (q *Queries) GetInferenceLog(ctx context.Context, arg GetInferenceLogParams) (InferenceLog, error) {
+	row := q.db.QueryRowContext(ctx, getInferenceLog, arg.ID, arg.UserID, arg.ApiKeyID)
+	var i InferenceLog
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ApiKeyID,
+		&i.RequestPayload,
+		&i.ResponsePayload,
+		&i.Error,
+		&i.RequestTime,
+		&i.ResponseTime,
+		&i.CreatedAt,
+		&i.ShadowModel,
+		&i.ShadowResponsePayload,
+		&i.ShadowError,
+		&i.Decision,
+		&i.PolicyID,
+		&i.PolicyVersion,
+		&i.FiredRules,
+		&i.Explanation,
+		&i.ScoringPath,
+	)
+	return i, err
+}
+
+const getInferenceLogIDByTransaction = `-- name: GetInferenceLogIDByTransaction :one
+-- The most recent successful prediction of the transaction; api_key_id
+-- restricts the lookup to the logs of one API key if set.
+SELECT id
+FROM inference_logs
+WHERE user_id = $1
+  AND request_payload->'features'->>'transaction_id' = $2::text
+  AND ($3::bigint IS NULL OR api_key_id = $3)
+  AND error IS NULL
+ORDER BY request_time DESC
+LIMIT 1
+`
+
+type GetInferenceLogIDByTransactionParams struct {
+	UserID        int64         `json:"user_id"`
+	TransactionID string        `json:"transaction_id"`
+	ApiKeyID      sql.NullInt64 `json:"api_key_id"`
+}
+
+// The most recent successful prediction of the transaction; api_key_id
+// restricts the lookup to the logs of one API key if set.
+func (q *Queries) GetInferenceLogIDByTransaction(ctx context.Context, arg GetInferenceLogIDByTransactionParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getInferenceLogIDByTransaction, arg.UserID, arg.TransactionID, arg.ApiKeyID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getInferenceLogIDForUser = `-- name: GetInferenceLogIDForUser :one
+-- api_key_id restricts the lookup to the logs of one API key if set.
+SELECT id
+FROM inference_logs
+WHERE id = $1
+  AND user_id = $2
+  AND ($3::bigint IS NULL OR api_key_id = $3)
+`
+
+type GetInferenceLogIDForUserParams struct {
+	ID       int64         `json:"id"`
+	UserID   int64         `json:"user_id"`
+	ApiKeyID sql.NullInt64 `json:"api_key_id"`
+}
+
+// api_key_id restricts the lookup to the logs of one API key if set.
+func (q *Queries) GetInferenceLogIDForUser(ctx context.Context, arg GetInferenceLogIDForUserParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getInferenceLogIDForUser, arg.ID, arg.UserID, arg.ApiKeyID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const listInferenceLogs = `-- name: ListInferenceLogs :many
+-- Keyset pagination, newest first: before_id is the last id of the previous
+-- page. NULL filters match every log.
+SELECT id, user_id, api_key_id, request_payload, response_payload, error, request_time, response_time, created_at,
+  shadow_model, shadow_response_payload, shadow_error, decision, policy_id, policy_version, fired_rules, explanation,
+  scoring_path
+FROM inference_logs
+WHERE user_id = $1
+  AND id < $2
+  AND request_time >= $3
+  AND request_time < $4
+  AND ($5::bigint IS NULL OR api_key_id = $5)
+  AND ($6::text IS NULL OR request_payload->>'model' = $6 OR response_payload->'meta'->>'model_name' = $6)
+  AND ($7::boolean IS NULL OR (error IS NOT NULL) = $7)
+  AND ($8::int IS NULL OR (response_payload->'result'->>'prediction')::int = $8)
+  AND ($9::float8 IS NULL OR (response_payload->'result'->>'score')::float8 >= $9)
+  AND ($10::float8 IS NULL OR (response_payload->'result'->>'score')::float8 <= $10)
+ORDER BY id DESC
+LIMIT $11
+`
+
+type ListInferenceLogsParams struct {
+	UserID     int64           `json:"user_id"`
+	BeforeID   int64           `json:"before_id"`
+	FromTime   time.Time       `json:"from_time"`
+	ToTime     time.Time       `json:"to_time"`
+	ApiKeyID   sql.NullInt64   `json:"api_key_id"`
+	Model      sql.NullString  `json:"model"`
+	HasError   sql.NullBool    `json:"has_error"`
+	Prediction sql.NullInt32   `json:"prediction"`
+	MinScore   sql.NullFloat64 `json:"min_score"`
+	MaxScore   sql.NullFloat64 `json:"max_score"`
+	MaxRows    int32           `json:"max_rows"`
+}
+
+// Keyset pagination, newest first: before_id is the last id of the previous
+// page. NULL filters match every log.
+func (q *Queries) ListInferenceLogs(ctx context.Context, arg ListInferenceLogsParams) ([]InferenceLog, error) {
+	rows, err := q.db.QueryContext(ctx, listInferenceLogs,
+		arg.UserID,
+		arg.BeforeID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.ApiKeyID,
+		arg.Model,
+		arg.HasError,
+		arg.Prediction,
+		arg.MinScore,
+		arg.MaxScore,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []InferenceLog{}
+	for rows.Next() {
+		var i InferenceLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ApiKeyID,
+			&i.RequestPayload,
+			&i.ResponsePayload,
+			&i.Error,
+			&i.RequestTime,
+			&i.ResponseTime,
+			&i.CreatedAt,
+			&i.ShadowModel,
+			&i.ShadowResponsePayload,
+			&i.ShadowError,
+			&i.Decision,
+			&i.PolicyID,
+			&i.PolicyVersion,
+			&i.FiredRules,
+			&i.Explanation,
+			&i.ScoringPath,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listShadowComparisons = `-- name: ListShadowComparisons :many
+SELECT
+  (response_payload->'meta'->>'model_name')::text AS champion_model,
+  shadow_model::text AS challenger_model,
+  COUNT(*)::bigint AS total,
+  COUNT(*) FILTER (
+    WHERE (response_payload->'result'->>'prediction') = (shadow_response_payload->'result'->>'prediction')
+  )::bigint AS agreements,
+  COALESCE(AVG((shadow_response_payload->'result'->>'score')::float8 - (response_payload->'result'->>'score')::float8), 0)::float8 AS mean_score_delta,
+  COALESCE(AVG(ABS((shadow_response_payload->'result'->>'score')::float8 - (response_payload->'result'->>'score')::float8)), 0)::float8 AS mean_abs_score_delta,
+  COALESCE(percentile_cont(0.95) WITHIN GROUP (
+    ORDER BY ABS((shadow_response_payload->'result'->>'score')::float8 - (response_payload->'result'->>'score')::float8)
+  ), 0)::float8 AS p95_abs_score_delta,
+  COALESCE(MAX(ABS((shadow_response_payload->'result'->>'score')::float8 - (response_payload->'result'->>'score')::float8)), 0)::float8 AS max_abs_score_delta
+FROM inference_logs
+WHERE user_id = $1
+  AND shadow_model IS NOT NULL
+  AND shadow_response_payload IS NOT NULL
+  AND response_payload IS NOT NULL
+  AND request_time >= $2
+  AND request_time < $3
+GROUP BY 1, 2
+ORDER BY 1, 2
+`
+
+type ListShadowComparisonsParams struct {
+	UserID   int64     `json:"user_id"`
+	FromTime time.Time `json:"from_time"`
+	ToTime   time.Time `json:"to_time"`
+}
+
+type ListShadowComparisonsRow struct {
+	ChampionModel     string  `json:"champion_model"`
+	ChallengerModel   string  `json:"challenger_model"`
+	Total             int64   `json:"total"`
+	Agreements        int64   `json:"agreements"`
+	MeanScoreDelta    float64 `json:"mean_score_delta"`
+	MeanAbsScoreDelta float64 `json:"mean_abs_score_delta"`
+	P95AbsScoreDelta  float64 `json:"p95_abs_score_delta"`
+	MaxAbsScoreDelta  float64 `json:"max_abs_score_delta"`
+}
+
+func (q *Queries) ListShadowComparisons(ctx context.Context, arg ListShadowComparisonsParams) ([]ListShadowComparisonsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listShadowComparisons, arg.UserID, arg.FromTime, arg.ToTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListShadowComparisonsRow{}
+	for rows.Next() {
+		var i ListShadowComparisonsRow
+		if err := rows.Scan(
+			&i.ChampionModel,
+			&i.ChallengerModel,
+			&i.Total,
+			&i.Agreements,
+			&i.MeanScoreDelta,
+			&i.MeanAbsScoreDelta,
+			&i.P95AbsScoreDelta,
+			&i.MaxAbsScoreDelta,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const reserveInferenceLogIDs = `-- name: ReserveInferenceLogIDs :many
+-- Allocates count ids from the inference_logs sequence for logs written later.
+SELECT nextval('inference_logs_id_seq')::bigint AS id
+FROM generate_series(1, $1::int)
+`
+
+// Allocates count ids from the inference_logs sequence for logs written later.
+func (q *Queries) ReserveInferenceLogIDs(ctx context.Context, count int32) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, reserveInferenceLogIDs, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateInferenceLogShadow = `-- name: UpdateInferenceLogShadow :exec
+UPDATE inference_logs
+SET shadow_model = $2, shadow_response_payload = $3, shadow_error = $4
+WHERE id = $1
+`
+
+type UpdateInferenceLogShadowParams struct {
+	ID                    int64                 `json:"id"`
+	ShadowModel           sql.NullString        `json:"shadow_model"`
+	ShadowResponsePayload pqtype.NullRawMessage `json:"shadow_response_payload"`
+	ShadowError           sql.NullString        `json:"shadow_error"`
+}
+
+func (q *Queries) UpdateInferenceLogShadow(ctx context.Context, arg UpdateInferenceLogShadowParams) error {
+	_, err := q.db.ExecContext(ctx, updateInferenceLogShadow,
+		arg.ID,
+		arg.ShadowModel,
+		arg.ShadowResponsePayload,
+		arg.ShadowError,
 	)
 	return err
 }
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/sqlc-dev/pqtype"
+)
+
+// insertInferenceLogsColumns are the columns written by InsertInferenceLogs.
+// The id comes first so that it can be left to the sequence.
+const insertInferenceLogsColumns = `id, user_id, api_key_id, request_payload, response_payload, error, request_time, response_time,
+  decision, policy_id, policy_version, fired_rules, explanation, scoring_path, shadow_model, shadow_response_payload, shadow_error`
+
+const insertInferenceLogsColumnCount = 17
+
+// InsertInferenceLogParams is one log written by InsertInferenceLogs. An ID of
+// 0 is assigned by the sequence.
+type InsertInferenceLogParams struct {
+	ID int64 `json:"id"`
+	CreateInferenceLogParams
+	ShadowModel           sql.NullString        `json:"shadow_model"`
+	ShadowResponsePayload pqtype.NullRawMessage `json:"shadow_response_payload"`
+	ShadowError           sql.NullString        `json:"shadow_error"`
+}
+
+// InsertInferenceLogs writes rows with a single multi-row INSERT. Logs whose id
+// already exists are skipped, so a batch can be retried after a failure.
+//
+// sqlc cannot generate statements with a variable number of rows, so this
+// query is written by hand.
+func (q *Queries) InsertInferenceLogs(ctx context.Context, rows []InsertInferenceLogParams) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("INSERT INTO inference_logs (")
+	b.WriteString(insertInferenceLogsColumns)
+	b.WriteString(") VALUES ")
+	args := make([]interface{}, 0, len(rows)*insertInferenceLogsColumnCount)
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		if row.ID == 0 {
+			b.WriteString("DEFAULT")
+		} else {
+			args = append(args, row.ID)
+			fmt.Fprintf(&b, "$%d", len(args))
+		}
+		for _, v := range []interface{}{
+			row.UserID, row.ApiKeyID, row.RequestPayload, row.ResponsePayload, row.Error, row.RequestTime, row.ResponseTime,
+			row.Decision, row.PolicyID, row.PolicyVersion, row.FiredRules, row.Explanation, row.ScoringPath,
+			row.ShadowModel, row.ShadowResponsePayload, row.ShadowError,
+		} {
+			args = append(args, v)
+			fmt.Fprintf(&b, ", $%d", len(args))
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(" ON CONFLICT DO NOTHING")
+
+	_, err := q.db.ExecContext(ctx, b.String(), args...)
+	return err
+}
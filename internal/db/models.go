@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sqlc-dev/pqtype"
 )
 
@@ -23,16 +24,194 @@ type ApiKey struct {
 	CreatedAt  time.Time      `json:"created_at"`
 }
 
+type DecisionPolicy struct {
+	ID               int64          `json:"id"`
+	Plan             sql.NullString `json:"plan"`
+	ApiKeyID         sql.NullInt64  `json:"api_key_id"`
+	ReviewThreshold  float64        `json:"review_threshold"`
+	DeclineThreshold float64        `json:"decline_threshold"`
+	Version          int32          `json:"version"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+}
+
+type FeatureDriftSnapshot struct {
+	ID             int64           `json:"id"`
+	Feature        string          `json:"feature"`
+	Kind           string          `json:"kind"`
+	ReferenceFrom  time.Time       `json:"reference_from"`
+	ReferenceTo    time.Time       `json:"reference_to"`
+	RecentFrom     time.Time       `json:"recent_from"`
+	RecentTo       time.Time       `json:"recent_to"`
+	ReferenceCount int64           `json:"reference_count"`
+	RecentCount    int64           `json:"recent_count"`
+	Psi            float64         `json:"psi"`
+	Ks             sql.NullFloat64 `json:"ks"`
+	Drifted        bool            `json:"drifted"`
+	ComputedAt     time.Time       `json:"computed_at"`
+}
+
+type FraudRule struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Stage      string    `json:"stage"`
+	Expression string    `json:"expression"`
+	Decision   string    `json:"decision"`
+	ReasonCode string    `json:"reason_code"`
+	Priority   int32     `json:"priority"`
+	Enabled    bool      `json:"enabled"`
+	Version    int32     `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type FraudRuleVersion struct {
+	RuleID     int64     `json:"rule_id"`
+	Version    int32     `json:"version"`
+	Name       string    `json:"name"`
+	Stage      string    `json:"stage"`
+	Expression string    `json:"expression"`
+	Decision   string    `json:"decision"`
+	ReasonCode string    `json:"reason_code"`
+	Priority   int32     `json:"priority"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type InferenceLog struct {
-	ID              int64                 `json:"id"`
-	UserID          int64                 `json:"user_id"`
-	ApiKeyID        sql.NullInt64         `json:"api_key_id"`
-	RequestPayload  json.RawMessage       `json:"request_payload"`
-	ResponsePayload pqtype.NullRawMessage `json:"response_payload"`
-	Error           sql.NullString        `json:"error"`
-	RequestTime     time.Time             `json:"request_time"`
-	ResponseTime    time.Time             `json:"response_time"`
-	CreatedAt       time.Time             `json:"created_at"`
+	ID                    int64                 `json:"id"`
+	UserID                int64                 `json:"user_id"`
+	ApiKeyID              sql.NullInt64         `json:"api_key_id"`
+	RequestPayload        json.RawMessage       `json:"request_payload"`
+	ResponsePayload       pqtype.NullRawMessage `json:"response_payload"`
+	Error                 sql.NullString        `json:"error"`
+	RequestTime           time.Time             `json:"request_time"`
+	ResponseTime          time.Time             `json:"response_time"`
+	CreatedAt             time.Time             `json:"created_at"`
+	ShadowModel           sql.NullString        `json:"shadow_model"`
+	ShadowResponsePayload pqtype.NullRawMessage `json:"shadow_response_payload"`
+	ShadowError           sql.NullString        `json:"shadow_error"`
+	Decision              sql.NullString        `json:"decision"`
+	PolicyID              sql.NullInt64         `json:"policy_id"`
+	PolicyVersion         sql.NullInt32         `json:"policy_version"`
+	FiredRules            pqtype.NullRawMessage `json:"fired_rules"`
+	Explanation           pqtype.NullRawMessage `json:"explanation"`
+	ScoringPath           sql.NullString        `json:"scoring_path"`
+}
+
+type ModelMetric struct {
+	ModelName         string          `json:"model_name"`
+	RunID             string          `json:"run_id"`
+	BucketStart       time.Time       `json:"bucket_start"`
+	BucketEnd         time.Time       `json:"bucket_end"`
+	Total             int64           `json:"total"`
+	Positives         int64           `json:"positives"`
+	TruePositives     int64           `json:"true_positives"`
+	FalsePositives    int64           `json:"false_positives"`
+	TrueNegatives     int64           `json:"true_negatives"`
+	FalseNegatives    int64           `json:"false_negatives"`
+	Precision         sql.NullFloat64 `json:"precision"`
+	Recall            sql.NullFloat64 `json:"recall"`
+	FalsePositiveRate sql.NullFloat64 `json:"false_positive_rate"`
+	Auc               sql.NullFloat64 `json:"auc"`
+	CalibrationError  sql.NullFloat64 `json:"calibration_error"`
+	ComputedAt        time.Time       `json:"computed_at"`
+}
+
+type PredictionFeedback struct {
+	ID             int64         `json:"id"`
+	InferenceLogID int64         `json:"inference_log_id"`
+	UserID         int64         `json:"user_id"`
+	ApiKeyID       sql.NullInt64 `json:"api_key_id"`
+	Label          string        `json:"label"`
+	LabelSource    string        `json:"label_source"`
+	LabeledAt      time.Time     `json:"labeled_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+type PredictionJob struct {
+	ID             uuid.UUID       `json:"id"`
+	UserID         int64           `json:"user_id"`
+	ApiKeyID       sql.NullInt64   `json:"api_key_id"`
+	Status         string          `json:"status"`
+	Items          json.RawMessage `json:"items"`
+	TotalItems     int32           `json:"total_items"`
+	ProcessedItems int32           `json:"processed_items"`
+	FailedItems    int32           `json:"failed_items"`
+	Error          sql.NullString  `json:"error"`
+	LeaseExpiresAt sql.NullTime    `json:"lease_expires_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	StartedAt      sql.NullTime    `json:"started_at"`
+	CompletedAt    sql.NullTime    `json:"completed_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type PredictionJobResult struct {
+	JobID     uuid.UUID             `json:"job_id"`
+	ItemIndex int32                 `json:"item_index"`
+	Response  pqtype.NullRawMessage `json:"response"`
+	Error     sql.NullString        `json:"error"`
+}
+
+type ReplayResult struct {
+	RunID            int64                 `json:"run_id"`
+	InferenceLogID   int64                 `json:"inference_log_id"`
+	RequestTime      time.Time             `json:"request_time"`
+	OriginalResponse json.RawMessage       `json:"original_response"`
+	ReplayResponse   pqtype.NullRawMessage `json:"replay_response"`
+	Error            sql.NullString        `json:"error"`
+	CreatedAt        time.Time             `json:"created_at"`
+}
+
+type ReplayRun struct {
+	ID             int64          `json:"id"`
+	CreatedBy      sql.NullInt64  `json:"created_by"`
+	TargetModel    string         `json:"target_model"`
+	FromTime       time.Time      `json:"from_time"`
+	ToTime         time.Time      `json:"to_time"`
+	UserID         sql.NullInt64  `json:"user_id"`
+	ApiKeyID       sql.NullInt64  `json:"api_key_id"`
+	SourceModel    sql.NullString `json:"source_model"`
+	RatePerSecond  float64        `json:"rate_per_second"`
+	Status         string         `json:"status"`
+	TotalItems     int32          `json:"total_items"`
+	ProcessedItems int32          `json:"processed_items"`
+	FailedItems    int32          `json:"failed_items"`
+	LastLogID      int64          `json:"last_log_id"`
+	Error          sql.NullString `json:"error"`
+	LeaseExpiresAt sql.NullTime   `json:"lease_expires_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	StartedAt      sql.NullTime   `json:"started_at"`
+	CompletedAt    sql.NullTime   `json:"completed_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+type ReviewCase struct {
+	ID             int64          `json:"id"`
+	InferenceLogID int64          `json:"inference_log_id"`
+	UserID         int64          `json:"user_id"`
+	ApiKeyID       sql.NullInt64  `json:"api_key_id"`
+	TransactionID  sql.NullString `json:"transaction_id"`
+	ModelName      string         `json:"model_name"`
+	Score          float64        `json:"score"`
+	Decision       string         `json:"decision"`
+	Reason         string         `json:"reason"`
+	Status         string         `json:"status"`
+	Assignee       sql.NullString `json:"assignee"`
+	Resolution     sql.NullString `json:"resolution"`
+	ResolvedBy     sql.NullInt64  `json:"resolved_by"`
+	ResolvedAt     sql.NullTime   `json:"resolved_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+type ReviewCaseComment struct {
+	ID        int64     `json:"id"`
+	CaseID    int64     `json:"case_id"`
+	AuthorID  int64     `json:"author_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type User struct {
@@ -44,3 +223,29 @@ type User struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 	Name         string    `json:"name"`
 }
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	EndpointID     int64           `json:"endpoint_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode sql.NullInt32   `json:"last_status_code"`
+	LastError      sql.NullString  `json:"last_error"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	LeasedUntil    sql.NullTime    `json:"leased_until"`
+}
+
+type WebhookEndpoint struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ApiKeyID  int64     `json:"api_key_id"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -6,21 +6,160 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Querier interface {
+	AddReviewCaseComment(ctx context.Context, arg AddReviewCaseCommentParams) (ReviewCaseComment, error)
+	// Moves up to max_rows logs of users on plan requested before before to
+	// inference_logs_archive.expired_inference_logs, keeping their feedback and
+	// review cases.
+	ArchiveExpiredInferenceLogs(ctx context.Context, arg ArchiveExpiredInferenceLogsParams) (int64, error)
+	AssignReviewCase(ctx context.Context, arg AssignReviewCaseParams) (ReviewCase, error)
+	// The lease expiry identifies the claim: the renew, complete and release
+	// queries only apply while the job still has the lease of the worker.
+	// The results of the first processed_items items of a job that was
+	// interrupted are already stored.
+	ClaimPredictionJob(ctx context.Context, arg ClaimPredictionJobParams) (ClaimPredictionJobRow, error)
+	ClaimReplayRun(ctx context.Context, arg ClaimReplayRunParams) (ReplayRun, error)
+	// Due pending deliveries are leased until lease_until so that concurrent
+	// dispatchers do not send them twice.
+	ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]ClaimWebhookDeliveriesRow, error)
+	CompletePredictionJob(ctx context.Context, arg CompletePredictionJobParams) (int64, error)
+	CompleteReplayRun(ctx context.Context, id int64) error
+	CountReplayLogs(ctx context.Context, arg CountReplayLogsParams) (int64, error)
 	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (CreateAPIKeyRow, error)
-	CreateInferenceLog(ctx context.Context, arg CreateInferenceLogParams) error
+	CreateDecisionPolicy(ctx context.Context, arg CreateDecisionPolicyParams) (DecisionPolicy, error)
+	// Replaces the snapshot of the same feature and window computed by another
+	// instance.
+	CreateFeatureDriftSnapshot(ctx context.Context, arg CreateFeatureDriftSnapshotParams) (FeatureDriftSnapshot, error)
+	CreateFraudRule(ctx context.Context, arg CreateFraudRuleParams) (FraudRule, error)
+	CreateInferenceLog(ctx context.Context, arg CreateInferenceLogParams) (int64, error)
+	// Creates the partition of the month of month_start unless it exists and
+	// returns its name.
+	CreateInferenceLogPartition(ctx context.Context, monthStart time.Time) (string, error)
+	CreatePredictionJob(ctx context.Context, arg CreatePredictionJobParams) (CreatePredictionJobRow, error)
+	CreateReplayRun(ctx context.Context, arg CreateReplayRunParams) (ReplayRun, error)
+	// The case inherits the owner and transaction ID of the logged prediction.
+	// A prediction has at most one case; no row is returned if it already exists.
+	CreateReviewCase(ctx context.Context, arg CreateReviewCaseParams) (ReviewCase, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error)
+	CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error)
 	DeleteAPIKey(ctx context.Context, arg DeleteAPIKeyParams) error
+	DeleteDecisionPolicy(ctx context.Context, id int64) error
+	// Deletes up to max_rows logs of users on plan requested before before, with
+	// their feedback and review cases.
+	DeleteExpiredInferenceLogs(ctx context.Context, arg DeleteExpiredInferenceLogsParams) (int64, error)
+	DeleteFraudRule(ctx context.Context, id int64) error
+	// Deletes the metrics of the buckets that start before bucket_start.
+	DeleteModelMetricsBefore(ctx context.Context, bucketStart time.Time) (int64, error)
+	DeleteWebhookEndpoint(ctx context.Context, arg DeleteWebhookEndpointParams) error
+	// Adds one delivery of the event for every endpoint of the API key.
+	EnqueueWebhookDeliveries(ctx context.Context, arg EnqueueWebhookDeliveriesParams) error
+	FailPredictionJob(ctx context.Context, arg FailPredictionJobParams) error
+	FailReplayRun(ctx context.Context, arg FailReplayRunParams) error
 	GetAPIKeyByHash(ctx context.Context, keyHash []byte) (GetAPIKeyByHashRow, error)
+	GetDecisionPolicy(ctx context.Context, id int64) (DecisionPolicy, error)
+	// api_key_id restricts the lookup to the logs of one API key if set.
+	GetInferenceLog(ctx context.Context, arg GetInferenceLogParams) (InferenceLog, error)
+	// The most recent successful prediction of the transaction; api_key_id
+	// restricts the lookup to the logs of one API key if set.
+	GetInferenceLogIDByTransaction(ctx context.Context, arg GetInferenceLogIDByTransactionParams) (int64, error)
+	// api_key_id restricts the lookup to the logs of one API key if set.
+	GetInferenceLogIDForUser(ctx context.Context, arg GetInferenceLogIDForUserParams) (int64, error)
+	GetPredictionJob(ctx context.Context, arg GetPredictionJobParams) (GetPredictionJobRow, error)
+	GetReplayRun(ctx context.Context, id int64) (ReplayRun, error)
+	GetReviewCase(ctx context.Context, arg GetReviewCaseParams) (ReviewCase, error)
 	GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error)
 	GetUserByEmailForLogin(ctx context.Context, email string) (GetUserByEmailForLoginRow, error)
 	// keyset pagination
 	GetUserByID(ctx context.Context, id int64) (GetUserByIDRow, error)
+	GetWebhookDeliveryLease(ctx context.Context, arg GetWebhookDeliveryLeaseParams) (sql.NullTime, error)
+	InsertFraudRuleVersion(ctx context.Context, arg InsertFraudRuleVersionParams) error
+	// Results already stored by an interrupted attempt of the run are kept.
+	InsertReplayResult(ctx context.Context, arg InsertReplayResultParams) error
 	ListAPIKeysByUser(ctx context.Context, userID int64) ([]ListAPIKeysByUserRow, error)
+	ListDecisionPolicies(ctx context.Context) ([]DecisionPolicy, error)
+	ListDecisionPoliciesForUser(ctx context.Context, userID int64) ([]DecisionPolicy, error)
+	// The feature names of the exported predictions, and whether every value of
+	// the feature is a JSON number.
+	ListExportFeatureColumns(ctx context.Context, arg ListExportFeatureColumnsParams) ([]ListExportFeatureColumnsRow, error)
+	// Successful predictions joined with their feedback label, in id order:
+	// after_id is the last id of the previous batch.
+	ListExportRows(ctx context.Context, arg ListExportRowsParams) ([]ListExportRowsRow, error)
+	ListFeatureDriftSnapshots(ctx context.Context, arg ListFeatureDriftSnapshotsParams) ([]FeatureDriftSnapshot, error)
+	// A uniform sample of the successful feature vectors of the window, at most
+	// max_rows.
+	ListFeatureVectors(ctx context.Context, arg ListFeatureVectorsParams) ([]json.RawMessage, error)
+	ListFraudRules(ctx context.Context) ([]FraudRule, error)
+	ListInferenceLogPartitions(ctx context.Context) ([]ListInferenceLogPartitionsRow, error)
+	// Keyset pagination, newest first: before_id is the last id of the previous
+	// page. NULL filters match every log.
+	ListInferenceLogs(ctx context.Context, arg ListInferenceLogsParams) ([]InferenceLog, error)
+	// Counts the labeled predictions of each model run and bucket by prediction
+	// and by score, rounded to 3 decimals. Buckets are bucket_seconds long and
+	// aligned on from_time.
+	ListLabeledScoreCounts(ctx context.Context, arg ListLabeledScoreCountsParams) ([]ListLabeledScoreCountsRow, error)
+	ListModelMetrics(ctx context.Context, arg ListModelMetricsParams) ([]ModelMetric, error)
+	// Results in item order, starting at from_index.
+	ListPredictionJobResults(ctx context.Context, arg ListPredictionJobResultsParams) ([]PredictionJobResult, error)
+	// The replayed predictions whose outcome changed first, then by decreasing
+	// score change.
+	ListReplayChanges(ctx context.Context, arg ListReplayChangesParams) ([]ListReplayChangesRow, error)
+	// Compares the replayed predictions with the original ones, by original model.
+	// Score deltas are the replay score minus the original score.
+	ListReplayComparisons(ctx context.Context, runID int64) ([]ListReplayComparisonsRow, error)
+	// Successful predictions to replay, in id order: after_id is the last id of
+	// the previous batch.
+	ListReplayLogs(ctx context.Context, arg ListReplayLogsParams) ([]ListReplayLogsRow, error)
+	ListReplayRuns(ctx context.Context, limit int32) ([]ReplayRun, error)
+	ListResumablePredictionJobs(ctx context.Context, updatedAt time.Time) ([]uuid.UUID, error)
+	ListResumableReplayRuns(ctx context.Context) ([]int64, error)
+	ListReviewCaseComments(ctx context.Context, caseID int64) ([]ReviewCaseComment, error)
+	ListReviewCases(ctx context.Context, arg ListReviewCasesParams) ([]ReviewCase, error)
+	ListShadowComparisons(ctx context.Context, arg ListShadowComparisonsParams) ([]ListShadowComparisonsRow, error)
+	ListUserPlans(ctx context.Context) ([]string, error)
 	ListUsersPaged(ctx context.Context, arg ListUsersPagedParams) ([]ListUsersPagedRow, error)
+	ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ListWebhookEndpoints(ctx context.Context, userID int64) ([]WebhookEndpoint, error)
+	MarkWebhookDelivered(ctx context.Context, arg MarkWebhookDeliveredParams) error
+	// Queues a delivery again in any state, with a fresh retry budget. Deliveries
+	// that a dispatcher is sending are left alone.
+	RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (WebhookDelivery, error)
+	ReleaseAdvisoryLock(ctx context.Context, name string) error
+	ReleasePredictionJob(ctx context.Context, arg ReleasePredictionJobParams) (int64, error)
+	ReleaseReplayRun(ctx context.Context, id int64) error
+	// Saves the progress of the job and extends the lease held until held_lease.
+	RenewPredictionJobLease(ctx context.Context, arg RenewPredictionJobLeaseParams) (int64, error)
+	// Allocates count ids from the inference_logs sequence for logs written later.
+	ReserveInferenceLogIDs(ctx context.Context, count int32) ([]int64, error)
+	// A policy for the API key takes precedence over the policy for the user's plan.
+	ResolveDecisionPolicy(ctx context.Context, arg ResolveDecisionPolicyParams) (DecisionPolicy, error)
+	// Only open cases can be resolved.
+	ResolveReviewCase(ctx context.Context, arg ResolveReviewCaseParams) (ReviewCase, error)
+	// Detaches the partition, then archives or drops it.
+	RetireInferenceLogPartition(ctx context.Context, arg RetireInferenceLogPartitionParams) error
+	// results is a JSON array of item results. An item scored again after its job
+	// was taken over replaces the stored result.
+	SavePredictionJobResults(ctx context.Context, arg SavePredictionJobResultsParams) error
+	// Records a failed attempt. status is 'pending' to retry at next_attempt_at or
+	// 'dead' once the retries are exhausted.
+	ScheduleWebhookRetry(ctx context.Context, arg ScheduleWebhookRetryParams) error
+	// Takes the session advisory lock of name unless another session holds it.
+	TryAdvisoryLock(ctx context.Context, name string) (bool, error)
 	UpdateAPIKeyLastUsed(ctx context.Context, id int64) error
+	UpdateDecisionPolicy(ctx context.Context, arg UpdateDecisionPolicyParams) (DecisionPolicy, error)
+	UpdateFraudRule(ctx context.Context, arg UpdateFraudRuleParams) (FraudRule, error)
+	UpdateInferenceLogShadow(ctx context.Context, arg UpdateInferenceLogShadowParams) error
+	// Records the progress of a run up to last_log_id and renews its lease.
+	UpdateReplayRunProgress(ctx context.Context, arg UpdateReplayRunProgressParams) error
+	UpsertModelMetrics(ctx context.Context, arg UpsertModelMetricsParams) error
+	// A later label for the same prediction replaces the earlier one.
+	UpsertPredictionFeedback(ctx context.Context, arg UpsertPredictionFeedbackParams) (PredictionFeedback, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,6 @@
+-- name: TryAdvisoryLock :one
+-- Takes the session advisory lock of name unless another session holds it.
+SELECT pg_try_advisory_lock(hashtext(sqlc.arg(name)::text))::boolean AS locked;
+
+-- name: ReleaseAdvisoryLock :exec
+SELECT pg_advisory_unlock(hashtext(sqlc.arg(name)::text));
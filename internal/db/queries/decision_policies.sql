@@ -0,0 +1,39 @@
+-- name: CreateDecisionPolicy :one
+INSERT INTO decision_policies (plan, api_key_id, review_threshold, decline_threshold)
+VALUES ($1, $2, $3, $4)
+RETURNING id, plan, api_key_id, review_threshold, decline_threshold, version, created_at, updated_at;
+
+-- name: GetDecisionPolicy :one
+SELECT id, plan, api_key_id, review_threshold, decline_threshold, version, created_at, updated_at
+FROM decision_policies
+WHERE id = $1;
+
+-- name: ListDecisionPolicies :many
+SELECT id, plan, api_key_id, review_threshold, decline_threshold, version, created_at, updated_at
+FROM decision_policies
+ORDER BY id;
+
+-- name: ListDecisionPoliciesForUser :many
+SELECT id, plan, api_key_id, review_threshold, decline_threshold, version, created_at, updated_at
+FROM decision_policies
+WHERE api_key_id IN (SELECT k.id FROM api_keys k WHERE k.user_id = $1)
+   OR plan = (SELECT u.plan FROM users u WHERE u.id = $1)
+ORDER BY id;
+
+-- name: ResolveDecisionPolicy :one
+-- A policy for the API key takes precedence over the policy for the user's plan.
+SELECT id, plan, api_key_id, review_threshold, decline_threshold, version, created_at, updated_at
+FROM decision_policies
+WHERE api_key_id = sqlc.narg(api_key_id)
+   OR plan = (SELECT u.plan FROM users u WHERE u.id = sqlc.arg(user_id))
+ORDER BY api_key_id IS NULL
+LIMIT 1;
+
+-- name: UpdateDecisionPolicy :one
+UPDATE decision_policies
+SET review_threshold = $2, decline_threshold = $3, version = version + 1, updated_at = now()
+WHERE id = $1
+RETURNING id, plan, api_key_id, review_threshold, decline_threshold, version, created_at, updated_at;
+
+-- name: DeleteDecisionPolicy :exec
+DELETE FROM decision_policies WHERE id = $1;
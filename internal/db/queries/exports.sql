@@ -0,0 +1,30 @@
+-- name: ListExportFeatureColumns :many
+-- The feature names of the exported predictions, and whether every value of
+-- the feature is a JSON number.
+SELECT f.key::text AS feature, bool_and(jsonb_typeof(f.value) = 'number')::boolean AS numeric
+FROM inference_logs l, jsonb_each(l.request_payload->'features') f
+WHERE l.error IS NULL
+  AND l.request_time >= sqlc.arg(from_time)
+  AND l.request_time < sqlc.arg(to_time)
+  AND (sqlc.narg(user_id)::bigint IS NULL OR l.user_id = sqlc.narg(user_id))
+  AND (sqlc.narg(api_key_id)::bigint IS NULL OR l.api_key_id = sqlc.narg(api_key_id))
+  AND (sqlc.narg(model)::text IS NULL OR l.request_payload->>'model' = sqlc.narg(model) OR l.response_payload->'meta'->>'model_name' = sqlc.narg(model))
+GROUP BY f.key
+ORDER BY f.key;
+
+-- name: ListExportRows :many
+-- Successful predictions joined with their feedback label, in id order:
+-- after_id is the last id of the previous batch.
+SELECT l.id, l.user_id, l.api_key_id, l.request_time, l.request_payload, l.response_payload, l.decision,
+  f.label, f.label_source
+FROM inference_logs l
+LEFT JOIN prediction_feedback f ON f.inference_log_id = l.id
+WHERE l.id > sqlc.arg(after_id)
+  AND l.error IS NULL
+  AND l.request_time >= sqlc.arg(from_time)
+  AND l.request_time < sqlc.arg(to_time)
+  AND (sqlc.narg(user_id)::bigint IS NULL OR l.user_id = sqlc.narg(user_id))
+  AND (sqlc.narg(api_key_id)::bigint IS NULL OR l.api_key_id = sqlc.narg(api_key_id))
+  AND (sqlc.narg(model)::text IS NULL OR l.request_payload->>'model' = sqlc.narg(model) OR l.response_payload->'meta'->>'model_name' = sqlc.narg(model))
+ORDER BY l.id
+LIMIT sqlc.arg(max_rows);
@@ -0,0 +1,33 @@
+-- name: CreateFeatureDriftSnapshot :one
+-- Replaces the snapshot of the same feature and window computed by another
+-- instance.
+INSERT INTO feature_drift_snapshots (
+  feature, kind, reference_from, reference_to, recent_from, recent_to, reference_count, recent_count, psi, ks, drifted
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+)
+ON CONFLICT (feature, recent_to) DO UPDATE
+SET kind = EXCLUDED.kind, reference_from = EXCLUDED.reference_from, reference_to = EXCLUDED.reference_to,
+    recent_from = EXCLUDED.recent_from, reference_count = EXCLUDED.reference_count,
+    recent_count = EXCLUDED.recent_count, psi = EXCLUDED.psi, ks = EXCLUDED.ks,
+    drifted = EXCLUDED.drifted, computed_at = now()
+RETURNING id, feature, kind, reference_from, reference_to, recent_from, recent_to, reference_count, recent_count, psi, ks, drifted, computed_at;
+
+-- name: ListFeatureDriftSnapshots :many
+SELECT id, feature, kind, reference_from, reference_to, recent_from, recent_to, reference_count, recent_count, psi, ks, drifted, computed_at
+FROM feature_drift_snapshots
+WHERE computed_at >= sqlc.arg(from_time)
+  AND computed_at < sqlc.arg(to_time)
+  AND (sqlc.narg(feature)::text IS NULL OR feature = sqlc.narg(feature))
+ORDER BY computed_at DESC, feature;
+
+-- name: ListFeatureVectors :many
+-- A uniform sample of the successful feature vectors of the window, at most
+-- max_rows.
+SELECT (request_payload->'features')::jsonb AS features
+FROM inference_logs
+WHERE error IS NULL
+  AND request_time >= sqlc.arg(from_time)
+  AND request_time < sqlc.arg(to_time)
+ORDER BY random()
+LIMIT sqlc.arg(max_rows);
@@ -0,0 +1,23 @@
+-- name: CreateFraudRule :one
+INSERT INTO fraud_rules (name, stage, expression, decision, reason_code, priority, enabled)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, name, stage, expression, decision, reason_code, priority, enabled, version, created_at, updated_at;
+
+-- name: ListFraudRules :many
+SELECT id, name, stage, expression, decision, reason_code, priority, enabled, version, created_at, updated_at
+FROM fraud_rules
+ORDER BY stage, priority, id;
+
+-- name: UpdateFraudRule :one
+UPDATE fraud_rules
+SET stage = $2, expression = $3, decision = $4, reason_code = $5, priority = $6, enabled = $7,
+    version = version + 1, updated_at = now()
+WHERE id = $1
+RETURNING id, name, stage, expression, decision, reason_code, priority, enabled, version, created_at, updated_at;
+
+-- name: DeleteFraudRule :exec
+DELETE FROM fraud_rules WHERE id = $1;
+
+-- name: InsertFraudRuleVersion :exec
+INSERT INTO fraud_rule_versions (rule_id, version, name, stage, expression, decision, reason_code, priority, enabled)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
@@ -0,0 +1,57 @@
+-- name: ArchiveExpiredInferenceLogs :execrows
+-- Moves up to max_rows logs of users on plan requested before before to
+-- inference_logs_archive.expired_inference_logs, keeping their feedback and
+-- review cases.
+WITH expired AS (
+  SELECT l.id, l.request_time
+  FROM inference_logs l
+  JOIN users u ON u.id = l.user_id
+  WHERE u.plan = sqlc.arg(plan) AND l.request_time < sqlc.arg(before)
+  LIMIT sqlc.arg(max_rows)
+), moved AS (
+  DELETE FROM inference_logs l
+  USING expired e
+  WHERE l.id = e.id AND l.request_time = e.request_time
+  RETURNING l.*
+)
+INSERT INTO inference_logs_archive.expired_inference_logs
+SELECT * FROM moved;
+
+-- name: CreateInferenceLogPartition :one
+-- Creates the partition of the month of month_start unless it exists and
+-- returns its name.
+SELECT create_inference_logs_partition(sqlc.arg(month_start)::date)::text AS name;
+
+-- name: DeleteExpiredInferenceLogs :execrows
+-- Deletes up to max_rows logs of users on plan requested before before, with
+-- their feedback and review cases.
+WITH expired AS (
+  SELECT l.id, l.request_time
+  FROM inference_logs l
+  JOIN users u ON u.id = l.user_id
+  WHERE u.plan = sqlc.arg(plan) AND l.request_time < sqlc.arg(before)
+  LIMIT sqlc.arg(max_rows)
+), deleted_feedback AS (
+  DELETE FROM prediction_feedback f USING expired e WHERE f.inference_log_id = e.id
+), deleted_cases AS (
+  DELETE FROM review_cases c USING expired e WHERE c.inference_log_id = e.id
+)
+DELETE FROM inference_logs l
+USING expired e
+WHERE l.id = e.id AND l.request_time = e.request_time;
+
+-- name: ListInferenceLogPartitions :many
+SELECT c.relname::text AS name,
+  pg_total_relation_size(c.oid)::bigint AS size_bytes,
+  GREATEST(c.reltuples, 0)::bigint AS estimated_rows
+FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = 'inference_logs'::regclass
+ORDER BY c.relname;
+
+-- name: ListUserPlans :many
+SELECT DISTINCT plan FROM users ORDER BY plan;
+
+-- name: RetireInferenceLogPartition :exec
+-- Detaches the partition, then archives or drops it.
+SELECT retire_inference_logs_partition(sqlc.arg(partition_name)::text, sqlc.arg(archive)::boolean);
@@ -1,6 +1,92 @@
--- name: CreateInferenceLog :exec
+-- name: CreateInferenceLog :one
 INSERT INTO inference_logs (
-  user_id, api_key_id, request_payload, response_payload, error, request_time, response_time
+  user_id, api_key_id, request_payload, response_payload, error, request_time, response_time,
+  decision, policy_id, policy_version, fired_rules, explanation, scoring_path
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7
-);
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+)
+RETURNING id;
+
+-- name: UpdateInferenceLogShadow :exec
+UPDATE inference_logs
+SET shadow_model = $2, shadow_response_payload = $3, shadow_error = $4
+WHERE id = $1;
+
+-- name: ListShadowComparisons :many
+SELECT
+  (response_payload->'meta'->>'model_name')::text AS champion_model,
+  shadow_model::text AS challenger_model,
+  COUNT(*)::bigint AS total,
+  COUNT(*) FILTER (
+    WHERE (response_payload->'result'->>'prediction') = (shadow_response_payload->'result'->>'prediction')
+  )::bigint AS agreements,
+  COALESCE(AVG((shadow_response_payload->'result'->>'score')::float8 - (response_payload->'result'->>'score')::float8), 0)::float8 AS mean_score_delta,
+  COALESCE(AVG(ABS((shadow_response_payload->'result'->>'score')::float8 - (response_payload->'result'->>'score')::float8)), 0)::float8 AS mean_abs_score_delta,
+  COALESCE(percentile_cont(0.95) WITHIN GROUP (
+    ORDER BY ABS((shadow_response_payload->'result'->>'score')::float8 - (response_payload->'result'->>'score')::float8)
+  ), 0)::float8 AS p95_abs_score_delta,
+  COALESCE(MAX(ABS((shadow_response_payload->'result'->>'score')::float8 - (response_payload->'result'->>'score')::float8)), 0)::float8 AS max_abs_score_delta
+FROM inference_logs
+WHERE user_id = sqlc.arg(user_id)
+  AND shadow_model IS NOT NULL
+  AND shadow_response_payload IS NOT NULL
+  AND response_payload IS NOT NULL
+  AND request_time >= sqlc.arg(from_time)
+  AND request_time < sqlc.arg(to_time)
+GROUP BY 1, 2
+ORDER BY 1, 2;
+
+-- name: GetInferenceLogIDForUser :one
+-- api_key_id restricts the lookup to the logs of one API key if set.
+SELECT id
+FROM inference_logs
+WHERE id = sqlc.arg(id)
+  AND user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(api_key_id)::bigint IS NULL OR api_key_id = sqlc.narg(api_key_id));
+
+-- name: GetInferenceLogIDByTransaction :one
+-- The most recent successful prediction of the transaction; api_key_id
+-- restricts the lookup to the logs of one API key if set.
+SELECT id
+FROM inference_logs
+WHERE user_id = sqlc.arg(user_id)
+  AND request_payload->'features'->>'transaction_id' = sqlc.arg(transaction_id)::text
+  AND (sqlc.narg(api_key_id)::bigint IS NULL OR api_key_id = sqlc.narg(api_key_id))
+  AND error IS NULL
+ORDER BY request_time DESC
+LIMIT 1;
+
+-- name: GetInferenceLog :one
+-- api_key_id restricts the lookup to the logs of one API key if set.
+SELECT id, user_id, api_key_id, request_payload, response_payload, error, request_time, response_time, created_at,
+  shadow_model, shadow_response_payload, shadow_error, decision, policy_id, policy_version, fired_rules, explanation,
+  scoring_path
+FROM inference_logs
+WHERE id = sqlc.arg(id)
+  AND user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(api_key_id)::bigint IS NULL OR api_key_id = sqlc.narg(api_key_id));
+
+-- name: ListInferenceLogs :many
+-- Keyset pagination, newest first: before_id is the last id of the previous
+-- page. NULL filters match every log.
+SELECT id, user_id, api_key_id, request_payload, response_payload, error, request_time, response_time, created_at,
+  shadow_model, shadow_response_payload, shadow_error, decision, policy_id, policy_version, fired_rules, explanation,
+  scoring_path
+FROM inference_logs
+WHERE user_id = sqlc.arg(user_id)
+  AND id < sqlc.arg(before_id)
+  AND request_time >= sqlc.arg(from_time)
+  AND request_time < sqlc.arg(to_time)
+  AND (sqlc.narg(api_key_id)::bigint IS NULL OR api_key_id = sqlc.narg(api_key_id))
+  AND (sqlc.narg(model)::text IS NULL OR request_payload->>'model' = sqlc.narg(model) OR response_payload->'meta'->>'model_name' = sqlc.narg(model))
+  AND (sqlc.narg(has_error)::boolean IS NULL OR (error IS NOT NULL) = sqlc.narg(has_error))
+  AND (sqlc.narg(prediction)::int IS NULL OR (response_payload->'result'->>'prediction')::int = sqlc.narg(prediction))
+  AND (sqlc.narg(min_score)::float8 IS NULL OR (response_payload->'result'->>'score')::float8 >= sqlc.narg(min_score))
+  AND (sqlc.narg(max_score)::float8 IS NULL OR (response_payload->'result'->>'score')::float8 <= sqlc.narg(max_score))
+ORDER BY id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: ReserveInferenceLogIDs :many
+-- Allocates count ids from the inference_logs sequence for logs written later.
+SELECT nextval('inference_logs_id_seq')::bigint AS id
+FROM generate_series(1, sqlc.arg(count)::int);
@@ -0,0 +1,53 @@
+-- name: DeleteModelMetricsBefore :execrows
+-- Deletes the metrics of the buckets that start before bucket_start.
+DELETE FROM model_metrics WHERE bucket_start < $1;
+
+-- name: ListLabeledScoreCounts :many
+-- Counts the labeled predictions of each model run and bucket by prediction
+-- and by score, rounded to 3 decimals. Buckets are bucket_seconds long and
+-- aligned on from_time.
+SELECT
+  (l.response_payload->'meta'->>'model_name')::text AS model_name,
+  COALESCE(l.response_payload->'meta'->>'run_id', '')::text AS run_id,
+  date_bin(sqlc.arg(bucket_seconds)::float8 * interval '1 second', l.request_time, sqlc.arg(from_time)::timestamptz)::timestamptz AS bucket_start,
+  round(COALESCE((l.response_payload->'result'->>'score')::float8, 0)::numeric, 3)::float8 AS score,
+  COALESCE((l.response_payload->'result'->>'prediction')::int, 0)::int AS prediction,
+  count(*) FILTER (WHERE f.label = 'fraud') AS frauds,
+  count(*) FILTER (WHERE f.label = 'legit') AS legits
+FROM inference_logs l
+JOIN prediction_feedback f ON f.inference_log_id = l.id
+WHERE l.response_payload IS NOT NULL
+  AND l.request_time >= sqlc.arg(from_time)
+  AND l.request_time < sqlc.arg(to_time)
+GROUP BY 1, 2, 3, 4, 5;
+
+-- name: ListModelMetrics :many
+SELECT model_name, run_id, bucket_start, bucket_end, total, positives, true_positives, false_positives,
+  true_negatives, false_negatives, precision, recall, false_positive_rate, auc, calibration_error, computed_at
+FROM model_metrics
+WHERE bucket_start >= sqlc.arg(from_time)
+  AND bucket_start < sqlc.arg(to_time)
+  AND (sqlc.narg(model_name)::text IS NULL OR model_name = sqlc.narg(model_name))
+ORDER BY model_name, run_id, bucket_start;
+
+-- name: UpsertModelMetrics :exec
+INSERT INTO model_metrics (
+  model_name, run_id, bucket_start, bucket_end, total, positives, true_positives, false_positives,
+  true_negatives, false_negatives, precision, recall, false_positive_rate, auc, calibration_error
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+)
+ON CONFLICT (model_name, run_id, bucket_start) DO UPDATE
+SET bucket_end = EXCLUDED.bucket_end,
+    total = EXCLUDED.total,
+    positives = EXCLUDED.positives,
+    true_positives = EXCLUDED.true_positives,
+    false_positives = EXCLUDED.false_positives,
+    true_negatives = EXCLUDED.true_negatives,
+    false_negatives = EXCLUDED.false_negatives,
+    precision = EXCLUDED.precision,
+    recall = EXCLUDED.recall,
+    false_positive_rate = EXCLUDED.false_positive_rate,
+    auc = EXCLUDED.auc,
+    calibration_error = EXCLUDED.calibration_error,
+    computed_at = now();
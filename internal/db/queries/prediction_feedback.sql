@@ -0,0 +1,11 @@
+-- name: UpsertPredictionFeedback :one
+-- A later label for the same prediction replaces the earlier one.
+INSERT INTO prediction_feedback (inference_log_id, user_id, api_key_id, label, label_source, labeled_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (inference_log_id) DO UPDATE
+SET api_key_id = EXCLUDED.api_key_id,
+    label = EXCLUDED.label,
+    label_source = EXCLUDED.label_source,
+    labeled_at = EXCLUDED.labeled_at,
+    updated_at = now()
+RETURNING id, inference_log_id, user_id, api_key_id, label, label_source, labeled_at, created_at, updated_at;
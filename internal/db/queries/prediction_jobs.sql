@@ -0,0 +1,63 @@
+-- name: CreatePredictionJob :one
+INSERT INTO prediction_jobs (id, user_id, api_key_id, items, total_items)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, user_id, api_key_id, status, total_items, processed_items, failed_items, error, created_at, started_at, completed_at;
+
+-- name: GetPredictionJob :one
+SELECT id, user_id, api_key_id, status, total_items, processed_items, failed_items, error, created_at, started_at, completed_at
+FROM prediction_jobs
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListPredictionJobResults :many
+-- Results in item order, starting at from_index.
+SELECT job_id, item_index, response, error
+FROM prediction_job_results
+WHERE job_id = sqlc.arg(job_id) AND item_index >= sqlc.arg(from_index)
+ORDER BY item_index
+LIMIT sqlc.arg(max_rows);
+
+-- name: SavePredictionJobResults :exec
+-- results is a JSON array of item results. An item scored again after its job
+-- was taken over replaces the stored result.
+INSERT INTO prediction_job_results (job_id, item_index, response, error)
+SELECT sqlc.arg(job_id), r.index, r.response, r.error
+FROM jsonb_to_recordset(sqlc.arg(results)::jsonb) AS r("index" INT, response JSONB, error TEXT)
+ON CONFLICT (job_id, item_index) DO UPDATE SET response = EXCLUDED.response, error = EXCLUDED.error;
+
+-- name: ClaimPredictionJob :one
+-- The lease expiry identifies the claim: the renew, complete and release
+-- queries only apply while the job still has the lease of the worker.
+-- The results of the first processed_items items of a job that was
+-- interrupted are already stored.
+UPDATE prediction_jobs
+SET status = 'running', started_at = COALESCE(started_at, now()), lease_expires_at = $2, updated_at = now()
+WHERE id = $1 AND (status = 'queued' OR (status = 'running' AND lease_expires_at < now()))
+RETURNING id, user_id, api_key_id, items, processed_items, failed_items;
+
+-- name: RenewPredictionJobLease :execrows
+-- Saves the progress of the job and extends the lease held until held_lease.
+UPDATE prediction_jobs
+SET processed_items = $2, failed_items = $3, lease_expires_at = $4, updated_at = now()
+WHERE id = $1 AND status = 'running' AND lease_expires_at = sqlc.arg(held_lease);
+
+-- name: CompletePredictionJob :execrows
+UPDATE prediction_jobs
+SET status = 'completed', processed_items = $2, failed_items = $3,
+    completed_at = now(), lease_expires_at = NULL, updated_at = now()
+WHERE id = $1 AND lease_expires_at = sqlc.arg(held_lease);
+
+-- name: FailPredictionJob :exec
+UPDATE prediction_jobs
+SET status = 'failed', error = $2, completed_at = now(), lease_expires_at = NULL, updated_at = now()
+WHERE id = $1;
+
+-- name: ReleasePredictionJob :execrows
+UPDATE prediction_jobs
+SET status = 'queued', processed_items = $2, failed_items = $3, lease_expires_at = NULL, updated_at = now()
+WHERE id = $1 AND status = 'running' AND lease_expires_at = sqlc.arg(held_lease);
+
+-- name: ListResumablePredictionJobs :many
+SELECT id FROM prediction_jobs
+WHERE (status = 'queued' AND updated_at < $1)
+   OR (status = 'running' AND lease_expires_at < now())
+ORDER BY created_at ASC;
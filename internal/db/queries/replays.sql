@@ -0,0 +1,128 @@
+-- name: ClaimReplayRun :one
+UPDATE replay_runs
+SET status = 'running', started_at = COALESCE(started_at, now()), lease_expires_at = $2, updated_at = now()
+WHERE id = $1 AND (status = 'queued' OR (status = 'running' AND lease_expires_at < now()))
+RETURNING id, created_by, target_model, from_time, to_time, user_id, api_key_id, source_model, rate_per_second, status,
+  total_items, processed_items, failed_items, last_log_id, error, lease_expires_at, created_at, started_at, completed_at, updated_at;
+
+-- name: CompleteReplayRun :exec
+UPDATE replay_runs
+SET status = 'completed', completed_at = now(), lease_expires_at = NULL, updated_at = now()
+WHERE id = $1;
+
+-- name: CountReplayLogs :one
+SELECT COUNT(*)::bigint AS total
+FROM inference_logs l
+WHERE l.error IS NULL
+  AND l.response_payload IS NOT NULL
+  AND l.request_time >= sqlc.arg(from_time)
+  AND l.request_time < sqlc.arg(to_time)
+  AND (sqlc.narg(user_id)::bigint IS NULL OR l.user_id = sqlc.narg(user_id))
+  AND (sqlc.narg(api_key_id)::bigint IS NULL OR l.api_key_id = sqlc.narg(api_key_id))
+  AND (sqlc.narg(source_model)::text IS NULL OR l.request_payload->>'model' = sqlc.narg(source_model) OR l.response_payload->'meta'->>'model_name' = sqlc.narg(source_model));
+
+-- name: CreateReplayRun :one
+INSERT INTO replay_runs (created_by, target_model, from_time, to_time, user_id, api_key_id, source_model, rate_per_second, total_items)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, created_by, target_model, from_time, to_time, user_id, api_key_id, source_model, rate_per_second, status,
+  total_items, processed_items, failed_items, last_log_id, error, lease_expires_at, created_at, started_at, completed_at, updated_at;
+
+-- name: FailReplayRun :exec
+UPDATE replay_runs
+SET status = 'failed', error = $2, completed_at = now(), lease_expires_at = NULL, updated_at = now()
+WHERE id = $1;
+
+-- name: GetReplayRun :one
+SELECT id, created_by, target_model, from_time, to_time, user_id, api_key_id, source_model, rate_per_second, status,
+  total_items, processed_items, failed_items, last_log_id, error, lease_expires_at, created_at, started_at, completed_at, updated_at
+FROM replay_runs
+WHERE id = $1;
+
+-- name: InsertReplayResult :exec
+-- Results already stored by an interrupted attempt of the run are kept.
+INSERT INTO replay_results (run_id, inference_log_id, request_time, original_response, replay_response, error)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (run_id, inference_log_id) DO NOTHING;
+
+-- name: ListReplayChanges :many
+-- The replayed predictions whose outcome changed first, then by decreasing
+-- score change.
+SELECT inference_log_id, request_time,
+  (original_response->'meta'->>'model_name')::text AS original_model,
+  (original_response->'result'->>'prediction')::int AS original_prediction,
+  (original_response->'result'->>'score')::float8 AS original_score,
+  (replay_response->'result'->>'prediction')::int AS replay_prediction,
+  (replay_response->'result'->>'score')::float8 AS replay_score
+FROM replay_results
+WHERE run_id = sqlc.arg(run_id) AND replay_response IS NOT NULL
+ORDER BY (original_response->'result'->>'prediction') IS DISTINCT FROM (replay_response->'result'->>'prediction') DESC,
+  ABS((replay_response->'result'->>'score')::float8 - (original_response->'result'->>'score')::float8) DESC,
+  inference_log_id
+LIMIT sqlc.arg(max_rows);
+
+-- name: ListReplayComparisons :many
+-- Compares the replayed predictions with the original ones, by original model.
+-- Score deltas are the replay score minus the original score.
+SELECT
+  (original_response->'meta'->>'model_name')::text AS original_model,
+  COUNT(*)::bigint AS total,
+  COUNT(*) FILTER (WHERE replay_response IS NULL)::bigint AS errors,
+  COUNT(*) FILTER (
+    WHERE (original_response->'result'->>'prediction') = (replay_response->'result'->>'prediction')
+  )::bigint AS agreements,
+  COUNT(*) FILTER (
+    WHERE (original_response->'result'->>'prediction') = '0' AND (replay_response->'result'->>'prediction') = '1'
+  )::bigint AS newly_flagged,
+  COUNT(*) FILTER (
+    WHERE (original_response->'result'->>'prediction') = '1' AND (replay_response->'result'->>'prediction') = '0'
+  )::bigint AS newly_cleared,
+  COALESCE(AVG((replay_response->'result'->>'score')::float8 - (original_response->'result'->>'score')::float8), 0)::float8 AS mean_score_delta,
+  COALESCE(AVG(ABS((replay_response->'result'->>'score')::float8 - (original_response->'result'->>'score')::float8)), 0)::float8 AS mean_abs_score_delta,
+  COALESCE(percentile_cont(0.95) WITHIN GROUP (
+    ORDER BY ABS((replay_response->'result'->>'score')::float8 - (original_response->'result'->>'score')::float8)
+  ), 0)::float8 AS p95_abs_score_delta,
+  COALESCE(MAX(ABS((replay_response->'result'->>'score')::float8 - (original_response->'result'->>'score')::float8)), 0)::float8 AS max_abs_score_delta
+FROM replay_results
+WHERE run_id = sqlc.arg(run_id)
+GROUP BY 1
+ORDER BY 1;
+
+-- name: ListReplayLogs :many
+-- Successful predictions to replay, in id order: after_id is the last id of
+-- the previous batch.
+SELECT l.id, l.request_time, l.request_payload, l.response_payload
+FROM inference_logs l
+WHERE l.id > sqlc.arg(after_id)
+  AND l.error IS NULL
+  AND l.response_payload IS NOT NULL
+  AND l.request_time >= sqlc.arg(from_time)
+  AND l.request_time < sqlc.arg(to_time)
+  AND (sqlc.narg(user_id)::bigint IS NULL OR l.user_id = sqlc.narg(user_id))
+  AND (sqlc.narg(api_key_id)::bigint IS NULL OR l.api_key_id = sqlc.narg(api_key_id))
+  AND (sqlc.narg(source_model)::text IS NULL OR l.request_payload->>'model' = sqlc.narg(source_model) OR l.response_payload->'meta'->>'model_name' = sqlc.narg(source_model))
+ORDER BY l.id
+LIMIT sqlc.arg(max_rows);
+
+-- name: ListReplayRuns :many
+SELECT id, created_by, target_model, from_time, to_time, user_id, api_key_id, source_model, rate_per_second, status,
+  total_items, processed_items, failed_items, last_log_id, error, lease_expires_at, created_at, started_at, completed_at, updated_at
+FROM replay_runs
+ORDER BY id DESC
+LIMIT $1;
+
+-- name: ListResumableReplayRuns :many
+SELECT id FROM replay_runs
+WHERE status = 'queued'
+   OR (status = 'running' AND lease_expires_at < now())
+ORDER BY id ASC;
+
+-- name: ReleaseReplayRun :exec
+UPDATE replay_runs
+SET status = 'queued', lease_expires_at = NULL, updated_at = now()
+WHERE id = $1 AND status = 'running';
+
+-- name: UpdateReplayRunProgress :exec
+-- Records the progress of a run up to last_log_id and renews its lease.
+UPDATE replay_runs
+SET last_log_id = $2, processed_items = $3, failed_items = $4, lease_expires_at = $5, updated_at = now()
+WHERE id = $1 AND status = 'running';
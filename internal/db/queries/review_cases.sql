@@ -0,0 +1,48 @@
+-- name: AddReviewCaseComment :one
+INSERT INTO review_case_comments (case_id, author_id, body)
+VALUES ($1, $2, $3)
+RETURNING id, case_id, author_id, body, created_at;
+
+-- name: AssignReviewCase :one
+UPDATE review_cases
+SET assignee = $3, updated_at = now()
+WHERE id = $1 AND user_id = $2
+RETURNING id, inference_log_id, user_id, api_key_id, transaction_id, model_name, score, decision, reason, status, assignee, resolution, resolved_by, resolved_at, created_at, updated_at;
+
+-- name: CreateReviewCase :one
+-- The case inherits the owner and transaction ID of the logged prediction.
+-- A prediction has at most one case; no row is returned if it already exists.
+INSERT INTO review_cases (inference_log_id, user_id, api_key_id, transaction_id, model_name, score, decision, reason)
+SELECT id, user_id, api_key_id, request_payload->'features'->>'transaction_id', sqlc.arg(model_name)::text, sqlc.arg(score)::double precision, sqlc.arg(decision)::text, sqlc.arg(reason)::text
+FROM inference_logs
+WHERE id = sqlc.arg(inference_log_id)
+ON CONFLICT (inference_log_id) DO NOTHING
+RETURNING id, inference_log_id, user_id, api_key_id, transaction_id, model_name, score, decision, reason, status, assignee, resolution, resolved_by, resolved_at, created_at, updated_at;
+
+-- name: GetReviewCase :one
+SELECT id, inference_log_id, user_id, api_key_id, transaction_id, model_name, score, decision, reason, status, assignee, resolution, resolved_by, resolved_at, created_at, updated_at
+FROM review_cases
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListReviewCaseComments :many
+SELECT id, case_id, author_id, body, created_at
+FROM review_case_comments
+WHERE case_id = $1
+ORDER BY created_at, id;
+
+-- name: ListReviewCases :many
+SELECT id, inference_log_id, user_id, api_key_id, transaction_id, model_name, score, decision, reason, status, assignee, resolution, resolved_by, resolved_at, created_at, updated_at
+FROM review_cases
+WHERE user_id = sqlc.arg(user_id)
+  AND created_at >= sqlc.arg(from_time)
+  AND created_at < sqlc.arg(to_time)
+  AND (sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status))
+  AND (sqlc.narg(assignee)::text IS NULL OR assignee = sqlc.narg(assignee))
+ORDER BY created_at DESC, id DESC;
+
+-- name: ResolveReviewCase :one
+-- Only open cases can be resolved.
+UPDATE review_cases
+SET status = 'resolved', resolution = $3, resolved_by = $4, resolved_at = now(), updated_at = now()
+WHERE id = $1 AND user_id = $2 AND status = 'open'
+RETURNING id, inference_log_id, user_id, api_key_id, transaction_id, model_name, score, decision, reason, status, assignee, resolution, resolved_by, resolved_at, created_at, updated_at;
@@ -0,0 +1,77 @@
+-- name: ClaimWebhookDeliveries :many
+-- Due pending deliveries are leased until lease_until so that concurrent
+-- dispatchers do not send them twice.
+UPDATE webhook_deliveries d
+SET next_attempt_at = sqlc.arg(lease_until), leased_until = sqlc.arg(lease_until), updated_at = now()
+FROM webhook_endpoints e
+WHERE d.endpoint_id = e.id
+  AND d.id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= now()
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg(max_rows)
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING d.id, d.event_id, d.event_type, d.payload, d.attempts, e.url, e.secret;
+
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (user_id, api_key_id, url, secret)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, api_key_id, url, secret, created_at;
+
+-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2;
+
+-- name: GetWebhookDeliveryLease :one
+SELECT d.leased_until
+FROM webhook_deliveries d
+JOIN webhook_endpoints e ON e.id = d.endpoint_id
+WHERE d.id = $1 AND e.user_id = $2;
+
+-- name: EnqueueWebhookDeliveries :exec
+-- Adds one delivery of the event for every endpoint of the API key.
+INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+SELECT id, sqlc.arg(event_id)::uuid, sqlc.arg(event_type)::text, sqlc.arg(payload)::jsonb
+FROM webhook_endpoints
+WHERE api_key_id = sqlc.arg(api_key_id);
+
+-- name: ListWebhookDeliveries :many
+SELECT d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.last_status_code, d.last_error, d.delivered_at, d.created_at, d.updated_at, d.leased_until
+FROM webhook_deliveries d
+JOIN webhook_endpoints e ON e.id = d.endpoint_id
+WHERE d.endpoint_id = sqlc.arg(endpoint_id)
+  AND e.user_id = sqlc.arg(user_id)
+  AND d.created_at >= sqlc.arg(from_time)
+  AND d.created_at < sqlc.arg(to_time)
+  AND (sqlc.narg(status)::text IS NULL OR d.status = sqlc.narg(status))
+ORDER BY d.created_at DESC, d.id DESC;
+
+-- name: ListWebhookEndpoints :many
+SELECT id, user_id, api_key_id, url, secret, created_at
+FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY id;
+
+-- name: MarkWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = now(), leased_until = NULL, updated_at = now()
+WHERE id = $1;
+
+-- name: RedeliverWebhookDelivery :one
+-- Queues a delivery again in any state, with a fresh retry budget. Deliveries
+-- that a dispatcher is sending are left alone.
+UPDATE webhook_deliveries d
+SET status = 'pending', attempts = 0, next_attempt_at = now(), updated_at = now()
+FROM webhook_endpoints e
+WHERE d.endpoint_id = e.id
+  AND d.id = $1
+  AND e.user_id = $2
+  AND (d.leased_until IS NULL OR d.leased_until <= now())
+RETURNING d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.last_status_code, d.last_error, d.delivered_at, d.created_at, d.updated_at, d.leased_until;
+
+-- name: ScheduleWebhookRetry :exec
+-- Records a failed attempt. status is 'pending' to retry at next_attempt_at or
+-- 'dead' once the retries are exhausted.
+UPDATE webhook_deliveries
+SET status = $2, attempts = attempts + 1, next_attempt_at = $3, last_status_code = $4, last_error = $5, leased_until = NULL, updated_at = now()
+WHERE id = $1;
@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+// CaseRepository stores the review cases. Resolving a case also records its
+// feedback label and closing comment, in the same transaction.
+type CaseRepository interface {
+	CreateReviewCase(ctx context.Context, arg db.CreateReviewCaseParams) (db.ReviewCase, error)
+	GetReviewCase(ctx context.Context, id, userID int64) (db.ReviewCase, error)
+	ListReviewCases(ctx context.Context, userID int64, from, to time.Time, status, assignee string) ([]db.ReviewCase, error)
+	AssignReviewCase(ctx context.Context, id, userID int64, assignee string) (db.ReviewCase, error)
+	// ResolveReviewCase returns sql.ErrNoRows unless the case is open. comment
+	// may be nil.
+	ResolveReviewCase(ctx context.Context, arg db.ResolveReviewCaseParams, feedback db.UpsertPredictionFeedbackParams, comment *db.AddReviewCaseCommentParams) (db.ReviewCase, error)
+	AddReviewCaseComment(ctx context.Context, arg db.AddReviewCaseCommentParams) (db.ReviewCaseComment, error)
+	ListReviewCaseComments(ctx context.Context, caseID int64) ([]db.ReviewCaseComment, error)
+}
+
+type postgresCaseRepository struct {
+	conn *sql.DB
+	q    db.Querier
+}
+
+func NewCaseRepository(conn *sql.DB) CaseRepository {
+	return &postgresCaseRepository{conn: conn, q: db.New(conn)}
+}
+
+func (r *postgresCaseRepository) CreateReviewCase(ctx context.Context, arg db.CreateReviewCaseParams) (db.ReviewCase, error) {
+	return r.q.CreateReviewCase(ctx, arg)
+}
+
+func (r *postgresCaseRepository) GetReviewCase(ctx context.Context, id, userID int64) (db.ReviewCase, error) {
+	return r.q.GetReviewCase(ctx, db.GetReviewCaseParams{ID: id, UserID: userID})
+}
+
+// ListReviewCases does not filter on status or assignee when they are empty.
+func (r *postgresCaseRepository) ListReviewCases(ctx context.Context, userID int64, from, to time.Time, status, assignee string) ([]db.ReviewCase, error) {
+	params := db.ListReviewCasesParams{
+		UserID:   userID,
+		FromTime: from,
+		ToTime:   to,
+		Status:   sql.NullString{String: status, Valid: status != ""},
+		Assignee: sql.NullString{String: assignee, Valid: assignee != ""},
+	}
+	return r.q.ListReviewCases(ctx, params)
+}
+
+// AssignReviewCase unassigns the case when assignee is empty.
+func (r *postgresCaseRepository) AssignReviewCase(ctx context.Context, id, userID int64, assignee string) (db.ReviewCase, error) {
+	params := db.AssignReviewCaseParams{
+		ID:       id,
+		UserID:   userID,
+		Assignee: sql.NullString{String: assignee, Valid: assignee != ""},
+	}
+	return r.q.AssignReviewCase(ctx, params)
+}
+
+func (r *postgresCaseRepository) ResolveReviewCase(ctx context.Context, arg db.ResolveReviewCaseParams, feedback db.UpsertPredictionFeedbackParams, comment *db.AddReviewCaseCommentParams) (db.ReviewCase, error) {
+	var row db.ReviewCase
+	err := inTx(ctx, r.conn, func(q *db.Queries) error {
+		var err error
+		if row, err = q.ResolveReviewCase(ctx, arg); err != nil {
+			return err
+		}
+		if comment != nil {
+			if _, err := q.AddReviewCaseComment(ctx, *comment); err != nil {
+				return err
+			}
+		}
+		_, err = q.UpsertPredictionFeedback(ctx, feedback)
+		return err
+	})
+	if err != nil {
+		return db.ReviewCase{}, err
+	}
+	return row, nil
+}
+
+func (r *postgresCaseRepository) AddReviewCaseComment(ctx context.Context, arg db.AddReviewCaseCommentParams) (db.ReviewCaseComment, error) {
+	return r.q.AddReviewCaseComment(ctx, arg)
+}
+
+func (r *postgresCaseRepository) ListReviewCaseComments(ctx context.Context, caseID int64) ([]db.ReviewCaseComment, error) {
+	return r.q.ListReviewCaseComments(ctx, caseID)
+}
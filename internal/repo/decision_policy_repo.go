@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+type DecisionPolicyRepository interface {
+	CreateDecisionPolicy(ctx context.Context, arg db.CreateDecisionPolicyParams) (db.DecisionPolicy, error)
+	GetDecisionPolicy(ctx context.Context, id int64) (db.DecisionPolicy, error)
+	ListDecisionPolicies(ctx context.Context) ([]db.DecisionPolicy, error)
+	ListDecisionPoliciesForUser(ctx context.Context, userID int64) ([]db.DecisionPolicy, error)
+	ResolveDecisionPolicy(ctx context.Context, userID int64, apiKeyID *int64) (db.DecisionPolicy, error)
+	UpdateDecisionPolicy(ctx context.Context, arg db.UpdateDecisionPolicyParams) (db.DecisionPolicy, error)
+	DeleteDecisionPolicy(ctx context.Context, id int64) error
+}
+
+type postgresDecisionPolicyRepository struct {
+	q db.Querier
+}
+
+func NewDecisionPolicyRepository(q db.Querier) DecisionPolicyRepository {
+	return &postgresDecisionPolicyRepository{q: q}
+}
+
+func (r *postgresDecisionPolicyRepository) CreateDecisionPolicy(ctx context.Context, arg db.CreateDecisionPolicyParams) (db.DecisionPolicy, error) {
+	policy, err := r.q.CreateDecisionPolicy(ctx, arg)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return db.DecisionPolicy{}, ErrDecisionPolicyExists
+		}
+		return db.DecisionPolicy{}, err
+	}
+	return policy, nil
+}
+
+func (r *postgresDecisionPolicyRepository) GetDecisionPolicy(ctx context.Context, id int64) (db.DecisionPolicy, error) {
+	return r.q.GetDecisionPolicy(ctx, id)
+}
+
+func (r *postgresDecisionPolicyRepository) ListDecisionPolicies(ctx context.Context) ([]db.DecisionPolicy, error) {
+	return r.q.ListDecisionPolicies(ctx)
+}
+
+func (r *postgresDecisionPolicyRepository) ListDecisionPoliciesForUser(ctx context.Context, userID int64) ([]db.DecisionPolicy, error) {
+	return r.q.ListDecisionPoliciesForUser(ctx, userID)
+}
+
+func (r *postgresDecisionPolicyRepository) ResolveDecisionPolicy(ctx context.Context, userID int64, apiKeyID *int64) (db.DecisionPolicy, error) {
+	params := db.ResolveDecisionPolicyParams{UserID: userID}
+	if apiKeyID != nil {
+		params.ApiKeyID = sql.NullInt64{Int64: *apiKeyID, Valid: true}
+	}
+	return r.q.ResolveDecisionPolicy(ctx, params)
+}
+
+func (r *postgresDecisionPolicyRepository) UpdateDecisionPolicy(ctx context.Context, arg db.UpdateDecisionPolicyParams) (db.DecisionPolicy, error) {
+	return r.q.UpdateDecisionPolicy(ctx, arg)
+}
+
+func (r *postgresDecisionPolicyRepository) DeleteDecisionPolicy(ctx context.Context, id int64) error {
+	return r.q.DeleteDecisionPolicy(ctx, id)
+}
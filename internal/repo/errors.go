@@ -3,3 +3,11 @@ package repo
 import "errors"
 
 var ErrAPIKeyLabelExists = errors.New("api key label already exists")
+
+var ErrDecisionPolicyExists = errors.New("decision policy already exists for this scope")
+
+var ErrFraudRuleExists = errors.New("fraud rule name already exists")
+
+var ErrInferenceLogDropped = errors.New("inference log dropped: queue full")
+
+var ErrInferenceLogWriterClosed = errors.New("inference log writer closed")
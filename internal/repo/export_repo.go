@@ -0,0 +1,30 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+type ExportRepository interface {
+	ListExportFeatureColumns(ctx context.Context, arg db.ListExportFeatureColumnsParams) ([]db.ListExportFeatureColumnsRow, error)
+	ListExportRows(ctx context.Context, arg db.ListExportRowsParams) ([]db.ListExportRowsRow, error)
+}
+
+type postgresExportRepository struct {
+	q db.Querier
+}
+
+func NewExportRepository(q db.Querier) ExportRepository {
+	return &postgresExportRepository{q: q}
+}
+
+func (r *postgresExportRepository) ListExportFeatureColumns(ctx context.Context, arg db.ListExportFeatureColumnsParams) ([]db.ListExportFeatureColumnsRow, error) {
+	return r.q.ListExportFeatureColumns(ctx, arg)
+}
+
+// ListExportRows returns the next batch of at most arg.MaxRows rows after
+// arg.AfterID.
+func (r *postgresExportRepository) ListExportRows(ctx context.Context, arg db.ListExportRowsParams) ([]db.ListExportRowsRow, error) {
+	return r.q.ListExportRows(ctx, arg)
+}
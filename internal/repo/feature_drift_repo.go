@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+type FeatureDriftRepository interface {
+	ListFeatureVectors(ctx context.Context, from, to time.Time, maxRows int32) ([]json.RawMessage, error)
+	CreateFeatureDriftSnapshot(ctx context.Context, arg db.CreateFeatureDriftSnapshotParams) (db.FeatureDriftSnapshot, error)
+	ListFeatureDriftSnapshots(ctx context.Context, from, to time.Time, feature string) ([]db.FeatureDriftSnapshot, error)
+}
+
+type postgresFeatureDriftRepository struct {
+	q db.Querier
+}
+
+func NewFeatureDriftRepository(q db.Querier) FeatureDriftRepository {
+	return &postgresFeatureDriftRepository{q: q}
+}
+
+func (r *postgresFeatureDriftRepository) ListFeatureVectors(ctx context.Context, from, to time.Time, maxRows int32) ([]json.RawMessage, error) {
+	params := db.ListFeatureVectorsParams{
+		FromTime: from,
+		ToTime:   to,
+		MaxRows:  maxRows,
+	}
+	return r.q.ListFeatureVectors(ctx, params)
+}
+
+func (r *postgresFeatureDriftRepository) CreateFeatureDriftSnapshot(ctx context.Context, arg db.CreateFeatureDriftSnapshotParams) (db.FeatureDriftSnapshot, error) {
+	return r.q.CreateFeatureDriftSnapshot(ctx, arg)
+}
+
+// ListFeatureDriftSnapshots returns the snapshots of every feature if feature
+// is empty.
+func (r *postgresFeatureDriftRepository) ListFeatureDriftSnapshots(ctx context.Context, from, to time.Time, feature string) ([]db.FeatureDriftSnapshot, error) {
+	params := db.ListFeatureDriftSnapshotsParams{
+		FromTime: from,
+		ToTime:   to,
+		Feature:  sql.NullString{String: feature, Valid: feature != ""},
+	}
+	return r.q.ListFeatureDriftSnapshots(ctx, params)
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+type FeedbackRepository interface {
+	GetInferenceLogIDForUser(ctx context.Context, id, userID int64, apiKeyID *int64) (int64, error)
+	GetInferenceLogIDByTransaction(ctx context.Context, userID int64, transactionID string, apiKeyID *int64) (int64, error)
+	UpsertPredictionFeedback(ctx context.Context, arg db.UpsertPredictionFeedbackParams) (db.PredictionFeedback, error)
+}
+
+type postgresFeedbackRepository struct {
+	q db.Querier
+}
+
+func NewFeedbackRepository(q db.Querier) FeedbackRepository {
+	return &postgresFeedbackRepository{q: q}
+}
+
+func (r *postgresFeedbackRepository) GetInferenceLogIDForUser(ctx context.Context, id, userID int64, apiKeyID *int64) (int64, error) {
+	params := db.GetInferenceLogIDForUserParams{
+		ID:     id,
+		UserID: userID,
+	}
+	if apiKeyID != nil {
+		params.ApiKeyID = sql.NullInt64{Int64: *apiKeyID, Valid: true}
+	}
+	return r.q.GetInferenceLogIDForUser(ctx, params)
+}
+
+func (r *postgresFeedbackRepository) GetInferenceLogIDByTransaction(ctx context.Context, userID int64, transactionID string, apiKeyID *int64) (int64, error) {
+	params := db.GetInferenceLogIDByTransactionParams{
+		UserID:        userID,
+		TransactionID: transactionID,
+	}
+	if apiKeyID != nil {
+		params.ApiKeyID = sql.NullInt64{Int64: *apiKeyID, Valid: true}
+	}
+	return r.q.GetInferenceLogIDByTransaction(ctx, params)
+}
+
+func (r *postgresFeedbackRepository) UpsertPredictionFeedback(ctx context.Context, arg db.UpsertPredictionFeedbackParams) (db.PredictionFeedback, error) {
+	return r.q.UpsertPredictionFeedback(ctx, arg)
+}
@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+// FraudRuleRepository stores the fraud rules. Creating or updating a rule also
+// records its new version in fraud_rule_versions, in the same transaction.
+type FraudRuleRepository interface {
+	CreateFraudRule(ctx context.Context, arg db.CreateFraudRuleParams) (db.FraudRule, error)
+	ListFraudRules(ctx context.Context) ([]db.FraudRule, error)
+	UpdateFraudRule(ctx context.Context, arg db.UpdateFraudRuleParams) (db.FraudRule, error)
+	DeleteFraudRule(ctx context.Context, id int64) error
+}
+
+type postgresFraudRuleRepository struct {
+	conn *sql.DB
+	q    db.Querier
+}
+
+func NewFraudRuleRepository(conn *sql.DB) FraudRuleRepository {
+	return &postgresFraudRuleRepository{conn: conn, q: db.New(conn)}
+}
+
+func (r *postgresFraudRuleRepository) CreateFraudRule(ctx context.Context, arg db.CreateFraudRuleParams) (db.FraudRule, error) {
+	var rule db.FraudRule
+	err := inTx(ctx, r.conn, func(q *db.Queries) error {
+		var err error
+		if rule, err = q.CreateFraudRule(ctx, arg); err != nil {
+			return err
+		}
+		return q.InsertFraudRuleVersion(ctx, fraudRuleVersion(rule))
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return db.FraudRule{}, ErrFraudRuleExists
+		}
+		return db.FraudRule{}, err
+	}
+	return rule, nil
+}
+
+func (r *postgresFraudRuleRepository) ListFraudRules(ctx context.Context) ([]db.FraudRule, error) {
+	return r.q.ListFraudRules(ctx)
+}
+
+func (r *postgresFraudRuleRepository) UpdateFraudRule(ctx context.Context, arg db.UpdateFraudRuleParams) (db.FraudRule, error) {
+	var rule db.FraudRule
+	err := inTx(ctx, r.conn, func(q *db.Queries) error {
+		var err error
+		if rule, err = q.UpdateFraudRule(ctx, arg); err != nil {
+			return err
+		}
+		return q.InsertFraudRuleVersion(ctx, fraudRuleVersion(rule))
+	})
+	if err != nil {
+		return db.FraudRule{}, err
+	}
+	return rule, nil
+}
+
+func (r *postgresFraudRuleRepository) DeleteFraudRule(ctx context.Context, id int64) error {
+	return r.q.DeleteFraudRule(ctx, id)
+}
+
+func fraudRuleVersion(rule db.FraudRule) db.InsertFraudRuleVersionParams {
+	return db.InsertFraudRuleVersionParams{
+		RuleID:     rule.ID,
+		Version:    rule.Version,
+		Name:       rule.Name,
+		Stage:      rule.Stage,
+		Expression: rule.Expression,
+		Decision:   rule.Decision,
+		ReasonCode: rule.ReasonCode,
+		Priority:   rule.Priority,
+		Enabled:    rule.Enabled,
+	}
+}
@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+type InferenceLogPartitionRepository interface {
+	CreatePartition(ctx context.Context, monthStart time.Time) (string, error)
+	ListPartitions(ctx context.Context) ([]db.ListInferenceLogPartitionsRow, error)
+	RetirePartition(ctx context.Context, name string, archive bool) error
+	ListUserPlans(ctx context.Context) ([]string, error)
+	DeleteExpiredLogs(ctx context.Context, plan string, before time.Time, maxRows int32, archive bool) (int64, error)
+}
+
+type postgresInferenceLogPartitionRepository struct {
+	q db.Querier
+}
+
+func NewInferenceLogPartitionRepository(q db.Querier) InferenceLogPartitionRepository {
+	return &postgresInferenceLogPartitionRepository{q: q}
+}
+
+func (r *postgresInferenceLogPartitionRepository) CreatePartition(ctx context.Context, monthStart time.Time) (string, error) {
+	return r.q.CreateInferenceLogPartition(ctx, monthStart)
+}
+
+func (r *postgresInferenceLogPartitionRepository) ListPartitions(ctx context.Context) ([]db.ListInferenceLogPartitionsRow, error) {
+	return r.q.ListInferenceLogPartitions(ctx)
+}
+
+// RetirePartition moves the partition to the archive schema if archive is set,
+// or drops it with the feedback and review cases of its logs.
+func (r *postgresInferenceLogPartitionRepository) RetirePartition(ctx context.Context, name string, archive bool) error {
+	return r.q.RetireInferenceLogPartition(ctx, db.RetireInferenceLogPartitionParams{
+		PartitionName: name,
+		Archive:       archive,
+	})
+}
+
+func (r *postgresInferenceLogPartitionRepository) ListUserPlans(ctx context.Context) ([]string, error) {
+	return r.q.ListUserPlans(ctx)
+}
+
+// DeleteExpiredLogs moves the expired logs to the archive schema if archive is
+// set, or deletes them with their feedback and review cases.
+func (r *postgresInferenceLogPartitionRepository) DeleteExpiredLogs(ctx context.Context, plan string, before time.Time, maxRows int32, archive bool) (int64, error) {
+	if archive {
+		return r.q.ArchiveExpiredInferenceLogs(ctx, db.ArchiveExpiredInferenceLogsParams{
+			Plan:    plan,
+			Before:  before,
+			MaxRows: maxRows,
+		})
+	}
+	return r.q.DeleteExpiredInferenceLogs(ctx, db.DeleteExpiredInferenceLogsParams{
+		Plan:    plan,
+		Before:  before,
+		MaxRows: maxRows,
+	})
+}
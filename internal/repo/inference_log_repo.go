@@ -2,12 +2,22 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/jules-labs/go-api-prod-template/internal/db"
 )
 
 type InferenceLogRepository interface {
-	CreateInferenceLog(ctx context.Context, arg db.CreateInferenceLogParams) error
+	CreateInferenceLog(ctx context.Context, arg db.CreateInferenceLogParams) (int64, error)
+	UpdateInferenceLogShadow(ctx context.Context, arg db.UpdateInferenceLogShadowParams) error
+	ListShadowComparisons(ctx context.Context, userID int64, from, to time.Time) ([]db.ListShadowComparisonsRow, error)
+	// GetInferenceLog returns a log of userID, restricted to apiKeyID if set.
+	GetInferenceLog(ctx context.Context, id, userID int64, apiKeyID *int64) (db.InferenceLog, error)
+	ListInferenceLogs(ctx context.Context, arg db.ListInferenceLogsParams) ([]db.InferenceLog, error)
+	// AfterInferenceLogWritten calls fn once log id is stored. Work that reads
+	// the log back, such as opening a review case, goes through it.
+	AfterInferenceLogWritten(ctx context.Context, id int64, fn func(ctx context.Context))
 }
 
 type postgresInferenceLogRepository struct {
@@ -18,6 +28,40 @@ func NewInferenceLogRepository(q db.Querier) InferenceLogRepository {
 	return &postgresInferenceLogRepository{q: q}
 }
 
-func (r *postgresInferenceLogRepository) CreateInferenceLog(ctx context.Context, arg db.CreateInferenceLogParams) error {
+func (r *postgresInferenceLogRepository) CreateInferenceLog(ctx context.Context, arg db.CreateInferenceLogParams) (int64, error) {
 	return r.q.CreateInferenceLog(ctx, arg)
 }
+
+// AfterInferenceLogWritten calls fn at once: CreateInferenceLog has stored the
+// log before returning its id.
+func (r *postgresInferenceLogRepository) AfterInferenceLogWritten(ctx context.Context, id int64, fn func(ctx context.Context)) {
+	fn(ctx)
+}
+
+func (r *postgresInferenceLogRepository) UpdateInferenceLogShadow(ctx context.Context, arg db.UpdateInferenceLogShadowParams) error {
+	return r.q.UpdateInferenceLogShadow(ctx, arg)
+}
+
+func (r *postgresInferenceLogRepository) ListShadowComparisons(ctx context.Context, userID int64, from, to time.Time) ([]db.ListShadowComparisonsRow, error) {
+	params := db.ListShadowComparisonsParams{
+		UserID:   userID,
+		FromTime: from,
+		ToTime:   to,
+	}
+	return r.q.ListShadowComparisons(ctx, params)
+}
+
+func (r *postgresInferenceLogRepository) GetInferenceLog(ctx context.Context, id, userID int64, apiKeyID *int64) (db.InferenceLog, error) {
+	params := db.GetInferenceLogParams{
+		ID:     id,
+		UserID: userID,
+	}
+	if apiKeyID != nil {
+		params.ApiKeyID = sql.NullInt64{Int64: *apiKeyID, Valid: true}
+	}
+	return r.q.GetInferenceLog(ctx, params)
+}
+
+func (r *postgresInferenceLogRepository) ListInferenceLogs(ctx context.Context, arg db.ListInferenceLogsParams) ([]db.InferenceLog, error) {
+	return r.q.ListInferenceLogs(ctx, arg)
+}
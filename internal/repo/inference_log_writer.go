@@ -0,0 +1,630 @@
+package repo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+// Overflow policies of the inference log writer, applied when its queue is
+// full.
+const (
+	// OverflowBlock makes the caller wait up to BlockTimeout for room in the
+	// queue, then drops the log.
+	OverflowBlock = "block"
+	// OverflowSpill appends the log to a file in SpillDir, written to the
+	// database once the queue has drained.
+	OverflowSpill = "spill"
+	// OverflowDrop drops the log.
+	OverflowDrop = "drop"
+)
+
+const (
+	spillFileName   = "inference_logs.spill"
+	replayFileName  = "inference_logs.replay"
+	maxFlushRetries = 3
+)
+
+var (
+	inferenceLogQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "inference_log_queue_depth",
+		Help: "Number of inference logs waiting to be written.",
+	})
+	inferenceLogsWritten = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "inference_logs_written_total",
+		Help: "Number of inference logs written by the batched writer.",
+	})
+	inferenceLogsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "inference_logs_dropped_total",
+		Help: "Number of inference logs that were never written, by reason.",
+	}, []string{"reason"})
+	inferenceLogsSpilled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "inference_logs_spilled_total",
+		Help: "Number of inference logs spilled to disk.",
+	})
+)
+
+// InferenceLogBatchStore is the subset of the queries used by the writer.
+type InferenceLogBatchStore interface {
+	ReserveInferenceLogIDs(ctx context.Context, count int32) ([]int64, error)
+	InsertInferenceLogs(ctx context.Context, rows []db.InsertInferenceLogParams) error
+}
+
+// InferenceLogWriterSettings configures the batched writer. SpillDir is
+// required by OverflowSpill; with the other policies it is only used to keep
+// the logs that could not be written at shutdown or after repeated failures.
+type InferenceLogWriterSettings struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+	Overflow      string
+	BlockTimeout  time.Duration
+	SpillDir      string
+}
+
+// InferenceLogWriter is an InferenceLogRepository that takes inference log
+// writes off the request path. CreateInferenceLog queues the log with an id
+// reserved in advance from the sequence and returns at once; a background
+// goroutine writes the queue in batches of BatchSize, or every FlushInterval.
+// Another one keeps at least BatchSize ids reserved, so CreateInferenceLog
+// never waits for the database. When none are left, as while Postgres is
+// down, the log is queued without an id and 0 is returned.
+//
+// Logs are only readable once written. Shadow results that arrive before then
+// are written with their log, and AfterInferenceLogWritten callbacks run once
+// it is written. The id of a log that is dropped names no row; its callbacks
+// never run.
+type InferenceLogWriter struct {
+	InferenceLogRepository
+	store    InferenceLogBatchStore
+	settings InferenceLogWriterSettings
+	logger   zerolog.Logger
+
+	queue  chan db.InsertInferenceLogParams
+	done   chan struct{}
+	refill chan struct{}
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// ids are reserved and not yet used.
+	ids []int64
+	// pending holds the queued, spilled and in-flight logs by id.
+	pending map[int64]*pendingLog
+	// retry is the batch that failed when run stopped, written by Close.
+	retry []db.InsertInferenceLogParams
+
+	// closeMu is held for reading while a log is queued, so that Close only
+	// drains the queue once no more logs can be added.
+	closeMu sync.RWMutex
+	closed  bool
+	spillMu sync.Mutex
+}
+
+// pendingLog is what is left to do once a log is written.
+type pendingLog struct {
+	// shadow is a shadow result to write with the log.
+	shadow *db.UpdateInferenceLogShadowParams
+	after  []func(ctx context.Context)
+}
+
+func NewInferenceLogWriter(inner InferenceLogRepository, store InferenceLogBatchStore, settings InferenceLogWriterSettings, logger zerolog.Logger) (*InferenceLogWriter, error) {
+	switch settings.Overflow {
+	case "":
+		settings.Overflow = OverflowBlock
+	case OverflowBlock, OverflowDrop:
+	case OverflowSpill:
+		if settings.SpillDir == "" {
+			return nil, errors.New("the spill overflow policy requires a spill directory")
+		}
+	default:
+		return nil, fmt.Errorf("unknown inference log overflow policy %q", settings.Overflow)
+	}
+	if settings.SpillDir != "" {
+		if err := os.MkdirAll(settings.SpillDir, 0o750); err != nil {
+			return nil, err
+		}
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = 500
+	}
+	if settings.QueueSize <= 0 {
+		settings.QueueSize = 10000
+	}
+	if settings.QueueSize < settings.BatchSize {
+		settings.QueueSize = settings.BatchSize
+	}
+	if settings.FlushInterval <= 0 {
+		settings.FlushInterval = time.Second
+	}
+
+	w := &InferenceLogWriter{
+		InferenceLogRepository: inner,
+		store:                  store,
+		settings:               settings,
+		logger:                 logger,
+		queue:                  make(chan db.InsertInferenceLogParams, settings.QueueSize),
+		done:                   make(chan struct{}),
+		refill:                 make(chan struct{}, 1),
+		pending:                make(map[int64]*pendingLog),
+	}
+	// The first ids are reserved before serving; if that fails, the
+	// background goroutine keeps trying.
+	if err := w.reserveIDs(2 * settings.BatchSize); err != nil {
+		logger.Warn().Err(err).Msg("failed to reserve inference log ids")
+	}
+	w.refill <- struct{}{}
+
+	w.wg.Add(2)
+	go w.run()
+	go w.reserve()
+	return w, nil
+}
+
+// CreateInferenceLog queues arg and returns its id, or 0 if no id could be
+// reserved, in which case the database assigns one.
+func (w *InferenceLogWriter) CreateInferenceLog(ctx context.Context, arg db.CreateInferenceLogParams) (int64, error) {
+	w.closeMu.RLock()
+	defer w.closeMu.RUnlock()
+	if w.closed {
+		return 0, ErrInferenceLogWriterClosed
+	}
+
+	row := db.InsertInferenceLogParams{ID: w.takeID(), CreateInferenceLogParams: arg}
+	if row.ID != 0 {
+		w.mu.Lock()
+		w.pending[row.ID] = &pendingLog{}
+		w.mu.Unlock()
+	}
+	if w.enqueue(ctx, row) {
+		return row.ID, nil
+	}
+	if w.settings.Overflow == OverflowSpill {
+		if err := w.spill([]db.InsertInferenceLogParams{row}); err == nil {
+			return row.ID, nil
+		}
+	}
+
+	w.mu.Lock()
+	delete(w.pending, row.ID)
+	w.mu.Unlock()
+	inferenceLogsDropped.WithLabelValues("queue_full").Inc()
+	return 0, ErrInferenceLogDropped
+}
+
+func (w *InferenceLogWriter) enqueue(ctx context.Context, row db.InsertInferenceLogParams) bool {
+	select {
+	case w.queue <- row:
+		inferenceLogQueueDepth.Set(float64(len(w.queue)))
+		return true
+	default:
+	}
+	if w.settings.Overflow != OverflowBlock {
+		return false
+	}
+
+	timer := time.NewTimer(w.settings.BlockTimeout)
+	defer timer.Stop()
+	select {
+	case w.queue <- row:
+		inferenceLogQueueDepth.Set(float64(len(w.queue)))
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// UpdateInferenceLogShadow keeps the shadow result of a log that is not written
+// yet to write it with the log.
+func (w *InferenceLogWriter) UpdateInferenceLogShadow(ctx context.Context, arg db.UpdateInferenceLogShadowParams) error {
+	w.mu.Lock()
+	if p, ok := w.pending[arg.ID]; ok {
+		p.shadow = &arg
+		w.mu.Unlock()
+		return nil
+	}
+	w.mu.Unlock()
+	return w.InferenceLogRepository.UpdateInferenceLogShadow(ctx, arg)
+}
+
+// AfterInferenceLogWritten keeps fn until the log is written, or calls it now
+// if the log is already written. fn is dropped with the log.
+func (w *InferenceLogWriter) AfterInferenceLogWritten(ctx context.Context, id int64, fn func(ctx context.Context)) {
+	w.mu.Lock()
+	if p, ok := w.pending[id]; ok {
+		p.after = append(p.after, fn)
+		w.mu.Unlock()
+		return
+	}
+	w.mu.Unlock()
+	fn(ctx)
+}
+
+// takeID returns a reserved id, or 0 if none is left, and wakes the reserve
+// goroutine when the reserved ids run low.
+func (w *InferenceLogWriter) takeID() int64 {
+	w.mu.Lock()
+	var id int64
+	if len(w.ids) > 0 {
+		id = w.ids[0]
+		w.ids = w.ids[1:]
+	}
+	low := len(w.ids) < w.settings.BatchSize
+	w.mu.Unlock()
+
+	if low {
+		select {
+		case w.refill <- struct{}{}:
+		default:
+		}
+	}
+	return id
+}
+
+// reserve tops the reserved ids up to twice BatchSize whenever takeID asks,
+// retrying every FlushInterval while the database is unavailable.
+func (w *InferenceLogWriter) reserve() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.refill:
+		}
+
+		w.mu.Lock()
+		missing := 2*w.settings.BatchSize - len(w.ids)
+		w.mu.Unlock()
+		if missing <= 0 {
+			continue
+		}
+		if err := w.reserveIDs(missing); err != nil {
+			w.logger.Warn().Err(err).Msg("failed to reserve inference log ids")
+			select {
+			case <-w.done:
+				return
+			case <-time.After(w.settings.FlushInterval):
+			}
+			select {
+			case w.refill <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (w *InferenceLogWriter) reserveIDs(count int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ids, err := w.store.ReserveInferenceLogIDs(ctx, int32(count))
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.ids = append(w.ids, ids...)
+	w.mu.Unlock()
+	return nil
+}
+
+// Close stops accepting logs and writes the queued ones until ctx is done.
+// Logs left over are spilled if a spill directory is set and dropped
+// otherwise.
+func (w *InferenceLogWriter) Close(ctx context.Context) error {
+	w.closeMu.Lock()
+	if w.closed {
+		w.closeMu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.closeMu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+
+	var rest []db.InsertInferenceLogParams
+	batch := w.retry
+	if len(batch) == 0 {
+		batch = w.nextBatch()
+	}
+	for ; len(batch) > 0; batch = w.nextBatch() {
+		remaining, err := w.write(ctx, batch)
+		if err != nil {
+			rest = append(rest, remaining...)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	for len(w.queue) > 0 {
+		rest = append(rest, <-w.queue)
+	}
+	inferenceLogQueueDepth.Set(0)
+	if len(rest) == 0 {
+		return nil
+	}
+
+	if w.settings.SpillDir != "" {
+		if err := w.spill(w.withShadows(rest)); err == nil {
+			w.logger.Warn().Int("logs", len(rest)).Msg("spilled unwritten inference logs at shutdown")
+			return nil
+		}
+	}
+	inferenceLogsDropped.WithLabelValues("shutdown").Add(float64(len(rest)))
+	return fmt.Errorf("dropped %d unwritten inference logs", len(rest))
+}
+
+// run writes the queue until Close. A batch that fails is retried before the
+// next one; after maxFlushRetries it is spilled if a spill directory is set.
+func (w *InferenceLogWriter) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.settings.FlushInterval)
+	defer ticker.Stop()
+
+	w.replaySpill()
+
+	var retry []db.InsertInferenceLogParams
+	failures := 0
+	for {
+		select {
+		case <-w.done:
+			// Close writes whatever is left, including the failed batch.
+			w.retry = retry
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			batch := retry
+			if batch == nil {
+				batch = w.nextBatch()
+			}
+			if len(batch) == 0 {
+				w.replaySpill()
+				break
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), w.settings.FlushInterval+5*time.Second)
+			remaining, err := w.write(ctx, batch)
+			cancel()
+			if err == nil {
+				retry, failures = nil, 0
+				if len(batch) < w.settings.BatchSize {
+					break
+				}
+				continue
+			}
+
+			failures++
+			w.logger.Error().Err(err).Int("logs", len(remaining)).Int("attempt", failures).Msg("failed to write inference logs")
+			retry = remaining
+			if failures >= maxFlushRetries && w.settings.SpillDir != "" {
+				if err := w.spill(w.withShadows(remaining)); err == nil {
+					retry, failures = nil, 0
+				}
+			}
+			break
+		}
+	}
+}
+
+// nextBatch takes up to BatchSize logs from the queue.
+func (w *InferenceLogWriter) nextBatch() []db.InsertInferenceLogParams {
+	var batch []db.InsertInferenceLogParams
+	for len(batch) < w.settings.BatchSize {
+		select {
+		case row := <-w.queue:
+			batch = append(batch, row)
+			continue
+		default:
+		}
+		break
+	}
+	inferenceLogQueueDepth.Set(float64(len(w.queue)))
+	return batch
+}
+
+// write inserts batch with the shadow results received so far. If the batch is
+// rejected by a constraint, e.g. because the API key was deleted meanwhile,
+// the logs are written one by one and the rejected ones dropped. It returns the
+// logs left to write on error.
+func (w *InferenceLogWriter) write(ctx context.Context, batch []db.InsertInferenceLogParams) ([]db.InsertInferenceLogParams, error) {
+	rows := w.withShadows(batch)
+	err := w.store.InsertInferenceLogs(ctx, rows)
+	if err != nil && isIntegrityViolation(err) {
+		for i, row := range rows {
+			err = w.store.InsertInferenceLogs(ctx, rows[i:i+1])
+			if err != nil && isIntegrityViolation(err) {
+				w.logger.Error().Err(err).Int64("inference_log_id", row.ID).Msg("dropped rejected inference log")
+				inferenceLogsDropped.WithLabelValues("rejected").Inc()
+				w.mu.Lock()
+				delete(w.pending, row.ID)
+				w.mu.Unlock()
+				continue
+			}
+			if err != nil {
+				return batch[i:], err
+			}
+			w.written(rows[i : i+1])
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return batch, err
+	}
+	w.written(rows)
+	return nil, nil
+}
+
+// withShadows returns a copy of batch with the shadow results received so far.
+func (w *InferenceLogWriter) withShadows(batch []db.InsertInferenceLogParams) []db.InsertInferenceLogParams {
+	rows := make([]db.InsertInferenceLogParams, len(batch))
+	copy(rows, batch)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range rows {
+		if p := w.pending[rows[i].ID]; p != nil && p.shadow != nil {
+			rows[i].ShadowModel = p.shadow.ShadowModel
+			rows[i].ShadowResponsePayload = p.shadow.ShadowResponsePayload
+			rows[i].ShadowError = p.shadow.ShadowError
+		}
+	}
+	return rows
+}
+
+// written forgets the pending ids of rows, writes the shadow results that
+// arrived while they were being inserted and runs their callbacks.
+func (w *InferenceLogWriter) written(rows []db.InsertInferenceLogParams) {
+	var late []db.UpdateInferenceLogShadowParams
+	var after []func(ctx context.Context)
+	w.mu.Lock()
+	for _, row := range rows {
+		if p := w.pending[row.ID]; p != nil {
+			if p.shadow != nil && !row.ShadowModel.Valid {
+				late = append(late, *p.shadow)
+			}
+			after = append(after, p.after...)
+		}
+		delete(w.pending, row.ID)
+	}
+	w.mu.Unlock()
+	inferenceLogsWritten.Add(float64(len(rows)))
+
+	for _, shadow := range late {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := w.InferenceLogRepository.UpdateInferenceLogShadow(ctx, shadow); err != nil {
+			w.logger.Error().Err(err).Int64("inference_log_id", shadow.ID).Msg("failed to log shadow inference")
+		}
+		cancel()
+	}
+	for _, fn := range after {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		fn(ctx)
+		cancel()
+	}
+}
+
+// spill appends rows to the spill file, one JSON object per line.
+func (w *InferenceLogWriter) spill(rows []db.InsertInferenceLogParams) error {
+	w.spillMu.Lock()
+	defer w.spillMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(w.settings.SpillDir, spillFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		w.logger.Error().Err(err).Msg("failed to open inference log spill file")
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	for _, row := range rows {
+		if err = enc.Encode(row); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		w.logger.Error().Err(err).Msg("failed to spill inference logs")
+		return err
+	}
+	// Spilled logs stay pending: their shadow results and callbacks are
+	// applied when the spill file is replayed by this process.
+	inferenceLogsSpilled.Add(float64(len(rows)))
+	return nil
+}
+
+// replaySpill writes the spilled logs. The spill file is renamed first so that
+// logs spilled meanwhile are kept for the next replay; a replay file left by a
+// crash is written again, which is safe as existing ids are skipped.
+func (w *InferenceLogWriter) replaySpill() {
+	if w.settings.SpillDir == "" {
+		return
+	}
+	spillPath := filepath.Join(w.settings.SpillDir, spillFileName)
+	replayPath := filepath.Join(w.settings.SpillDir, replayFileName)
+
+	w.spillMu.Lock()
+	if _, err := os.Stat(replayPath); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(spillPath, replayPath); err != nil {
+			w.spillMu.Unlock()
+			return
+		}
+	}
+	w.spillMu.Unlock()
+
+	f, err := os.Open(replayPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var batch []db.InsertInferenceLogParams
+	written := 0
+	flush := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), w.settings.FlushInterval+5*time.Second)
+		defer cancel()
+		_, err := w.write(ctx, batch)
+		written += len(batch)
+		batch = batch[:0]
+		return err
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var row db.InsertInferenceLogParams
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			w.logger.Error().Err(err).Msg("skipped unreadable spilled inference log")
+			inferenceLogsDropped.WithLabelValues("rejected").Inc()
+			continue
+		}
+		batch = append(batch, row)
+		if len(batch) == w.settings.BatchSize {
+			if err := flush(); err != nil {
+				w.logger.Error().Err(err).Msg("failed to replay spilled inference logs")
+				return
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		w.logger.Error().Err(err).Msg("failed to read spilled inference logs")
+		return
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			w.logger.Error().Err(err).Msg("failed to replay spilled inference logs")
+			return
+		}
+	}
+
+	if err := os.Remove(replayPath); err != nil {
+		w.logger.Error().Err(err).Msg("failed to remove replayed inference log spill file")
+	}
+	if written > 0 {
+		w.logger.Info().Int("logs", written).Msg("replayed spilled inference logs")
+	}
+}
+
+func isIntegrityViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code)
+}
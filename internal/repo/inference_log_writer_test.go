@@ -0,0 +1,243 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryBatchStore struct {
+	mu      sync.Mutex
+	nextID  int64
+	rows    map[int64]db.InsertInferenceLogParams
+	batches int
+	fail    bool
+	// reserveErr fails the id reservations while set.
+	reserveErr error
+}
+
+func newMemoryBatchStore() *memoryBatchStore {
+	return &memoryBatchStore{rows: map[int64]db.InsertInferenceLogParams{}}
+}
+
+func (s *memoryBatchStore) ReserveInferenceLogIDs(ctx context.Context, count int32) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reserveErr != nil {
+		return nil, s.reserveErr
+	}
+	ids := make([]int64, count)
+	for i := range ids {
+		s.nextID++
+		ids[i] = s.nextID
+	}
+	return ids, nil
+}
+
+func (s *memoryBatchStore) InsertInferenceLogs(ctx context.Context, rows []db.InsertInferenceLogParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("connection refused")
+	}
+	s.batches++
+	for _, row := range rows {
+		if _, ok := s.rows[row.ID]; !ok {
+			s.rows[row.ID] = row
+		}
+	}
+	return nil
+}
+
+// shadowRecorder records the shadow updates of logs that were already written.
+type shadowRecorder struct {
+	InferenceLogRepository
+	mu      sync.Mutex
+	updates []int64
+}
+
+func (r *shadowRecorder) UpdateInferenceLogShadow(ctx context.Context, arg db.UpdateInferenceLogShadowParams) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, arg.ID)
+	return nil
+}
+
+func logParams(userID int64) db.CreateInferenceLogParams {
+	return db.CreateInferenceLogParams{
+		UserID:         userID,
+		RequestPayload: []byte(`{"model":"logreg"}`),
+		RequestTime:    time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestInferenceLogWriter_BatchesAndShadows(t *testing.T) {
+	store := newMemoryBatchStore()
+	inner := &shadowRecorder{}
+	// The interval is long enough that only Close writes the logs.
+	w, err := NewInferenceLogWriter(inner, store, InferenceLogWriterSettings{BatchSize: 2, FlushInterval: time.Hour}, zerolog.Nop())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var ids []int64
+	for i := int64(1); i <= 3; i++ {
+		id, err := w.CreateInferenceLog(ctx, logParams(i))
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+
+	// The shadow result of a queued log is written with it.
+	require.NoError(t, w.UpdateInferenceLogShadow(ctx, db.UpdateInferenceLogShadowParams{
+		ID:          2,
+		ShadowModel: sql.NullString{String: "challenger", Valid: true},
+	}))
+	assert.Empty(t, inner.updates)
+
+	require.NoError(t, w.Close(ctx))
+	assert.Len(t, store.rows, 3)
+	assert.Equal(t, 2, store.batches)
+	assert.Equal(t, "challenger", store.rows[2].ShadowModel.String)
+	assert.Equal(t, int64(3), store.rows[3].UserID)
+
+	// Written logs are updated in place.
+	require.NoError(t, w.UpdateInferenceLogShadow(ctx, db.UpdateInferenceLogShadowParams{ID: 1}))
+	assert.Equal(t, []int64{1}, inner.updates)
+
+	_, err = w.CreateInferenceLog(ctx, logParams(4))
+	assert.ErrorIs(t, err, ErrInferenceLogWriterClosed)
+}
+
+func TestInferenceLogWriter_ReservesIDsAhead(t *testing.T) {
+	store := newMemoryBatchStore()
+	store.reserveErr = errors.New("connection refused")
+	w, err := NewInferenceLogWriter(&shadowRecorder{}, store, InferenceLogWriterSettings{BatchSize: 2, FlushInterval: 10 * time.Millisecond}, zerolog.Nop())
+	require.NoError(t, err)
+
+	// Without reserved ids the log is queued without one.
+	ctx := context.Background()
+	id, err := w.CreateInferenceLog(ctx, logParams(1))
+	require.NoError(t, err)
+	assert.Zero(t, id)
+
+	// Ids are reserved in the background once the database is back.
+	store.mu.Lock()
+	store.reserveErr = nil
+	store.mu.Unlock()
+	require.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.ids) == 4
+	}, time.Second, 10*time.Millisecond)
+	id, err = w.CreateInferenceLog(ctx, logParams(2))
+	require.NoError(t, err)
+	assert.NotZero(t, id)
+	require.NoError(t, w.Close(ctx))
+	assert.Len(t, store.rows, 2)
+}
+
+func TestInferenceLogWriter_AfterWritten(t *testing.T) {
+	store := newMemoryBatchStore()
+	w, err := NewInferenceLogWriter(&shadowRecorder{}, store, InferenceLogWriterSettings{BatchSize: 2, FlushInterval: time.Hour}, zerolog.Nop())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	id, err := w.CreateInferenceLog(ctx, logParams(1))
+	require.NoError(t, err)
+
+	// The callback of a queued log waits until the log is stored.
+	var calls []int
+	w.AfterInferenceLogWritten(ctx, id, func(ctx context.Context) {
+		_, stored := store.rows[id]
+		assert.True(t, stored)
+		calls = append(calls, 1)
+	})
+	assert.Empty(t, calls)
+	require.NoError(t, w.Close(ctx))
+	assert.Equal(t, []int{1}, calls)
+
+	// Written logs run it at once.
+	w.AfterInferenceLogWritten(ctx, id, func(ctx context.Context) {
+		calls = append(calls, 2)
+	})
+	assert.Equal(t, []int{1, 2}, calls)
+}
+
+func TestInferenceLogWriter_SpillAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	store := newMemoryBatchStore()
+	settings := InferenceLogWriterSettings{
+		BatchSize:     1,
+		QueueSize:     1,
+		FlushInterval: time.Hour,
+		Overflow:      OverflowSpill,
+		SpillDir:      dir,
+	}
+	w, err := NewInferenceLogWriter(&shadowRecorder{}, store, settings, zerolog.Nop())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = w.CreateInferenceLog(ctx, logParams(1))
+	require.NoError(t, err)
+	// The queue is full, so the second log goes to the spill file, which is
+	// replayed once the queue is empty.
+	spilled, err := w.CreateInferenceLog(ctx, logParams(2))
+	require.NoError(t, err)
+	require.NoError(t, w.Close(ctx))
+
+	settings.FlushInterval = 10 * time.Millisecond
+	w, err = NewInferenceLogWriter(&shadowRecorder{}, store, settings, zerolog.Nop())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.rows) == 2
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, w.Close(ctx))
+	assert.Equal(t, int64(2), store.rows[spilled].UserID)
+	assert.Equal(t, []byte(`{"model":"logreg"}`), []byte(store.rows[spilled].RequestPayload))
+	for _, name := range []string{spillFileName, replayFileName} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestInferenceLogWriter_Overflow(t *testing.T) {
+	store := newMemoryBatchStore()
+	store.fail = true
+	w, err := NewInferenceLogWriter(&shadowRecorder{}, store, InferenceLogWriterSettings{
+		BatchSize:     1,
+		QueueSize:     1,
+		FlushInterval: time.Hour,
+		Overflow:      OverflowBlock,
+		BlockTimeout:  10 * time.Millisecond,
+	}, zerolog.Nop())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = w.CreateInferenceLog(ctx, logParams(1))
+	require.NoError(t, err)
+	_, err = w.CreateInferenceLog(ctx, logParams(2))
+	assert.ErrorIs(t, err, ErrInferenceLogDropped)
+
+	// Without a spill directory, the logs that cannot be written are dropped.
+	assert.Error(t, w.Close(ctx))
+	assert.Empty(t, store.rows)
+}
+
+func TestNewInferenceLogWriter_InvalidSettings(t *testing.T) {
+	_, err := NewInferenceLogWriter(&shadowRecorder{}, newMemoryBatchStore(), InferenceLogWriterSettings{Overflow: OverflowSpill}, zerolog.Nop())
+	assert.Error(t, err)
+	_, err = NewInferenceLogWriter(&shadowRecorder{}, newMemoryBatchStore(), InferenceLogWriterSettings{Overflow: "retry"}, zerolog.Nop())
+	assert.Error(t, err)
+}
@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+// RunExclusive runs fn while holding the Postgres session advisory lock of
+// name, so that one instance at a time runs it. It reports false without
+// running fn if another session holds the lock.
+func RunExclusive(ctx context.Context, conn *sql.DB, name string, fn func(context.Context) error) (bool, error) {
+	session, err := conn.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	q := db.New(session)
+	locked, err := q.TryAdvisoryLock(ctx, name)
+	if err != nil || !locked {
+		return false, err
+	}
+	defer func() {
+		_ = q.ReleaseAdvisoryLock(context.WithoutCancel(ctx), name)
+	}()
+	return true, fn(ctx)
+}
@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+type ModelMetricsRepository interface {
+	// ListLabeledScoreCounts counts the labeled predictions requested in
+	// [from, to) in buckets of bucket aligned on from.
+	ListLabeledScoreCounts(ctx context.Context, from, to time.Time, bucket time.Duration) ([]db.ListLabeledScoreCountsRow, error)
+	ListModelMetrics(ctx context.Context, from, to time.Time, modelName string) ([]db.ModelMetric, error)
+	UpsertModelMetrics(ctx context.Context, arg db.UpsertModelMetricsParams) error
+	DeleteModelMetricsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type postgresModelMetricsRepository struct {
+	q db.Querier
+}
+
+func NewModelMetricsRepository(q db.Querier) ModelMetricsRepository {
+	return &postgresModelMetricsRepository{q: q}
+}
+
+func (r *postgresModelMetricsRepository) ListLabeledScoreCounts(ctx context.Context, from, to time.Time, bucket time.Duration) ([]db.ListLabeledScoreCountsRow, error) {
+	params := db.ListLabeledScoreCountsParams{
+		BucketSeconds: bucket.Seconds(),
+		FromTime:      from,
+		ToTime:        to,
+	}
+	return r.q.ListLabeledScoreCounts(ctx, params)
+}
+
+// ListModelMetrics returns the metrics of every model if modelName is empty.
+func (r *postgresModelMetricsRepository) ListModelMetrics(ctx context.Context, from, to time.Time, modelName string) ([]db.ModelMetric, error) {
+	params := db.ListModelMetricsParams{
+		FromTime:  from,
+		ToTime:    to,
+		ModelName: sql.NullString{String: modelName, Valid: modelName != ""},
+	}
+	return r.q.ListModelMetrics(ctx, params)
+}
+
+func (r *postgresModelMetricsRepository) UpsertModelMetrics(ctx context.Context, arg db.UpsertModelMetricsParams) error {
+	return r.q.UpsertModelMetrics(ctx, arg)
+}
+
+func (r *postgresModelMetricsRepository) DeleteModelMetricsBefore(ctx context.Context, before time.Time) (int64, error) {
+	return r.q.DeleteModelMetricsBefore(ctx, before)
+}
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+// PredictionJobRepository stores the prediction jobs and their results, one
+// row per item. The renew, complete and release methods store the results
+// passed along, each a JSON array of item results, in the same transaction as
+// the progress of the job, and only while the job still has the lease.
+type PredictionJobRepository interface {
+	CreatePredictionJob(ctx context.Context, arg db.CreatePredictionJobParams) (db.CreatePredictionJobRow, error)
+	GetPredictionJob(ctx context.Context, id uuid.UUID, userID int64) (db.GetPredictionJobRow, error)
+	ListPredictionJobResults(ctx context.Context, jobID uuid.UUID, fromIndex, maxRows int32) ([]db.PredictionJobResult, error)
+	ClaimPredictionJob(ctx context.Context, id uuid.UUID, leaseExpiresAt time.Time) (db.ClaimPredictionJobRow, error)
+	// RenewPredictionJobLease returns 0 if the job no longer has the lease.
+	RenewPredictionJobLease(ctx context.Context, arg db.RenewPredictionJobLeaseParams, results []json.RawMessage) (int64, error)
+	CompletePredictionJob(ctx context.Context, arg db.CompletePredictionJobParams, results []json.RawMessage) error
+	FailPredictionJob(ctx context.Context, arg db.FailPredictionJobParams) error
+	ReleasePredictionJob(ctx context.Context, arg db.ReleasePredictionJobParams, results []json.RawMessage) error
+	ListResumablePredictionJobs(ctx context.Context, queuedBefore time.Time) ([]uuid.UUID, error)
+}
+
+type postgresPredictionJobRepository struct {
+	conn *sql.DB
+	q    db.Querier
+}
+
+func NewPredictionJobRepository(conn *sql.DB) PredictionJobRepository {
+	return &postgresPredictionJobRepository{conn: conn, q: db.New(conn)}
+}
+
+func (r *postgresPredictionJobRepository) CreatePredictionJob(ctx context.Context, arg db.CreatePredictionJobParams) (db.CreatePredictionJobRow, error) {
+	return r.q.CreatePredictionJob(ctx, arg)
+}
+
+func (r *postgresPredictionJobRepository) GetPredictionJob(ctx context.Context, id uuid.UUID, userID int64) (db.GetPredictionJobRow, error) {
+	return r.q.GetPredictionJob(ctx, db.GetPredictionJobParams{ID: id, UserID: userID})
+}
+
+func (r *postgresPredictionJobRepository) ListPredictionJobResults(ctx context.Context, jobID uuid.UUID, fromIndex, maxRows int32) ([]db.PredictionJobResult, error) {
+	params := db.ListPredictionJobResultsParams{
+		JobID:     jobID,
+		FromIndex: fromIndex,
+		MaxRows:   maxRows,
+	}
+	return r.q.ListPredictionJobResults(ctx, params)
+}
+
+func (r *postgresPredictionJobRepository) ClaimPredictionJob(ctx context.Context, id uuid.UUID, leaseExpiresAt time.Time) (db.ClaimPredictionJobRow, error) {
+	params := db.ClaimPredictionJobParams{
+		ID:             id,
+		LeaseExpiresAt: sql.NullTime{Time: leaseExpiresAt, Valid: true},
+	}
+	return r.q.ClaimPredictionJob(ctx, params)
+}
+
+func (r *postgresPredictionJobRepository) RenewPredictionJobLease(ctx context.Context, arg db.RenewPredictionJobLeaseParams, results []json.RawMessage) (int64, error) {
+	var n int64
+	err := inTx(ctx, r.conn, func(q *db.Queries) error {
+		var err error
+		if n, err = q.RenewPredictionJobLease(ctx, arg); err != nil || n == 0 {
+			return err
+		}
+		return saveJobResults(ctx, q, arg.ID, results)
+	})
+	return n, err
+}
+
+func (r *postgresPredictionJobRepository) CompletePredictionJob(ctx context.Context, arg db.CompletePredictionJobParams, results []json.RawMessage) error {
+	return inTx(ctx, r.conn, func(q *db.Queries) error {
+		n, err := q.CompletePredictionJob(ctx, arg)
+		if err != nil || n == 0 {
+			return err
+		}
+		return saveJobResults(ctx, q, arg.ID, results)
+	})
+}
+
+func (r *postgresPredictionJobRepository) FailPredictionJob(ctx context.Context, arg db.FailPredictionJobParams) error {
+	return r.q.FailPredictionJob(ctx, arg)
+}
+
+func (r *postgresPredictionJobRepository) ReleasePredictionJob(ctx context.Context, arg db.ReleasePredictionJobParams, results []json.RawMessage) error {
+	return inTx(ctx, r.conn, func(q *db.Queries) error {
+		n, err := q.ReleasePredictionJob(ctx, arg)
+		if err != nil || n == 0 {
+			return err
+		}
+		return saveJobResults(ctx, q, arg.ID, results)
+	})
+}
+
+func saveJobResults(ctx context.Context, q *db.Queries, jobID uuid.UUID, results []json.RawMessage) error {
+	for _, chunk := range results {
+		if err := q.SavePredictionJobResults(ctx, db.SavePredictionJobResultsParams{JobID: jobID, Results: chunk}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *postgresPredictionJobRepository) ListResumablePredictionJobs(ctx context.Context, queuedBefore time.Time) ([]uuid.UUID, error) {
+	return r.q.ListResumablePredictionJobs(ctx, queuedBefore)
+}
@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+type ReplayRepository interface {
+	CountReplayLogs(ctx context.Context, arg db.CountReplayLogsParams) (int64, error)
+	CreateReplayRun(ctx context.Context, arg db.CreateReplayRunParams) (db.ReplayRun, error)
+	GetReplayRun(ctx context.Context, id int64) (db.ReplayRun, error)
+	ListReplayRuns(ctx context.Context, limit int32) ([]db.ReplayRun, error)
+	ClaimReplayRun(ctx context.Context, id int64, leaseExpiresAt time.Time) (db.ReplayRun, error)
+	ListReplayLogs(ctx context.Context, arg db.ListReplayLogsParams) ([]db.ListReplayLogsRow, error)
+	InsertReplayResult(ctx context.Context, arg db.InsertReplayResultParams) error
+	UpdateReplayRunProgress(ctx context.Context, arg db.UpdateReplayRunProgressParams) error
+	CompleteReplayRun(ctx context.Context, id int64) error
+	FailReplayRun(ctx context.Context, id int64, reason string) error
+	ReleaseReplayRun(ctx context.Context, id int64) error
+	ListResumableReplayRuns(ctx context.Context) ([]int64, error)
+	ListReplayComparisons(ctx context.Context, runID int64) ([]db.ListReplayComparisonsRow, error)
+	ListReplayChanges(ctx context.Context, runID int64, limit int32) ([]db.ListReplayChangesRow, error)
+}
+
+type postgresReplayRepository struct {
+	q db.Querier
+}
+
+func NewReplayRepository(q db.Querier) ReplayRepository {
+	return &postgresReplayRepository{q: q}
+}
+
+func (r *postgresReplayRepository) CountReplayLogs(ctx context.Context, arg db.CountReplayLogsParams) (int64, error) {
+	return r.q.CountReplayLogs(ctx, arg)
+}
+
+func (r *postgresReplayRepository) CreateReplayRun(ctx context.Context, arg db.CreateReplayRunParams) (db.ReplayRun, error) {
+	return r.q.CreateReplayRun(ctx, arg)
+}
+
+func (r *postgresReplayRepository) GetReplayRun(ctx context.Context, id int64) (db.ReplayRun, error) {
+	return r.q.GetReplayRun(ctx, id)
+}
+
+func (r *postgresReplayRepository) ListReplayRuns(ctx context.Context, limit int32) ([]db.ReplayRun, error) {
+	return r.q.ListReplayRuns(ctx, limit)
+}
+
+func (r *postgresReplayRepository) ClaimReplayRun(ctx context.Context, id int64, leaseExpiresAt time.Time) (db.ReplayRun, error) {
+	params := db.ClaimReplayRunParams{
+		ID:             id,
+		LeaseExpiresAt: sql.NullTime{Time: leaseExpiresAt, Valid: true},
+	}
+	return r.q.ClaimReplayRun(ctx, params)
+}
+
+// ListReplayLogs returns the next batch of at most arg.MaxRows logs after
+// arg.AfterID.
+func (r *postgresReplayRepository) ListReplayLogs(ctx context.Context, arg db.ListReplayLogsParams) ([]db.ListReplayLogsRow, error) {
+	return r.q.ListReplayLogs(ctx, arg)
+}
+
+func (r *postgresReplayRepository) InsertReplayResult(ctx context.Context, arg db.InsertReplayResultParams) error {
+	return r.q.InsertReplayResult(ctx, arg)
+}
+
+func (r *postgresReplayRepository) UpdateReplayRunProgress(ctx context.Context, arg db.UpdateReplayRunProgressParams) error {
+	return r.q.UpdateReplayRunProgress(ctx, arg)
+}
+
+func (r *postgresReplayRepository) CompleteReplayRun(ctx context.Context, id int64) error {
+	return r.q.CompleteReplayRun(ctx, id)
+}
+
+func (r *postgresReplayRepository) FailReplayRun(ctx context.Context, id int64, reason string) error {
+	return r.q.FailReplayRun(ctx, db.FailReplayRunParams{ID: id, Error: sql.NullString{String: reason, Valid: true}})
+}
+
+func (r *postgresReplayRepository) ReleaseReplayRun(ctx context.Context, id int64) error {
+	return r.q.ReleaseReplayRun(ctx, id)
+}
+
+func (r *postgresReplayRepository) ListResumableReplayRuns(ctx context.Context) ([]int64, error) {
+	return r.q.ListResumableReplayRuns(ctx)
+}
+
+func (r *postgresReplayRepository) ListReplayComparisons(ctx context.Context, runID int64) ([]db.ListReplayComparisonsRow, error) {
+	return r.q.ListReplayComparisons(ctx, runID)
+}
+
+func (r *postgresReplayRepository) ListReplayChanges(ctx context.Context, runID int64, limit int32) ([]db.ListReplayChangesRow, error) {
+	return r.q.ListReplayChanges(ctx, db.ListReplayChangesParams{RunID: runID, MaxRows: limit})
+}
@@ -0,0 +1,25 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+// inTx runs fn with queries bound to a transaction on conn. The transaction is
+// committed if fn succeeds and rolled back otherwise.
+func inTx(ctx context.Context, conn *sql.DB, fn func(q *db.Queries) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := fn(db.New(conn).WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+)
+
+type WebhookRepository interface {
+	CreateWebhookEndpoint(ctx context.Context, arg db.CreateWebhookEndpointParams) (db.WebhookEndpoint, error)
+	ListWebhookEndpoints(ctx context.Context, userID int64) ([]db.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, id, userID int64) error
+	EnqueueWebhookDeliveries(ctx context.Context, arg db.EnqueueWebhookDeliveriesParams) error
+	ClaimWebhookDeliveries(ctx context.Context, leaseUntil time.Time, maxRows int32) ([]db.ClaimWebhookDeliveriesRow, error)
+	MarkWebhookDelivered(ctx context.Context, id int64, statusCode int) error
+	ScheduleWebhookRetry(ctx context.Context, arg db.ScheduleWebhookRetryParams) error
+	ListWebhookDeliveries(ctx context.Context, endpointID, userID int64, from, to time.Time, status string) ([]db.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, id, userID int64) (db.WebhookDelivery, error)
+	GetWebhookDeliveryLease(ctx context.Context, id, userID int64) (sql.NullTime, error)
+}
+
+type postgresWebhookRepository struct {
+	q db.Querier
+}
+
+func NewWebhookRepository(q db.Querier) WebhookRepository {
+	return &postgresWebhookRepository{q: q}
+}
+
+func (r *postgresWebhookRepository) CreateWebhookEndpoint(ctx context.Context, arg db.CreateWebhookEndpointParams) (db.WebhookEndpoint, error) {
+	return r.q.CreateWebhookEndpoint(ctx, arg)
+}
+
+func (r *postgresWebhookRepository) ListWebhookEndpoints(ctx context.Context, userID int64) ([]db.WebhookEndpoint, error) {
+	return r.q.ListWebhookEndpoints(ctx, userID)
+}
+
+func (r *postgresWebhookRepository) DeleteWebhookEndpoint(ctx context.Context, id, userID int64) error {
+	return r.q.DeleteWebhookEndpoint(ctx, db.DeleteWebhookEndpointParams{ID: id, UserID: userID})
+}
+
+func (r *postgresWebhookRepository) EnqueueWebhookDeliveries(ctx context.Context, arg db.EnqueueWebhookDeliveriesParams) error {
+	return r.q.EnqueueWebhookDeliveries(ctx, arg)
+}
+
+func (r *postgresWebhookRepository) ClaimWebhookDeliveries(ctx context.Context, leaseUntil time.Time, maxRows int32) ([]db.ClaimWebhookDeliveriesRow, error) {
+	return r.q.ClaimWebhookDeliveries(ctx, db.ClaimWebhookDeliveriesParams{LeaseUntil: leaseUntil, MaxRows: maxRows})
+}
+
+func (r *postgresWebhookRepository) MarkWebhookDelivered(ctx context.Context, id int64, statusCode int) error {
+	params := db.MarkWebhookDeliveredParams{
+		ID:             id,
+		LastStatusCode: sql.NullInt32{Int32: int32(statusCode), Valid: true},
+	}
+	return r.q.MarkWebhookDelivered(ctx, params)
+}
+
+func (r *postgresWebhookRepository) ScheduleWebhookRetry(ctx context.Context, arg db.ScheduleWebhookRetryParams) error {
+	return r.q.ScheduleWebhookRetry(ctx, arg)
+}
+
+// ListWebhookDeliveries returns deliveries in every status if status is empty.
+func (r *postgresWebhookRepository) ListWebhookDeliveries(ctx context.Context, endpointID, userID int64, from, to time.Time, status string) ([]db.WebhookDelivery, error) {
+	params := db.ListWebhookDeliveriesParams{
+		EndpointID: endpointID,
+		UserID:     userID,
+		FromTime:   from,
+		ToTime:     to,
+		Status:     sql.NullString{String: status, Valid: status != ""},
+	}
+	return r.q.ListWebhookDeliveries(ctx, params)
+}
+
+func (r *postgresWebhookRepository) RedeliverWebhookDelivery(ctx context.Context, id, userID int64) (db.WebhookDelivery, error) {
+	return r.q.RedeliverWebhookDelivery(ctx, db.RedeliverWebhookDeliveryParams{ID: id, UserID: userID})
+}
+
+func (r *postgresWebhookRepository) GetWebhookDeliveryLease(ctx context.Context, id, userID int64) (sql.NullTime, error) {
+	return r.q.GetWebhookDeliveryLease(ctx, db.GetWebhookDeliveryLeaseParams{ID: id, UserID: userID})
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/rs/zerolog"
+)
+
+// CaseStatus is the review state of a case.
+type CaseStatus string
+
+const (
+	CaseStatusOpen     CaseStatus = "open"
+	CaseStatusResolved CaseStatus = "resolved"
+)
+
+// CaseReason records why a prediction was sent to manual review.
+type CaseReason string
+
+const (
+	// CaseReasonFlagged is used when the prediction was fraud.
+	CaseReasonFlagged CaseReason = "flagged"
+	// CaseReasonReview is used when the score fell in the review band of the
+	// decision policy.
+	CaseReasonReview CaseReason = "review"
+)
+
+// CaseLabelSource is the feedback label source of resolved cases.
+const CaseLabelSource = "case_review"
+
+var (
+	// ErrCaseNotFound is returned when the case does not exist or belongs to
+	// another user.
+	ErrCaseNotFound = errors.New("case not found")
+	ErrCaseResolved = errors.New("case is already resolved")
+	ErrInvalidCase  = errors.New("invalid case update")
+)
+
+// Case is a flagged prediction waiting for, or closed by, an analyst.
+type Case struct {
+	ID            int64         `json:"id"`
+	InferenceID   int64         `json:"inference_id"`
+	TransactionID string        `json:"transaction_id,omitempty"`
+	ModelName     string        `json:"model_name"`
+	Score         float64       `json:"score"`
+	Decision      Decision      `json:"decision"`
+	Reason        CaseReason    `json:"reason"`
+	Status        CaseStatus    `json:"status"`
+	Assignee      string        `json:"assignee,omitempty"`
+	Resolution    FeedbackLabel `json:"resolution,omitempty"`
+	ResolvedBy    *int64        `json:"resolved_by,omitempty"`
+	ResolvedAt    *time.Time    `json:"resolved_at,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	// Comments is only set by CaseService.Get.
+	Comments []CaseComment `json:"comments,omitempty"`
+}
+
+type CaseComment struct {
+	ID        int64     `json:"id"`
+	AuthorID  int64     `json:"author_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CaseFilter selects the cases created in [From, To). Empty Status and
+// Assignee match every case.
+type CaseFilter struct {
+	From     time.Time
+	To       time.Time
+	Status   CaseStatus
+	Assignee string
+}
+
+type CaseService interface {
+	// Open creates a case for the prediction logged as logID if the model
+	// flagged it as fraud or its decision is review. Other predictions are
+	// ignored. Webhook events are sent for new cases only.
+	Open(ctx context.Context, logID int64, resp PredictResponse) error
+	List(ctx context.Context, userID int64, filter CaseFilter) ([]Case, error)
+	// Get returns the case with its comments.
+	Get(ctx context.Context, userID, id int64) (Case, error)
+	// Assign hands the case to assignee, or unassigns it if assignee is empty.
+	Assign(ctx context.Context, userID, id int64, assignee string) (Case, error)
+	Comment(ctx context.Context, userID, id int64, body string) (CaseComment, error)
+	// Resolve closes an open case and records resolution as the feedback label
+	// of its prediction. A non-empty comment is added to the case. Either all
+	// of them are stored or none is.
+	Resolve(ctx context.Context, userID, id int64, resolution FeedbackLabel, comment string) (Case, error)
+}
+
+type caseService struct {
+	caseRepo   repo.CaseRepository
+	webhookSvc WebhookService
+	logger     zerolog.Logger
+}
+
+// NewCaseService returns a CaseService. webhookSvc may be nil to disable
+// webhook events.
+func NewCaseService(caseRepo repo.CaseRepository, webhookSvc WebhookService, logger zerolog.Logger) CaseService {
+	return &caseService{caseRepo: caseRepo, webhookSvc: webhookSvc, logger: logger}
+}
+
+func (s *caseService) Open(ctx context.Context, logID int64, resp PredictResponse) error {
+	var reason CaseReason
+	switch {
+	case resp.Result.Prediction == 1:
+		reason = CaseReasonFlagged
+	case resp.Result.Decision == DecisionReview:
+		reason = CaseReasonReview
+	default:
+		return nil
+	}
+
+	row, err := s.caseRepo.CreateReviewCase(ctx, db.CreateReviewCaseParams{
+		ModelName:      resp.Meta.ModelName,
+		Score:          resp.Result.Score,
+		Decision:       string(resp.Result.Decision),
+		Reason:         string(reason),
+		InferenceLogID: logID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The prediction already has a case.
+			return nil
+		}
+		return err
+	}
+
+	c := toCase(row)
+	if reason == CaseReasonFlagged {
+		data := map[string]interface{}{
+			"inference_id":   c.InferenceID,
+			"transaction_id": c.TransactionID,
+			"model_name":     c.ModelName,
+			"score":          c.Score,
+			"decision":       c.Decision,
+			"case_id":        c.ID,
+		}
+		if resp.Result.Explanation != nil {
+			data["reason_codes"] = resp.Result.Explanation.ReasonCodes
+		}
+		s.emit(ctx, row, WebhookPredictionFlagged, data)
+	}
+	s.emit(ctx, row, WebhookCaseOpened, c)
+	return nil
+}
+
+func (s *caseService) List(ctx context.Context, userID int64, filter CaseFilter) ([]Case, error) {
+	if filter.Status != "" && filter.Status != CaseStatusOpen && filter.Status != CaseStatusResolved {
+		return nil, fmt.Errorf("%w: status must be one of [open resolved]", ErrInvalidCase)
+	}
+
+	rows, err := s.caseRepo.ListReviewCases(ctx, userID, filter.From, filter.To, string(filter.Status), filter.Assignee)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := make([]Case, len(rows))
+	for i, row := range rows {
+		cases[i] = toCase(row)
+	}
+	return cases, nil
+}
+
+func (s *caseService) Get(ctx context.Context, userID, id int64) (Case, error) {
+	row, err := s.caseRepo.GetReviewCase(ctx, id, userID)
+	if err != nil {
+		return Case{}, caseError(err)
+	}
+
+	comments, err := s.caseRepo.ListReviewCaseComments(ctx, id)
+	if err != nil {
+		return Case{}, err
+	}
+
+	c := toCase(row)
+	c.Comments = make([]CaseComment, len(comments))
+	for i, comment := range comments {
+		c.Comments[i] = toCaseComment(comment)
+	}
+	return c, nil
+}
+
+func (s *caseService) Assign(ctx context.Context, userID, id int64, assignee string) (Case, error) {
+	row, err := s.caseRepo.AssignReviewCase(ctx, id, userID, strings.TrimSpace(assignee))
+	if err != nil {
+		return Case{}, caseError(err)
+	}
+
+	c := toCase(row)
+	s.emit(ctx, row, WebhookCaseAssigned, c)
+	return c, nil
+}
+
+func (s *caseService) Comment(ctx context.Context, userID, id int64, body string) (CaseComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return CaseComment{}, fmt.Errorf("%w: body is required", ErrInvalidCase)
+	}
+	if _, err := s.caseRepo.GetReviewCase(ctx, id, userID); err != nil {
+		return CaseComment{}, caseError(err)
+	}
+
+	row, err := s.caseRepo.AddReviewCaseComment(ctx, db.AddReviewCaseCommentParams{
+		CaseID:   id,
+		AuthorID: userID,
+		Body:     body,
+	})
+	if err != nil {
+		return CaseComment{}, err
+	}
+	return toCaseComment(row), nil
+}
+
+func (s *caseService) Resolve(ctx context.Context, userID, id int64, resolution FeedbackLabel, comment string) (Case, error) {
+	if resolution != LabelFraud && resolution != LabelLegit {
+		return Case{}, fmt.Errorf("%w: resolution must be one of [fraud legit]", ErrInvalidCase)
+	}
+
+	row, err := s.caseRepo.GetReviewCase(ctx, id, userID)
+	if err != nil {
+		return Case{}, caseError(err)
+	}
+	if CaseStatus(row.Status) == CaseStatusResolved {
+		return Case{}, ErrCaseResolved
+	}
+
+	feedback := db.UpsertPredictionFeedbackParams{
+		InferenceLogID: row.InferenceLogID,
+		UserID:         userID,
+		Label:          string(resolution),
+		LabelSource:    CaseLabelSource,
+		LabeledAt:      time.Now().UTC(),
+	}
+	var closing *db.AddReviewCaseCommentParams
+	if body := strings.TrimSpace(comment); body != "" {
+		closing = &db.AddReviewCaseCommentParams{CaseID: id, AuthorID: userID, Body: body}
+	}
+
+	row, err = s.caseRepo.ResolveReviewCase(ctx, db.ResolveReviewCaseParams{
+		ID:         id,
+		UserID:     userID,
+		Resolution: sql.NullString{String: string(resolution), Valid: true},
+		ResolvedBy: sql.NullInt64{Int64: userID, Valid: true},
+	}, feedback, closing)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Resolved concurrently.
+			return Case{}, ErrCaseResolved
+		}
+		return Case{}, err
+	}
+
+	c := toCase(row)
+	s.emit(ctx, row, WebhookCaseResolved, c)
+	return c, nil
+}
+
+// emit queues a webhook event for the API key that made the prediction of the
+// case. Failures are logged; the case change itself has already been stored.
+func (s *caseService) emit(ctx context.Context, row db.ReviewCase, event WebhookEvent, data interface{}) {
+	if s.webhookSvc == nil || !row.ApiKeyID.Valid {
+		return
+	}
+	if err := s.webhookSvc.Enqueue(ctx, row.ApiKeyID.Int64, event, data); err != nil {
+		s.logger.Error().Err(err).Int64("case_id", row.ID).Str("event", string(event)).Msg("failed to enqueue webhook event")
+	}
+}
+
+func caseError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCaseNotFound
+	}
+	return err
+}
+
+func toCase(row db.ReviewCase) Case {
+	c := Case{
+		ID:            row.ID,
+		InferenceID:   row.InferenceLogID,
+		TransactionID: row.TransactionID.String,
+		ModelName:     row.ModelName,
+		Score:         row.Score,
+		Decision:      Decision(row.Decision),
+		Reason:        CaseReason(row.Reason),
+		Status:        CaseStatus(row.Status),
+		Assignee:      row.Assignee.String,
+		Resolution:    FeedbackLabel(row.Resolution.String),
+		CreatedAt:     row.CreatedAt,
+		UpdatedAt:     row.UpdatedAt,
+	}
+	if row.ResolvedBy.Valid {
+		c.ResolvedBy = &row.ResolvedBy.Int64
+	}
+	if row.ResolvedAt.Valid {
+		c.ResolvedAt = &row.ResolvedAt.Time
+	}
+	return c
+}
+
+func toCaseComment(row db.ReviewCaseComment) CaseComment {
+	return CaseComment{
+		ID:        row.ID,
+		AuthorID:  row.AuthorID,
+		Body:      row.Body,
+		CreatedAt: row.CreatedAt,
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCaseRepo takes the owner of each inference log from owners. The
+// feedback recorded by resolved cases is kept by inference log ID.
+type memoryCaseRepo struct {
+	owners   map[int64]int64
+	cases    []db.ReviewCase
+	comments []db.ReviewCaseComment
+	feedback map[int64]db.UpsertPredictionFeedbackParams
+}
+
+func (r *memoryCaseRepo) find(id, userID int64) (*db.ReviewCase, error) {
+	for i := range r.cases {
+		if r.cases[i].ID == id && r.cases[i].UserID == userID {
+			return &r.cases[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memoryCaseRepo) CreateReviewCase(ctx context.Context, arg db.CreateReviewCaseParams) (db.ReviewCase, error) {
+	for _, c := range r.cases {
+		if c.InferenceLogID == arg.InferenceLogID {
+			return db.ReviewCase{}, sql.ErrNoRows
+		}
+	}
+	r.cases = append(r.cases, db.ReviewCase{
+		ID:             int64(len(r.cases) + 1),
+		InferenceLogID: arg.InferenceLogID,
+		UserID:         r.owners[arg.InferenceLogID],
+		ModelName:      arg.ModelName,
+		Score:          arg.Score,
+		Decision:       arg.Decision,
+		Reason:         arg.Reason,
+		Status:         string(CaseStatusOpen),
+		CreatedAt:      time.Now(),
+	})
+	return r.cases[len(r.cases)-1], nil
+}
+
+func (r *memoryCaseRepo) GetReviewCase(ctx context.Context, id, userID int64) (db.ReviewCase, error) {
+	c, err := r.find(id, userID)
+	if err != nil {
+		return db.ReviewCase{}, err
+	}
+	return *c, nil
+}
+
+func (r *memoryCaseRepo) ListReviewCases(ctx context.Context, userID int64, from, to time.Time, status, assignee string) ([]db.ReviewCase, error) {
+	var rows []db.ReviewCase
+	for _, c := range r.cases {
+		if c.UserID == userID && (status == "" || c.Status == status) && (assignee == "" || c.Assignee.String == assignee) {
+			rows = append(rows, c)
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryCaseRepo) AssignReviewCase(ctx context.Context, id, userID int64, assignee string) (db.ReviewCase, error) {
+	c, err := r.find(id, userID)
+	if err != nil {
+		return db.ReviewCase{}, err
+	}
+	c.Assignee = sql.NullString{String: assignee, Valid: assignee != ""}
+	return *c, nil
+}
+
+func (r *memoryCaseRepo) ResolveReviewCase(ctx context.Context, arg db.ResolveReviewCaseParams, feedback db.UpsertPredictionFeedbackParams, comment *db.AddReviewCaseCommentParams) (db.ReviewCase, error) {
+	c, err := r.find(arg.ID, arg.UserID)
+	if err != nil || c.Status != string(CaseStatusOpen) {
+		return db.ReviewCase{}, sql.ErrNoRows
+	}
+	c.Status = string(CaseStatusResolved)
+	c.Resolution = arg.Resolution
+	c.ResolvedBy = arg.ResolvedBy
+	c.ResolvedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if comment != nil {
+		_, _ = r.AddReviewCaseComment(ctx, *comment)
+	}
+	r.feedback[feedback.InferenceLogID] = feedback
+	return *c, nil
+}
+
+func (r *memoryCaseRepo) AddReviewCaseComment(ctx context.Context, arg db.AddReviewCaseCommentParams) (db.ReviewCaseComment, error) {
+	row := db.ReviewCaseComment{ID: int64(len(r.comments) + 1), CaseID: arg.CaseID, AuthorID: arg.AuthorID, Body: arg.Body}
+	r.comments = append(r.comments, row)
+	return row, nil
+}
+
+func (r *memoryCaseRepo) ListReviewCaseComments(ctx context.Context, caseID int64) ([]db.ReviewCaseComment, error) {
+	var rows []db.ReviewCaseComment
+	for _, c := range r.comments {
+		if c.CaseID == caseID {
+			rows = append(rows, c)
+		}
+	}
+	return rows, nil
+}
+
+func TestCaseService_Open(t *testing.T) {
+	repo := &memoryCaseRepo{owners: map[int64]int64{10: 1, 11: 1, 12: 1}}
+	svc := NewCaseService(repo, nil, zerolog.Nop())
+	ctx := context.Background()
+
+	var flagged, review, approved PredictResponse
+	flagged.Result.Prediction = 1
+	flagged.Result.Decision = DecisionDecline
+	review.Result.Decision = DecisionReview
+	approved.Result.Decision = DecisionApprove
+
+	require.NoError(t, svc.Open(ctx, 10, flagged))
+	require.NoError(t, svc.Open(ctx, 11, review))
+	require.NoError(t, svc.Open(ctx, 12, approved))
+	// A prediction has at most one case.
+	require.NoError(t, svc.Open(ctx, 10, flagged))
+
+	cases, err := svc.List(ctx, 1, CaseFilter{})
+	require.NoError(t, err)
+	require.Len(t, cases, 2)
+	assert.Equal(t, CaseReasonFlagged, cases[0].Reason)
+	assert.Equal(t, CaseReasonReview, cases[1].Reason)
+
+	_, err = svc.List(ctx, 1, CaseFilter{Status: "closed"})
+	assert.ErrorIs(t, err, ErrInvalidCase)
+}
+
+func TestCaseService_Resolve(t *testing.T) {
+	repo := &memoryCaseRepo{owners: map[int64]int64{10: 1}, feedback: map[int64]db.UpsertPredictionFeedbackParams{}}
+	svc := NewCaseService(repo, nil, zerolog.Nop())
+	ctx := context.Background()
+
+	var resp PredictResponse
+	resp.Result.Prediction = 1
+	require.NoError(t, svc.Open(ctx, 10, resp))
+
+	c, err := svc.Assign(ctx, 1, 1, " alice ")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", c.Assignee)
+
+	// Other users cannot see the case.
+	_, err = svc.Get(ctx, 2, 1)
+	assert.ErrorIs(t, err, ErrCaseNotFound)
+	_, err = svc.Comment(ctx, 2, 1, "hello")
+	assert.ErrorIs(t, err, ErrCaseNotFound)
+
+	_, err = svc.Comment(ctx, 1, 1, "  ")
+	assert.ErrorIs(t, err, ErrInvalidCase)
+	_, err = svc.Resolve(ctx, 1, 1, "unsure", "")
+	assert.ErrorIs(t, err, ErrInvalidCase)
+
+	c, err = svc.Resolve(ctx, 1, 1, LabelLegit, "customer confirmed the purchase")
+	require.NoError(t, err)
+	assert.Equal(t, CaseStatusResolved, c.Status)
+	assert.Equal(t, LabelLegit, c.Resolution)
+	require.NotNil(t, c.ResolvedBy)
+	assert.Equal(t, int64(1), *c.ResolvedBy)
+
+	fb := repo.feedback[10]
+	assert.Equal(t, string(LabelLegit), fb.Label)
+	assert.Equal(t, CaseLabelSource, fb.LabelSource)
+	assert.Equal(t, int64(1), fb.UserID)
+
+	c, err = svc.Get(ctx, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, c.Comments, 1)
+	assert.Equal(t, "customer confirmed the purchase", c.Comments[0].Body)
+
+	_, err = svc.Resolve(ctx, 1, 1, LabelFraud, "")
+	assert.ErrorIs(t, err, ErrCaseResolved)
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/rs/zerolog"
+)
+
+// AdminPlan is the user plan allowed to manage plan-wide settings.
+const AdminPlan = "admin"
+
+// Decision is the action suggested for a scored transaction.
+type Decision string
+
+const (
+	DecisionApprove Decision = "approve"
+	DecisionReview  Decision = "review"
+	DecisionDecline Decision = "decline"
+)
+
+// decisionPolicyCacheTTL bounds how long a resolved policy is reused. Changes
+// made through another instance become visible after at most this long.
+const decisionPolicyCacheTTL = 30 * time.Second
+
+var (
+	ErrDecisionPolicyNotFound  = errors.New("decision policy not found")
+	ErrDecisionPolicyForbidden = errors.New("not allowed to manage this decision policy")
+	ErrDecisionPolicyExists    = errors.New("decision policy already exists for this scope")
+	ErrInvalidDecisionPolicy   = errors.New("exactly one of plan or api_key_id is required and thresholds must satisfy 0 <= review_threshold <= decline_threshold <= 1")
+)
+
+// DecisionPolicy maps a score into a decision. Scores below ReviewThreshold
+// are approved, scores at or above DeclineThreshold are declined and anything
+// in between is sent to review. A policy applies either to every user on Plan
+// or to a single API key; the API key policy wins when both exist.
+type DecisionPolicy struct {
+	ID               int64     `json:"id"`
+	Plan             *string   `json:"plan,omitempty"`
+	APIKeyID         *int64    `json:"api_key_id,omitempty"`
+	ReviewThreshold  float64   `json:"review_threshold"`
+	DeclineThreshold float64   `json:"decline_threshold"`
+	Version          int32     `json:"version"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Decide returns the decision for score. The zero policy, used when no policy
+// is configured, declines at the model threshold and never asks for review.
+func (p DecisionPolicy) Decide(score, threshold float64) Decision {
+	review, decline := p.ReviewThreshold, p.DeclineThreshold
+	if p.ID == 0 {
+		review, decline = threshold, threshold
+	}
+	switch {
+	case score >= decline:
+		return DecisionDecline
+	case score >= review:
+		return DecisionReview
+	default:
+		return DecisionApprove
+	}
+}
+
+// PolicyCaller identifies the user managing decision policies.
+type PolicyCaller struct {
+	UserID int64
+	Plan   string
+}
+
+// DecisionPolicyInput holds the fields of a new decision policy.
+type DecisionPolicyInput struct {
+	Plan             string
+	APIKeyID         *int64
+	ReviewThreshold  float64
+	DeclineThreshold float64
+}
+
+type DecisionPolicyService interface {
+	List(ctx context.Context, caller PolicyCaller) ([]DecisionPolicy, error)
+	Create(ctx context.Context, caller PolicyCaller, input DecisionPolicyInput) (DecisionPolicy, error)
+	Update(ctx context.Context, caller PolicyCaller, id int64, reviewThreshold, declineThreshold float64) (DecisionPolicy, error)
+	Delete(ctx context.Context, caller PolicyCaller, id int64) error
+	// Apply sets the decision and policy of resp using the policy that applies
+	// to the API key or, failing that, to the plan of the user.
+	Apply(ctx context.Context, userID int64, apiKeyID *int64, resp *PredictResponse)
+}
+
+type cachedDecisionPolicy struct {
+	policy  DecisionPolicy
+	expires time.Time
+}
+
+type decisionPolicyService struct {
+	policyRepo repo.DecisionPolicyRepository
+	apiKeyRepo repo.APIKeyRepository
+	logger     zerolog.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedDecisionPolicy
+}
+
+func NewDecisionPolicyService(policyRepo repo.DecisionPolicyRepository, apiKeyRepo repo.APIKeyRepository, logger zerolog.Logger) DecisionPolicyService {
+	return &decisionPolicyService{
+		policyRepo: policyRepo,
+		apiKeyRepo: apiKeyRepo,
+		logger:     logger,
+		cache:      make(map[string]cachedDecisionPolicy),
+	}
+}
+
+func (s *decisionPolicyService) List(ctx context.Context, caller PolicyCaller) ([]DecisionPolicy, error) {
+	var rows []db.DecisionPolicy
+	var err error
+	if caller.Plan == AdminPlan {
+		rows, err = s.policyRepo.ListDecisionPolicies(ctx)
+	} else {
+		rows, err = s.policyRepo.ListDecisionPoliciesForUser(ctx, caller.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]DecisionPolicy, len(rows))
+	for i, row := range rows {
+		policies[i] = toDecisionPolicy(row)
+	}
+	return policies, nil
+}
+
+func (s *decisionPolicyService) Create(ctx context.Context, caller PolicyCaller, input DecisionPolicyInput) (DecisionPolicy, error) {
+	if (input.Plan == "") == (input.APIKeyID == nil) || !validThresholds(input.ReviewThreshold, input.DeclineThreshold) {
+		return DecisionPolicy{}, ErrInvalidDecisionPolicy
+	}
+
+	params := db.CreateDecisionPolicyParams{
+		ReviewThreshold:  input.ReviewThreshold,
+		DeclineThreshold: input.DeclineThreshold,
+	}
+	if input.Plan != "" {
+		params.Plan = sql.NullString{String: input.Plan, Valid: true}
+	} else {
+		params.ApiKeyID = sql.NullInt64{Int64: *input.APIKeyID, Valid: true}
+	}
+
+	if err := s.authorize(ctx, caller, params.Plan, params.ApiKeyID); err != nil {
+		return DecisionPolicy{}, err
+	}
+
+	row, err := s.policyRepo.CreateDecisionPolicy(ctx, params)
+	if err != nil {
+		if errors.Is(err, repo.ErrDecisionPolicyExists) {
+			return DecisionPolicy{}, ErrDecisionPolicyExists
+		}
+		return DecisionPolicy{}, err
+	}
+	s.invalidate()
+	return toDecisionPolicy(row), nil
+}
+
+func (s *decisionPolicyService) Update(ctx context.Context, caller PolicyCaller, id int64, reviewThreshold, declineThreshold float64) (DecisionPolicy, error) {
+	if !validThresholds(reviewThreshold, declineThreshold) {
+		return DecisionPolicy{}, ErrInvalidDecisionPolicy
+	}
+	if _, err := s.get(ctx, caller, id); err != nil {
+		return DecisionPolicy{}, err
+	}
+
+	row, err := s.policyRepo.UpdateDecisionPolicy(ctx, db.UpdateDecisionPolicyParams{
+		ID:               id,
+		ReviewThreshold:  reviewThreshold,
+		DeclineThreshold: declineThreshold,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DecisionPolicy{}, ErrDecisionPolicyNotFound
+		}
+		return DecisionPolicy{}, err
+	}
+	s.invalidate()
+	return toDecisionPolicy(row), nil
+}
+
+func (s *decisionPolicyService) Delete(ctx context.Context, caller PolicyCaller, id int64) error {
+	if _, err := s.get(ctx, caller, id); err != nil {
+		return err
+	}
+	if err := s.policyRepo.DeleteDecisionPolicy(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *decisionPolicyService) Apply(ctx context.Context, userID int64, apiKeyID *int64, resp *PredictResponse) {
+	policy, err := s.resolve(ctx, userID, apiKeyID)
+	if err != nil {
+		s.logger.Warn().Err(err).Int64("user_id", userID).Msg("failed to resolve decision policy, using model threshold")
+	}
+
+	resp.Result.Decision = policy.Decide(resp.Result.Score, resp.Result.Threshold)
+	resp.Meta.PolicyID = policy.ID
+	resp.Meta.PolicyVersion = policy.Version
+}
+
+func (s *decisionPolicyService) resolve(ctx context.Context, userID int64, apiKeyID *int64) (DecisionPolicy, error) {
+	key := strconv.FormatInt(userID, 10)
+	if apiKeyID != nil {
+		key += ":" + strconv.FormatInt(*apiKeyID, 10)
+	}
+
+	s.mu.Lock()
+	cached, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.policy, nil
+	}
+
+	var policy DecisionPolicy
+	row, err := s.policyRepo.ResolveDecisionPolicy(ctx, userID, apiKeyID)
+	switch {
+	case err == nil:
+		policy = toDecisionPolicy(row)
+	case errors.Is(err, sql.ErrNoRows):
+		// No policy configured; cache the default as well.
+	default:
+		return DecisionPolicy{}, err
+	}
+
+	s.mu.Lock()
+	s.cache[key] = cachedDecisionPolicy{policy: policy, expires: time.Now().Add(decisionPolicyCacheTTL)}
+	s.mu.Unlock()
+	return policy, nil
+}
+
+// get loads policy id if caller may manage it.
+func (s *decisionPolicyService) get(ctx context.Context, caller PolicyCaller, id int64) (db.DecisionPolicy, error) {
+	row, err := s.policyRepo.GetDecisionPolicy(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.DecisionPolicy{}, ErrDecisionPolicyNotFound
+		}
+		return db.DecisionPolicy{}, err
+	}
+	if err := s.authorize(ctx, caller, row.Plan, row.ApiKeyID); err != nil {
+		if errors.Is(err, ErrDecisionPolicyForbidden) && row.ApiKeyID.Valid {
+			// Do not reveal policies of other users' API keys.
+			return db.DecisionPolicy{}, ErrDecisionPolicyNotFound
+		}
+		return db.DecisionPolicy{}, err
+	}
+	return row, nil
+}
+
+// authorize allows admins to manage every policy and other users to manage
+// the policies of their own API keys.
+func (s *decisionPolicyService) authorize(ctx context.Context, caller PolicyCaller, plan sql.NullString, apiKeyID sql.NullInt64) error {
+	if caller.Plan == AdminPlan {
+		return nil
+	}
+	if plan.Valid || !apiKeyID.Valid {
+		return ErrDecisionPolicyForbidden
+	}
+
+	keys, err := s.apiKeyRepo.ListAPIKeysByUser(ctx, caller.UserID)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if k.ID == apiKeyID.Int64 {
+			return nil
+		}
+	}
+	return ErrDecisionPolicyForbidden
+}
+
+func (s *decisionPolicyService) invalidate() {
+	s.mu.Lock()
+	s.cache = make(map[string]cachedDecisionPolicy)
+	s.mu.Unlock()
+}
+
+func validThresholds(review, decline float64) bool {
+	return review >= 0 && review <= decline && decline <= 1
+}
+
+func toDecisionPolicy(row db.DecisionPolicy) DecisionPolicy {
+	p := DecisionPolicy{
+		ID:               row.ID,
+		ReviewThreshold:  row.ReviewThreshold,
+		DeclineThreshold: row.DeclineThreshold,
+		Version:          row.Version,
+		CreatedAt:        row.CreatedAt,
+		UpdatedAt:        row.UpdatedAt,
+	}
+	if row.Plan.Valid {
+		plan := row.Plan.String
+		p.Plan = &plan
+	}
+	if row.ApiKeyID.Valid {
+		id := row.ApiKeyID.Int64
+		p.APIKeyID = &id
+	}
+	return p
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryPolicyRepo struct {
+	policies []db.DecisionPolicy
+	resolves int
+}
+
+func (r *memoryPolicyRepo) CreateDecisionPolicy(ctx context.Context, arg db.CreateDecisionPolicyParams) (db.DecisionPolicy, error) {
+	p := db.DecisionPolicy{
+		ID:               int64(len(r.policies) + 1),
+		Plan:             arg.Plan,
+		ApiKeyID:         arg.ApiKeyID,
+		ReviewThreshold:  arg.ReviewThreshold,
+		DeclineThreshold: arg.DeclineThreshold,
+		Version:          1,
+	}
+	r.policies = append(r.policies, p)
+	return p, nil
+}
+
+func (r *memoryPolicyRepo) GetDecisionPolicy(ctx context.Context, id int64) (db.DecisionPolicy, error) {
+	for _, p := range r.policies {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return db.DecisionPolicy{}, sql.ErrNoRows
+}
+
+func (r *memoryPolicyRepo) ListDecisionPolicies(ctx context.Context) ([]db.DecisionPolicy, error) {
+	return r.policies, nil
+}
+
+func (r *memoryPolicyRepo) ListDecisionPoliciesForUser(ctx context.Context, userID int64) ([]db.DecisionPolicy, error) {
+	return r.policies, nil
+}
+
+func (r *memoryPolicyRepo) ResolveDecisionPolicy(ctx context.Context, userID int64, apiKeyID *int64) (db.DecisionPolicy, error) {
+	r.resolves++
+	var planPolicy *db.DecisionPolicy
+	for i, p := range r.policies {
+		if apiKeyID != nil && p.ApiKeyID.Valid && p.ApiKeyID.Int64 == *apiKeyID {
+			return p, nil
+		}
+		if p.Plan.Valid && p.Plan.String == "pro" {
+			planPolicy = &r.policies[i]
+		}
+	}
+	if planPolicy != nil {
+		return *planPolicy, nil
+	}
+	return db.DecisionPolicy{}, sql.ErrNoRows
+}
+
+func (r *memoryPolicyRepo) UpdateDecisionPolicy(ctx context.Context, arg db.UpdateDecisionPolicyParams) (db.DecisionPolicy, error) {
+	for i, p := range r.policies {
+		if p.ID == arg.ID {
+			r.policies[i].ReviewThreshold = arg.ReviewThreshold
+			r.policies[i].DeclineThreshold = arg.DeclineThreshold
+			r.policies[i].Version++
+			return r.policies[i], nil
+		}
+	}
+	return db.DecisionPolicy{}, sql.ErrNoRows
+}
+
+func (r *memoryPolicyRepo) DeleteDecisionPolicy(ctx context.Context, id int64) error {
+	return nil
+}
+
+type memoryAPIKeyRepo struct {
+	keys map[int64]int64 // key ID -> user ID
+}
+
+func (r *memoryAPIKeyRepo) GetAPIKeyByHash(ctx context.Context, keyHash []byte) (db.GetAPIKeyByHashRow, error) {
+	return db.GetAPIKeyByHashRow{}, sql.ErrNoRows
+}
+
+func (r *memoryAPIKeyRepo) CreateAPIKey(ctx context.Context, arg db.CreateAPIKeyParams) (db.CreateAPIKeyRow, error) {
+	return db.CreateAPIKeyRow{}, nil
+}
+
+func (r *memoryAPIKeyRepo) ListAPIKeysByUser(ctx context.Context, userID int64) ([]db.ListAPIKeysByUserRow, error) {
+	var rows []db.ListAPIKeysByUserRow
+	for id, owner := range r.keys {
+		if owner == userID {
+			rows = append(rows, db.ListAPIKeysByUserRow{ID: id})
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryAPIKeyRepo) DeleteAPIKey(ctx context.Context, userID, keyID int64) error { return nil }
+
+func (r *memoryAPIKeyRepo) UpdateAPIKeyLastUsed(ctx context.Context, id int64) error { return nil }
+
+func TestDecisionPolicy_Decide(t *testing.T) {
+	policy := DecisionPolicy{ID: 1, ReviewThreshold: 0.4, DeclineThreshold: 0.8}
+	assert.Equal(t, DecisionApprove, policy.Decide(0.39, 0.5))
+	assert.Equal(t, DecisionReview, policy.Decide(0.4, 0.5))
+	assert.Equal(t, DecisionReview, policy.Decide(0.79, 0.5))
+	assert.Equal(t, DecisionDecline, policy.Decide(0.8, 0.5))
+
+	// Without a configured policy the model threshold decides.
+	assert.Equal(t, DecisionApprove, DecisionPolicy{}.Decide(0.49, 0.5))
+	assert.Equal(t, DecisionDecline, DecisionPolicy{}.Decide(0.5, 0.5))
+}
+
+func TestDecisionPolicyService_Apply(t *testing.T) {
+	ctx := context.Background()
+	policies := &memoryPolicyRepo{}
+	svc := NewDecisionPolicyService(policies, &memoryAPIKeyRepo{keys: map[int64]int64{7: 1}}, zerolog.Nop())
+	admin := PolicyCaller{UserID: 99, Plan: AdminPlan}
+	user := PolicyCaller{UserID: 1, Plan: "pro"}
+	keyID := int64(7)
+
+	var resp PredictResponse
+	resp.Result.Score = 0.6
+	resp.Result.Threshold = 0.5
+	svc.Apply(ctx, 1, &keyID, &resp)
+	assert.Equal(t, DecisionDecline, resp.Result.Decision)
+	assert.Zero(t, resp.Meta.PolicyID)
+
+	_, err := svc.Create(ctx, user, DecisionPolicyInput{Plan: "pro", ReviewThreshold: 0.5, DeclineThreshold: 0.9})
+	assert.ErrorIs(t, err, ErrDecisionPolicyForbidden)
+	_, err = svc.Create(ctx, admin, DecisionPolicyInput{Plan: "pro", APIKeyID: &keyID, ReviewThreshold: 0.5, DeclineThreshold: 0.9})
+	assert.ErrorIs(t, err, ErrInvalidDecisionPolicy)
+	_, err = svc.Create(ctx, admin, DecisionPolicyInput{Plan: "pro", ReviewThreshold: 0.9, DeclineThreshold: 0.5})
+	assert.ErrorIs(t, err, ErrInvalidDecisionPolicy)
+
+	planPolicy, err := svc.Create(ctx, admin, DecisionPolicyInput{Plan: "pro", ReviewThreshold: 0.5, DeclineThreshold: 0.9})
+	require.NoError(t, err)
+
+	svc.Apply(ctx, 1, &keyID, &resp)
+	assert.Equal(t, DecisionReview, resp.Result.Decision)
+	assert.Equal(t, planPolicy.ID, resp.Meta.PolicyID)
+	assert.Equal(t, int32(1), resp.Meta.PolicyVersion)
+
+	otherKey := int64(8)
+	_, err = svc.Create(ctx, user, DecisionPolicyInput{APIKeyID: &otherKey, ReviewThreshold: 0.1, DeclineThreshold: 0.2})
+	assert.ErrorIs(t, err, ErrDecisionPolicyForbidden)
+
+	keyPolicy, err := svc.Create(ctx, user, DecisionPolicyInput{APIKeyID: &keyID, ReviewThreshold: 0.1, DeclineThreshold: 0.2})
+	require.NoError(t, err)
+	updated, err := svc.Update(ctx, user, keyPolicy.ID, 0.7, 0.95)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), updated.Version)
+
+	_, err = svc.Update(ctx, PolicyCaller{UserID: 2, Plan: "pro"}, keyPolicy.ID, 0.1, 0.2)
+	assert.ErrorIs(t, err, ErrDecisionPolicyNotFound)
+
+	resolves := policies.resolves
+	svc.Apply(ctx, 1, &keyID, &resp)
+	svc.Apply(ctx, 1, &keyID, &resp)
+	assert.Equal(t, DecisionApprove, resp.Result.Decision)
+	assert.Equal(t, keyPolicy.ID, resp.Meta.PolicyID)
+	assert.Equal(t, int32(2), resp.Meta.PolicyVersion)
+	assert.Equal(t, resolves+1, policies.resolves, "resolved policy should be cached")
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+)
+
+// EnsembleModel is the pseudo model type that scores a request with every
+// loaded model and combines the results.
+const EnsembleModel = "ensemble"
+
+// EnsembleStrategy controls how individual model scores are combined.
+type EnsembleStrategy string
+
+const (
+	EnsembleMean     EnsembleStrategy = "mean"
+	EnsembleWeighted EnsembleStrategy = "weighted"
+	EnsembleMax      EnsembleStrategy = "max"
+	EnsembleVote     EnsembleStrategy = "vote"
+)
+
+var ErrEnsembleUnavailable = errors.New("no ensemble member returned a prediction")
+
+// ParseEnsembleStrategy validates a configured strategy name. An empty name
+// selects the mean strategy.
+func ParseEnsembleStrategy(name string) (EnsembleStrategy, error) {
+	switch s := EnsembleStrategy(name); s {
+	case "":
+		return EnsembleMean, nil
+	case EnsembleMean, EnsembleWeighted, EnsembleMax, EnsembleVote:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown ensemble strategy %q", name)
+	}
+}
+
+// EnsembleMember is the individual result of one model in an ensemble.
+type EnsembleMember struct {
+	ModelType  string  `json:"model_type"`
+	ModelName  string  `json:"model_name,omitempty"`
+	RunID      string  `json:"run_id,omitempty"`
+	Prediction int     `json:"prediction"`
+	Score      float64 `json:"score"`
+	Threshold  float64 `json:"threshold"`
+	Weight     float64 `json:"weight"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// WithEnsemble configures the strategy used for model "ensemble". Weights are
+// keyed by model type and only used by the weighted strategy; models without a
+// weight count as 1.
+func WithEnsemble(strategy EnsembleStrategy, weights map[string]float64) VendorOption {
+	return func(s *vendorService) {
+		s.ensembleStrategy = strategy
+		s.ensembleWeights = weights
+	}
+}
+
+// predictEnsemble scores the request with every loaded model in parallel and
+// combines the successful results. Failed members are reported but ignored.
+func (s *vendorService) predictEnsemble(ctx context.Context, features map[string]interface{}) (PredictResponse, error) {
+	start := time.Now()
+
+	models, err := s.models(ctx)
+	if err != nil {
+		return PredictResponse{}, err
+	}
+
+	members := make([]EnsembleMember, len(models))
+	var wg sync.WaitGroup
+	for i, m := range models {
+		wg.Add(1)
+		go func(i int, modelType string) {
+			defer wg.Done()
+
+			member := EnsembleMember{ModelType: modelType, Weight: s.ensembleWeight(modelType)}
+			vendorResp, _, err := s.predictModel(ctx, s.client, clients.PredictRequest{Model: modelType, Features: features})
+			if err != nil {
+				s.logger.Warn().Err(err).Str("model", modelType).Msg("ensemble member predict failed")
+				member.Error = err.Error()
+			} else {
+				member.ModelName = vendorResp.Meta.ModelName
+				member.RunID = vendorResp.Meta.RunID
+				member.Prediction = vendorResp.Result.Prediction
+				member.Score = vendorResp.Result.Score
+				member.Threshold = vendorResp.Result.Threshold
+			}
+			members[i] = member
+		}(i, m.ModelType)
+	}
+	wg.Wait()
+
+	score, threshold, prediction, err := combineEnsemble(s.ensembleStrategy, members)
+	if err != nil {
+		return PredictResponse{}, err
+	}
+
+	var resp PredictResponse
+	resp.Meta.ModelName = EnsembleModel
+	resp.Meta.RequestID = uuid.New().String()
+	resp.Meta.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	resp.Meta.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	resp.Result.Prediction = prediction
+	resp.Result.Score = score
+	resp.Result.Threshold = threshold
+	resp.Result.Members = members
+	return resp, nil
+}
+
+func (s *vendorService) ensembleWeight(modelType string) float64 {
+	if w, ok := s.ensembleWeights[modelType]; ok {
+		return w
+	}
+	return 1
+}
+
+// combineEnsemble merges member results according to strategy and returns the
+// combined score, threshold and prediction.
+func combineEnsemble(strategy EnsembleStrategy, members []EnsembleMember) (float64, float64, int, error) {
+	ok := make([]EnsembleMember, 0, len(members))
+	for _, m := range members {
+		if m.Error == "" {
+			ok = append(ok, m)
+		}
+	}
+	if len(ok) == 0 {
+		return 0, 0, 0, ErrEnsembleUnavailable
+	}
+
+	var score, threshold float64
+	switch strategy {
+	case EnsembleWeighted:
+		var total float64
+		for _, m := range ok {
+			score += m.Weight * m.Score
+			threshold += m.Weight * m.Threshold
+			total += m.Weight
+		}
+		if total <= 0 {
+			return 0, 0, 0, errors.New("ensemble weights must sum to a positive value")
+		}
+		score /= total
+		threshold /= total
+	case EnsembleMax:
+		best := ok[0]
+		for _, m := range ok[1:] {
+			if m.Score > best.Score {
+				best = m
+			}
+		}
+		score, threshold = best.Score, best.Threshold
+	case EnsembleVote:
+		// The score is the share of members flagging fraud; ties are flagged.
+		var votes int
+		for _, m := range ok {
+			votes += m.Prediction
+		}
+		score = float64(votes) / float64(len(ok))
+		threshold = 0.5
+	default:
+		for _, m := range ok {
+			score += m.Score
+			threshold += m.Threshold
+		}
+		score /= float64(len(ok))
+		threshold /= float64(len(ok))
+	}
+
+	prediction := 0
+	if score >= threshold {
+		prediction = 1
+	}
+	return score, threshold, prediction, nil
+}
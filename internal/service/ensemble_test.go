@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCombineEnsemble(t *testing.T) {
+	members := []EnsembleMember{
+		{ModelType: "lightgbm", Prediction: 1, Score: 0.9, Threshold: 0.5, Weight: 3},
+		{ModelType: "logreg", Prediction: 0, Score: 0.3, Threshold: 0.5, Weight: 1},
+		{ModelType: "xgboost", Prediction: 0, Score: 0.2, Threshold: 0.6, Weight: 1},
+		{ModelType: "broken", Error: "vendor API returned non-200 status"},
+	}
+
+	tests := []struct {
+		strategy   EnsembleStrategy
+		score      float64
+		threshold  float64
+		prediction int
+	}{
+		{EnsembleMean, (0.9 + 0.3 + 0.2) / 3, (0.5 + 0.5 + 0.6) / 3, 0},
+		{EnsembleWeighted, (3*0.9 + 0.3 + 0.2) / 5, (3*0.5 + 0.5 + 0.6) / 5, 1},
+		{EnsembleMax, 0.9, 0.5, 1},
+		{EnsembleVote, 1.0 / 3, 0.5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			score, threshold, prediction, err := combineEnsemble(tt.strategy, members)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.score, score, 1e-9)
+			assert.InDelta(t, tt.threshold, threshold, 1e-9)
+			assert.Equal(t, tt.prediction, prediction)
+		})
+	}
+
+	_, _, _, err := combineEnsemble(EnsembleMean, members[3:])
+	assert.ErrorIs(t, err, ErrEnsembleUnavailable)
+}
+
+func TestVendorService_PredictEnsemble(t *testing.T) {
+	version := `{"loaded_models":{"lightgbm":{"name":"FraudDetector-lightgbm"},"logreg":{"name":"FraudDetector-logistic_regression"},"xgboost":{"name":"FraudDetector-xgboost"}}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/version":
+			_, _ = w.Write([]byte(version))
+		case "/v1/predict":
+			var body clients.PredictRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			switch body.Model {
+			case "xgboost":
+				w.WriteHeader(http.StatusBadRequest)
+			case "lightgbm":
+				_, _ = w.Write([]byte(`{"meta":{"model_name":"FraudDetector-lightgbm"},"result":{"prediction":1,"score":0.8,"threshold":0.5}}`))
+			default:
+				_, _ = w.Write([]byte(`{"meta":{"model_name":"FraudDetector-logistic_regression"},"result":{"prediction":0,"score":0.4,"threshold":0.5}}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	svc := NewVendorService(client, zerolog.Nop(), WithEnsemble(EnsembleMean, nil))
+
+	resp, err := svc.Predict(context.Background(), PredictRequest{
+		Model:    EnsembleModel,
+		Features: map[string]interface{}{"amount": 10.5},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, EnsembleModel, resp.Meta.ModelName)
+	assert.InDelta(t, 0.6, resp.Result.Score, 1e-9)
+	assert.Equal(t, 1, resp.Result.Prediction)
+
+	require.Len(t, resp.Result.Members, 3)
+	assert.Equal(t, "lightgbm", resp.Result.Members[0].ModelType)
+	assert.Equal(t, "FraudDetector-lightgbm", resp.Result.Members[0].ModelName)
+	assert.Equal(t, "xgboost", resp.Result.Members[2].ModelType)
+	assert.NotEmpty(t, resp.Result.Members[2].Error)
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+)
+
+// Explanation methods reported by Explanation.Method.
+const (
+	// ExplainMethodVendor is used when the vendor model returned the feature
+	// contributions itself.
+	ExplainMethodVendor = "vendor"
+	// ExplainMethodOcclusion is the local approximation: the contribution of a
+	// numeric feature is the score minus the score with that feature set to 0.
+	ExplainMethodOcclusion = "occlusion"
+)
+
+const (
+	defaultExplainTopN              = 3
+	defaultExplainMaxFeatures       = 32
+	defaultExplainConcurrency       = 4
+	defaultExplainGlobalConcurrency = 32
+	defaultExplainTimeout           = 2 * time.Second
+
+	// explainDeadlineMargin is the time occlusion leaves before the deadline
+	// of the request, to answer it with the contributions computed so far.
+	explainDeadlineMargin = 500 * time.Millisecond
+)
+
+// FeatureContribution is how much one feature moved the score. Positive values
+// push towards fraud and carry a reason code.
+type FeatureContribution struct {
+	Feature      string  `json:"feature"`
+	Contribution float64 `json:"contribution"`
+	ReasonCode   string  `json:"reason_code,omitempty"`
+}
+
+// Explanation lists the top contributors to a score, largest first, and the
+// reason codes of those that pushed it towards fraud.
+type Explanation struct {
+	Method        string                `json:"method"`
+	Contributions []FeatureContribution `json:"contributions"`
+	ReasonCodes   []string              `json:"reason_codes"`
+}
+
+// ExplainSettings configures explanations. ReasonCodes maps feature names to
+// reason codes; other features get "FEATURE_<NAME>". MaxFeatures bounds the
+// number of extra vendor calls made by the occlusion fallback, Concurrency how
+// many of them run at once for one request and GlobalConcurrency for all
+// requests together. ExcludedFeatures, such as identifiers, and the derived
+// features are never occluded. Timeout bounds the occlusion calls of a
+// request.
+type ExplainSettings struct {
+	TopN              int
+	MaxFeatures       int
+	Concurrency       int
+	GlobalConcurrency int
+	ReasonCodes       map[string]string
+	ExcludedFeatures  []string
+	Timeout           time.Duration
+}
+
+// WithExplain configures the explanations returned for explained requests.
+// Occlusion calls go through client, whose circuit breaker is separate from
+// the one of scoring; without WithExplain only vendor contributions are
+// returned.
+func WithExplain(settings ExplainSettings, client *clients.ThirdPartyClient) VendorOption {
+	return func(s *vendorService) {
+		if settings.Concurrency <= 0 {
+			settings.Concurrency = defaultExplainConcurrency
+		}
+		if settings.GlobalConcurrency <= 0 {
+			settings.GlobalConcurrency = defaultExplainGlobalConcurrency
+		}
+		if settings.Timeout <= 0 {
+			settings.Timeout = defaultExplainTimeout
+		}
+		s.explain = settings
+		s.explainClient = client
+		s.explainSem = make(chan struct{}, settings.GlobalConcurrency)
+	}
+}
+
+// explainPrediction returns the explanation of vendorResp, falling back to
+// occlusion when the vendor returned no contributions. Explanations are best
+// effort: nil is returned if none could be computed.
+func (s *vendorService) explainPrediction(ctx context.Context, req PredictRequest, vendorResp *clients.PredictResponse) *Explanation {
+	if len(vendorResp.Result.Contributions) > 0 {
+		return s.newExplanation(ExplainMethodVendor, vendorResp.Result.Contributions)
+	}
+
+	if s.explainClient == nil {
+		return nil
+	}
+	contributions := s.occlusion(ctx, req, vendorResp.Result.Score)
+	if len(contributions) == 0 {
+		s.logger.Warn().Str("model", req.Model).Msg("failed to explain prediction")
+		return nil
+	}
+	return s.newExplanation(ExplainMethodOcclusion, contributions)
+}
+
+// occlusion re-scores the request once per numeric feature, in parallel, with
+// that feature set to 0. Features whose call fails, or that do not finish
+// within the explain timeout or shortly before the deadline of ctx, are left
+// out.
+func (s *vendorService) occlusion(ctx context.Context, req PredictRequest, score float64) map[string]float64 {
+	deadline := time.Now().Add(s.explain.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Add(-explainDeadlineMargin).Before(deadline) {
+		deadline = ctxDeadline.Add(-explainDeadlineMargin)
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	maxFeatures := s.explain.MaxFeatures
+	if maxFeatures <= 0 {
+		maxFeatures = defaultExplainMaxFeatures
+	}
+
+	var names []string
+	for name, v := range req.Features {
+		if s.derivedFeatures[name] || slices.Contains(s.explain.ExcludedFeatures, name) {
+			continue
+		}
+		if _, ok := toFloat(v); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > maxFeatures {
+		names = names[:maxFeatures]
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.explain.Concurrency)
+	contributions := make(map[string]float64, len(names))
+	for _, name := range names {
+		features := make(map[string]interface{}, len(req.Features))
+		for k, v := range req.Features {
+			features[k] = v
+		}
+		features[name] = 0.0
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(name string, features map[string]interface{}) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			select {
+			case s.explainSem <- struct{}{}:
+				defer func() { <-s.explainSem }()
+			case <-ctx.Done():
+				return
+			}
+
+			vendorResp, _, err := s.predictModel(ctx, s.explainClient, clients.PredictRequest{Model: req.Model, Features: features})
+			if err != nil {
+				s.logger.Debug().Err(err).Str("feature", name).Msg("occlusion predict failed")
+				return
+			}
+			mu.Lock()
+			contributions[name] = score - vendorResp.Result.Score
+			mu.Unlock()
+		}(name, features)
+	}
+	wg.Wait()
+	return contributions
+}
+
+// newExplanation keeps the TopN contributions by magnitude and assigns the
+// reason codes of the positive ones.
+func (s *vendorService) newExplanation(method string, contributions map[string]float64) *Explanation {
+	topN := s.explain.TopN
+	if topN <= 0 {
+		topN = defaultExplainTopN
+	}
+
+	top := make([]FeatureContribution, 0, len(contributions))
+	for feature, c := range contributions {
+		top = append(top, FeatureContribution{Feature: feature, Contribution: c})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		ai, aj := math.Abs(top[i].Contribution), math.Abs(top[j].Contribution)
+		if ai != aj {
+			return ai > aj
+		}
+		return top[i].Feature < top[j].Feature
+	})
+	if len(top) > topN {
+		top = top[:topN]
+	}
+
+	e := &Explanation{Method: method, Contributions: top, ReasonCodes: []string{}}
+	for i := range top {
+		if top[i].Contribution > 0 {
+			top[i].ReasonCode = s.reasonCode(top[i].Feature)
+			e.ReasonCodes = append(e.ReasonCodes, top[i].ReasonCode)
+		}
+	}
+	return e
+}
+
+// reasonCode returns the configured reason code of feature, or one derived from
+// its name so that codes stay stable without configuration.
+func (s *vendorService) reasonCode(feature string) string {
+	if code, ok := s.explain.ReasonCodes[feature]; ok {
+		return code
+	}
+	return "FEATURE_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(feature))
+}
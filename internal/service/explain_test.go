@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// explainVendor scores 0.1, plus 0.6 if amount is set and 0.2 if
+// tx_count_1h is set, minus 0.05 if account_age_days is set.
+func explainVendor(t *testing.T, contributions map[string]float64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body clients.PredictRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		var resp clients.PredictResponse
+		resp.Meta.ModelName = body.Model
+		resp.Result.Threshold = 0.5
+		resp.Result.Score = 0.1
+		if v, _ := toFloat(body.Features["amount"]); v != 0 {
+			resp.Result.Score += 0.6
+		}
+		if v, _ := toFloat(body.Features["tx_count_1h"]); v != 0 {
+			resp.Result.Score += 0.2
+		}
+		if v, _ := toFloat(body.Features["account_age_days"]); v != 0 {
+			resp.Result.Score -= 0.05
+		}
+		if body.Explain {
+			resp.Result.Contributions = contributions
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func explainRequest() PredictRequest {
+	return PredictRequest{
+		Model: "logreg",
+		Features: map[string]interface{}{
+			"amount":           250.5,
+			"tx_count_1h":      int64(4),
+			"account_age_days": int64(300),
+			"merchant_type":    "electronics",
+		},
+		Explain: true,
+	}
+}
+
+func TestVendorService_ExplainOcclusion(t *testing.T) {
+	server := explainVendor(t, nil)
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	svc := NewVendorService(client, zerolog.Nop(),
+		WithExplain(ExplainSettings{TopN: 2, ReasonCodes: map[string]string{"amount": "HIGH_AMOUNT"}}, client))
+
+	resp, err := svc.Predict(context.Background(), explainRequest())
+	require.NoError(t, err)
+	require.NotNil(t, resp.Result.Explanation)
+
+	e := resp.Result.Explanation
+	assert.Equal(t, ExplainMethodOcclusion, e.Method)
+	require.Len(t, e.Contributions, 2)
+	assert.Equal(t, "amount", e.Contributions[0].Feature)
+	assert.InDelta(t, 0.6, e.Contributions[0].Contribution, 1e-9)
+	assert.Equal(t, "tx_count_1h", e.Contributions[1].Feature)
+	assert.Equal(t, []string{"HIGH_AMOUNT", "FEATURE_TX_COUNT_1H"}, e.ReasonCodes)
+
+	// Requests without explain are not explained.
+	req := explainRequest()
+	req.Explain = false
+	resp, err = svc.Predict(context.Background(), req)
+	require.NoError(t, err)
+	assert.Nil(t, resp.Result.Explanation)
+}
+
+func TestVendorService_ExplainOcclusionDeadline(t *testing.T) {
+	// Occlusion calls, which do not ask the vendor to explain, outlast the
+	// request.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body clients.PredictRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if !body.Explain {
+			time.Sleep(time.Second)
+		}
+		var resp clients.PredictResponse
+		resp.Meta.ModelName = body.Model
+		resp.Result.Threshold = 0.5
+		resp.Result.Score = 0.5
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	svc := NewVendorService(client, zerolog.Nop(),
+		WithExplain(ExplainSettings{Timeout: time.Minute}, clients.NewThirdPartyClient(server.URL, "", zerolog.Nop(), clients.WithRetryCount(0))))
+
+	// The prediction is answered before the deadline of the request, without
+	// the contributions that could not be computed in time.
+	ctx, cancel := context.WithTimeout(context.Background(), explainDeadlineMargin+300*time.Millisecond)
+	defer cancel()
+	resp, err := svc.Predict(ctx, explainRequest())
+	require.NoError(t, err)
+	assert.NoError(t, ctx.Err())
+	assert.Nil(t, resp.Result.Explanation)
+}
+
+func TestVendorService_ExplainOcclusionBounded(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	occluded := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body clients.PredictRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		for name, v := range body.Features {
+			if f, _ := toFloat(v); f == 0 {
+				occluded[name] = true
+			}
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		var resp clients.PredictResponse
+		resp.Meta.ModelName = body.Model
+		resp.Result.Threshold = 0.5
+		resp.Result.Score = 0.5
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	svc := NewVendorService(client, zerolog.Nop(),
+		WithDerivedFeatures("velocity_1h"),
+		WithExplain(ExplainSettings{
+			Concurrency:      2,
+			ExcludedFeatures: []string{"transaction_id"},
+		}, client))
+
+	req := explainRequest()
+	req.Features["transaction_id"] = int64(12345)
+	req.Features["velocity_1h"] = int64(3)
+	for i := 0; i < 4; i++ {
+		req.Features[fmt.Sprintf("f%d", i)] = float64(i + 1)
+	}
+	_, err := svc.Predict(context.Background(), req)
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.LessOrEqual(t, maxInFlight, 2)
+	assert.True(t, occluded["amount"])
+	assert.True(t, occluded["f3"])
+	assert.False(t, occluded["transaction_id"])
+	assert.False(t, occluded["velocity_1h"])
+}
+
+func TestVendorService_ExplainVendor(t *testing.T) {
+	server := explainVendor(t, map[string]float64{
+		"amount":           0.4,
+		"account_age_days": -0.3,
+		"merchant_type":    0.1,
+	})
+	defer server.Close()
+
+	svc := NewVendorService(clients.NewThirdPartyClient(server.URL, "", zerolog.Nop()), zerolog.Nop())
+
+	resp, err := svc.Predict(context.Background(), explainRequest())
+	require.NoError(t, err)
+	require.NotNil(t, resp.Result.Explanation)
+
+	e := resp.Result.Explanation
+	assert.Equal(t, ExplainMethodVendor, e.Method)
+	require.Len(t, e.Contributions, 3)
+	assert.Equal(t, "account_age_days", e.Contributions[1].Feature)
+	// Features that lowered the score have no reason code.
+	assert.Empty(t, e.Contributions[1].ReasonCode)
+	assert.Equal(t, []string{"FEATURE_AMOUNT", "FEATURE_MERCHANT_TYPE"}, e.ReasonCodes)
+}
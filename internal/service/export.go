@@ -0,0 +1,412 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/parquet-go/parquet-go"
+)
+
+// ExportFormat is the file format of an inference log export.
+type ExportFormat string
+
+const (
+	ExportCSV     ExportFormat = "csv"
+	ExportNDJSON  ExportFormat = "ndjson"
+	ExportParquet ExportFormat = "parquet"
+)
+
+const (
+	defaultExportBatchSize = 1000
+	// exportRowGroupSize bounds the rows the parquet writer buffers in memory.
+	exportRowGroupSize = 10000
+	// exportFeaturePrefix is prepended to the request features to name their
+	// columns.
+	exportFeaturePrefix = "feature_"
+)
+
+// ParseExportFormat validates an export format name. An empty name selects
+// CSV.
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch f := ExportFormat(name); f {
+	case "":
+		return ExportCSV, nil
+	case ExportCSV, ExportNDJSON, ExportParquet:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w: format must be one of [csv ndjson parquet]", ErrInvalidLogFilter)
+	}
+}
+
+// ContentType is the media type of an export in format f.
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportNDJSON:
+		return "application/x-ndjson"
+	case ExportParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv"
+	}
+}
+
+// ExportFilter selects the successful predictions requested in [From, To).
+// A nil UserID exports the predictions of every user and is only used by the
+// export command.
+type ExportFilter struct {
+	From     time.Time
+	To       time.Time
+	UserID   *int64
+	APIKeyID *int64
+	Model    string
+}
+
+// ExportService dumps the inference logs, joined with their feedback label, one
+// row per prediction. Request features are flattened into "feature_<name>"
+// columns; the columns are fixed when the export starts, so features first
+// seen in predictions logged during the export are left out.
+type ExportService interface {
+	// Export streams the rows matching filter to w in batches and returns the
+	// number of rows written. Nothing is written when the filter is invalid.
+	Export(ctx context.Context, w io.Writer, format ExportFormat, filter ExportFilter) (int, error)
+}
+
+type exportService struct {
+	exportRepo repo.ExportRepository
+	batchSize  int32
+}
+
+func NewExportService(exportRepo repo.ExportRepository, batchSize int32) ExportService {
+	if batchSize <= 0 {
+		batchSize = defaultExportBatchSize
+	}
+	return &exportService{exportRepo: exportRepo, batchSize: batchSize}
+}
+
+func (s *exportService) Export(ctx context.Context, w io.Writer, format ExportFormat, filter ExportFilter) (int, error) {
+	if _, err := ParseExportFormat(string(format)); err != nil {
+		return 0, err
+	}
+	if !filter.From.Before(filter.To) {
+		return 0, fmt.Errorf("%w: from must be before to", ErrInvalidLogFilter)
+	}
+
+	params := db.ListExportRowsParams{
+		FromTime: filter.From,
+		ToTime:   filter.To,
+		Model:    sql.NullString{String: filter.Model, Valid: filter.Model != ""},
+		MaxRows:  s.batchSize,
+	}
+	if filter.UserID != nil {
+		params.UserID = sql.NullInt64{Int64: *filter.UserID, Valid: true}
+	}
+	if filter.APIKeyID != nil {
+		params.ApiKeyID = sql.NullInt64{Int64: *filter.APIKeyID, Valid: true}
+	}
+
+	features, err := s.exportRepo.ListExportFeatureColumns(ctx, db.ListExportFeatureColumnsParams{
+		FromTime: params.FromTime,
+		ToTime:   params.ToTime,
+		UserID:   params.UserID,
+		ApiKeyID: params.ApiKeyID,
+		Model:    params.Model,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	columns := exportColumns(features)
+	ew, err := newExportWriter(w, format, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for {
+		rows, err := s.exportRepo.ListExportRows(ctx, params)
+		if err != nil {
+			return n, err
+		}
+		for _, row := range rows {
+			if err := ew.Write(exportValues(row, features)); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(rows) < int(s.batchSize) {
+			break
+		}
+		params.AfterID = rows[len(rows)-1].ID
+	}
+	return n, ew.Close()
+}
+
+type exportKind int
+
+const (
+	exportInt exportKind = iota
+	exportFloat
+	exportString
+	exportTime
+)
+
+type exportColumn struct {
+	Name string
+	Kind exportKind
+}
+
+// exportFixedColumns are the columns written before the features, in order.
+// exportValues must return their values in the same order.
+var exportFixedColumns = []exportColumn{
+	{"inference_id", exportInt},
+	{"user_id", exportInt},
+	{"api_key_id", exportInt},
+	{"request_time", exportTime},
+	{"model", exportString},
+	{"model_name", exportString},
+	{"prediction", exportInt},
+	{"score", exportFloat},
+	{"threshold", exportFloat},
+	{"decision", exportString},
+	{"label", exportString},
+	{"label_source", exportString},
+}
+
+func exportColumns(features []db.ListExportFeatureColumnsRow) []exportColumn {
+	columns := append([]exportColumn(nil), exportFixedColumns...)
+	for _, f := range features {
+		kind := exportString
+		if f.Numeric {
+			kind = exportFloat
+		}
+		columns = append(columns, exportColumn{Name: exportFeaturePrefix + f.Feature, Kind: kind})
+	}
+	return columns
+}
+
+// exportValues returns the values of row in column order: int64, float64,
+// string, time.Time or nil when unset.
+func exportValues(row db.ListExportRowsRow, features []db.ListExportFeatureColumnsRow) []interface{} {
+	values := make([]interface{}, 0, len(exportFixedColumns)+len(features))
+	values = append(values, row.ID, row.UserID, nil, row.RequestTime)
+	if row.ApiKeyID.Valid {
+		values[2] = row.ApiKeyID.Int64
+	}
+
+	var req PredictRequest
+	_ = json.Unmarshal(row.RequestPayload, &req)
+	values = append(values, req.Model)
+
+	var resp PredictResponse
+	if row.ResponsePayload.Valid && json.Unmarshal(row.ResponsePayload.RawMessage, &resp) == nil {
+		values = append(values, resp.Meta.ModelName, int64(resp.Result.Prediction), resp.Result.Score, resp.Result.Threshold)
+	} else {
+		values = append(values, nil, nil, nil, nil)
+	}
+
+	values = append(values, nullString(row.Decision), nullString(row.Label), nullString(row.LabelSource))
+
+	for _, f := range features {
+		values = append(values, exportFeatureValue(req.Features[f.Feature], f.Numeric))
+	}
+	return values
+}
+
+func nullString(s sql.NullString) interface{} {
+	if !s.Valid {
+		return nil
+	}
+	return s.String
+}
+
+// exportFeatureValue converts a request feature to the kind of its column.
+// Non-string values of string columns are written as JSON.
+func exportFeatureValue(v interface{}, numeric bool) interface{} {
+	if v == nil {
+		return nil
+	}
+	if numeric {
+		if f, ok := toFloat(v); ok {
+			return f
+		}
+		return nil
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
+// exportWriter encodes rows of values in column order. Close flushes the
+// buffered rows; the underlying writer is not closed.
+type exportWriter interface {
+	Write(values []interface{}) error
+	Close() error
+}
+
+func newExportWriter(w io.Writer, format ExportFormat, columns []exportColumn) (exportWriter, error) {
+	switch format {
+	case ExportNDJSON:
+		return &ndjsonExportWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case ExportParquet:
+		return newParquetExportWriter(w, columns), nil
+	default:
+		cw := csv.NewWriter(w)
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{w: cw, record: make([]string, len(columns))}, nil
+	}
+}
+
+type csvExportWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (e *csvExportWriter) Write(values []interface{}) error {
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			e.record[i] = ""
+		case int64:
+			e.record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			e.record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case time.Time:
+			e.record[i] = v.UTC().Format(time.RFC3339Nano)
+		case string:
+			e.record[i] = csvText(v)
+		}
+	}
+	return e.w.Write(e.record)
+}
+
+// csvText quotes text that a spreadsheet would evaluate as a formula, such as
+// a merchant name of "=HYPERLINK(...)", by prefixing it with a single quote.
+func csvText(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func (e *csvExportWriter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	w       *bufio.Writer
+	columns []exportColumn
+}
+
+// Write writes one flat JSON object per row, keeping the column order.
+func (e *ndjsonExportWriter) Write(values []interface{}) error {
+	_ = e.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			_ = e.w.WriteByte(',')
+		}
+		key, err := json.Marshal(e.columns[i].Name)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, _ = e.w.Write(key)
+		_ = e.w.WriteByte(':')
+		_, _ = e.w.Write(value)
+	}
+	_, err := e.w.WriteString("}\n")
+	return err
+}
+
+func (e *ndjsonExportWriter) Close() error {
+	return e.w.Flush()
+}
+
+// parquetExportWriter writes every column as an optional leaf. The schema
+// orders its leaves by name, so values are placed by their leaf index.
+type parquetExportWriter struct {
+	w       *parquet.Writer
+	columns []exportColumn
+	leaves  []int
+}
+
+func newParquetExportWriter(w io.Writer, columns []exportColumn) *parquetExportWriter {
+	group := make(parquet.Group, len(columns))
+	for _, c := range columns {
+		var node parquet.Node
+		switch c.Kind {
+		case exportInt:
+			node = parquet.Int(64)
+		case exportFloat:
+			node = parquet.Leaf(parquet.DoubleType)
+		case exportTime:
+			node = parquet.Timestamp(parquet.Millisecond)
+		default:
+			node = parquet.String()
+		}
+		group[c.Name] = parquet.Optional(node)
+	}
+	schema := parquet.NewSchema("inference_logs", group)
+
+	leaves := make([]int, len(columns))
+	for i, c := range columns {
+		leaf, _ := schema.Lookup(c.Name)
+		leaves[i] = leaf.ColumnIndex
+	}
+	return &parquetExportWriter{
+		w:       parquet.NewWriter(w, schema, parquet.MaxRowsPerRowGroup(exportRowGroupSize)),
+		columns: columns,
+		leaves:  leaves,
+	}
+}
+
+func (e *parquetExportWriter) Write(values []interface{}) error {
+	row := make(parquet.Row, len(values))
+	for i, v := range values {
+		var value parquet.Value
+		switch v := v.(type) {
+		case nil:
+			row[e.leaves[i]] = parquet.NullValue().Level(0, 0, e.leaves[i])
+			continue
+		case int64:
+			value = parquet.Int64Value(v)
+		case float64:
+			value = parquet.DoubleValue(v)
+		case time.Time:
+			value = parquet.Int64Value(v.UnixMilli())
+		case string:
+			value = parquet.ByteArrayValue([]byte(v))
+		}
+		row[e.leaves[i]] = value.Level(0, 1, e.leaves[i])
+	}
+	_, err := e.w.WriteRows([]parquet.Row{row})
+	return err
+}
+
+func (e *parquetExportWriter) Close() error {
+	return e.w.Close()
+}
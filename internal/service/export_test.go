@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/parquet-go/parquet-go"
+	"github.com/sqlc-dev/pqtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryExportRepo struct {
+	features []db.ListExportFeatureColumnsRow
+	rows     []db.ListExportRowsRow
+	batches  int
+}
+
+func (r *memoryExportRepo) ListExportFeatureColumns(ctx context.Context, arg db.ListExportFeatureColumnsParams) ([]db.ListExportFeatureColumnsRow, error) {
+	return r.features, nil
+}
+
+func (r *memoryExportRepo) ListExportRows(ctx context.Context, arg db.ListExportRowsParams) ([]db.ListExportRowsRow, error) {
+	r.batches++
+	var out []db.ListExportRowsRow
+	for _, row := range r.rows {
+		if row.ID > arg.AfterID && len(out) < int(arg.MaxRows) {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+func exportFixture() *memoryExportRepo {
+	requestTime := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	response := pqtype.NullRawMessage{
+		RawMessage: []byte(`{"meta":{"model_name":"FraudDetector-logreg"},"result":{"prediction":1,"score":0.9,"threshold":0.5}}`),
+		Valid:      true,
+	}
+	return &memoryExportRepo{
+		features: []db.ListExportFeatureColumnsRow{
+			{Feature: "amount", Numeric: true},
+			{Feature: "merchant_type"},
+		},
+		rows: []db.ListExportRowsRow{
+			{
+				ID: 1, UserID: 1, RequestTime: requestTime,
+				ApiKeyID:        sql.NullInt64{Int64: 7, Valid: true},
+				RequestPayload:  []byte(`{"model":"logreg","features":{"amount":250.5,"merchant_type":"electronics"}}`),
+				ResponsePayload: response,
+				Decision:        sql.NullString{String: "review", Valid: true},
+				Label:           sql.NullString{String: "fraud", Valid: true},
+				LabelSource:     sql.NullString{String: "chargeback", Valid: true},
+			},
+			{
+				ID: 2, UserID: 1, RequestTime: requestTime.Add(time.Minute),
+				RequestPayload:  []byte(`{"model":"logreg","features":{"merchant_type":{"code":5732}}}`),
+				ResponsePayload: response,
+			},
+			{
+				ID: 5, UserID: 2, RequestTime: requestTime.Add(2 * time.Minute),
+				RequestPayload:  []byte(`{"model":"logreg","features":{"amount":10}}`),
+				ResponsePayload: response,
+			},
+		},
+	}
+}
+
+func exportWindow() ExportFilter {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	return ExportFilter{From: from, To: from.Add(24 * time.Hour)}
+}
+
+func TestExportService_CSV(t *testing.T) {
+	repo := exportFixture()
+	svc := NewExportService(repo, 2)
+
+	var buf bytes.Buffer
+	n, err := svc.Export(context.Background(), &buf, ExportCSV, exportWindow())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	// A full batch, then the short one that ends the export.
+	assert.Equal(t, 2, repo.batches)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, []string{
+		"inference_id", "user_id", "api_key_id", "request_time", "model", "model_name", "prediction",
+		"score", "threshold", "decision", "label", "label_source", "feature_amount", "feature_merchant_type",
+	}, records[0])
+	assert.Equal(t, []string{
+		"1", "1", "7", "2026-03-01T12:00:00Z", "logreg", "FraudDetector-logreg", "1",
+		"0.9", "0.5", "review", "fraud", "chargeback", "250.5", "electronics",
+	}, records[1])
+	// Missing features are empty and non-string values are written as JSON.
+	assert.Equal(t, "", records[2][2])
+	assert.Equal(t, "", records[2][12])
+	assert.Equal(t, `{"code":5732}`, records[2][13])
+}
+
+func TestExportService_CSVFormulas(t *testing.T) {
+	repo := exportFixture()
+	repo.rows[2].RequestPayload = []byte(`{"model":"logreg","features":{"amount":-10,"merchant_type":"=HYPERLINK(\"https://example.com\")"}}`)
+	svc := NewExportService(repo, 0)
+
+	var buf bytes.Buffer
+	_, err := svc.Export(context.Background(), &buf, ExportCSV, exportWindow())
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	// Numbers are written as is.
+	assert.Equal(t, "-10", records[3][12])
+	assert.Equal(t, `'=HYPERLINK("https://example.com")`, records[3][13])
+}
+
+func TestExportService_NDJSON(t *testing.T) {
+	svc := NewExportService(exportFixture(), 0)
+
+	var buf bytes.Buffer
+	n, err := svc.Export(context.Background(), &buf, ExportNDJSON, exportWindow())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	scanner := bufio.NewScanner(&buf)
+	require.True(t, scanner.Scan())
+	var first map[string]interface{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &first))
+	assert.Equal(t, float64(1), first["inference_id"])
+	assert.Equal(t, "fraud", first["label"])
+	assert.Equal(t, 250.5, first["feature_amount"])
+
+	require.True(t, scanner.Scan())
+	require.True(t, scanner.Scan())
+	var last map[string]interface{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &last))
+	assert.Nil(t, last["label"])
+	assert.Nil(t, last["feature_merchant_type"])
+	assert.False(t, scanner.Scan())
+}
+
+func TestExportService_Parquet(t *testing.T) {
+	svc := NewExportService(exportFixture(), 0)
+
+	var buf bytes.Buffer
+	n, err := svc.Export(context.Background(), &buf, ExportParquet, exportWindow())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), f.NumRows())
+
+	type exportRow struct {
+		InferenceID  int64     `parquet:"inference_id"`
+		APIKeyID     *int64    `parquet:"api_key_id,optional"`
+		RequestTime  time.Time `parquet:"request_time,timestamp(millisecond)"`
+		Score        *float64  `parquet:"score,optional"`
+		Label        *string   `parquet:"label,optional"`
+		Amount       *float64  `parquet:"feature_amount,optional"`
+		MerchantType *string   `parquet:"feature_merchant_type,optional"`
+	}
+	rows, err := parquet.Read[exportRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, int64(1), rows[0].InferenceID)
+	require.NotNil(t, rows[0].APIKeyID)
+	assert.Equal(t, int64(7), *rows[0].APIKeyID)
+	assert.True(t, rows[0].RequestTime.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)))
+	require.NotNil(t, rows[0].Label)
+	assert.Equal(t, "fraud", *rows[0].Label)
+	require.NotNil(t, rows[0].Amount)
+	assert.Equal(t, 250.5, *rows[0].Amount)
+	assert.Nil(t, rows[1].APIKeyID)
+	assert.Nil(t, rows[1].Amount)
+	assert.Equal(t, int64(5), rows[2].InferenceID)
+	assert.Nil(t, rows[2].MerchantType)
+}
+
+func TestExportService_InvalidFilter(t *testing.T) {
+	svc := NewExportService(exportFixture(), 0)
+	filter := exportWindow()
+
+	var buf bytes.Buffer
+	_, err := svc.Export(context.Background(), &buf, "xlsx", filter)
+	assert.ErrorIs(t, err, ErrInvalidLogFilter)
+
+	filter.From, filter.To = filter.To, filter.From
+	_, err = svc.Export(context.Background(), &buf, ExportCSV, filter)
+	assert.ErrorIs(t, err, ErrInvalidLogFilter)
+	assert.Zero(t, buf.Len())
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// FallbackMode selects how predictions are scored while the vendor is
+// unavailable.
+type FallbackMode string
+
+const (
+	// FallbackOff fails predictions while the vendor is unavailable.
+	FallbackOff FallbackMode = "off"
+	// FallbackLogistic scores predictions with a local logistic regression.
+	FallbackLogistic FallbackMode = "logistic"
+	// FallbackRules decides predictions with the rules alone: requests that no
+	// pre-model rule decided get the configured fallback decision.
+	FallbackRules FallbackMode = "rules"
+)
+
+// ScoringPath records how a prediction was scored.
+type ScoringPath string
+
+const (
+	ScoringPathVendor           ScoringPath = "vendor"
+	ScoringPathRules            ScoringPath = "rules"
+	ScoringPathFallbackLogistic ScoringPath = "fallback_logistic"
+	ScoringPathFallbackRules    ScoringPath = "fallback_rules"
+)
+
+// FallbackModel is reported as the model name of predictions decided by the
+// rules-only fallback, and is the default name of the logistic fallback.
+const FallbackModel = "fallback"
+
+// FallbackReasonCode is the reason code of decisions made by the rules-only
+// fallback.
+const FallbackReasonCode = "vendor_unavailable"
+
+var ErrInvalidFallback = errors.New("invalid fallback configuration")
+
+var fallbackPredictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "fallback_predictions_total",
+	Help: "Total number of predictions scored by the local fallback while the vendor was unavailable, by mode.",
+}, []string{"mode"})
+
+// LogisticModel is a logistic regression evaluated in process. It is loaded
+// from a JSON file such as:
+//
+//	{
+//	  "name": "fallback-logreg-2026-04",
+//	  "intercept": -4.2,
+//	  "threshold": 0.5,
+//	  "coefficients": {"amount": 0.0004, "is_new_device": 1.1, "country=NG": 1.3}
+//	}
+//
+// Numeric and boolean features are multiplied by the coefficient of their
+// name. String features match the coefficient named "feature=value", so
+// categorical features can be one-hot encoded. Missing features count as 0.
+type LogisticModel struct {
+	Name         string             `json:"name"`
+	Intercept    float64            `json:"intercept"`
+	Threshold    float64            `json:"threshold"`
+	Coefficients map[string]float64 `json:"coefficients"`
+}
+
+// LoadLogisticModel reads and validates a logistic model file. The name
+// defaults to FallbackModel and the threshold to 0.5.
+func LoadLogisticModel(path string) (*LogisticModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFallback, err)
+	}
+	m, err := parseLogisticModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFallback, path, err)
+	}
+	return m, nil
+}
+
+func parseLogisticModel(data []byte) (*LogisticModel, error) {
+	var m LogisticModel
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if m.Name == "" {
+		m.Name = FallbackModel
+	}
+	if m.Threshold == 0 {
+		m.Threshold = 0.5
+	}
+	if m.Threshold < 0 || m.Threshold > 1 {
+		return nil, fmt.Errorf("threshold must be between 0 and 1")
+	}
+	if len(m.Coefficients) == 0 {
+		return nil, fmt.Errorf("no coefficients")
+	}
+	return &m, nil
+}
+
+// Score returns the probability of fraud for features.
+func (m *LogisticModel) Score(features map[string]interface{}) float64 {
+	z := m.Intercept
+	for name, value := range features {
+		switch v := value.(type) {
+		case string:
+			z += m.Coefficients[name+"="+v]
+		case bool:
+			if v {
+				z += m.Coefficients[name]
+			}
+		default:
+			if x, ok := toFloat(v); ok {
+				z += m.Coefficients[name] * x
+			}
+		}
+	}
+	return 1 / (1 + math.Exp(-z))
+}
+
+// Features returns the features with a coefficient, sorted. One-hot
+// coefficients count as their feature.
+func (m *LogisticModel) Features() []string {
+	seen := make(map[string]bool, len(m.Coefficients))
+	names := make([]string, 0, len(m.Coefficients))
+	for name := range m.Coefficients {
+		name, _, _ = strings.Cut(name, "=")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FallbackSettings configures the local fallback. Model is required in
+// logistic mode; Decision is used in rules mode and defaults to review.
+type FallbackSettings struct {
+	Mode     FallbackMode
+	Model    *LogisticModel
+	Decision Decision
+}
+
+// Fallback scores predictions in process while the vendor is unavailable.
+// Its responses are marked degraded.
+type Fallback struct {
+	mode     FallbackMode
+	model    *LogisticModel
+	decision Decision
+}
+
+// NewFallback returns the fallback for settings, or nil in FallbackOff mode.
+func NewFallback(settings FallbackSettings) (*Fallback, error) {
+	f := &Fallback{mode: settings.Mode, model: settings.Model, decision: settings.Decision}
+	switch f.mode {
+	case "", FallbackOff:
+		return nil, nil
+	case FallbackLogistic:
+		if f.model == nil {
+			return nil, fmt.Errorf("%w: logistic mode requires a model file", ErrInvalidFallback)
+		}
+	case FallbackRules:
+		switch f.decision {
+		case "":
+			f.decision = DecisionReview
+		case DecisionApprove, DecisionReview, DecisionDecline:
+		default:
+			return nil, fmt.Errorf("%w: unknown decision %q", ErrInvalidFallback, f.decision)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidFallback, f.mode)
+	}
+	return f, nil
+}
+
+// Mode returns the mode of the fallback.
+func (f *Fallback) Mode() FallbackMode {
+	return f.mode
+}
+
+// Predict scores req locally. In rules mode the response carries the fallback
+// decision and no score.
+func (f *Fallback) Predict(req PredictRequest) PredictResponse {
+	var resp PredictResponse
+	resp.Meta.RequestID = uuid.New().String()
+	resp.Meta.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	resp.Meta.Degraded = true
+
+	if f.mode == FallbackRules {
+		resp.Meta.ModelName = FallbackModel
+		resp.Result.Decision = f.decision
+		resp.Result.ReasonCode = FallbackReasonCode
+		if f.decision == DecisionDecline {
+			resp.Result.Prediction = 1
+		}
+		resp.path = ScoringPathFallbackRules
+	} else {
+		resp.Meta.ModelName = f.model.Name
+		resp.Result.Score = f.model.Score(req.Features)
+		resp.Result.Threshold = f.model.Threshold
+		if resp.Result.Score >= resp.Result.Threshold {
+			resp.Result.Prediction = 1
+		}
+		resp.path = ScoringPathFallbackLogistic
+	}
+
+	fallbackPredictionsTotal.WithLabelValues(string(f.mode)).Inc()
+	return resp
+}
+
+// vendorUnavailable reports whether a failed vendor prediction should be
+// scored by the fallback instead.
+func vendorUnavailable(err error) bool {
+	return clients.IsUnavailable(err) || errors.Is(err, ErrEnsembleUnavailable)
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unavailableVendorService fails every prediction with err.
+type unavailableVendorService struct {
+	fakeVendorService
+	err error
+}
+
+func (v unavailableVendorService) Predict(ctx context.Context, req PredictRequest) (PredictResponse, error) {
+	return PredictResponse{}, v.err
+}
+
+// ValidateModel fails like a model registry that was never loaded.
+func (v unavailableVendorService) ValidateModel(ctx context.Context, model string) error {
+	return v.err
+}
+
+func writeModelFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fallback.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadLogisticModel(t *testing.T) {
+	m, err := LoadLogisticModel(writeModelFile(t, `{"intercept": -2, "coefficients": {"amount": 0.01, "is_new_device": 1, "country=NG": 2}}`))
+	require.NoError(t, err)
+	assert.Equal(t, FallbackModel, m.Name)
+	assert.Equal(t, 0.5, m.Threshold)
+
+	assert.InDelta(t, 0.1192, m.Score(map[string]interface{}{}), 0.0001)
+	// -2 + 0.01*100 + 1 + 2 = 2
+	assert.InDelta(t, 0.8808, m.Score(map[string]interface{}{"amount": 100.0, "is_new_device": true, "country": "NG", "ignored": "x"}), 0.0001)
+	assert.InDelta(t, 0.2689, m.Score(map[string]interface{}{"amount": 100, "is_new_device": false, "country": "FR"}), 0.0001)
+
+	for _, content := range []string{
+		`{"intercept": 1}`,
+		`{"threshold": 2, "coefficients": {"amount": 1}}`,
+		`not json`,
+	} {
+		_, err := LoadLogisticModel(writeModelFile(t, content))
+		assert.ErrorIs(t, err, ErrInvalidFallback, content)
+	}
+	_, err = LoadLogisticModel(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, ErrInvalidFallback)
+}
+
+func TestNewFallback(t *testing.T) {
+	f, err := NewFallback(FallbackSettings{Mode: FallbackOff})
+	require.NoError(t, err)
+	assert.Nil(t, f)
+
+	_, err = NewFallback(FallbackSettings{Mode: FallbackLogistic})
+	assert.ErrorIs(t, err, ErrInvalidFallback)
+	_, err = NewFallback(FallbackSettings{Mode: FallbackRules, Decision: "maybe"})
+	assert.ErrorIs(t, err, ErrInvalidFallback)
+	_, err = NewFallback(FallbackSettings{Mode: "onnx"})
+	assert.ErrorIs(t, err, ErrInvalidFallback)
+
+	f, err = NewFallback(FallbackSettings{Mode: FallbackRules})
+	require.NoError(t, err)
+	resp := f.Predict(PredictRequest{Model: "logreg"})
+	assert.Equal(t, DecisionReview, resp.Result.Decision)
+	assert.True(t, resp.Meta.Degraded)
+}
+
+func TestScoringService_Fallback(t *testing.T) {
+	ctx := context.Background()
+	model := &LogisticModel{Name: "fallback-logreg", Intercept: -2, Threshold: 0.5, Coefficients: map[string]float64{"amount": 0.01}}
+	logistic, err := NewFallback(FallbackSettings{Mode: FallbackLogistic, Model: model})
+	require.NoError(t, err)
+	before := testutil.ToFloat64(fallbackPredictionsTotal.WithLabelValues(string(FallbackLogistic)))
+
+	open := unavailableVendorService{err: gobreaker.ErrOpenState}
+	svc := NewScoringService(open, nil, nil, nil, zerolog.Nop(), WithFallback(logistic))
+	resp, err := svc.Score(ctx, 1, nil, PredictRequest{Model: "logreg", Features: map[string]interface{}{"amount": 300.0}})
+	require.NoError(t, err)
+	assert.True(t, resp.Meta.Degraded)
+	assert.Equal(t, "fallback-logreg", resp.Meta.ModelName)
+	assert.Equal(t, ScoringPathFallbackLogistic, resp.ScoringPath())
+	assert.InDelta(t, 0.7311, resp.Result.Score, 0.0001)
+	assert.Equal(t, 1, resp.Result.Prediction)
+	// The decision policy still applies to fallback scores.
+	assert.Equal(t, DecisionDecline, resp.Result.Decision)
+	assert.Equal(t, before+1, testutil.ToFloat64(fallbackPredictionsTotal.WithLabelValues(string(FallbackLogistic))))
+
+	// Vendor errors that are not unavailability still fail the prediction.
+	svc = NewScoringService(unavailableVendorService{err: errors.New("vendor API returned non-200 status")}, nil, nil, nil, zerolog.Nop(), WithFallback(logistic))
+	_, err = svc.Score(ctx, 1, nil, PredictRequest{Model: "logreg"})
+	assert.Error(t, err)
+
+	rules, err := NewFallback(FallbackSettings{Mode: FallbackRules, Decision: DecisionDecline})
+	require.NoError(t, err)
+	svc = NewScoringService(unavailableVendorService{err: ErrEnsembleUnavailable}, nil, nil, nil, zerolog.Nop(), WithFallback(rules))
+	resp, err = svc.Score(ctx, 1, nil, PredictRequest{Model: EnsembleModel})
+	require.NoError(t, err)
+	assert.True(t, resp.Meta.Degraded)
+	assert.Equal(t, ScoringPathFallbackRules, resp.ScoringPath())
+	assert.Equal(t, DecisionDecline, resp.Result.Decision)
+	assert.Equal(t, FallbackReasonCode, resp.Result.ReasonCode)
+
+	// Without a fallback the prediction fails as before.
+	_, err = NewScoringService(open, nil, nil, nil, zerolog.Nop()).Score(ctx, 1, nil, PredictRequest{Model: "logreg"})
+	assert.ErrorIs(t, err, gobreaker.ErrOpenState)
+
+	// Vendor predictions take the vendor path.
+	resp, err = NewScoringService(fakeVendorService{}, nil, nil, nil, zerolog.Nop(), WithFallback(logistic)).Score(ctx, 1, nil, PredictRequest{Model: "logreg"})
+	require.NoError(t, err)
+	assert.False(t, resp.Meta.Degraded)
+	assert.Equal(t, ScoringPathVendor, resp.ScoringPath())
+}
+
+func TestScoringService_ValidateFallback(t *testing.T) {
+	ctx := context.Background()
+	rules, err := NewFallback(FallbackSettings{Mode: FallbackRules, Decision: DecisionReview})
+	require.NoError(t, err)
+	req := PredictRequest{Model: "logreg"}
+
+	open := unavailableVendorService{err: gobreaker.ErrOpenState}
+	assert.NoError(t, NewScoringService(open, nil, nil, nil, zerolog.Nop(), WithFallback(rules)).Validate(ctx, req))
+	assert.ErrorIs(t, NewScoringService(open, nil, nil, nil, zerolog.Nop()).Validate(ctx, req), gobreaker.ErrOpenState)
+
+	// Only an unavailable registry is left to the fallback.
+	failing := unavailableVendorService{err: errors.New("vendor API returned non-200 status")}
+	assert.Error(t, NewScoringService(failing, nil, nil, nil, zerolog.Nop(), WithFallback(rules)).Validate(ctx, req))
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+// Feature kinds reported by FeatureDrift.
+const (
+	FeatureKindNumeric     = "numeric"
+	FeatureKindCategorical = "categorical"
+)
+
+const (
+	// driftBins is the number of reference quantile bins used for the PSI of
+	// numeric features.
+	driftBins = 10
+	// minDriftSamples is the number of values a feature needs in both windows
+	// before its drift is computed.
+	minDriftSamples = 30
+	// psiEpsilon stands in for empty bins so that PSI stays finite.
+	psiEpsilon = 1e-4
+)
+
+var (
+	featureDriftPSI = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "feature_drift_psi",
+		Help: "Population stability index of the feature between the reference and recent window.",
+	}, []string{"feature"})
+	featureDriftKS = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "feature_drift_ks",
+		Help: "Kolmogorov-Smirnov statistic of a numeric feature between the reference and recent window.",
+	}, []string{"feature"})
+	featureDriftAlert = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "feature_drift_alert",
+		Help: "1 if the drift of the feature crossed the PSI or KS threshold in the latest snapshot, else 0.",
+	}, []string{"feature"})
+)
+
+// FeatureDrift compares the distribution of one feature in the recent window
+// with the reference window. KS is only computed for numeric features.
+type FeatureDrift struct {
+	ID             int64     `json:"id"`
+	Feature        string    `json:"feature"`
+	Kind           string    `json:"kind"`
+	ReferenceFrom  time.Time `json:"reference_from"`
+	ReferenceTo    time.Time `json:"reference_to"`
+	RecentFrom     time.Time `json:"recent_from"`
+	RecentTo       time.Time `json:"recent_to"`
+	ReferenceCount int64     `json:"reference_count"`
+	RecentCount    int64     `json:"recent_count"`
+	PSI            float64   `json:"psi"`
+	KS             *float64  `json:"ks"`
+	Drifted        bool      `json:"drifted"`
+	ComputedAt     time.Time `json:"computed_at"`
+}
+
+// DriftSettings configures the drift monitor. The recent window ends at the
+// time of the run and the reference window ends where the recent one starts.
+type DriftSettings struct {
+	ReferenceWindow  time.Duration
+	RecentWindow     time.Duration
+	PSIThreshold     float64
+	KSThreshold      float64
+	MaxSamples       int32
+	ExcludedFeatures []string
+}
+
+type FeatureDriftService interface {
+	// Compute snapshots the drift of every feature at now and updates the
+	// Prometheus gauges. A snapshot of the same feature and window is
+	// replaced.
+	Compute(ctx context.Context, now time.Time) ([]FeatureDrift, error)
+	// List returns the snapshots computed in [from, to), for every feature if
+	// feature is empty.
+	List(ctx context.Context, from, to time.Time, feature string) ([]FeatureDrift, error)
+}
+
+type featureDriftService struct {
+	driftRepo repo.FeatureDriftRepository
+	settings  DriftSettings
+	excluded  map[string]bool
+	logger    zerolog.Logger
+}
+
+func NewFeatureDriftService(driftRepo repo.FeatureDriftRepository, settings DriftSettings, logger zerolog.Logger) FeatureDriftService {
+	excluded := make(map[string]bool, len(settings.ExcludedFeatures))
+	for _, name := range settings.ExcludedFeatures {
+		excluded[name] = true
+	}
+	return &featureDriftService{
+		driftRepo: driftRepo,
+		settings:  settings,
+		excluded:  excluded,
+		logger:    logger,
+	}
+}
+
+func (s *featureDriftService) Compute(ctx context.Context, now time.Time) ([]FeatureDrift, error) {
+	recentFrom := now.Add(-s.settings.RecentWindow)
+	referenceFrom := recentFrom.Add(-s.settings.ReferenceWindow)
+
+	reference, err := s.loadFeatures(ctx, referenceFrom, recentFrom)
+	if err != nil {
+		return nil, err
+	}
+	recent, err := s.loadFeatures(ctx, recentFrom, now)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(reference))
+	for name := range reference {
+		if len(reference[name]) >= minDriftSamples && len(recent[name]) >= minDriftSamples {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	featureDriftPSI.Reset()
+	featureDriftKS.Reset()
+	featureDriftAlert.Reset()
+
+	drifts := make([]FeatureDrift, 0, len(names))
+	for _, name := range names {
+		kind, psi, ks := compareDistributions(reference[name], recent[name])
+		drifted := psi >= s.settings.PSIThreshold || (ks != nil && *ks >= s.settings.KSThreshold)
+
+		row, err := s.driftRepo.CreateFeatureDriftSnapshot(ctx, db.CreateFeatureDriftSnapshotParams{
+			Feature:        name,
+			Kind:           kind,
+			ReferenceFrom:  referenceFrom,
+			ReferenceTo:    recentFrom,
+			RecentFrom:     recentFrom,
+			RecentTo:       now,
+			ReferenceCount: int64(len(reference[name])),
+			RecentCount:    int64(len(recent[name])),
+			Psi:            psi,
+			Ks:             nullFloat(ks),
+			Drifted:        drifted,
+		})
+		if err != nil {
+			return nil, err
+		}
+		drift := toFeatureDrift(row)
+		drifts = append(drifts, drift)
+
+		featureDriftPSI.WithLabelValues(name).Set(psi)
+		if ks != nil {
+			featureDriftKS.WithLabelValues(name).Set(*ks)
+		}
+		alert := 0.0
+		if drifted {
+			alert = 1
+			s.logger.Warn().Str("feature", name).Float64("psi", psi).Msg("feature drift threshold crossed")
+		}
+		featureDriftAlert.WithLabelValues(name).Set(alert)
+	}
+	return drifts, nil
+}
+
+func (s *featureDriftService) List(ctx context.Context, from, to time.Time, feature string) ([]FeatureDrift, error) {
+	rows, err := s.driftRepo.ListFeatureDriftSnapshots(ctx, from, to, feature)
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := make([]FeatureDrift, len(rows))
+	for i, row := range rows {
+		drifts[i] = toFeatureDrift(row)
+	}
+	return drifts, nil
+}
+
+// loadFeatures returns the values of every logged feature in [from, to),
+// skipping excluded features and nulls.
+func (s *featureDriftService) loadFeatures(ctx context.Context, from, to time.Time) (map[string][]interface{}, error) {
+	vectors, err := s.driftRepo.ListFeatureVectors(ctx, from, to, s.settings.MaxSamples)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]interface{})
+	for _, raw := range vectors {
+		var features map[string]interface{}
+		if err := json.Unmarshal(raw, &features); err != nil {
+			continue
+		}
+		for name, v := range features {
+			if v == nil || s.excluded[name] {
+				continue
+			}
+			values[name] = append(values[name], v)
+		}
+	}
+	return values, nil
+}
+
+// compareDistributions treats a feature as numeric if every reference value
+// is a number, and as categorical otherwise.
+func compareDistributions(reference, recent []interface{}) (string, float64, *float64) {
+	refNums, refOK := toFloats(reference)
+	recNums, recOK := toFloats(recent)
+	if refOK && recOK {
+		ks := ksStatistic(refNums, recNums)
+		return FeatureKindNumeric, numericPSI(refNums, recNums), &ks
+	}
+	return FeatureKindCategorical, categoricalPSI(reference, recent), nil
+}
+
+func toFloats(values []interface{}) ([]float64, bool) {
+	nums := make([]float64, len(values))
+	for i, v := range values {
+		n, ok := toFloat(v)
+		if !ok {
+			return nil, false
+		}
+		nums[i] = n
+	}
+	return nums, true
+}
+
+// numericPSI bins both samples by the quantiles of the reference sample.
+func numericPSI(reference, recent []float64) float64 {
+	sorted := make([]float64, len(reference))
+	copy(sorted, reference)
+	sort.Float64s(sorted)
+
+	var edges []float64
+	for i := 1; i < driftBins; i++ {
+		edge := sorted[i*len(sorted)/driftBins]
+		if len(edges) == 0 || edge > edges[len(edges)-1] {
+			edges = append(edges, edge)
+		}
+	}
+
+	bin := func(v float64) string {
+		return fmt.Sprint(sort.Search(len(edges), func(i int) bool { return v < edges[i] }))
+	}
+	refBins := make([]interface{}, len(reference))
+	for i, v := range reference {
+		refBins[i] = bin(v)
+	}
+	recBins := make([]interface{}, len(recent))
+	for i, v := range recent {
+		recBins[i] = bin(v)
+	}
+	return categoricalPSI(refBins, recBins)
+}
+
+// categoricalPSI is sum((recent - reference) * ln(recent / reference)) over the
+// share of each value.
+func categoricalPSI(reference, recent []interface{}) float64 {
+	refShare := shares(reference)
+	recShare := shares(recent)
+
+	var psi float64
+	seen := make(map[string]bool)
+	for _, m := range []map[string]float64{refShare, recShare} {
+		for k := range m {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			r := math.Max(refShare[k], psiEpsilon)
+			q := math.Max(recShare[k], psiEpsilon)
+			psi += (q - r) * math.Log(q/r)
+		}
+	}
+	return psi
+}
+
+func shares(values []interface{}) map[string]float64 {
+	counts := make(map[string]float64)
+	for _, v := range values {
+		counts[fmt.Sprint(v)]++
+	}
+	for k := range counts {
+		counts[k] /= float64(len(values))
+	}
+	return counts
+}
+
+// ksStatistic is the largest distance between the empirical CDFs of a and b.
+func ksStatistic(a, b []float64) float64 {
+	a = append([]float64(nil), a...)
+	b = append([]float64(nil), b...)
+	sort.Float64s(a)
+	sort.Float64s(b)
+
+	var i, j int
+	var d float64
+	for i < len(a) && j < len(b) {
+		v := math.Min(a[i], b[j])
+		for i < len(a) && a[i] == v {
+			i++
+		}
+		for j < len(b) && b[j] == v {
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(i)/float64(len(a))-float64(j)/float64(len(b))))
+	}
+	return d
+}
+
+func toFeatureDrift(row db.FeatureDriftSnapshot) FeatureDrift {
+	return FeatureDrift{
+		ID:             row.ID,
+		Feature:        row.Feature,
+		Kind:           row.Kind,
+		ReferenceFrom:  row.ReferenceFrom,
+		ReferenceTo:    row.ReferenceTo,
+		RecentFrom:     row.RecentFrom,
+		RecentTo:       row.RecentTo,
+		ReferenceCount: row.ReferenceCount,
+		RecentCount:    row.RecentCount,
+		PSI:            row.Psi,
+		KS:             floatPtr(row.Ks),
+		Drifted:        row.Drifted,
+		ComputedAt:     row.ComputedAt,
+	}
+}
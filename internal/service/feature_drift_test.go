@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type loggedVector struct {
+	at       time.Time
+	features string
+}
+
+type memoryDriftRepo struct {
+	vectors   []loggedVector
+	snapshots []db.FeatureDriftSnapshot
+}
+
+func (r *memoryDriftRepo) ListFeatureVectors(ctx context.Context, from, to time.Time, maxRows int32) ([]json.RawMessage, error) {
+	var rows []json.RawMessage
+	for _, v := range r.vectors {
+		if !v.at.Before(from) && v.at.Before(to) && int32(len(rows)) < maxRows {
+			rows = append(rows, json.RawMessage(v.features))
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryDriftRepo) CreateFeatureDriftSnapshot(ctx context.Context, arg db.CreateFeatureDriftSnapshotParams) (db.FeatureDriftSnapshot, error) {
+	row := db.FeatureDriftSnapshot{
+		ID:             int64(len(r.snapshots) + 1),
+		Feature:        arg.Feature,
+		Kind:           arg.Kind,
+		ReferenceFrom:  arg.ReferenceFrom,
+		ReferenceTo:    arg.ReferenceTo,
+		RecentFrom:     arg.RecentFrom,
+		RecentTo:       arg.RecentTo,
+		ReferenceCount: arg.ReferenceCount,
+		RecentCount:    arg.RecentCount,
+		Psi:            arg.Psi,
+		Ks:             arg.Ks,
+		Drifted:        arg.Drifted,
+	}
+	r.snapshots = append(r.snapshots, row)
+	return row, nil
+}
+
+func (r *memoryDriftRepo) ListFeatureDriftSnapshots(ctx context.Context, from, to time.Time, feature string) ([]db.FeatureDriftSnapshot, error) {
+	return r.snapshots, nil
+}
+
+func TestKSStatistic(t *testing.T) {
+	assert.InDelta(t, 0.0, ksStatistic([]float64{1, 2, 3}, []float64{3, 2, 1}), 1e-9)
+	assert.InDelta(t, 1.0, ksStatistic([]float64{1, 2}, []float64{3, 4}), 1e-9)
+	assert.InDelta(t, 0.5, ksStatistic([]float64{1, 2, 3, 4}, []float64{3, 4, 5, 6}), 1e-9)
+}
+
+func TestCategoricalPSI(t *testing.T) {
+	same := []interface{}{"web", "app", "web", "app"}
+	assert.InDelta(t, 0.0, categoricalPSI(same, same), 1e-9)
+
+	// 50/50 shifting to 90/10: 0.4*ln(1.8) + 0.4*ln(5).
+	shifted := []interface{}{"web", "web", "web", "web", "web", "web", "web", "web", "web", "app"}
+	assert.InDelta(t, 0.4*0.587787+0.4*1.609438, categoricalPSI(same, shifted), 1e-5)
+}
+
+func TestFeatureDriftCompute(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	repo := &memoryDriftRepo{}
+	for i := 0; i < 100; i++ {
+		repo.vectors = append(repo.vectors,
+			loggedVector{
+				at:       now.Add(-48 * time.Hour).Add(time.Duration(i) * time.Minute),
+				features: fmt.Sprintf(`{"amount": %d, "device_type": "web", "transaction_id": "r%d"}`, i, i),
+			},
+			loggedVector{
+				at:       now.Add(-12 * time.Hour).Add(time.Duration(i) * time.Minute),
+				features: fmt.Sprintf(`{"amount": %d, "device_type": "web", "transaction_id": "n%d"}`, i+50, i),
+			},
+		)
+	}
+
+	svc := NewFeatureDriftService(repo, DriftSettings{
+		ReferenceWindow:  72 * time.Hour,
+		RecentWindow:     24 * time.Hour,
+		PSIThreshold:     0.2,
+		KSThreshold:      0.1,
+		MaxSamples:       1000,
+		ExcludedFeatures: []string{"transaction_id"},
+	}, zerolog.Nop())
+
+	drifts, err := svc.Compute(context.Background(), now)
+	require.NoError(t, err)
+	require.Len(t, drifts, 2)
+
+	amount := drifts[0]
+	assert.Equal(t, "amount", amount.Feature)
+	assert.Equal(t, FeatureKindNumeric, amount.Kind)
+	assert.Equal(t, int64(100), amount.ReferenceCount)
+	assert.Equal(t, now.Add(-24*time.Hour), amount.ReferenceTo)
+	require.NotNil(t, amount.KS)
+	assert.InDelta(t, 0.5, *amount.KS, 1e-9)
+	assert.True(t, amount.Drifted)
+
+	device := drifts[1]
+	assert.Equal(t, "device_type", device.Feature)
+	assert.Equal(t, FeatureKindCategorical, device.Kind)
+	assert.Nil(t, device.KS)
+	assert.InDelta(t, 0.0, device.PSI, 1e-9)
+	assert.False(t, device.Drifted)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(featureDriftAlert.WithLabelValues("amount")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(featureDriftAlert.WithLabelValues("device_type")))
+}
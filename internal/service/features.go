@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"sort"
+)
+
+// Feature problems reported by FeatureValidationError.
+const (
+	FeatureMissing     = "missing"
+	FeatureUnknown     = "unknown"
+	FeatureInvalidType = "invalid_type"
+	// FeatureReserved is reported for the derived features, which are
+	// computed by the service and cannot be sent.
+	FeatureReserved = "reserved"
+)
+
+// knownFeatureTypes are the JSON types of features shared across models.
+// Features not listed here must be a string, number or boolean.
+var knownFeatureTypes = map[string]string{
+	"transaction_id": "integer",
+	"amount":         "number",
+	"merchant_type":  "string",
+	"device_type":    "string",
+}
+
+// FeatureProblem describes a single feature that does not match the model
+// signature.
+type FeatureProblem struct {
+	Feature  string `json:"feature"`
+	Problem  string `json:"problem"`
+	Expected string `json:"expected,omitempty"`
+}
+
+// FeatureValidationError lists every feature of a request that does not match
+// the signature inputs of the selected model.
+type FeatureValidationError struct {
+	Model    string
+	Problems []FeatureProblem
+}
+
+func (e *FeatureValidationError) Error() string {
+	return "features do not match the signature of model " + e.Model
+}
+
+func (s *vendorService) ValidateFeatures(ctx context.Context, model string, features map[string]interface{}) error {
+	models, err := s.models(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The ensemble scores every loaded model, so it needs the union of their
+	// signatures. Local models ignore extra features, so their inputs are
+	// required but do not make other features unknown.
+	var signature, required []string
+	for _, m := range models {
+		if m.ModelType != model && model != EnsembleModel {
+			continue
+		}
+		for _, name := range m.SignatureInputs {
+			if s.derivedFeatures[name] {
+				continue
+			}
+			if m.Stage == LocalModelStage {
+				required = append(required, name)
+			} else {
+				signature = append(signature, name)
+			}
+		}
+	}
+
+	problems := checkFeatures(signature, required, s.clientFeatures(features))
+	for name := range features {
+		if s.derivedFeatures[name] {
+			problems = append(problems, FeatureProblem{Feature: name, Problem: FeatureReserved})
+		}
+	}
+	sortFeatureProblems(problems)
+	if len(problems) > 0 {
+		return &FeatureValidationError{Model: model, Problems: problems}
+	}
+	return nil
+}
+
+// checkFeatures compares features with the signature inputs and the required
+// features. Features outside both are unknown unless the signature is empty.
+// Problems are sorted by feature name.
+func checkFeatures(signature, required []string, features map[string]interface{}) []FeatureProblem {
+	var problems []FeatureProblem
+
+	expected := make(map[string]bool, len(signature)+len(required))
+	for _, name := range slices.Concat(signature, required) {
+		if expected[name] {
+			continue
+		}
+		expected[name] = true
+		if _, ok := features[name]; !ok {
+			problems = append(problems, FeatureProblem{Feature: name, Problem: FeatureMissing, Expected: featureType(name)})
+		}
+	}
+
+	for name, value := range features {
+		if len(signature) > 0 && !expected[name] {
+			problems = append(problems, FeatureProblem{Feature: name, Problem: FeatureUnknown})
+			continue
+		}
+		if want := featureType(name); !hasFeatureType(value, want) {
+			problems = append(problems, FeatureProblem{Feature: name, Problem: FeatureInvalidType, Expected: want})
+		}
+	}
+
+	sortFeatureProblems(problems)
+	return problems
+}
+
+func sortFeatureProblems(problems []FeatureProblem) {
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Feature != problems[j].Feature {
+			return problems[i].Feature < problems[j].Feature
+		}
+		return problems[i].Problem < problems[j].Problem
+	})
+}
+
+func featureType(name string) string {
+	if t, ok := knownFeatureTypes[name]; ok {
+		return t
+	}
+	return "scalar"
+}
+
+// hasFeatureType reports whether a decoded JSON value matches want. Integral
+// JSON numbers are expected to be decoded as int64 and the others as float64.
+func hasFeatureType(value interface{}, want string) bool {
+	switch v := value.(type) {
+	case int64, int:
+		return want == "integer" || want == "number" || want == "scalar"
+	case float64:
+		return want == "number" || want == "scalar" || (want == "integer" && v == float64(int64(v)))
+	case string:
+		return want == "string" || want == "scalar"
+	case bool:
+		return want == "boolean" || want == "scalar"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFeatures(t *testing.T) {
+	signature := []string{"transaction_id", "amount", "merchant_type", "device_type", "card_age_days"}
+
+	problems := checkFeatures(signature, nil, map[string]interface{}{
+		"transaction_id": int64(42),
+		"amount":         "10.50",
+		"merchant_type":  "grocery",
+		"card_age_days":  []interface{}{1},
+		"ip_country":     "NL",
+	})
+
+	assert.Equal(t, []FeatureProblem{
+		{Feature: "amount", Problem: FeatureInvalidType, Expected: "number"},
+		{Feature: "card_age_days", Problem: FeatureInvalidType, Expected: "scalar"},
+		{Feature: "device_type", Problem: FeatureMissing, Expected: "string"},
+		{Feature: "ip_country", Problem: FeatureUnknown},
+	}, problems)
+
+	assert.Empty(t, checkFeatures(signature, nil, map[string]interface{}{
+		"transaction_id": int64(42),
+		"amount":         int64(10),
+		"merchant_type":  "grocery",
+		"device_type":    "mobile",
+		"card_age_days":  float64(3.5),
+	}))
+
+	// Without a known signature only the types are checked.
+	assert.Empty(t, checkFeatures(nil, nil, map[string]interface{}{"ip_country": "NL"}))
+
+	// Required features must be set, but do not make the others unknown.
+	assert.Equal(t, []FeatureProblem{
+		{Feature: "amount", Problem: FeatureMissing, Expected: "number"},
+	}, checkFeatures(nil, []string{"amount"}, map[string]interface{}{"ip_country": "NL"}))
+}
+
+func TestVendorService_ValidateFeaturesReserved(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"loaded_models":{"logreg":{"name":"FraudDetector-logistic_regression","signature_inputs":["amount","tx_count_1h"]}}}`))
+	}))
+	defer server.Close()
+
+	svc := NewVendorService(clients.NewThirdPartyClient(server.URL, "", zerolog.Nop()), zerolog.Nop(), WithDerivedFeatures("tx_count_1h"))
+	ctx := context.Background()
+
+	require.NoError(t, svc.ValidateFeatures(ctx, "logreg", map[string]interface{}{"amount": 10.5}))
+
+	// Derived features are computed by the service, so clients cannot set them.
+	err := svc.ValidateFeatures(ctx, "logreg", map[string]interface{}{"amount": 10.5, "tx_count_1h": int64(0)})
+	var validationErr *FeatureValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []FeatureProblem{{Feature: "tx_count_1h", Problem: FeatureReserved}}, validationErr.Problems)
+}
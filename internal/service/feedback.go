@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+)
+
+// FeedbackLabel is the confirmed outcome of a scored transaction.
+type FeedbackLabel string
+
+const (
+	LabelFraud FeedbackLabel = "fraud"
+	LabelLegit FeedbackLabel = "legit"
+)
+
+var (
+	// ErrPredictionNotFound is returned when the labelled prediction does not
+	// exist or belongs to another user.
+	ErrPredictionNotFound = errors.New("prediction not found")
+	ErrInvalidFeedback    = errors.New("invalid feedback")
+)
+
+// Feedback is the ground-truth label attached to a prediction.
+type Feedback struct {
+	ID          int64         `json:"id"`
+	InferenceID int64         `json:"inference_id"`
+	Label       FeedbackLabel `json:"label"`
+	LabelSource string        `json:"label_source"`
+	LabeledAt   time.Time     `json:"labeled_at"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// FeedbackInput identifies a prediction by InferenceID or, when it is zero, by
+// TransactionID. LabeledAt defaults to now.
+type FeedbackInput struct {
+	InferenceID   int64
+	TransactionID string
+	Label         FeedbackLabel
+	LabelSource   string
+	LabeledAt     time.Time
+}
+
+type FeedbackService interface {
+	// Record attaches a label to a prediction of the user, replacing any
+	// earlier label.
+	Record(ctx context.Context, userID int64, apiKeyID *int64, input FeedbackInput) (Feedback, error)
+}
+
+type feedbackService struct {
+	feedbackRepo repo.FeedbackRepository
+}
+
+func NewFeedbackService(feedbackRepo repo.FeedbackRepository) FeedbackService {
+	return &feedbackService{feedbackRepo: feedbackRepo}
+}
+
+func (s *feedbackService) Record(ctx context.Context, userID int64, apiKeyID *int64, input FeedbackInput) (Feedback, error) {
+	if err := validateFeedback(input); err != nil {
+		return Feedback{}, err
+	}
+
+	// Predictions are looked up among the user's own, and those of the API key
+	// when the caller uses one, so labels for another tenant's or key's
+	// predictions are reported as not found.
+	var inferenceID int64
+	var err error
+	if input.InferenceID != 0 {
+		inferenceID, err = s.feedbackRepo.GetInferenceLogIDForUser(ctx, input.InferenceID, userID, apiKeyID)
+	} else {
+		inferenceID, err = s.feedbackRepo.GetInferenceLogIDByTransaction(ctx, userID, input.TransactionID, apiKeyID)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Feedback{}, ErrPredictionNotFound
+		}
+		return Feedback{}, err
+	}
+
+	labeledAt := input.LabeledAt
+	if labeledAt.IsZero() {
+		labeledAt = time.Now().UTC()
+	}
+	var keyID sql.NullInt64
+	if apiKeyID != nil {
+		keyID = sql.NullInt64{Int64: *apiKeyID, Valid: true}
+	}
+
+	row, err := s.feedbackRepo.UpsertPredictionFeedback(ctx, db.UpsertPredictionFeedbackParams{
+		InferenceLogID: inferenceID,
+		UserID:         userID,
+		ApiKeyID:       keyID,
+		Label:          string(input.Label),
+		LabelSource:    input.LabelSource,
+		LabeledAt:      labeledAt,
+	})
+	if err != nil {
+		return Feedback{}, err
+	}
+	return toFeedback(row), nil
+}
+
+func validateFeedback(input FeedbackInput) error {
+	if input.InferenceID == 0 && input.TransactionID == "" {
+		return fmt.Errorf("%w: inference_id or transaction_id is required", ErrInvalidFeedback)
+	}
+	if input.InferenceID != 0 && input.TransactionID != "" {
+		return fmt.Errorf("%w: only one of inference_id and transaction_id may be set", ErrInvalidFeedback)
+	}
+	if input.Label != LabelFraud && input.Label != LabelLegit {
+		return fmt.Errorf("%w: label must be one of [fraud legit]", ErrInvalidFeedback)
+	}
+	if input.LabelSource == "" {
+		return fmt.Errorf("%w: label_source is required", ErrInvalidFeedback)
+	}
+	if input.LabeledAt.After(time.Now().Add(time.Minute)) {
+		return fmt.Errorf("%w: labeled_at must not be in the future", ErrInvalidFeedback)
+	}
+	return nil
+}
+
+func toFeedback(row db.PredictionFeedback) Feedback {
+	return Feedback{
+		ID:          row.ID,
+		InferenceID: row.InferenceLogID,
+		Label:       FeedbackLabel(row.Label),
+		LabelSource: row.LabelSource,
+		LabeledAt:   row.LabeledAt,
+		CreatedAt:   row.CreatedAt,
+		UpdatedAt:   row.UpdatedAt,
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryFeedbackRepo holds inference logs as log ID -> owner, API key and
+// transaction.
+type memoryFeedbackRepo struct {
+	owners       map[int64]int64
+	keys         map[int64]int64
+	transactions map[int64]string
+	feedback     map[int64]db.PredictionFeedback
+}
+
+func (r *memoryFeedbackRepo) visible(id, userID int64, apiKeyID *int64) bool {
+	if r.owners[id] != userID {
+		return false
+	}
+	return apiKeyID == nil || r.keys[id] == *apiKeyID
+}
+
+func (r *memoryFeedbackRepo) GetInferenceLogIDForUser(ctx context.Context, id, userID int64, apiKeyID *int64) (int64, error) {
+	if !r.visible(id, userID, apiKeyID) {
+		return 0, sql.ErrNoRows
+	}
+	return id, nil
+}
+
+func (r *memoryFeedbackRepo) GetInferenceLogIDByTransaction(ctx context.Context, userID int64, transactionID string, apiKeyID *int64) (int64, error) {
+	for id, txn := range r.transactions {
+		if txn == transactionID && r.visible(id, userID, apiKeyID) {
+			return id, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (r *memoryFeedbackRepo) UpsertPredictionFeedback(ctx context.Context, arg db.UpsertPredictionFeedbackParams) (db.PredictionFeedback, error) {
+	row, ok := r.feedback[arg.InferenceLogID]
+	if !ok {
+		row = db.PredictionFeedback{ID: int64(len(r.feedback) + 1), InferenceLogID: arg.InferenceLogID, UserID: arg.UserID}
+	}
+	row.ApiKeyID = arg.ApiKeyID
+	row.Label = arg.Label
+	row.LabelSource = arg.LabelSource
+	row.LabeledAt = arg.LabeledAt
+	r.feedback[arg.InferenceLogID] = row
+	return row, nil
+}
+
+func TestFeedbackService_Record(t *testing.T) {
+	repo := &memoryFeedbackRepo{
+		owners:       map[int64]int64{10: 1, 11: 1, 20: 2},
+		keys:         map[int64]int64{10: 7, 11: 7, 20: 9},
+		transactions: map[int64]string{10: "42", 20: "43"},
+		feedback:     map[int64]db.PredictionFeedback{},
+	}
+	svc := NewFeedbackService(repo)
+	ctx := context.Background()
+	keyID := int64(7)
+	labeledAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	fb, err := svc.Record(ctx, 1, &keyID, FeedbackInput{TransactionID: "42", Label: LabelFraud, LabelSource: "chargeback", LabeledAt: labeledAt})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), fb.InferenceID)
+	assert.Equal(t, LabelFraud, fb.Label)
+	assert.Equal(t, labeledAt, fb.LabeledAt)
+
+	// A later label replaces the earlier one.
+	fb, err = svc.Record(ctx, 1, &keyID, FeedbackInput{InferenceID: 10, Label: LabelLegit, LabelSource: "manual_review"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), fb.ID)
+	assert.Equal(t, LabelLegit, fb.Label)
+	assert.False(t, fb.LabeledAt.IsZero())
+
+	// Predictions of other users cannot be labelled.
+	_, err = svc.Record(ctx, 1, &keyID, FeedbackInput{InferenceID: 20, Label: LabelFraud, LabelSource: "chargeback"})
+	assert.ErrorIs(t, err, ErrPredictionNotFound)
+	_, err = svc.Record(ctx, 1, &keyID, FeedbackInput{TransactionID: "43", Label: LabelFraud, LabelSource: "chargeback"})
+	assert.ErrorIs(t, err, ErrPredictionNotFound)
+
+	for _, input := range []FeedbackInput{
+		{Label: LabelFraud, LabelSource: "chargeback"},
+		{InferenceID: 11, TransactionID: "42", Label: LabelFraud, LabelSource: "chargeback"},
+		{InferenceID: 11, Label: "maybe", LabelSource: "chargeback"},
+		{InferenceID: 11, Label: LabelFraud},
+		{InferenceID: 11, Label: LabelFraud, LabelSource: "chargeback", LabeledAt: time.Now().Add(time.Hour)},
+	} {
+		_, err := svc.Record(ctx, 1, &keyID, input)
+		assert.ErrorIs(t, err, ErrInvalidFeedback)
+	}
+}
+
+func TestFeedbackService_RecordOtherAPIKey(t *testing.T) {
+	repo := &memoryFeedbackRepo{
+		owners:       map[int64]int64{10: 1, 11: 1},
+		keys:         map[int64]int64{10: 7, 11: 8},
+		transactions: map[int64]string{10: "42", 11: "43"},
+		feedback:     map[int64]db.PredictionFeedback{},
+	}
+	svc := NewFeedbackService(repo)
+	ctx := context.Background()
+	keyID := int64(7)
+
+	// A key cannot label predictions made with another key of the same user.
+	_, err := svc.Record(ctx, 1, &keyID, FeedbackInput{InferenceID: 11, Label: LabelFraud, LabelSource: "chargeback"})
+	assert.ErrorIs(t, err, ErrPredictionNotFound)
+	_, err = svc.Record(ctx, 1, &keyID, FeedbackInput{TransactionID: "43", Label: LabelFraud, LabelSource: "chargeback"})
+	assert.ErrorIs(t, err, ErrPredictionNotFound)
+
+	// Its own predictions are found by ID and by transaction.
+	fb, err := svc.Record(ctx, 1, &keyID, FeedbackInput{TransactionID: "42", Label: LabelFraud, LabelSource: "chargeback"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), fb.InferenceID)
+
+	// Callers without an API key see all of the user's predictions.
+	fb, err = svc.Record(ctx, 1, nil, FeedbackInput{InferenceID: 11, Label: LabelLegit, LabelSource: "manual_review"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), fb.InferenceID)
+}
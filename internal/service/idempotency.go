@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// idempotencyPollInterval is how often a duplicate request checks whether the
+// original request has finished.
+const idempotencyPollInterval = 50 * time.Millisecond
+
+// idempotencyDeadlineMargin is the time a duplicate leaves before the deadline
+// of its request to answer with ErrIdempotencyInProgress.
+const idempotencyDeadlineMargin = 500 * time.Millisecond
+
+var (
+	// ErrIdempotencyInProgress is returned when a request with the same key is
+	// still being scored after the lock timeout or close to the deadline of
+	// the caller.
+	ErrIdempotencyInProgress = errors.New("a request with the same idempotency key is in progress")
+	// ErrIdempotencyMismatch is returned when the response stored under a key
+	// was made for another request body.
+	ErrIdempotencyMismatch = errors.New("idempotency key was used with a different request")
+)
+
+// releaseLockScript deletes the lock in KEYS[1] only if it still holds the
+// token of the caller.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// extendLockScript resets the expiry of the lock in KEYS[1] to ARGV[2]
+// milliseconds only if it still holds the token of the caller.
+var extendLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// idempotencyRecord is the stored response of a key, with the fingerprint of
+// the request it answered.
+type idempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"`
+	Response    PredictResponse `json:"response"`
+}
+
+// IdempotencyService makes predictions idempotent per caller-scoped key.
+type IdempotencyService interface {
+	// Do returns the response stored under key by an earlier call, or runs fn
+	// and stores its response if fn reports success. replayed is true when a
+	// stored response is returned. Concurrent calls with the same key wait for
+	// the first one, so fn runs once. fingerprint identifies the request: a
+	// stored response of another fingerprint returns ErrIdempotencyMismatch.
+	Do(ctx context.Context, key, fingerprint string, fn func() (PredictResponse, bool)) (resp PredictResponse, replayed bool, err error)
+}
+
+type idempotencyService struct {
+	redisClient *redis.Client
+	window      time.Duration
+	lockTimeout time.Duration
+	logger      zerolog.Logger
+}
+
+// NewIdempotencyService stores successful responses for window. lockTimeout
+// bounds both how long duplicates wait for a request and how long its key
+// stays locked after it stops renewing the lock. Duplicates also stop waiting
+// shortly before the deadline of their context, if it is earlier.
+func NewIdempotencyService(redisClient *redis.Client, window, lockTimeout time.Duration, logger zerolog.Logger) IdempotencyService {
+	return &idempotencyService{
+		redisClient: redisClient,
+		window:      window,
+		lockTimeout: lockTimeout,
+		logger:      logger,
+	}
+}
+
+// Do degrades to calling fn directly when Redis is unavailable.
+func (s *idempotencyService) Do(ctx context.Context, key, fingerprint string, fn func() (PredictResponse, bool)) (PredictResponse, bool, error) {
+	resultKey := "idempotency:" + key
+	lockKey := "idempotency:lock:" + key
+	deadline := time.Now().Add(s.lockTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Add(-idempotencyDeadlineMargin).Before(deadline) {
+		deadline = ctxDeadline.Add(-idempotencyDeadlineMargin)
+	}
+
+	for {
+		resp, found, err := s.load(ctx, resultKey, fingerprint)
+		if err != nil && !errors.Is(err, ErrIdempotencyMismatch) {
+			return s.fallback(err, fn)
+		}
+		if err != nil || found {
+			return resp, found, err
+		}
+
+		token := uuid.New().String()
+		acquired, err := s.redisClient.SetNX(ctx, lockKey, token, s.lockTimeout).Result()
+		if err != nil {
+			return s.fallback(err, fn)
+		}
+		if acquired {
+			return s.run(ctx, resultKey, lockKey, token, fingerprint, fn)
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return PredictResponse{}, false, ErrIdempotencyInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return PredictResponse{}, false, ctx.Err()
+		case <-time.After(min(idempotencyPollInterval, wait)):
+		}
+	}
+}
+
+func (s *idempotencyService) run(ctx context.Context, resultKey, lockKey, token, fingerprint string, fn func() (PredictResponse, bool)) (PredictResponse, bool, error) {
+	defer func() {
+		if err := releaseLockScript.Run(context.WithoutCancel(ctx), s.redisClient, []string{lockKey}, token).Err(); err != nil {
+			s.logger.Warn().Err(err).Str("key", lockKey).Msg("failed to release idempotency lock")
+		}
+	}()
+
+	// The request holding the lock before us may have stored its response
+	// between our read and taking the lock.
+	if resp, found, err := s.load(ctx, resultKey, fingerprint); errors.Is(err, ErrIdempotencyMismatch) {
+		return resp, false, err
+	} else if err == nil && found {
+		return resp, true, nil
+	}
+
+	// fn may outlast the lock timeout, so the lock is renewed until it
+	// returns.
+	done := make(chan struct{})
+	go s.extendLock(ctx, lockKey, token, done)
+	resp, ok := fn()
+	close(done)
+	if !ok {
+		return resp, false, nil
+	}
+	payload, err := json.Marshal(idempotencyRecord{Fingerprint: fingerprint, Response: resp})
+	if err != nil {
+		return resp, false, nil
+	}
+	if err := s.redisClient.Set(context.WithoutCancel(ctx), resultKey, payload, s.window).Err(); err != nil {
+		s.logger.Warn().Err(err).Str("key", resultKey).Msg("failed to store idempotent response")
+	}
+	return resp, false, nil
+}
+
+// extendLock renews the lock every third of the lock timeout until done is
+// closed.
+func (s *idempotencyService) extendLock(ctx context.Context, lockKey, token string, done <-chan struct{}) {
+	ticker := time.NewTicker(max(s.lockTimeout/3, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := extendLockScript.Run(ctx, s.redisClient, []string{lockKey}, token, s.lockTimeout.Milliseconds()).Err(); err != nil {
+				s.logger.Warn().Err(err).Str("key", lockKey).Msg("failed to extend idempotency lock")
+			}
+		}
+	}
+}
+
+func (s *idempotencyService) load(ctx context.Context, resultKey, fingerprint string) (PredictResponse, bool, error) {
+	payload, err := s.redisClient.Get(ctx, resultKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return PredictResponse{}, false, nil
+	}
+	if err != nil {
+		return PredictResponse{}, false, err
+	}
+	var record idempotencyRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return PredictResponse{}, false, err
+	}
+	if record.Fingerprint != fingerprint {
+		return PredictResponse{}, false, ErrIdempotencyMismatch
+	}
+	return record.Response, true, nil
+}
+
+func (s *idempotencyService) fallback(err error, fn func() (PredictResponse, bool)) (PredictResponse, bool, error) {
+	s.logger.Warn().Err(err).Msg("idempotency store unavailable, scoring without it")
+	resp, _ := fn()
+	return resp, false, nil
+}
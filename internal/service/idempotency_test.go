@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyService_Do(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	svc := NewIdempotencyService(redisClient, time.Hour, time.Second, zerolog.Nop())
+	ctx := context.Background()
+
+	var calls int32
+	score := func() (PredictResponse, bool) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		var resp PredictResponse
+		resp.Meta.RequestID = "req-1"
+		resp.Result.Score = 0.9
+		return resp, true
+	}
+
+	// Concurrent duplicates wait for the first call instead of scoring again.
+	var wg sync.WaitGroup
+	replays := make([]bool, 3)
+	for i := range replays {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, replayed, err := svc.Do(ctx, "key:7:txn:42", "body", score)
+			assert.NoError(t, err)
+			assert.Equal(t, "req-1", resp.Meta.RequestID)
+			replays[i] = replayed
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.ElementsMatch(t, []bool{false, true, true}, replays)
+
+	// Later retries get the stored response.
+	resp, replayed, err := svc.Do(ctx, "key:7:txn:42", "body", score)
+	require.NoError(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, 0.9, resp.Result.Score)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Failed calls are not stored, so a retry scores again.
+	fail := func() (PredictResponse, bool) {
+		atomic.AddInt32(&calls, 1)
+		return PredictResponse{}, false
+	}
+	_, replayed, err = svc.Do(ctx, "key:7:txn:43", "body", fail)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	_, replayed, err = svc.Do(ctx, "key:7:txn:43", "body", score)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyService_InProgress(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	svc := NewIdempotencyService(redisClient, time.Hour, 100*time.Millisecond, zerolog.Nop())
+	require.NoError(t, redisClient.Set(context.Background(), "idempotency:lock:key:7:txn:42", "other", time.Minute).Err())
+
+	_, _, err = svc.Do(context.Background(), "key:7:txn:42", "body", func() (PredictResponse, bool) {
+		t.Fatal("expected locked key not to be scored")
+		return PredictResponse{}, false
+	})
+	assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+}
+
+func TestIdempotencyService_InProgressBeforeDeadline(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	svc := NewIdempotencyService(redisClient, time.Hour, time.Minute, zerolog.Nop())
+	require.NoError(t, redisClient.Set(context.Background(), "idempotency:lock:key:7:txn:42", "other", time.Minute).Err())
+
+	// A duplicate gives up before the deadline of its request rather than
+	// after the lock timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), idempotencyDeadlineMargin+200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = svc.Do(ctx, "key:7:txn:42", "body", func() (PredictResponse, bool) {
+		t.Fatal("expected locked key not to be scored")
+		return PredictResponse{}, false
+	})
+	assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+	assert.NoError(t, ctx.Err())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestIdempotencyService_Mismatch(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	svc := NewIdempotencyService(redisClient, time.Hour, time.Second, zerolog.Nop())
+	ctx := context.Background()
+	score := func() (PredictResponse, bool) {
+		return PredictResponse{}, true
+	}
+
+	_, _, err = svc.Do(ctx, "key:7:txn:42", "body", score)
+	require.NoError(t, err)
+
+	// The same key with another body is refused rather than answered with the
+	// response of the first request.
+	_, replayed, err := svc.Do(ctx, "key:7:txn:42", "other", func() (PredictResponse, bool) {
+		t.Fatal("expected a reused key not to be scored")
+		return PredictResponse{}, false
+	})
+	assert.ErrorIs(t, err, ErrIdempotencyMismatch)
+	assert.False(t, replayed)
+}
+
+func TestIdempotencyService_ExtendsLock(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	svc := NewIdempotencyService(redisClient, time.Hour, 100*time.Millisecond, zerolog.Nop())
+
+	// The lock outlives its timeout while the request is scored.
+	_, _, err = svc.Do(context.Background(), "key:7:txn:42", "body", func() (PredictResponse, bool) {
+		for i := 0; i < 4; i++ {
+			time.Sleep(50 * time.Millisecond)
+			mr.FastForward(50 * time.Millisecond)
+			assert.True(t, mr.Exists("idempotency:lock:key:7:txn:42"))
+		}
+		return PredictResponse{}, true
+	})
+	require.NoError(t, err)
+	assert.False(t, mr.Exists("idempotency:lock:key:7:txn:42"))
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// inferenceLogPartitionLayout is the time layout of the partition names
+	// created by create_inference_logs_partition.
+	inferenceLogPartitionLayout    = "inference_logs_y2006m01"
+	defaultRetentionDeleteBatch    = 10000
+	defaultInferenceLogMonthsAhead = 3
+)
+
+var (
+	inferenceLogPartitionBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "inference_log_partition_size_bytes",
+		Help: "Total size of the inference_logs partition, including its indexes.",
+	}, []string{"partition"})
+	inferenceLogPartitionRows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "inference_log_partition_rows",
+		Help: "Estimated number of rows of the inference_logs partition as of its last analyze.",
+	}, []string{"partition"})
+	inferenceLogPartitionsRetired = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "inference_log_partitions_retired_total",
+		Help: "Number of inference_logs partitions dropped or archived by the retention.",
+	})
+	inferenceLogsExpired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "inference_logs_expired_total",
+		Help: "Number of inference logs deleted or archived by the retention of the user's plan.",
+	}, []string{"plan"})
+)
+
+// PartitionSettings configures the maintenance of the monthly inference_logs
+// partitions. Retention applies to the plans without a PlanRetention entry; a
+// retention of 0 keeps the logs forever.
+//
+// Partitions are retired once all their logs are older than the longest
+// retention of the users' plans. Logs of plans with a shorter retention are
+// expired row by row, DeleteBatchSize at a time. With Archive, retired
+// partitions and expired logs are moved to the inference_logs_archive schema
+// instead of being deleted.
+type PartitionSettings struct {
+	MonthsAhead     int
+	Retention       time.Duration
+	PlanRetention   map[string]time.Duration
+	Archive         bool
+	DeleteBatchSize int32
+}
+
+type InferenceLogPartitionService interface {
+	// Maintain creates the partitions of the month of now and the MonthsAhead
+	// following ones, applies the retention and updates the partition gauges.
+	Maintain(ctx context.Context, now time.Time) error
+}
+
+type inferenceLogPartitionService struct {
+	partitionRepo repo.InferenceLogPartitionRepository
+	settings      PartitionSettings
+	logger        zerolog.Logger
+}
+
+func NewInferenceLogPartitionService(partitionRepo repo.InferenceLogPartitionRepository, settings PartitionSettings, logger zerolog.Logger) InferenceLogPartitionService {
+	if settings.MonthsAhead <= 0 {
+		settings.MonthsAhead = defaultInferenceLogMonthsAhead
+	}
+	if settings.DeleteBatchSize <= 0 {
+		settings.DeleteBatchSize = defaultRetentionDeleteBatch
+	}
+	return &inferenceLogPartitionService{
+		partitionRepo: partitionRepo,
+		settings:      settings,
+		logger:        logger,
+	}
+}
+
+func (s *inferenceLogPartitionService) Maintain(ctx context.Context, now time.Time) error {
+	month := time.Date(now.UTC().Year(), now.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= s.settings.MonthsAhead; i++ {
+		if _, err := s.partitionRepo.CreatePartition(ctx, month.AddDate(0, i, 0)); err != nil {
+			return fmt.Errorf("create inference log partition: %w", err)
+		}
+	}
+
+	if err := s.applyRetention(ctx, now); err != nil {
+		return err
+	}
+
+	partitions, err := s.partitionRepo.ListPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	inferenceLogPartitionBytes.Reset()
+	inferenceLogPartitionRows.Reset()
+	for _, p := range partitions {
+		inferenceLogPartitionBytes.WithLabelValues(p.Name).Set(float64(p.SizeBytes))
+		inferenceLogPartitionRows.WithLabelValues(p.Name).Set(float64(p.EstimatedRows))
+	}
+	return nil
+}
+
+func (s *inferenceLogPartitionService) applyRetention(ctx context.Context, now time.Time) error {
+	plans, err := s.partitionRepo.ListUserPlans(ctx)
+	if err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		return nil
+	}
+
+	// The longest retention decides which partitions can be retired as a
+	// whole; it is 0 if some plan keeps its logs forever.
+	var longest time.Duration
+	forever := false
+	for _, plan := range plans {
+		retention := s.retention(plan)
+		if retention <= 0 {
+			forever = true
+		}
+		if retention > longest {
+			longest = retention
+		}
+	}
+
+	for _, plan := range plans {
+		retention := s.retention(plan)
+		if retention <= 0 || (!forever && retention >= longest) {
+			continue
+		}
+		if err := s.deleteExpired(ctx, plan, now.Add(-retention)); err != nil {
+			return err
+		}
+	}
+	if forever {
+		return nil
+	}
+
+	partitions, err := s.partitionRepo.ListPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	cutoff := now.Add(-longest)
+	for _, p := range partitions {
+		start, err := time.Parse(inferenceLogPartitionLayout, p.Name)
+		if err != nil || start.AddDate(0, 1, 0).After(cutoff) {
+			continue
+		}
+		if err := s.partitionRepo.RetirePartition(ctx, p.Name, s.settings.Archive); err != nil {
+			return fmt.Errorf("retire inference log partition %s: %w", p.Name, err)
+		}
+		inferenceLogPartitionsRetired.Inc()
+		s.logger.Info().Str("partition", p.Name).Bool("archived", s.settings.Archive).Msg("retired inference log partition")
+	}
+	return nil
+}
+
+// deleteExpired deletes, or archives, the logs of the users on plan requested
+// before before.
+func (s *inferenceLogPartitionService) deleteExpired(ctx context.Context, plan string, before time.Time) error {
+	var total int64
+	for {
+		n, err := s.partitionRepo.DeleteExpiredLogs(ctx, plan, before, s.settings.DeleteBatchSize, s.settings.Archive)
+		if err != nil {
+			return fmt.Errorf("delete expired inference logs of plan %s: %w", plan, err)
+		}
+		total += n
+		inferenceLogsExpired.WithLabelValues(plan).Add(float64(n))
+		if n < int64(s.settings.DeleteBatchSize) {
+			break
+		}
+	}
+	if total > 0 {
+		s.logger.Info().Str("plan", plan).Int64("logs", total).Bool("archived", s.settings.Archive).Msg("expired inference logs")
+	}
+	return nil
+}
+
+func (s *inferenceLogPartitionService) retention(plan string) time.Duration {
+	if retention, ok := s.settings.PlanRetention[plan]; ok {
+		return retention
+	}
+	return s.settings.Retention
+}
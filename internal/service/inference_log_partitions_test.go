@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryPartitionRepo struct {
+	partitions map[string]bool
+	retired    map[string]bool
+	archived   bool
+	plans      []string
+	// expired is the number of expired logs per plan and the cutoff they were
+	// deleted with; expiredArchived whether they were archived instead.
+	expired         map[string]int64
+	before          map[string]time.Time
+	expiredArchived bool
+}
+
+func newMemoryPartitionRepo(plans ...string) *memoryPartitionRepo {
+	return &memoryPartitionRepo{
+		partitions: map[string]bool{},
+		retired:    map[string]bool{},
+		plans:      plans,
+		expired:    map[string]int64{},
+		before:     map[string]time.Time{},
+	}
+}
+
+func (r *memoryPartitionRepo) CreatePartition(ctx context.Context, monthStart time.Time) (string, error) {
+	name := monthStart.Format(inferenceLogPartitionLayout)
+	r.partitions[name] = true
+	return name, nil
+}
+
+func (r *memoryPartitionRepo) ListPartitions(ctx context.Context) ([]db.ListInferenceLogPartitionsRow, error) {
+	var rows []db.ListInferenceLogPartitionsRow
+	for name := range r.partitions {
+		rows = append(rows, db.ListInferenceLogPartitionsRow{Name: name, SizeBytes: 8192})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+	return rows, nil
+}
+
+func (r *memoryPartitionRepo) RetirePartition(ctx context.Context, name string, archive bool) error {
+	delete(r.partitions, name)
+	r.retired[name] = true
+	r.archived = archive
+	return nil
+}
+
+func (r *memoryPartitionRepo) ListUserPlans(ctx context.Context) ([]string, error) {
+	return r.plans, nil
+}
+
+func (r *memoryPartitionRepo) DeleteExpiredLogs(ctx context.Context, plan string, before time.Time, maxRows int32, archive bool) (int64, error) {
+	r.before[plan] = before
+	r.expiredArchived = archive
+	n := r.expired[plan]
+	if n > int64(maxRows) {
+		n = int64(maxRows)
+	}
+	r.expired[plan] -= n
+	return n, nil
+}
+
+func TestInferenceLogPartitionService_Maintain(t *testing.T) {
+	now := time.Date(2026, 5, 20, 10, 0, 0, 0, time.UTC)
+	repo := newMemoryPartitionRepo("admin", "free")
+	for _, name := range []string{"inference_logs_y2025m12", "inference_logs_y2026m01", "inference_logs_y2026m02"} {
+		repo.partitions[name] = true
+	}
+	repo.expired["free"] = 25
+
+	svc := NewInferenceLogPartitionService(repo, PartitionSettings{
+		MonthsAhead:     2,
+		Retention:       30 * 24 * time.Hour,
+		PlanRetention:   map[string]time.Duration{"admin": 120 * 24 * time.Hour},
+		Archive:         true,
+		DeleteBatchSize: 10,
+	}, zerolog.Nop())
+	require.NoError(t, svc.Maintain(context.Background(), now))
+
+	// The current month and the two following ones.
+	for _, name := range []string{"inference_logs_y2026m05", "inference_logs_y2026m06", "inference_logs_y2026m07"} {
+		assert.True(t, repo.partitions[name], name)
+	}
+	assert.False(t, repo.partitions["inference_logs_y2026m08"])
+
+	// Only partitions entirely older than the longest retention (admin, 120
+	// days before now is 2026-01-20) are retired.
+	assert.Equal(t, map[string]bool{"inference_logs_y2025m12": true}, repo.retired)
+	assert.True(t, repo.archived)
+	assert.True(t, repo.partitions["inference_logs_y2026m01"])
+
+	// Shorter retentions are applied row by row until a batch comes back short.
+	assert.Zero(t, repo.expired["free"])
+	assert.Equal(t, now.Add(-30*24*time.Hour), repo.before["free"])
+	assert.True(t, repo.expiredArchived)
+	_, deleted := repo.before["admin"]
+	assert.False(t, deleted)
+}
+
+func TestInferenceLogPartitionService_KeepForever(t *testing.T) {
+	now := time.Date(2026, 5, 20, 10, 0, 0, 0, time.UTC)
+	repo := newMemoryPartitionRepo("enterprise", "free")
+	repo.partitions["inference_logs_y2020m01"] = true
+
+	svc := NewInferenceLogPartitionService(repo, PartitionSettings{
+		PlanRetention: map[string]time.Duration{"free": 30 * 24 * time.Hour},
+	}, zerolog.Nop())
+	require.NoError(t, svc.Maintain(context.Background(), now))
+
+	// Plans without retention keep every partition; the free plan is still
+	// expired row by row.
+	assert.Empty(t, repo.retired)
+	assert.Contains(t, repo.before, "free")
+	// MonthsAhead defaults to 3.
+	assert.True(t, repo.partitions["inference_logs_y2026m08"])
+}
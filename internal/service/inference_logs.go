@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/sqlc-dev/pqtype"
+)
+
+// Outcomes accepted by InferenceLogFilter.Status.
+const (
+	InferenceLogSuccess = "success"
+	InferenceLogError   = "error"
+)
+
+const (
+	DefaultInferenceLogPageSize = 50
+	MaxInferenceLogPageSize     = 500
+)
+
+var (
+	// ErrInferenceLogNotFound is returned when the log does not exist or is
+	// not visible to the caller.
+	ErrInferenceLogNotFound  = errors.New("inference log not found")
+	ErrInferenceLogForbidden = errors.New("not allowed to read the logs of this API key")
+	ErrInvalidLogFilter      = errors.New("invalid inference log filter")
+)
+
+// InferenceLogFilter selects the logs of predictions requested in [From, To).
+// Nil and empty fields match every log. Cursor is the NextCursor of the
+// previous page, or 0 for the first page.
+type InferenceLogFilter struct {
+	From       time.Time
+	To         time.Time
+	APIKeyID   *int64
+	Model      string
+	Status     string
+	Prediction *int
+	MinScore   *float64
+	MaxScore   *float64
+	Cursor     int64
+	Limit      int
+}
+
+// InferenceLogSummary is one prediction in the log listing. Prediction, Score,
+// ModelName and ScoringPath are unset for failed requests.
+type InferenceLogSummary struct {
+	ID           int64     `json:"id"`
+	APIKeyID     *int64    `json:"api_key_id,omitempty"`
+	Model        string    `json:"model"`
+	ModelName    string    `json:"model_name,omitempty"`
+	Prediction   *int      `json:"prediction,omitempty"`
+	Score        *float64  `json:"score,omitempty"`
+	Decision     string    `json:"decision,omitempty"`
+	ScoringPath  string    `json:"scoring_path,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	RequestTime  time.Time `json:"request_time"`
+	ResponseTime time.Time `json:"response_time"`
+}
+
+// InferenceLog is the full record of one prediction. Request features are
+// masked as they were when logged.
+type InferenceLog struct {
+	InferenceLogSummary
+	Request        json.RawMessage `json:"request"`
+	Response       json.RawMessage `json:"response,omitempty"`
+	PolicyID       *int64          `json:"policy_id,omitempty"`
+	PolicyVersion  *int32          `json:"policy_version,omitempty"`
+	FiredRules     json.RawMessage `json:"fired_rules,omitempty"`
+	Explanation    json.RawMessage `json:"explanation,omitempty"`
+	ShadowModel    string          `json:"shadow_model,omitempty"`
+	ShadowResponse json.RawMessage `json:"shadow_response,omitempty"`
+	ShadowError    string          `json:"shadow_error,omitempty"`
+}
+
+// InferenceLogPage is one page of logs, newest first. NextCursor is nil on the
+// last page.
+type InferenceLogPage struct {
+	Items      []InferenceLogSummary `json:"items"`
+	NextCursor *int64                `json:"next_cursor"`
+}
+
+// InferenceLogService reads the prediction history of a caller. Callers that
+// authenticated with an API key only see the logs of that key.
+type InferenceLogService interface {
+	List(ctx context.Context, userID int64, apiKeyID *int64, filter InferenceLogFilter) (InferenceLogPage, error)
+	Get(ctx context.Context, userID int64, apiKeyID *int64, id int64) (InferenceLog, error)
+}
+
+type inferenceLogService struct {
+	logRepo repo.InferenceLogRepository
+}
+
+func NewInferenceLogService(logRepo repo.InferenceLogRepository) InferenceLogService {
+	return &inferenceLogService{logRepo: logRepo}
+}
+
+func (s *inferenceLogService) List(ctx context.Context, userID int64, apiKeyID *int64, filter InferenceLogFilter) (InferenceLogPage, error) {
+	if err := validateLogFilter(filter); err != nil {
+		return InferenceLogPage{}, err
+	}
+
+	keyID := filter.APIKeyID
+	if apiKeyID != nil {
+		if keyID != nil && *keyID != *apiKeyID {
+			return InferenceLogPage{}, ErrInferenceLogForbidden
+		}
+		keyID = apiKeyID
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultInferenceLogPageSize
+	}
+	beforeID := filter.Cursor
+	if beforeID == 0 {
+		beforeID = math.MaxInt64
+	}
+
+	params := db.ListInferenceLogsParams{
+		UserID:   userID,
+		BeforeID: beforeID,
+		FromTime: filter.From,
+		ToTime:   filter.To,
+		Model:    sql.NullString{String: filter.Model, Valid: filter.Model != ""},
+		HasError: sql.NullBool{Bool: filter.Status == InferenceLogError, Valid: filter.Status != ""},
+		// One extra row tells whether there is a next page.
+		MaxRows: int32(limit + 1),
+	}
+	if keyID != nil {
+		params.ApiKeyID = sql.NullInt64{Int64: *keyID, Valid: true}
+	}
+	if filter.Prediction != nil {
+		params.Prediction = sql.NullInt32{Int32: int32(*filter.Prediction), Valid: true}
+	}
+	params.MinScore = nullFloat(filter.MinScore)
+	params.MaxScore = nullFloat(filter.MaxScore)
+
+	rows, err := s.logRepo.ListInferenceLogs(ctx, params)
+	if err != nil {
+		return InferenceLogPage{}, err
+	}
+
+	page := InferenceLogPage{Items: make([]InferenceLogSummary, 0, len(rows))}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next := rows[limit-1].ID
+		page.NextCursor = &next
+	}
+	for _, row := range rows {
+		page.Items = append(page.Items, toInferenceLogSummary(row))
+	}
+	return page, nil
+}
+
+func (s *inferenceLogService) Get(ctx context.Context, userID int64, apiKeyID *int64, id int64) (InferenceLog, error) {
+	row, err := s.logRepo.GetInferenceLog(ctx, id, userID, apiKeyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return InferenceLog{}, ErrInferenceLogNotFound
+		}
+		return InferenceLog{}, err
+	}
+
+	l := InferenceLog{
+		InferenceLogSummary: toInferenceLogSummary(row),
+		Request:             row.RequestPayload,
+		ShadowModel:         row.ShadowModel.String,
+		ShadowError:         row.ShadowError.String,
+	}
+	if row.ResponsePayload.Valid {
+		l.Response = row.ResponsePayload.RawMessage
+	}
+	if row.PolicyID.Valid {
+		l.PolicyID = &row.PolicyID.Int64
+	}
+	if row.PolicyVersion.Valid {
+		l.PolicyVersion = &row.PolicyVersion.Int32
+	}
+	if row.FiredRules.Valid {
+		l.FiredRules = row.FiredRules.RawMessage
+	}
+	if row.Explanation.Valid {
+		l.Explanation = row.Explanation.RawMessage
+	}
+	if row.ShadowResponsePayload.Valid {
+		l.ShadowResponse = row.ShadowResponsePayload.RawMessage
+	}
+	return l, nil
+}
+
+func validateLogFilter(filter InferenceLogFilter) error {
+	switch filter.Status {
+	case "", InferenceLogSuccess, InferenceLogError:
+	default:
+		return fmt.Errorf("%w: status must be one of [success error]", ErrInvalidLogFilter)
+	}
+	if filter.Prediction != nil && *filter.Prediction != 0 && *filter.Prediction != 1 {
+		return fmt.Errorf("%w: prediction must be 0 or 1", ErrInvalidLogFilter)
+	}
+	if filter.MinScore != nil && filter.MaxScore != nil && *filter.MinScore > *filter.MaxScore {
+		return fmt.Errorf("%w: min_score must not exceed max_score", ErrInvalidLogFilter)
+	}
+	if filter.Limit < 0 || filter.Limit > MaxInferenceLogPageSize {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidLogFilter, MaxInferenceLogPageSize)
+	}
+	if filter.Cursor < 0 {
+		return fmt.Errorf("%w: invalid cursor", ErrInvalidLogFilter)
+	}
+	return nil
+}
+
+func toInferenceLogSummary(row db.InferenceLog) InferenceLogSummary {
+	l := InferenceLogSummary{
+		ID:           row.ID,
+		Error:        row.Error.String,
+		Decision:     row.Decision.String,
+		ScoringPath:  row.ScoringPath.String,
+		RequestTime:  row.RequestTime,
+		ResponseTime: row.ResponseTime,
+	}
+	if row.ApiKeyID.Valid {
+		l.APIKeyID = &row.ApiKeyID.Int64
+	}
+
+	var req PredictRequest
+	if err := json.Unmarshal(row.RequestPayload, &req); err == nil {
+		l.Model = req.Model
+	}
+	if row.ResponsePayload.Valid {
+		var resp PredictResponse
+		if err := json.Unmarshal(row.ResponsePayload.RawMessage, &resp); err == nil {
+			l.ModelName = resp.Meta.ModelName
+			l.Prediction = &resp.Result.Prediction
+			l.Score = &resp.Result.Score
+		}
+	}
+	return l
+}
+
+// NewInferenceLogParams builds the inference log row of one prediction. resp
+// is nil and errMsg set when the request failed; reqPayload must already have
+// its sensitive features masked.
+func NewInferenceLogParams(userID int64, apiKeyID *int64, reqPayload []byte, resp *PredictResponse, errMsg string, reqTime, respTime time.Time) db.CreateInferenceLogParams {
+	params := db.CreateInferenceLogParams{
+		UserID:         userID,
+		RequestPayload: reqPayload,
+		RequestTime:    reqTime,
+		ResponseTime:   respTime,
+	}
+	if apiKeyID != nil {
+		params.ApiKeyID = sql.NullInt64{Int64: *apiKeyID, Valid: true}
+	}
+	if errMsg != "" {
+		params.Error = sql.NullString{String: errMsg, Valid: true}
+	}
+	if resp == nil {
+		return params
+	}
+
+	if respPayload, err := json.Marshal(resp); err == nil {
+		params.ResponsePayload = pqtype.NullRawMessage{RawMessage: respPayload, Valid: true}
+	}
+	params.ScoringPath = sql.NullString{String: string(resp.ScoringPath()), Valid: true}
+	if resp.Result.Decision != "" {
+		params.Decision = sql.NullString{String: string(resp.Result.Decision), Valid: true}
+		params.PolicyID = sql.NullInt64{Int64: resp.Meta.PolicyID, Valid: resp.Meta.PolicyID != 0}
+		params.PolicyVersion = sql.NullInt32{Int32: resp.Meta.PolicyVersion, Valid: true}
+	}
+	if fired := resp.FiredRules(); len(fired) > 0 {
+		if payload, err := json.Marshal(fired); err == nil {
+			params.FiredRules = pqtype.NullRawMessage{RawMessage: payload, Valid: true}
+		}
+	}
+	if resp.Result.Explanation != nil {
+		if payload, err := json.Marshal(resp.Result.Explanation); err == nil {
+			params.Explanation = pqtype.NullRawMessage{RawMessage: payload, Valid: true}
+		}
+	}
+	return params
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/sqlc-dev/pqtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferenceLogService_List(t *testing.T) {
+	key7, key8 := int64(7), int64(8)
+	repo := &memoryLogRepo{}
+	for i := 0; i < 5; i++ {
+		keyID := key7
+		if i%2 == 1 {
+			keyID = key8
+		}
+		repo.logs = append(repo.logs, db.CreateInferenceLogParams{
+			UserID:          1,
+			ApiKeyID:        sql.NullInt64{Int64: keyID, Valid: true},
+			RequestPayload:  []byte(`{"model":"logreg","features":{"amount":10}}`),
+			ResponsePayload: pqtype.NullRawMessage{RawMessage: []byte(`{"meta":{"model_name":"FraudDetector-logreg"},"result":{"prediction":1,"score":0.9}}`), Valid: true},
+			RequestTime:     time.Now(),
+		})
+	}
+	repo.logs = append(repo.logs, db.CreateInferenceLogParams{UserID: 2, RequestPayload: []byte(`{}`)})
+	svc := NewInferenceLogService(repo)
+	ctx := context.Background()
+
+	// JWT callers page through every log of the user, newest first.
+	page, err := svc.List(ctx, 1, nil, InferenceLogFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, int64(5), page.Items[0].ID)
+	assert.Equal(t, "logreg", page.Items[0].Model)
+	assert.Equal(t, "FraudDetector-logreg", page.Items[0].ModelName)
+	require.NotNil(t, page.Items[0].Score)
+	assert.Equal(t, 0.9, *page.Items[0].Score)
+	require.NotNil(t, page.NextCursor)
+
+	page, err = svc.List(ctx, 1, nil, InferenceLogFilter{Limit: 2, Cursor: *page.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), page.Items[0].ID)
+	page, err = svc.List(ctx, 1, nil, InferenceLogFilter{Limit: 2, Cursor: *page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Nil(t, page.NextCursor)
+
+	// API key callers only see their own key.
+	page, err = svc.List(ctx, 1, &key8, InferenceLogFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, key8, *page.Items[1].APIKeyID)
+	_, err = svc.List(ctx, 1, &key8, InferenceLogFilter{APIKeyID: &key7})
+	assert.ErrorIs(t, err, ErrInferenceLogForbidden)
+
+	_, err = svc.List(ctx, 1, nil, InferenceLogFilter{Status: "failed"})
+	assert.ErrorIs(t, err, ErrInvalidLogFilter)
+	_, err = svc.List(ctx, 1, nil, InferenceLogFilter{Limit: MaxInferenceLogPageSize + 1})
+	assert.ErrorIs(t, err, ErrInvalidLogFilter)
+	low, high := 0.8, 0.2
+	_, err = svc.List(ctx, 1, nil, InferenceLogFilter{MinScore: &low, MaxScore: &high})
+	assert.ErrorIs(t, err, ErrInvalidLogFilter)
+}
+
+func TestInferenceLogService_Get(t *testing.T) {
+	key7 := int64(7)
+	repo := &memoryLogRepo{logs: []db.CreateInferenceLogParams{{
+		UserID:         1,
+		RequestPayload: []byte(`{"model":"logreg","features":{"amount":10}}`),
+		Error:          sql.NullString{String: "vendor unavailable", Valid: true},
+	}}}
+	svc := NewInferenceLogService(repo)
+	ctx := context.Background()
+
+	l, err := svc.Get(ctx, 1, nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "vendor unavailable", l.Error)
+	assert.Nil(t, l.Prediction)
+	assert.JSONEq(t, `{"model":"logreg","features":{"amount":10}}`, string(l.Request))
+
+	_, err = svc.Get(ctx, 2, nil, 1)
+	assert.ErrorIs(t, err, ErrInferenceLogNotFound)
+	// The log was not made with the caller's API key.
+	_, err = svc.Get(ctx, 1, &key7, 1)
+	assert.ErrorIs(t, err, ErrInferenceLogNotFound)
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+// LocalFormat is the file format of a local model.
+type LocalFormat string
+
+const (
+	// LocalFormatLogistic is the JSON coefficient file of LogisticModel.
+	LocalFormatLogistic LocalFormat = "logistic"
+	// LocalFormatLightGBM is the text format of LightGBM Booster.save_model.
+	LocalFormatLightGBM LocalFormat = "lightgbm"
+	// LocalFormatXGBoost is the JSON format of XGBoost Booster.dump_model.
+	LocalFormatXGBoost LocalFormat = "xgboost"
+)
+
+// LocalModelStage is reported as the stage of models evaluated in process.
+const LocalModelStage = "local"
+
+const defaultLocalThreshold = 0.5
+
+var ErrInvalidLocalModel = errors.New("invalid local model")
+
+var localModelLoadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "local_model_loads_total",
+	Help: "Total number of local model file loads by model and result.",
+}, []string{"model", "result"})
+
+// Scorer evaluates a binary classifier in process.
+type Scorer interface {
+	// Score returns the probability of the positive class for features.
+	Score(features map[string]interface{}) float64
+	// Features returns the input features of the model.
+	Features() []string
+}
+
+// LocalModelSpec routes the model type Name to the model file at Path instead
+// of the vendor. Threshold defaults to the threshold of the logistic file, or
+// 0.5. BaseScore is the base score of XGBoost models, 0.5 by default.
+type LocalModelSpec struct {
+	Name      string
+	Format    LocalFormat
+	Path      string
+	Threshold float64
+	BaseScore float64
+}
+
+type localModel struct {
+	// name is reported as the model name: the file name without its
+	// extension.
+	name      string
+	scorer    Scorer
+	threshold float64
+	version   string
+	modTime   time.Time
+	size      int64
+}
+
+// LocalRuntime evaluates models from disk in process. Reload picks up model
+// files that changed; a file that fails to load keeps the previous version
+// serving.
+type LocalRuntime struct {
+	specs  []LocalModelSpec
+	logger zerolog.Logger
+
+	mu     sync.RWMutex
+	models map[string]*localModel
+}
+
+// NewLocalRuntime validates specs and loads every model file.
+func NewLocalRuntime(specs []LocalModelSpec, logger zerolog.Logger) (*LocalRuntime, error) {
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		switch {
+		case spec.Name == "":
+			return nil, fmt.Errorf("%w: name is required", ErrInvalidLocalModel)
+		case spec.Name == EnsembleModel:
+			return nil, fmt.Errorf("%w: %s is reserved", ErrInvalidLocalModel, EnsembleModel)
+		case seen[spec.Name]:
+			return nil, fmt.Errorf("%w: duplicate model %s", ErrInvalidLocalModel, spec.Name)
+		case spec.Path == "":
+			return nil, fmt.Errorf("%w: %s: path is required", ErrInvalidLocalModel, spec.Name)
+		case spec.Threshold < 0 || spec.Threshold > 1:
+			return nil, fmt.Errorf("%w: %s: threshold must be between 0 and 1", ErrInvalidLocalModel, spec.Name)
+		}
+		switch spec.Format {
+		case LocalFormatLogistic, LocalFormatLightGBM, LocalFormatXGBoost:
+		default:
+			return nil, fmt.Errorf("%w: %s: format must be one of [logistic lightgbm xgboost]", ErrInvalidLocalModel, spec.Name)
+		}
+		seen[spec.Name] = true
+	}
+
+	r := &LocalRuntime{specs: specs, logger: logger, models: make(map[string]*localModel, len(specs))}
+	for _, spec := range specs {
+		m, err := loadLocalModel(spec)
+		if err != nil {
+			localModelLoadsTotal.WithLabelValues(spec.Name, "error").Inc()
+			return nil, err
+		}
+		localModelLoadsTotal.WithLabelValues(spec.Name, "success").Inc()
+		r.models[spec.Name] = m
+	}
+	return r, nil
+}
+
+// Reload loads the model files whose size or modification time changed.
+// Model files should be replaced atomically, by renaming a complete file over
+// the old one.
+func (r *LocalRuntime) Reload(ctx context.Context) error {
+	var errs []error
+	for _, spec := range r.specs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		info, err := os.Stat(spec.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %v", ErrInvalidLocalModel, spec.Name, err))
+			continue
+		}
+		r.mu.RLock()
+		current := r.models[spec.Name]
+		r.mu.RUnlock()
+		if info.ModTime().Equal(current.modTime) && info.Size() == current.size {
+			continue
+		}
+
+		m, err := loadLocalModel(spec)
+		if err != nil {
+			localModelLoadsTotal.WithLabelValues(spec.Name, "error").Inc()
+			errs = append(errs, err)
+			continue
+		}
+		localModelLoadsTotal.WithLabelValues(spec.Name, "success").Inc()
+		r.mu.Lock()
+		r.models[spec.Name] = m
+		r.mu.Unlock()
+		r.logger.Info().Str("model", spec.Name).Str("version", m.version).Msg("reloaded local model")
+	}
+	return errors.Join(errs...)
+}
+
+// Has reports whether model is served locally. It is false for a nil
+// runtime.
+func (r *LocalRuntime) Has(model string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.models[model]
+	return ok
+}
+
+// Models returns the local models sorted by model type. The version, also
+// reported as the run ID, is a hash of the model file.
+func (r *LocalRuntime) Models() []Model {
+	if r == nil {
+		return nil
+	}
+	models := make([]Model, 0, len(r.specs))
+	r.mu.RLock()
+	for _, spec := range r.specs {
+		m := r.models[spec.Name]
+		models = append(models, Model{
+			ModelType:       spec.Name,
+			Name:            m.name,
+			Version:         m.version,
+			RunID:           m.version,
+			Stage:           LocalModelStage,
+			SignatureInputs: m.scorer.Features(),
+		})
+	}
+	r.mu.RUnlock()
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ModelType < models[j].ModelType
+	})
+	return models
+}
+
+// Predict scores req with the local model and returns the response in the
+// shape of the vendor. Features missing from req score as missing values.
+func (r *LocalRuntime) Predict(req clients.PredictRequest) (*clients.PredictResponse, error) {
+	start := time.Now()
+	r.mu.RLock()
+	m, ok := r.models[req.Model]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("model %s is not served locally", req.Model)
+	}
+
+	resp := &clients.PredictResponse{}
+	resp.Meta.ModelName = m.name
+	resp.Meta.ModelVersion = m.version
+	resp.Meta.ModelStage = LocalModelStage
+	resp.Meta.RunID = m.version
+	resp.Meta.RequestID = uuid.New().String()
+	resp.Meta.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	resp.Result.Score = m.scorer.Score(req.Features)
+	resp.Result.Threshold = m.threshold
+	if resp.Result.Score >= m.threshold {
+		resp.Result.Prediction = 1
+	}
+	resp.Meta.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	return resp, nil
+}
+
+func loadLocalModel(spec LocalModelSpec) (*localModel, error) {
+	info, err := os.Stat(spec.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidLocalModel, spec.Name, err)
+	}
+	data, err := os.ReadFile(spec.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidLocalModel, spec.Name, err)
+	}
+
+	threshold := spec.Threshold
+	var scorer Scorer
+	switch spec.Format {
+	case LocalFormatLogistic:
+		var m *LogisticModel
+		if m, err = parseLogisticModel(data); err == nil {
+			scorer = m
+			if threshold == 0 {
+				threshold = m.Threshold
+			}
+		}
+	case LocalFormatLightGBM:
+		scorer, err = parseLightGBMModel(data)
+	case LocalFormatXGBoost:
+		baseScore := spec.BaseScore
+		if baseScore == 0 {
+			baseScore = 0.5
+		}
+		scorer, err = parseXGBoostModel(data, baseScore)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s: %v", ErrInvalidLocalModel, spec.Name, spec.Path, err)
+	}
+	if threshold == 0 {
+		threshold = defaultLocalThreshold
+	}
+
+	sum := sha256.Sum256(data)
+	base := filepath.Base(spec.Path)
+	return &localModel{
+		name:      strings.TrimSuffix(base, filepath.Ext(base)),
+		scorer:    scorer,
+		threshold: threshold,
+		version:   hex.EncodeToString(sum[:6]),
+		modTime:   info.ModTime(),
+		size:      info.Size(),
+	}, nil
+}
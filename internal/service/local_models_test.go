@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeLocalModel writes a model file and moves its modification time forward
+// so that Reload sees every rewrite.
+func writeLocalModel(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestLocalRuntime(t *testing.T) {
+	dir := t.TempDir()
+	logreg := filepath.Join(dir, "logreg-v1.json")
+	lightgbm := filepath.Join(dir, "lightgbm.txt")
+	now := time.Now()
+	writeLocalModel(t, logreg, `{"intercept": -2, "coefficients": {"amount": 0.01}}`, now)
+	writeLocalModel(t, lightgbm, testLightGBMModel, now)
+
+	_, err := NewLocalRuntime([]LocalModelSpec{{Name: "logreg", Format: "onnx", Path: logreg}}, zerolog.Nop())
+	assert.ErrorIs(t, err, ErrInvalidLocalModel)
+	_, err = NewLocalRuntime([]LocalModelSpec{{Name: "logreg", Format: LocalFormatXGBoost, Path: logreg}}, zerolog.Nop())
+	assert.ErrorIs(t, err, ErrInvalidLocalModel)
+
+	rt, err := NewLocalRuntime([]LocalModelSpec{
+		{Name: "logreg", Format: LocalFormatLogistic, Path: logreg},
+		{Name: "lightgbm", Format: LocalFormatLightGBM, Path: lightgbm, Threshold: 0.7},
+	}, zerolog.Nop())
+	require.NoError(t, err)
+	assert.True(t, rt.Has("logreg"))
+	assert.False(t, rt.Has("xgboost"))
+
+	models := rt.Models()
+	require.Len(t, models, 2)
+	assert.Equal(t, "lightgbm", models[0].ModelType)
+	assert.Equal(t, LocalModelStage, models[0].Stage)
+	assert.Equal(t, []string{"amount", "is_new_device"}, models[0].SignatureInputs)
+	assert.Equal(t, "logreg-v1", models[1].Name)
+
+	resp, err := rt.Predict(clients.PredictRequest{Model: "lightgbm", Features: map[string]interface{}{"amount": 500.0, "is_new_device": false}})
+	require.NoError(t, err)
+	assert.InDelta(t, sigmoid(0.75), resp.Result.Score, 1e-9)
+	assert.Equal(t, 0.7, resp.Result.Threshold)
+	assert.Equal(t, 0, resp.Result.Prediction)
+	assert.Equal(t, "lightgbm", resp.Meta.ModelName)
+	assert.NotEmpty(t, resp.Meta.ModelVersion)
+
+	resp, err = rt.Predict(clients.PredictRequest{Model: "logreg", Features: map[string]interface{}{"amount": 300.0}})
+	require.NoError(t, err)
+	assert.InDelta(t, sigmoid(1), resp.Result.Score, 1e-9)
+	assert.Equal(t, 1, resp.Result.Prediction)
+	version := resp.Meta.ModelVersion
+
+	// Unchanged files are not reloaded; changed files are.
+	require.NoError(t, rt.Reload(context.Background()))
+	writeLocalModel(t, logreg, `{"intercept": -4, "coefficients": {"amount": 0.01}}`, now.Add(time.Second))
+	require.NoError(t, rt.Reload(context.Background()))
+	resp, err = rt.Predict(clients.PredictRequest{Model: "logreg", Features: map[string]interface{}{"amount": 300.0}})
+	require.NoError(t, err)
+	assert.InDelta(t, sigmoid(-1), resp.Result.Score, 1e-9)
+	assert.NotEqual(t, version, resp.Meta.ModelVersion)
+
+	// A broken file keeps the previous model serving.
+	writeLocalModel(t, logreg, `{"intercept": `, now.Add(2*time.Second))
+	assert.ErrorIs(t, rt.Reload(context.Background()), ErrInvalidLocalModel)
+	resp, err = rt.Predict(clients.PredictRequest{Model: "logreg", Features: map[string]interface{}{"amount": 300.0}})
+	require.NoError(t, err)
+	assert.InDelta(t, sigmoid(-1), resp.Result.Score, 1e-9)
+}
+
+func TestVendorService_LocalModels(t *testing.T) {
+	var vendorCalls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/version":
+			_, _ = w.Write([]byte(`{"loaded_models":{"logreg":{"name":"FraudDetector-logistic_regression","signature_inputs":["amount"]},"xgboost":{"name":"FraudDetector-xgboost","signature_inputs":["amount"]}}}`))
+		case "/v1/predict":
+			vendorCalls++
+			_, _ = w.Write([]byte(`{"meta":{"model_name":"FraudDetector-logistic_regression"},"result":{"prediction":0,"score":0.1,"threshold":0.5}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "xgboost.json")
+	writeLocalModel(t, path, testXGBoostModel, time.Now())
+	rt, err := NewLocalRuntime([]LocalModelSpec{{Name: "xgboost", Format: LocalFormatXGBoost, Path: path}}, zerolog.Nop())
+	require.NoError(t, err)
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	svc := NewVendorService(client, zerolog.Nop(), WithLocalRuntime(rt))
+	ctx := context.Background()
+
+	models, err := svc.ListModels(ctx)
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	assert.Equal(t, "xgboost", models[1].ModelType)
+	assert.Equal(t, LocalModelStage, models[1].Stage)
+
+	resp, err := svc.Predict(ctx, PredictRequest{Model: "xgboost", Features: map[string]interface{}{"amount": 500.5, "is_new_device": true}})
+	require.NoError(t, err)
+	assert.Equal(t, 0, vendorCalls)
+	assert.Equal(t, "xgboost", resp.Meta.ModelName)
+	assert.InDelta(t, sigmoid(2.25), resp.Result.Score, 1e-9)
+
+	// The inputs of local models are required, extra features are allowed.
+	require.NoError(t, svc.ValidateFeatures(ctx, "xgboost", map[string]interface{}{"amount": 500.5, "is_new_device": true, "transaction_id": 1}))
+	var validationErr *FeatureValidationError
+	require.ErrorAs(t, svc.ValidateFeatures(ctx, "xgboost", map[string]interface{}{"transaction_id": 1}), &validationErr)
+	assert.Equal(t, FeatureMissing, validationErr.Problems[0].Problem)
+	assert.Equal(t, models[1].Version, resp.Meta.RunID)
+
+	_, err = svc.Predict(ctx, PredictRequest{Model: "logreg", Features: map[string]interface{}{"amount": 10.5}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, vendorCalls)
+
+	var unknown *UnknownModelError
+	require.ErrorAs(t, svc.ValidateModel(ctx, "catboost"), &unknown)
+	assert.Equal(t, []string{"ensemble", "logreg", "xgboost"}, unknown.Allowed)
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+// calibrationBins is the number of equal-width score bins used for the
+// expected calibration error.
+const calibrationBins = 10
+
+// Model metrics over the whole lookback window, by model name and run ID.
+var (
+	modelLabeledPredictions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "model_labeled_predictions",
+		Help: "Number of predictions with a ground-truth label in the metrics lookback window.",
+	}, []string{"model_name", "run_id"})
+	modelPrecision = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "model_precision",
+		Help: "Precision of the model on labeled predictions in the metrics lookback window.",
+	}, []string{"model_name", "run_id"})
+	modelRecall = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "model_recall",
+		Help: "Recall of the model on labeled predictions in the metrics lookback window.",
+	}, []string{"model_name", "run_id"})
+	modelFalsePositiveRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "model_false_positive_rate",
+		Help: "False-positive rate of the model on labeled predictions in the metrics lookback window.",
+	}, []string{"model_name", "run_id"})
+	modelAUC = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "model_auc",
+		Help: "ROC AUC of the model scores on labeled predictions in the metrics lookback window.",
+	}, []string{"model_name", "run_id"})
+	modelCalibrationError = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "model_calibration_error",
+		Help: "Expected calibration error of the model scores in the metrics lookback window.",
+	}, []string{"model_name", "run_id"})
+)
+
+// ModelMetrics describes how a model run performed on the labeled predictions
+// made in one time bucket. Rates are nil when they are undefined, e.g. recall
+// without any fraud label.
+type ModelMetrics struct {
+	ModelName         string    `json:"model_name"`
+	RunID             string    `json:"run_id"`
+	BucketStart       time.Time `json:"bucket_start"`
+	BucketEnd         time.Time `json:"bucket_end"`
+	Total             int64     `json:"total"`
+	Positives         int64     `json:"positives"`
+	TruePositives     int64     `json:"true_positives"`
+	FalsePositives    int64     `json:"false_positives"`
+	TrueNegatives     int64     `json:"true_negatives"`
+	FalseNegatives    int64     `json:"false_negatives"`
+	Precision         *float64  `json:"precision"`
+	Recall            *float64  `json:"recall"`
+	FalsePositiveRate *float64  `json:"false_positive_rate"`
+	AUC               *float64  `json:"auc"`
+	CalibrationError  *float64  `json:"calibration_error"`
+}
+
+type ModelMetricsService interface {
+	// Compute recomputes the metrics of every bucket in the lookback window
+	// before now, stores them, deletes the buckets that left the window and
+	// updates the Prometheus gauges.
+	Compute(ctx context.Context, now time.Time) error
+	// List returns the stored metrics of buckets starting in [from, to), for
+	// every model if modelName is empty.
+	List(ctx context.Context, from, to time.Time, modelName string) ([]ModelMetrics, error)
+}
+
+type modelMetricsService struct {
+	metricsRepo repo.ModelMetricsRepository
+	bucket      time.Duration
+	lookback    time.Duration
+	logger      zerolog.Logger
+}
+
+func NewModelMetricsService(metricsRepo repo.ModelMetricsRepository, bucket, lookback time.Duration, logger zerolog.Logger) ModelMetricsService {
+	return &modelMetricsService{
+		metricsRepo: metricsRepo,
+		bucket:      bucket,
+		lookback:    lookback,
+		logger:      logger,
+	}
+}
+
+// scoreCount counts the labeled predictions that got one score and
+// prediction, by ground-truth label.
+type scoreCount struct {
+	score      float64
+	prediction int32
+	frauds     int64
+	legits     int64
+}
+
+type modelRun struct {
+	model string
+	runID string
+}
+
+type bucketKey struct {
+	modelRun
+	start time.Time
+}
+
+func (s *modelMetricsService) Compute(ctx context.Context, now time.Time) error {
+	from := now.Add(-s.lookback).Truncate(s.bucket)
+	rows, err := s.metricsRepo.ListLabeledScoreCounts(ctx, from, now, s.bucket)
+	if err != nil {
+		return err
+	}
+
+	var labeled int64
+	buckets := make(map[bucketKey][]scoreCount)
+	runs := make(map[modelRun][]scoreCount)
+	for _, row := range rows {
+		// Requests decided by a pre-model rule were never scored.
+		if row.ModelName == RulesModel {
+			continue
+		}
+		count := scoreCount{score: row.Score, prediction: row.Prediction, frauds: row.Frauds, legits: row.Legits}
+		run := modelRun{model: row.ModelName, runID: row.RunID}
+		key := bucketKey{modelRun: run, start: row.BucketStart.UTC()}
+		buckets[key] = append(buckets[key], count)
+		runs[run] = append(runs[run], count)
+		labeled += row.Frauds + row.Legits
+	}
+
+	for key, counts := range buckets {
+		m := computeModelMetrics(counts)
+		if err := s.metricsRepo.UpsertModelMetrics(ctx, db.UpsertModelMetricsParams{
+			ModelName:         key.model,
+			RunID:             key.runID,
+			BucketStart:       key.start,
+			BucketEnd:         key.start.Add(s.bucket),
+			Total:             m.Total,
+			Positives:         m.Positives,
+			TruePositives:     m.TruePositives,
+			FalsePositives:    m.FalsePositives,
+			TrueNegatives:     m.TrueNegatives,
+			FalseNegatives:    m.FalseNegatives,
+			Precision:         nullFloat(m.Precision),
+			Recall:            nullFloat(m.Recall),
+			FalsePositiveRate: nullFloat(m.FalsePositiveRate),
+			Auc:               nullFloat(m.AUC),
+			CalibrationError:  nullFloat(m.CalibrationError),
+		}); err != nil {
+			return err
+		}
+	}
+
+	pruned, err := s.metricsRepo.DeleteModelMetricsBefore(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	resetModelGauges()
+	for run, counts := range runs {
+		m := computeModelMetrics(counts)
+		modelLabeledPredictions.WithLabelValues(run.model, run.runID).Set(float64(m.Total))
+		setGauge(modelPrecision, run, m.Precision)
+		setGauge(modelRecall, run, m.Recall)
+		setGauge(modelFalsePositiveRate, run, m.FalsePositiveRate)
+		setGauge(modelAUC, run, m.AUC)
+		setGauge(modelCalibrationError, run, m.CalibrationError)
+	}
+
+	s.logger.Info().Int64("labeled", labeled).Int("buckets", len(buckets)).Int64("pruned", pruned).Msg("computed model metrics")
+	return nil
+}
+
+func (s *modelMetricsService) List(ctx context.Context, from, to time.Time, modelName string) ([]ModelMetrics, error) {
+	rows, err := s.metricsRepo.ListModelMetrics(ctx, from, to, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]ModelMetrics, len(rows))
+	for i, row := range rows {
+		metrics[i] = ModelMetrics{
+			ModelName:         row.ModelName,
+			RunID:             row.RunID,
+			BucketStart:       row.BucketStart,
+			BucketEnd:         row.BucketEnd,
+			Total:             row.Total,
+			Positives:         row.Positives,
+			TruePositives:     row.TruePositives,
+			FalsePositives:    row.FalsePositives,
+			TrueNegatives:     row.TrueNegatives,
+			FalseNegatives:    row.FalseNegatives,
+			Precision:         floatPtr(row.Precision),
+			Recall:            floatPtr(row.Recall),
+			FalsePositiveRate: floatPtr(row.FalsePositiveRate),
+			AUC:               floatPtr(row.Auc),
+			CalibrationError:  floatPtr(row.CalibrationError),
+		}
+	}
+	return metrics, nil
+}
+
+// computeModelMetrics derives the confusion matrix from the model predictions
+// and AUC and calibration from the scores.
+func computeModelMetrics(counts []scoreCount) ModelMetrics {
+	var m ModelMetrics
+	for _, c := range counts {
+		if c.prediction == 1 {
+			m.TruePositives += c.frauds
+			m.FalsePositives += c.legits
+		} else {
+			m.FalseNegatives += c.frauds
+			m.TrueNegatives += c.legits
+		}
+	}
+	m.Positives = m.TruePositives + m.FalseNegatives
+	m.Total = m.Positives + m.FalsePositives + m.TrueNegatives
+
+	m.Precision = ratio(m.TruePositives, m.TruePositives+m.FalsePositives)
+	m.Recall = ratio(m.TruePositives, m.Positives)
+	m.FalsePositiveRate = ratio(m.FalsePositives, m.FalsePositives+m.TrueNegatives)
+	m.AUC = rocAUC(counts)
+	m.CalibrationError = calibrationError(counts)
+	return m
+}
+
+// rocAUC is the probability that a fraudulent sample scores higher than a
+// legitimate one, computed from score ranks with ties sharing their average
+// rank.
+func rocAUC(counts []scoreCount) *float64 {
+	sorted := make([]scoreCount, len(counts))
+	copy(sorted, counts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].score < sorted[j].score })
+
+	var positives, negatives int64
+	var positiveRanks float64
+	for i := 0; i < len(sorted); {
+		var frauds, legits int64
+		j := i
+		for ; j < len(sorted) && sorted[j].score == sorted[i].score; j++ {
+			frauds += sorted[j].frauds
+			legits += sorted[j].legits
+		}
+		// The tied samples take the ranks after the lower scores.
+		below := positives + negatives
+		rank := float64(2*below+frauds+legits+1) / 2
+		positives += frauds
+		negatives += legits
+		positiveRanks += float64(frauds) * rank
+		i = j
+	}
+	if positives == 0 || negatives == 0 {
+		return nil
+	}
+	auc := (positiveRanks - float64(positives*(positives+1))/2) / float64(positives*negatives)
+	return &auc
+}
+
+// calibrationError is the expected calibration error: the sample-weighted mean
+// gap between the average score and the fraud rate of each score bin.
+func calibrationError(counts []scoreCount) *float64 {
+	var total float64
+	var samples, frauds, scores [calibrationBins]float64
+	for _, c := range counts {
+		n := float64(c.frauds + c.legits)
+		score := math.Min(math.Max(c.score, 0), 1)
+		bin := int(score * calibrationBins)
+		if bin == calibrationBins {
+			bin--
+		}
+		samples[bin] += n
+		scores[bin] += score * n
+		frauds[bin] += float64(c.frauds)
+		total += n
+	}
+	if total == 0 {
+		return nil
+	}
+
+	var ece float64
+	for i := range samples {
+		if samples[i] == 0 {
+			continue
+		}
+		ece += samples[i] / total * math.Abs(scores[i]/samples[i]-frauds[i]/samples[i])
+	}
+	return &ece
+}
+
+func ratio(num, denom int64) *float64 {
+	if denom == 0 {
+		return nil
+	}
+	r := float64(num) / float64(denom)
+	return &r
+}
+
+func resetModelGauges() {
+	for _, g := range []*prometheus.GaugeVec{modelLabeledPredictions, modelPrecision, modelRecall, modelFalsePositiveRate, modelAUC, modelCalibrationError} {
+		g.Reset()
+	}
+}
+
+func setGauge(g *prometheus.GaugeVec, run modelRun, v *float64) {
+	if v != nil {
+		g.WithLabelValues(run.model, run.runID).Set(*v)
+	}
+}
+
+func nullFloat(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
+
+func floatPtr(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
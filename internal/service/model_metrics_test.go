@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// labeledPrediction is one labeled prediction of memoryMetricsRepo.
+type labeledPrediction struct {
+	ModelName   string
+	RunID       string
+	RequestTime time.Time
+	Score       float64
+	Prediction  int32
+	Label       string
+}
+
+type memoryMetricsRepo struct {
+	labeled []labeledPrediction
+	metrics []db.UpsertModelMetricsParams
+	pruned  []time.Time
+}
+
+func (r *memoryMetricsRepo) ListLabeledScoreCounts(ctx context.Context, from, to time.Time, bucket time.Duration) ([]db.ListLabeledScoreCountsRow, error) {
+	var rows []db.ListLabeledScoreCountsRow
+	for _, p := range r.labeled {
+		if p.RequestTime.Before(from) || !p.RequestTime.Before(to) {
+			continue
+		}
+		row := db.ListLabeledScoreCountsRow{
+			ModelName:   p.ModelName,
+			RunID:       p.RunID,
+			BucketStart: from.Add(p.RequestTime.Sub(from) / bucket * bucket),
+			Score:       p.Score,
+			Prediction:  p.Prediction,
+		}
+		if p.Label == string(LabelFraud) {
+			row.Frauds = 1
+		} else {
+			row.Legits = 1
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (r *memoryMetricsRepo) ListModelMetrics(ctx context.Context, from, to time.Time, modelName string) ([]db.ModelMetric, error) {
+	return nil, nil
+}
+
+func (r *memoryMetricsRepo) UpsertModelMetrics(ctx context.Context, arg db.UpsertModelMetricsParams) error {
+	r.metrics = append(r.metrics, arg)
+	return nil
+}
+
+func (r *memoryMetricsRepo) DeleteModelMetricsBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.pruned = append(r.pruned, before)
+	return 0, nil
+}
+
+func TestComputeModelMetrics(t *testing.T) {
+	m := computeModelMetrics([]scoreCount{
+		{score: 0.9, prediction: 1, frauds: 1},
+		{score: 0.8, prediction: 1, legits: 1},
+		{score: 0.6, prediction: 1, frauds: 1},
+		{score: 0.3, prediction: 0, frauds: 1},
+		{score: 0.2, prediction: 0, legits: 1},
+		{score: 0.1, prediction: 0, legits: 1},
+	})
+
+	assert.Equal(t, int64(6), m.Total)
+	assert.Equal(t, int64(3), m.Positives)
+	assert.Equal(t, int64(2), m.TruePositives)
+	assert.Equal(t, int64(1), m.FalsePositives)
+	assert.Equal(t, int64(2), m.TrueNegatives)
+	assert.Equal(t, int64(1), m.FalseNegatives)
+	assert.InDelta(t, 2.0/3, *m.Precision, 1e-9)
+	assert.InDelta(t, 2.0/3, *m.Recall, 1e-9)
+	assert.InDelta(t, 1.0/3, *m.FalsePositiveRate, 1e-9)
+	// 7 of the 9 fraud/legit pairs are ranked correctly.
+	assert.InDelta(t, 7.0/9, *m.AUC, 1e-9)
+	require.NotNil(t, m.CalibrationError)
+
+	// Rates without a denominator are undefined.
+	m = computeModelMetrics([]scoreCount{{score: 0.2, prediction: 0, legits: 1}})
+	assert.Nil(t, m.Precision)
+	assert.Nil(t, m.Recall)
+	assert.Nil(t, m.AUC)
+	assert.InDelta(t, 0.0, *m.FalsePositiveRate, 1e-9)
+}
+
+func TestComputeModelMetrics_Counts(t *testing.T) {
+	// Counted predictions score like the same predictions one by one, ties
+	// included.
+	counted := computeModelMetrics([]scoreCount{
+		{score: 0.8, prediction: 1, frauds: 2, legits: 1},
+		{score: 0.4, prediction: 0, frauds: 1, legits: 3},
+		{score: 0.8, prediction: 1, frauds: 1},
+	})
+	single := computeModelMetrics([]scoreCount{
+		{score: 0.8, prediction: 1, frauds: 1}, {score: 0.8, prediction: 1, frauds: 1},
+		{score: 0.8, prediction: 1, frauds: 1}, {score: 0.8, prediction: 1, legits: 1},
+		{score: 0.4, prediction: 0, frauds: 1}, {score: 0.4, prediction: 0, legits: 1},
+		{score: 0.4, prediction: 0, legits: 1}, {score: 0.4, prediction: 0, legits: 1},
+	})
+	assert.Equal(t, single, counted)
+	assert.Equal(t, int64(8), counted.Total)
+	// 3*3 pairs ranked correctly, 3*1 + 1*3 ties counting half: 12/16.
+	assert.InDelta(t, 0.75, *counted.AUC, 1e-9)
+}
+
+func TestCalibrationError(t *testing.T) {
+	// Scores matching the observed fraud rate are perfectly calibrated.
+	ece := calibrationError([]scoreCount{
+		{score: 0.5, frauds: 1},
+		{score: 0.5, legits: 1},
+		{score: 1, frauds: 1},
+	})
+	assert.InDelta(t, 0.0, *ece, 1e-9)
+
+	ece = calibrationError([]scoreCount{{score: 0.9, legits: 1}})
+	assert.InDelta(t, 0.9, *ece, 1e-9)
+}
+
+func TestModelMetricsService_Compute(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	day1 := time.Date(2026, 3, 8, 9, 0, 0, 0, time.UTC)
+	day2 := time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)
+	repo := &memoryMetricsRepo{labeled: []labeledPrediction{
+		{ModelName: "xgboost", RunID: "run-1", RequestTime: day1, Score: 0.9, Prediction: 1, Label: "fraud"},
+		{ModelName: "xgboost", RunID: "run-1", RequestTime: day1.Add(time.Hour), Score: 0.1, Prediction: 0, Label: "legit"},
+		{ModelName: "xgboost", RunID: "run-1", RequestTime: day2, Score: 0.7, Prediction: 1, Label: "legit"},
+		{ModelName: RulesModel, RequestTime: day2, Label: "fraud"},
+		{ModelName: "xgboost", RunID: "run-1", RequestTime: now.Add(-60 * 24 * time.Hour), Score: 0.7, Prediction: 1, Label: "legit"},
+	}}
+	svc := NewModelMetricsService(repo, 24*time.Hour, 7*24*time.Hour, zerolog.Nop())
+
+	require.NoError(t, svc.Compute(context.Background(), now))
+	require.Len(t, repo.metrics, 2)
+	for _, m := range repo.metrics {
+		assert.Equal(t, "xgboost", m.ModelName)
+		assert.Equal(t, m.BucketStart.Add(24*time.Hour), m.BucketEnd)
+		switch m.BucketStart {
+		case time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC):
+			assert.Equal(t, int64(2), m.Total)
+			assert.InDelta(t, 1.0, m.Auc.Float64, 1e-9)
+		case time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC):
+			assert.Equal(t, int64(1), m.Total)
+			assert.False(t, m.Recall.Valid)
+		default:
+			t.Fatalf("unexpected bucket %s", m.BucketStart)
+		}
+	}
+
+	// Buckets that left the lookback window are deleted.
+	assert.Equal(t, []time.Time{time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)}, repo.pruned)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(modelLabeledPredictions.WithLabelValues("xgboost", "run-1")))
+	assert.InDelta(t, 0.5, testutil.ToFloat64(modelPrecision.WithLabelValues("xgboost", "run-1")), 1e-9)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultModelRegistryTTL = 30 * time.Second
+
+// UnknownModelError is returned when a request names a model type that is not
+// currently loaded by the vendor.
+type UnknownModelError struct {
+	Model   string
+	Allowed []string
+}
+
+func (e *UnknownModelError) Error() string {
+	return "model must be one of [" + strings.Join(e.Allowed, " ") + "]"
+}
+
+// modelRegistry caches the models loaded by the vendor. Entries older than ttl
+// are still served while a single background refresh runs, so a vendor outage
+// keeps the last known registry instead of failing validation.
+type modelRegistry struct {
+	client *clients.ThirdPartyClient
+	ttl    time.Duration
+	logger zerolog.Logger
+
+	// loads makes the requests that find the registry empty share one
+	// vendor call.
+	loads      singleflight.Group
+	mu         sync.Mutex
+	models     []Model
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+func newModelRegistry(client *clients.ThirdPartyClient, ttl time.Duration, logger zerolog.Logger) *modelRegistry {
+	if ttl <= 0 {
+		ttl = defaultModelRegistryTTL
+	}
+	return &modelRegistry{client: client, ttl: ttl, logger: logger}
+}
+
+// Models returns the loaded models sorted by model type. Only the very first
+// lookup blocks on the vendor.
+func (r *modelRegistry) Models(ctx context.Context) ([]Model, error) {
+	r.mu.Lock()
+	if r.models == nil {
+		r.mu.Unlock()
+		return r.refresh(ctx)
+	}
+
+	models := r.models
+	if time.Since(r.fetchedAt) >= r.ttl && !r.refreshing {
+		r.refreshing = true
+		go func() {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.ttl)
+			defer cancel()
+			if _, err := r.refresh(ctx); err != nil {
+				r.logger.Warn().Err(err).Msg("model registry refresh failed, serving stale models")
+			}
+		}()
+	}
+	r.mu.Unlock()
+	return models, nil
+}
+
+// Validate checks that model is loaded by the vendor. The "ensemble" pseudo
+// model is always accepted.
+func (r *modelRegistry) Validate(ctx context.Context, model string) error {
+	models, err := r.Models(ctx)
+	if err != nil {
+		return err
+	}
+
+	allowed := make([]string, 0, len(models)+1)
+	for _, m := range models {
+		if m.ModelType == model {
+			return nil
+		}
+		allowed = append(allowed, m.ModelType)
+	}
+	if model == EnsembleModel {
+		return nil
+	}
+
+	allowed = append(allowed, EnsembleModel)
+	sort.Strings(allowed)
+	return &UnknownModelError{Model: model, Allowed: allowed}
+}
+
+// refresh loads the models from the vendor. Concurrent callers share one
+// call.
+func (r *modelRegistry) refresh(ctx context.Context) ([]Model, error) {
+	models, err, _ := r.loads.Do("models", func() (interface{}, error) {
+		return r.fetch(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return models.([]Model), nil
+}
+
+func (r *modelRegistry) fetch(ctx context.Context) ([]Model, error) {
+	version, err := r.client.Version(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refreshing = false
+	if err != nil {
+		// Back off for a full ttl before the next background attempt.
+		if r.models != nil {
+			r.fetchedAt = time.Now()
+		}
+		return nil, err
+	}
+
+	models := make([]Model, 0, len(version.LoadedModels))
+	for modelType, m := range version.LoadedModels {
+		models = append(models, Model{
+			ModelType:       modelType,
+			Name:            m.Name,
+			Version:         m.Version,
+			Stage:           m.Stage,
+			RunID:           m.RunID,
+			SignatureInputs: m.SignatureInputs,
+		})
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ModelType < models[j].ModelType
+	})
+
+	r.models = models
+	r.fetchedAt = time.Now()
+	return models, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRegistry_Validate(t *testing.T) {
+	var calls, down atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down.Load() == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"loaded_models":{"logreg":{"name":"FraudDetector-logistic_regression"},"catboost":{"name":"FraudDetector-catboost"}}}`))
+	}))
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	registry := newModelRegistry(client, 50*time.Millisecond, zerolog.Nop())
+	ctx := context.Background()
+
+	require.NoError(t, registry.Validate(ctx, "catboost"))
+	require.NoError(t, registry.Validate(ctx, EnsembleModel))
+	assert.Equal(t, int32(1), calls.Load(), "fresh registry should be served from cache")
+
+	err := registry.Validate(ctx, "xgboost")
+	var unknownErr *UnknownModelError
+	require.ErrorAs(t, err, &unknownErr)
+	assert.Equal(t, []string{"catboost", "ensemble", "logreg"}, unknownErr.Allowed)
+	assert.Equal(t, "model must be one of [catboost ensemble logreg]", err.Error())
+
+	// Once stale, the cached models keep being served while the vendor is down.
+	down.Store(1)
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, registry.Validate(ctx, "logreg"))
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, registry.Validate(ctx, "logreg"))
+}
+
+func TestModelRegistry_Unavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	registry := newModelRegistry(client, time.Minute, zerolog.Nop())
+
+	err := registry.Validate(context.Background(), "logreg")
+	require.Error(t, err)
+	var unknownErr *UnknownModelError
+	assert.False(t, errors.As(err, &unknownErr))
+}
+
+func TestModelRegistry_ColdLoadsOnce(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"loaded_models":{"logreg":{"name":"FraudDetector-logistic_regression"}}}`))
+	}))
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	registry := newModelRegistry(client, time.Minute, zerolog.Nop())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, registry.Validate(context.Background(), "logreg"))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
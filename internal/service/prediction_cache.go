@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// Prediction cache lookup results.
+const (
+	predictionCacheHit   = "hit"
+	predictionCacheMiss  = "miss"
+	predictionCacheError = "error"
+)
+
+var predictionCacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "prediction_cache_requests_total",
+	Help: "Total number of prediction cache lookups by model and result (hit, miss or error).",
+}, []string{"model", "result"})
+
+// PredictionCache stores vendor predictions for a short time, so identical
+// feature vectors scored again, such as a transaction checked at
+// authorization and at capture, skip the vendor. Callers pass the client
+// features only: derived features differ between the two checks, so a hit
+// returns the score computed with the derived features of the first call.
+type PredictionCache interface {
+	// Get returns the prediction stored for the features scored by run runID
+	// of model.
+	Get(ctx context.Context, model, runID string, features map[string]interface{}) (*clients.PredictResponse, bool)
+	// Set stores resp for the TTL of model.
+	Set(ctx context.Context, model, runID string, features map[string]interface{}, resp *clients.PredictResponse)
+}
+
+type redisPredictionCache struct {
+	redisClient *redis.Client
+	ttl         time.Duration
+	modelTTLs   map[string]time.Duration
+	logger      zerolog.Logger
+}
+
+// NewPredictionCache caches predictions in Redis for ttl, or for the TTL of
+// the model in modelTTLs. Models with a TTL of 0 are not cached. Redis errors
+// are logged and treated as misses.
+func NewPredictionCache(redisClient *redis.Client, ttl time.Duration, modelTTLs map[string]time.Duration, logger zerolog.Logger) PredictionCache {
+	return &redisPredictionCache{
+		redisClient: redisClient,
+		ttl:         ttl,
+		modelTTLs:   modelTTLs,
+		logger:      logger,
+	}
+}
+
+func (c *redisPredictionCache) Get(ctx context.Context, model, runID string, features map[string]interface{}) (*clients.PredictResponse, bool) {
+	if c.modelTTL(model) <= 0 {
+		return nil, false
+	}
+	key, ok := predictionCacheKey(model, runID, features)
+	if !ok {
+		return nil, false
+	}
+
+	data, err := c.redisClient.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			predictionCacheRequestsTotal.WithLabelValues(model, predictionCacheMiss).Inc()
+		} else {
+			predictionCacheRequestsTotal.WithLabelValues(model, predictionCacheError).Inc()
+			c.logger.Warn().Err(err).Str("model", model).Msg("prediction cache lookup failed")
+		}
+		return nil, false
+	}
+
+	var resp clients.PredictResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		predictionCacheRequestsTotal.WithLabelValues(model, predictionCacheError).Inc()
+		c.logger.Warn().Err(err).Str("model", model).Msg("invalid cached prediction")
+		return nil, false
+	}
+	predictionCacheRequestsTotal.WithLabelValues(model, predictionCacheHit).Inc()
+	return &resp, true
+}
+
+func (c *redisPredictionCache) Set(ctx context.Context, model, runID string, features map[string]interface{}, resp *clients.PredictResponse) {
+	ttl := c.modelTTL(model)
+	if ttl <= 0 {
+		return
+	}
+	key, ok := predictionCacheKey(model, runID, features)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	if err := c.redisClient.Set(ctx, key, data, ttl).Err(); err != nil {
+		c.logger.Warn().Err(err).Str("model", model).Msg("failed to cache prediction")
+	}
+}
+
+func (c *redisPredictionCache) modelTTL(model string) time.Duration {
+	if ttl, ok := c.modelTTLs[model]; ok {
+		return ttl
+	}
+	return c.ttl
+}
+
+// predictionCacheKey hashes the canonical JSON encoding of features, which
+// sorts map keys. The run ID is part of the key, so the entries of a model
+// are abandoned as soon as the registry reports a new run.
+func predictionCacheKey(model, runID string, features map[string]interface{}) (string, bool) {
+	data, err := json.Marshal(features)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return "prediction_cache:" + model + ":" + runID + ":" + hex.EncodeToString(sum[:]), true
+}
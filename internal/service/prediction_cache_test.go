@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVendorService_PredictionCache(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	var runID atomic.Value
+	runID.Store("run-1")
+	var predictCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		run := runID.Load().(string)
+		switch r.URL.Path {
+		case "/v1/version":
+			_, _ = w.Write([]byte(`{"loaded_models":{"logreg":{"name":"FraudDetector-logistic_regression","run_id":"` + run + `"},"xgboost":{"name":"FraudDetector-xgboost","run_id":"` + run + `"}}}`))
+		case "/v1/predict":
+			predictCalls.Add(1)
+			_, _ = w.Write([]byte(`{"meta":{"model_name":"FraudDetector-logistic_regression","run_id":"` + run + `"},"result":{"prediction":0,"score":0.1,"threshold":0.5}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cache := NewPredictionCache(redisClient, time.Minute, map[string]time.Duration{"xgboost": 0}, zerolog.Nop())
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	svc := NewVendorService(client, zerolog.Nop(), WithModelRegistryTTL(50*time.Millisecond), WithPredictionCache(cache),
+		WithExplain(ExplainSettings{}, client))
+	ctx := context.Background()
+	hits := testutil.ToFloat64(predictionCacheRequestsTotal.WithLabelValues("logreg", predictionCacheHit))
+
+	predict := func(model string, features map[string]interface{}) PredictResponse {
+		t.Helper()
+		resp, err := svc.Predict(ctx, PredictRequest{Model: model, Features: features})
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := predict("logreg", map[string]interface{}{"amount": 10.5, "merchant_type": "crypto"})
+	assert.False(t, resp.Meta.Cached)
+	resp = predict("logreg", map[string]interface{}{"merchant_type": "crypto", "amount": 10.5})
+	assert.True(t, resp.Meta.Cached)
+	assert.Equal(t, 0.1, resp.Result.Score)
+	assert.Equal(t, int32(1), predictCalls.Load())
+	assert.Equal(t, hits+1, testutil.ToFloat64(predictionCacheRequestsTotal.WithLabelValues("logreg", predictionCacheHit)))
+
+	// Other features, explained requests and models with a TTL of 0 miss. The
+	// explanation re-scores amount once more.
+	predict("logreg", map[string]interface{}{"amount": 20.5, "merchant_type": "crypto"})
+	_, err = svc.Predict(ctx, PredictRequest{Model: "logreg", Features: map[string]interface{}{"amount": 10.5, "merchant_type": "crypto"}, Explain: true})
+	require.NoError(t, err)
+	predict("xgboost", map[string]interface{}{"amount": 10.5})
+	resp = predict("xgboost", map[string]interface{}{"amount": 10.5})
+	assert.False(t, resp.Meta.Cached)
+	assert.Equal(t, int32(6), predictCalls.Load())
+
+	// A new run invalidates the cached predictions once the registry sees it.
+	runID.Store("run-2")
+	require.Eventually(t, func() bool {
+		models, err := svc.ListModels(ctx)
+		return err == nil && models[0].RunID == "run-2"
+	}, 2*time.Second, 20*time.Millisecond)
+	resp = predict("logreg", map[string]interface{}{"amount": 10.5, "merchant_type": "crypto"})
+	assert.False(t, resp.Meta.Cached)
+	resp = predict("logreg", map[string]interface{}{"amount": 10.5, "merchant_type": "crypto"})
+	assert.True(t, resp.Meta.Cached)
+	assert.Equal(t, int32(7), predictCalls.Load())
+
+	// Without Redis, predictions go to the vendor.
+	mr.Close()
+	resp = predict("logreg", map[string]interface{}{"amount": 10.5, "merchant_type": "crypto"})
+	assert.False(t, resp.Meta.Cached)
+	assert.Equal(t, int32(8), predictCalls.Load())
+}
+
+func TestScoringService_PredictionCacheWithVelocity(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	var predictCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/version":
+			_, _ = w.Write([]byte(`{"loaded_models":{"logreg":{"name":"FraudDetector-logistic_regression","run_id":"run-1"}}}`))
+		case "/v1/predict":
+			predictCalls.Add(1)
+			_, _ = w.Write([]byte(`{"meta":{"model_name":"FraudDetector-logistic_regression","run_id":"run-1"},"result":{"prediction":0,"score":0.1,"threshold":0.5}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	velocity, err := NewVelocityStore(redisClient, []VelocityFeature{
+		{Name: "device_txn_count_10m", Keys: []string{VelocityIdentityKey, "device_type"}, Window: 10 * time.Minute, Aggregate: VelocityCount},
+	})
+	require.NoError(t, err)
+	cache := NewPredictionCache(redisClient, time.Minute, nil, zerolog.Nop())
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	vendorSvc := NewVendorService(client, zerolog.Nop(), WithPredictionCache(cache), WithDerivedFeatures(velocity.Names()...))
+	svc := NewScoringService(vendorSvc, nil, nil, velocity, zerolog.Nop())
+	ctx := context.Background()
+
+	score := func() PredictResponse {
+		t.Helper()
+		resp, err := svc.Score(ctx, 1, nil, PredictRequest{Model: "logreg", Features: map[string]interface{}{"amount": 10.5, "device_type": "mobile"}})
+		require.NoError(t, err)
+		return resp
+	}
+
+	// The velocity count differs between the two requests, the client
+	// features do not.
+	assert.False(t, score().Meta.Cached)
+	assert.True(t, score().Meta.Cached)
+	assert.Equal(t, int32(1), predictCalls.Load())
+}
@@ -0,0 +1,553 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+
+	predictionJobQueueKey = "prediction_jobs:queue"
+
+	// minJobItemRate is the slowest pace of a job, one item per minute.
+	minJobItemRate = 1.0 / 60
+
+	// jobResultChunkSize is the number of item results stored per statement
+	// when the progress of a job is saved.
+	jobResultChunkSize = 500
+
+	DefaultJobResultPageSize = 100
+	MaxJobResultPageSize     = 1000
+)
+
+var (
+	ErrJobNotFound          = errors.New("prediction job not found")
+	ErrJobNotFinished       = errors.New("prediction job not finished")
+	ErrInvalidJobResultPage = errors.New("invalid job result page")
+)
+
+// JobOwner identifies the caller that submitted a prediction job.
+type JobOwner struct {
+	UserID   int64
+	APIKeyID *int64
+}
+
+// PredictionJob describes the status of an asynchronous prediction job.
+type PredictionJob struct {
+	ID             uuid.UUID  `json:"id"`
+	Status         string     `json:"status"`
+	TotalItems     int        `json:"total_items"`
+	ProcessedItems int        `json:"processed_items"`
+	FailedItems    int        `json:"failed_items"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+}
+
+// JobItemResult is the outcome of scoring a single item of a job.
+type JobItemResult struct {
+	Index    int              `json:"index"`
+	Response *PredictResponse `json:"response,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// JobResultPage is one page of the results of a job, in item order.
+// NextCursor is the index to request the next page from, nil on the last page.
+type JobResultPage struct {
+	Results    []JobItemResult `json:"results"`
+	NextCursor *int            `json:"next_cursor"`
+}
+
+type PredictionJobService interface {
+	Submit(ctx context.Context, owner JobOwner, items []PredictRequest) (PredictionJob, error)
+	Get(ctx context.Context, userID int64, id uuid.UUID) (PredictionJob, error)
+	// Results returns up to limit results of a finished job, starting at item
+	// cursor; limit 0 selects DefaultJobResultPageSize.
+	Results(ctx context.Context, userID int64, id uuid.UUID, cursor, limit int) (JobResultPage, error)
+	// Next blocks for up to timeout waiting for a queued job ID.
+	Next(ctx context.Context, timeout time.Duration) (uuid.UUID, bool, error)
+	Process(ctx context.Context, id uuid.UUID) error
+	// Resume re-enqueues jobs that were queued before queuedBefore and are
+	// missing from the queue, or whose worker lease has expired, e.g. because
+	// the server restarted.
+	Resume(ctx context.Context, queuedBefore time.Time) (int, error)
+}
+
+type predictionJobService struct {
+	jobRepo     repo.PredictionJobRepository
+	logRepo     repo.InferenceLogRepository
+	scoringSvc  ScoringService
+	caseSvc     CaseService
+	redisClient *redis.Client
+	concurrency int
+	itemRate    float64
+	lease       time.Duration
+	logger      zerolog.Logger
+}
+
+// NewPredictionJobService scores up to concurrency items of a job at a time,
+// starting at most itemRate items per second (0 removes the limit).
+func NewPredictionJobService(jobRepo repo.PredictionJobRepository, logRepo repo.InferenceLogRepository, scoringSvc ScoringService, caseSvc CaseService, redisClient *redis.Client, concurrency int, itemRate float64, lease time.Duration, logger zerolog.Logger) PredictionJobService {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if itemRate < 0 {
+		itemRate = 0
+	} else if itemRate > 0 && itemRate < minJobItemRate {
+		itemRate = minJobItemRate
+	}
+	return &predictionJobService{
+		jobRepo:     jobRepo,
+		logRepo:     logRepo,
+		scoringSvc:  scoringSvc,
+		caseSvc:     caseSvc,
+		redisClient: redisClient,
+		concurrency: concurrency,
+		itemRate:    itemRate,
+		lease:       lease,
+		logger:      logger,
+	}
+}
+
+func (s *predictionJobService) Submit(ctx context.Context, owner JobOwner, items []PredictRequest) (PredictionJob, error) {
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return PredictionJob{}, err
+	}
+
+	var apiKeyID sql.NullInt64
+	if owner.APIKeyID != nil {
+		apiKeyID = sql.NullInt64{Int64: *owner.APIKeyID, Valid: true}
+	}
+
+	row, err := s.jobRepo.CreatePredictionJob(ctx, db.CreatePredictionJobParams{
+		ID:         uuid.New(),
+		UserID:     owner.UserID,
+		ApiKeyID:   apiKeyID,
+		Items:      itemsJSON,
+		TotalItems: int32(len(items)),
+	})
+	if err != nil {
+		return PredictionJob{}, err
+	}
+
+	// A failed push is not fatal: the job stays queued in Postgres and is
+	// picked up by the next Resume pass.
+	if err := s.enqueue(ctx, row.ID); err != nil {
+		s.logger.Warn().Err(err).Str("job_id", row.ID.String()).Msg("failed to enqueue prediction job")
+	}
+
+	return predictionJobFromRow(db.GetPredictionJobRow(row)), nil
+}
+
+func (s *predictionJobService) Get(ctx context.Context, userID int64, id uuid.UUID) (PredictionJob, error) {
+	row, err := s.jobRepo.GetPredictionJob(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PredictionJob{}, ErrJobNotFound
+		}
+		return PredictionJob{}, err
+	}
+	return predictionJobFromRow(row), nil
+}
+
+func (s *predictionJobService) Results(ctx context.Context, userID int64, id uuid.UUID, cursor, limit int) (JobResultPage, error) {
+	if cursor < 0 || limit < 0 || limit > MaxJobResultPageSize {
+		return JobResultPage{}, fmt.Errorf("%w: cursor must not be negative and limit must be between 0 and %d", ErrInvalidJobResultPage, MaxJobResultPageSize)
+	}
+	if limit == 0 {
+		limit = DefaultJobResultPageSize
+	}
+
+	job, err := s.jobRepo.GetPredictionJob(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return JobResultPage{}, ErrJobNotFound
+		}
+		return JobResultPage{}, err
+	}
+	if job.Status != JobStatusCompleted {
+		return JobResultPage{}, ErrJobNotFinished
+	}
+
+	// One extra row tells whether there is a next page.
+	rows, err := s.jobRepo.ListPredictionJobResults(ctx, id, int32(min(cursor, math.MaxInt32)), int32(limit+1))
+	if err != nil {
+		return JobResultPage{}, err
+	}
+
+	page := JobResultPage{Results: make([]JobItemResult, 0, len(rows))}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next := int(rows[limit-1].ItemIndex) + 1
+		page.NextCursor = &next
+	}
+	for _, row := range rows {
+		res := JobItemResult{Index: int(row.ItemIndex), Error: row.Error.String}
+		if row.Response.Valid {
+			var resp PredictResponse
+			if err := json.Unmarshal(row.Response.RawMessage, &resp); err != nil {
+				return JobResultPage{}, err
+			}
+			res.Response = &resp
+		}
+		page.Results = append(page.Results, res)
+	}
+	return page, nil
+}
+
+func (s *predictionJobService) Next(ctx context.Context, timeout time.Duration) (uuid.UUID, bool, error) {
+	res, err := s.redisClient.BRPop(ctx, timeout, predictionJobQueueKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return uuid.Nil, false, nil
+		}
+		return uuid.Nil, false, err
+	}
+
+	// BRPOP returns the key name followed by the popped value.
+	id, err := uuid.Parse(res[1])
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	return id, true, nil
+}
+
+// Process claims the job and scores its items, skipping the items scored by an
+// earlier claim. The lease is renewed with the progress of the job every third
+// of the lease; if another worker took the job over, processing stops. If ctx
+// is cancelled before the job finishes, the progress is saved and the claim
+// released so another worker can resume the job.
+func (s *predictionJobService) Process(ctx context.Context, id uuid.UUID) error {
+	lease := time.Now().Add(s.lease).Truncate(time.Microsecond)
+	claimed, err := s.jobRepo.ClaimPredictionJob(ctx, id, lease)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already finished or actively processed by another worker.
+			return nil
+		}
+		return err
+	}
+
+	logger := s.logger.With().Str("job_id", id.String()).Logger()
+
+	var items []PredictRequest
+	if err := json.Unmarshal(claimed.Items, &items); err != nil {
+		failErr := s.jobRepo.FailPredictionJob(ctx, db.FailPredictionJobParams{
+			ID:    id,
+			Error: sql.NullString{String: "invalid job items: " + err.Error(), Valid: true},
+		})
+		return errors.Join(err, failErr)
+	}
+
+	progress := newJobProgress(len(items), claimed.ProcessedItems, claimed.FailedItems)
+	logger.Info().Int("resumed_at", progress.done).Msg("processing prediction job")
+
+	var apiKeyID *int64
+	if claimed.ApiKeyID.Valid {
+		apiKeyID = &claimed.ApiKeyID.Int64
+	}
+	owner := JobOwner{UserID: claimed.UserID, APIKeyID: apiKeyID}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var lost atomic.Bool
+	renewerDone := make(chan struct{})
+	go func() {
+		defer close(renewerDone)
+		ticker := time.NewTicker(max(s.lease/3, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			results, processed, failed := progress.snapshot()
+			next := time.Now().Add(s.lease).Truncate(time.Microsecond)
+			n, err := s.jobRepo.RenewPredictionJobLease(jobCtx, db.RenewPredictionJobLeaseParams{
+				ID:             id,
+				ProcessedItems: processed,
+				FailedItems:    failed,
+				LeaseExpiresAt: sql.NullTime{Time: next, Valid: true},
+				HeldLease:      sql.NullTime{Time: lease, Valid: true},
+			}, results)
+			if err != nil {
+				if jobCtx.Err() == nil {
+					logger.Warn().Err(err).Msg("failed to renew prediction job lease")
+				}
+				continue
+			}
+			if n == 0 {
+				lost.Store(true)
+				cancel()
+				return
+			}
+			lease = next
+			progress.markSaved(processed, failed)
+		}
+	}()
+
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+
+	var pace <-chan time.Time
+	if s.itemRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / s.itemRate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+	for i := progress.done; i < len(items); i++ {
+		if pace != nil && i > progress.done {
+			select {
+			case <-jobCtx.Done():
+			case <-pace:
+			}
+		}
+		if jobCtx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item PredictRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			reqTime := time.Now()
+			resp, err := s.scoringSvc.Score(jobCtx, owner.UserID, owner.APIKeyID, item)
+			respTime := time.Now()
+			if jobCtx.Err() != nil {
+				// Shutting down or taken over; the item is rescored when the
+				// job resumes.
+				return
+			}
+			logID := recordInference(jobCtx, s.logRepo, owner, item, resp, err, reqTime, respTime, logger)
+			if err == nil {
+				PersistShadow(s.logRepo, logID, resp, logger)
+				if s.caseSvc != nil && logID != 0 {
+					caseResp := resp
+					s.logRepo.AfterInferenceLogWritten(jobCtx, logID, func(ctx context.Context) {
+						if err := s.caseSvc.Open(ctx, logID, caseResp); err != nil {
+							logger.Error().Err(err).Int64("inference_log_id", logID).Msg("failed to open review case")
+						}
+					})
+				}
+				resp.Meta.InferenceID = logID
+			}
+
+			res := JobItemResult{Index: i}
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Response = &resp
+			}
+			progress.set(res)
+		}(i, items[i])
+	}
+	wg.Wait()
+	cancel()
+	<-renewerDone
+
+	if lost.Load() {
+		logger.Warn().Msg("prediction job lease was taken over by another worker")
+		return nil
+	}
+
+	results, processed, failed := progress.snapshot()
+	if ctx.Err() != nil {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := s.jobRepo.ReleasePredictionJob(releaseCtx, db.ReleasePredictionJobParams{
+			ID:             id,
+			ProcessedItems: processed,
+			FailedItems:    failed,
+			HeldLease:      sql.NullTime{Time: lease, Valid: true},
+		}, results); err != nil {
+			return err
+		}
+		if err := s.enqueue(releaseCtx, id); err != nil {
+			logger.Warn().Err(err).Msg("failed to re-enqueue released prediction job")
+		}
+		logger.Info().Int32("processed", processed).Msg("released unfinished prediction job")
+		return ctx.Err()
+	}
+
+	if err := s.jobRepo.CompletePredictionJob(ctx, db.CompletePredictionJobParams{
+		ID:             id,
+		ProcessedItems: processed,
+		FailedItems:    failed,
+		HeldLease:      sql.NullTime{Time: lease, Valid: true},
+	}, results); err != nil {
+		return err
+	}
+
+	logger.Info().Int32("processed", processed).Int32("failed", failed).Msg("prediction job completed")
+	return nil
+}
+
+// Resume re-enqueues the jobs whose lease expired and the queued jobs that
+// were last updated before queuedBefore. Jobs still waiting in the queue are
+// not pushed again.
+func (s *predictionJobService) Resume(ctx context.Context, queuedBefore time.Time) (int, error) {
+	ids, err := s.jobRepo.ListResumablePredictionJobs(ctx, queuedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := s.enqueue(ctx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// enqueueJobScript pushes a job ID unless it is already queued.
+var enqueueJobScript = redis.NewScript(`
+if redis.call("LPOS", KEYS[1], ARGV[1]) then
+    return 0
+end
+return redis.call("LPUSH", KEYS[1], ARGV[1])
+`)
+
+func (s *predictionJobService) enqueue(ctx context.Context, id uuid.UUID) error {
+	return enqueueJobScript.Run(ctx, s.redisClient, []string{predictionJobQueueKey}, id.String()).Err()
+}
+
+// jobProgress collects the results of a job. Items finish out of order; done
+// is the length of the prefix of finished items, which is what gets saved and
+// skipped when the job resumes. The results before saved are already stored
+// and are not kept in memory.
+type jobProgress struct {
+	mu       sync.Mutex
+	results  []JobItemResult
+	finished []bool
+	done     int
+	failed   int
+
+	saved       int
+	savedFailed int
+}
+
+// newJobProgress starts after the processed items of an earlier claim, whose
+// results are stored.
+func newJobProgress(n int, processed, failed int32) *jobProgress {
+	done := min(max(int(processed), 0), n)
+	p := &jobProgress{
+		results:     make([]JobItemResult, n),
+		finished:    make([]bool, n),
+		done:        done,
+		failed:      int(failed),
+		saved:       done,
+		savedFailed: int(failed),
+	}
+	for i := 0; i < done; i++ {
+		p.finished[i] = true
+	}
+	return p
+}
+
+func (p *jobProgress) set(res JobItemResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.results[res.Index] = res
+	p.finished[res.Index] = true
+	for p.done < len(p.finished) && p.finished[p.done] {
+		if p.results[p.done].Error != "" {
+			p.failed++
+		}
+		p.done++
+	}
+}
+
+// snapshot returns the results of the finished prefix that are not saved yet,
+// in chunks of jobResultChunkSize, and the counts of the prefix.
+func (p *jobProgress) snapshot() ([]json.RawMessage, int32, int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var chunks []json.RawMessage
+	for start := p.saved; start < p.done; start += jobResultChunkSize {
+		data, err := json.Marshal(p.results[start:min(start+jobResultChunkSize, p.done)])
+		if err != nil {
+			return nil, int32(p.saved), int32(p.savedFailed)
+		}
+		chunks = append(chunks, data)
+	}
+	return chunks, int32(p.done), int32(p.failed)
+}
+
+// markSaved records that the results of the first done items, failed of
+// which failed, are stored.
+func (p *jobProgress) markSaved(done, failed int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if int(done) <= p.saved {
+		return
+	}
+	p.savedFailed = int(failed)
+	for ; p.saved < int(done); p.saved++ {
+		p.results[p.saved] = JobItemResult{}
+	}
+}
+
+func predictionJobFromRow(row db.GetPredictionJobRow) PredictionJob {
+	job := PredictionJob{
+		ID:             row.ID,
+		Status:         row.Status,
+		TotalItems:     int(row.TotalItems),
+		ProcessedItems: int(row.ProcessedItems),
+		FailedItems:    int(row.FailedItems),
+		CreatedAt:      row.CreatedAt,
+	}
+	if row.Error.Valid {
+		job.Error = row.Error.String
+	}
+	if row.StartedAt.Valid {
+		t := row.StartedAt.Time
+		job.StartedAt = &t
+	}
+	if row.CompletedAt.Valid {
+		t := row.CompletedAt.Time
+		job.CompletedAt = &t
+	}
+	return job
+}
+
+// recordInference stores a prediction made outside of an HTTP request in the
+// inference log and returns the ID of the new row, or 0 if it was not stored.
+func recordInference(ctx context.Context, logRepo repo.InferenceLogRepository, owner JobOwner, req PredictRequest, resp PredictResponse, predictErr error, reqTime, respTime time.Time, logger zerolog.Logger) int64 {
+	reqPayload, _ := json.Marshal(PredictRequest{Model: req.Model, Features: MaskSensitiveFeatures(req.Features), Explain: req.Explain})
+	var params db.CreateInferenceLogParams
+	if predictErr != nil {
+		params = NewInferenceLogParams(owner.UserID, owner.APIKeyID, reqPayload, nil, predictErr.Error(), reqTime, respTime)
+	} else {
+		params = NewInferenceLogParams(owner.UserID, owner.APIKeyID, reqPayload, &resp, "", reqTime, respTime)
+	}
+
+	id, err := logRepo.CreateInferenceLog(ctx, params)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to log inference")
+		return 0
+	}
+	return id
+}
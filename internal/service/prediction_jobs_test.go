@@ -0,0 +1,442 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/sqlc-dev/pqtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryJobRepo struct {
+	mu      sync.Mutex
+	jobs    map[uuid.UUID]*db.PredictionJob
+	results map[uuid.UUID]map[int32]db.PredictionJobResult
+	// saves counts the result chunks written.
+	saves int
+}
+
+func newMemoryJobRepo() *memoryJobRepo {
+	return &memoryJobRepo{jobs: map[uuid.UUID]*db.PredictionJob{}, results: map[uuid.UUID]map[int32]db.PredictionJobResult{}}
+}
+
+// save stores chunks of item results the way SavePredictionJobResults does.
+func (r *memoryJobRepo) save(jobID uuid.UUID, chunks []json.RawMessage) error {
+	if r.results[jobID] == nil {
+		r.results[jobID] = map[int32]db.PredictionJobResult{}
+	}
+	for _, chunk := range chunks {
+		var items []struct {
+			Index    int32           `json:"index"`
+			Response json.RawMessage `json:"response"`
+			Error    string          `json:"error"`
+		}
+		if err := json.Unmarshal(chunk, &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			r.results[jobID][item.Index] = db.PredictionJobResult{
+				JobID:     jobID,
+				ItemIndex: item.Index,
+				Response:  pqtype.NullRawMessage{RawMessage: item.Response, Valid: item.Response != nil},
+				Error:     sql.NullString{String: item.Error, Valid: item.Error != ""},
+			}
+		}
+		r.saves++
+	}
+	return nil
+}
+
+func (r *memoryJobRepo) CreatePredictionJob(ctx context.Context, arg db.CreatePredictionJobParams) (db.CreatePredictionJobRow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.jobs[arg.ID] = &db.PredictionJob{
+		ID:         arg.ID,
+		UserID:     arg.UserID,
+		ApiKeyID:   arg.ApiKeyID,
+		Status:     JobStatusQueued,
+		Items:      arg.Items,
+		TotalItems: arg.TotalItems,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	return db.CreatePredictionJobRow{ID: arg.ID, UserID: arg.UserID, Status: JobStatusQueued, TotalItems: arg.TotalItems, CreatedAt: now}, nil
+}
+
+func (r *memoryJobRepo) GetPredictionJob(ctx context.Context, id uuid.UUID, userID int64) (db.GetPredictionJobRow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok || j.UserID != userID {
+		return db.GetPredictionJobRow{}, sql.ErrNoRows
+	}
+	return db.GetPredictionJobRow{ID: j.ID, UserID: j.UserID, Status: j.Status, TotalItems: j.TotalItems, ProcessedItems: j.ProcessedItems, FailedItems: j.FailedItems}, nil
+}
+
+func (r *memoryJobRepo) ListPredictionJobResults(ctx context.Context, jobID uuid.UUID, fromIndex, maxRows int32) ([]db.PredictionJobResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []db.PredictionJobResult
+	for i := fromIndex; int32(len(rows)) < maxRows && i < r.jobs[jobID].TotalItems; i++ {
+		if row, ok := r.results[jobID][i]; ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryJobRepo) ClaimPredictionJob(ctx context.Context, id uuid.UUID, leaseExpiresAt time.Time) (db.ClaimPredictionJobRow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok || (j.Status != JobStatusQueued && !(j.Status == JobStatusRunning && j.LeaseExpiresAt.Time.Before(time.Now()))) {
+		return db.ClaimPredictionJobRow{}, sql.ErrNoRows
+	}
+	j.Status = JobStatusRunning
+	j.LeaseExpiresAt = sql.NullTime{Time: leaseExpiresAt, Valid: true}
+	return db.ClaimPredictionJobRow{ID: j.ID, UserID: j.UserID, ApiKeyID: j.ApiKeyID, Items: j.Items, ProcessedItems: j.ProcessedItems, FailedItems: j.FailedItems}, nil
+}
+
+func (r *memoryJobRepo) RenewPredictionJobLease(ctx context.Context, arg db.RenewPredictionJobLeaseParams, results []json.RawMessage) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.jobs[arg.ID]
+	if j.Status != JobStatusRunning || !j.LeaseExpiresAt.Time.Equal(arg.HeldLease.Time) {
+		return 0, nil
+	}
+	j.ProcessedItems = arg.ProcessedItems
+	j.FailedItems = arg.FailedItems
+	j.LeaseExpiresAt = arg.LeaseExpiresAt
+	return 1, r.save(arg.ID, results)
+}
+
+func (r *memoryJobRepo) CompletePredictionJob(ctx context.Context, arg db.CompletePredictionJobParams, results []json.RawMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.jobs[arg.ID]
+	if !j.LeaseExpiresAt.Time.Equal(arg.HeldLease.Time) {
+		return nil
+	}
+	j.Status = JobStatusCompleted
+	j.ProcessedItems = arg.ProcessedItems
+	j.FailedItems = arg.FailedItems
+	return r.save(arg.ID, results)
+}
+
+func (r *memoryJobRepo) FailPredictionJob(ctx context.Context, arg db.FailPredictionJobParams) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[arg.ID].Status = JobStatusFailed
+	r.jobs[arg.ID].Error = arg.Error
+	return nil
+}
+
+func (r *memoryJobRepo) ReleasePredictionJob(ctx context.Context, arg db.ReleasePredictionJobParams, results []json.RawMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if j := r.jobs[arg.ID]; j.Status == JobStatusRunning && j.LeaseExpiresAt.Time.Equal(arg.HeldLease.Time) {
+		j.Status = JobStatusQueued
+		j.ProcessedItems = arg.ProcessedItems
+		j.FailedItems = arg.FailedItems
+		j.LeaseExpiresAt = sql.NullTime{}
+		return r.save(arg.ID, results)
+	}
+	return nil
+}
+
+func (r *memoryJobRepo) ListResumablePredictionJobs(ctx context.Context, queuedBefore time.Time) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []uuid.UUID
+	for id, j := range r.jobs {
+		if (j.Status == JobStatusQueued && j.UpdatedAt.Before(queuedBefore)) ||
+			(j.Status == JobStatusRunning && j.LeaseExpiresAt.Time.Before(time.Now())) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+type memoryLogRepo struct {
+	mu   sync.Mutex
+	logs []db.CreateInferenceLogParams
+}
+
+func (r *memoryLogRepo) CreateInferenceLog(ctx context.Context, arg db.CreateInferenceLogParams) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, arg)
+	return int64(len(r.logs)), nil
+}
+
+func (r *memoryLogRepo) UpdateInferenceLogShadow(ctx context.Context, arg db.UpdateInferenceLogShadowParams) error {
+	return nil
+}
+
+func (r *memoryLogRepo) AfterInferenceLogWritten(ctx context.Context, id int64, fn func(ctx context.Context)) {
+	fn(ctx)
+}
+
+func (r *memoryLogRepo) ListShadowComparisons(ctx context.Context, userID int64, from, to time.Time) ([]db.ListShadowComparisonsRow, error) {
+	return nil, nil
+}
+
+// row returns the stored log with the given ID; IDs start at 1.
+func (r *memoryLogRepo) row(id int64) db.InferenceLog {
+	arg := r.logs[id-1]
+	return db.InferenceLog{
+		ID:              id,
+		UserID:          arg.UserID,
+		ApiKeyID:        arg.ApiKeyID,
+		RequestPayload:  arg.RequestPayload,
+		ResponsePayload: arg.ResponsePayload,
+		Error:           arg.Error,
+		RequestTime:     arg.RequestTime,
+		ResponseTime:    arg.ResponseTime,
+		Decision:        arg.Decision,
+		FiredRules:      arg.FiredRules,
+		Explanation:     arg.Explanation,
+		ScoringPath:     arg.ScoringPath,
+	}
+}
+
+func (r *memoryLogRepo) GetInferenceLog(ctx context.Context, id, userID int64, apiKeyID *int64) (db.InferenceLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > int64(len(r.logs)) {
+		return db.InferenceLog{}, sql.ErrNoRows
+	}
+	row := r.row(id)
+	if row.UserID != userID || (apiKeyID != nil && row.ApiKeyID.Int64 != *apiKeyID) {
+		return db.InferenceLog{}, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+// ListInferenceLogs only applies the user, API key and keyset filters.
+func (r *memoryLogRepo) ListInferenceLogs(ctx context.Context, arg db.ListInferenceLogsParams) ([]db.InferenceLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []db.InferenceLog
+	for id := int64(len(r.logs)); id >= 1 && int32(len(rows)) < arg.MaxRows; id-- {
+		row := r.row(id)
+		if row.UserID == arg.UserID && id < arg.BeforeID && (!arg.ApiKeyID.Valid || row.ApiKeyID == arg.ApiKeyID) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+type fakeVendorService struct{}
+
+func (fakeVendorService) Ping(ctx context.Context) (string, error) { return "pong", nil }
+
+func (fakeVendorService) ListModels(ctx context.Context) ([]Model, error) { return nil, nil }
+
+func (fakeVendorService) ValidateModel(ctx context.Context, model string) error { return nil }
+
+func (fakeVendorService) ValidateFeatures(ctx context.Context, model string, features map[string]interface{}) error {
+	return nil
+}
+
+func (fakeVendorService) Predict(ctx context.Context, req PredictRequest) (PredictResponse, error) {
+	if req.Model == "broken" {
+		return PredictResponse{}, errors.New("vendor API returned non-200 status")
+	}
+	var resp PredictResponse
+	resp.Meta.ModelName = req.Model
+	resp.Result.Score = 0.25
+	return resp, nil
+}
+
+func TestPredictionJobService_Lifecycle(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	jobs := newMemoryJobRepo()
+	logs := &memoryLogRepo{}
+	svc := NewPredictionJobService(jobs, logs, NewScoringService(fakeVendorService{}, nil, nil, nil, zerolog.Nop()), nil, redisClient, 2, 0, time.Minute, zerolog.Nop())
+	ctx := context.Background()
+
+	items := []PredictRequest{
+		{Model: "logreg", Features: map[string]interface{}{"amount": 10.5}},
+		{Model: "broken", Features: map[string]interface{}{"amount": 20.5}},
+		{Model: "xgboost", Features: map[string]interface{}{"amount": 30.5}},
+	}
+	job, err := svc.Submit(ctx, JobOwner{UserID: 1}, items)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusQueued, job.Status)
+	assert.Equal(t, 3, job.TotalItems)
+
+	_, err = svc.Results(ctx, 1, job.ID, 0, 0)
+	assert.ErrorIs(t, err, ErrJobNotFinished)
+
+	id, ok, err := svc.Next(ctx, time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, job.ID, id)
+
+	require.NoError(t, svc.Process(ctx, id))
+
+	got, err := svc.Get(ctx, 1, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusCompleted, got.Status)
+	assert.Equal(t, 3, got.ProcessedItems)
+	assert.Equal(t, 1, got.FailedItems)
+
+	page, err := svc.Results(ctx, 1, job.ID, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Results, 3)
+	assert.Nil(t, page.NextCursor)
+	results := page.Results
+	assert.Equal(t, "logreg", results[0].Response.Meta.ModelName)
+	assert.NotEmpty(t, results[1].Error)
+	assert.Equal(t, 2, results[2].Index)
+
+	// Results are paged in item order.
+	page, err = svc.Results(ctx, 1, job.ID, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, page.Results, 2)
+	require.NotNil(t, page.NextCursor)
+	assert.Equal(t, 2, *page.NextCursor)
+	page, err = svc.Results(ctx, 1, job.ID, *page.NextCursor, 2)
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, 2, page.Results[0].Index)
+	assert.Nil(t, page.NextCursor)
+	_, err = svc.Results(ctx, 1, job.ID, 0, MaxJobResultPageSize+1)
+	assert.ErrorIs(t, err, ErrInvalidJobResultPage)
+	assert.Len(t, logs.logs, 3)
+	for _, l := range logs.logs {
+		// Failed predictions have no scoring path.
+		assert.Equal(t, !l.Error.Valid, l.ScoringPath.Valid)
+		if l.ScoringPath.Valid {
+			assert.Equal(t, string(ScoringPathVendor), l.ScoringPath.String)
+		}
+	}
+
+	// Other users cannot see the job.
+	_, err = svc.Get(ctx, 2, job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	// Completed jobs are not processed twice.
+	require.NoError(t, svc.Process(ctx, job.ID))
+	assert.Len(t, logs.logs, 3)
+}
+
+func TestPredictionJobService_Resume(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	jobs := newMemoryJobRepo()
+	svc := NewPredictionJobService(jobs, &memoryLogRepo{}, NewScoringService(fakeVendorService{}, nil, nil, nil, zerolog.Nop()), nil, redisClient, 1, 0, time.Minute, zerolog.Nop())
+	ctx := context.Background()
+
+	items, _ := json.Marshal([]PredictRequest{{Model: "logreg"}})
+	stale := uuid.New()
+	jobs.jobs[stale] = &db.PredictionJob{
+		ID:             stale,
+		UserID:         1,
+		Status:         JobStatusRunning,
+		Items:          items,
+		TotalItems:     1,
+		LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	}
+
+	n, err := svc.Resume(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	id, ok, err := svc.Next(ctx, time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, svc.Process(ctx, id))
+	assert.Equal(t, JobStatusCompleted, jobs.jobs[stale].Status)
+}
+
+func TestPredictionJobService_ResumeSkipsQueuedJobs(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	jobs := newMemoryJobRepo()
+	svc := NewPredictionJobService(jobs, &memoryLogRepo{}, NewScoringService(fakeVendorService{}, nil, nil, nil, zerolog.Nop()), nil, redisClient, 1, 0, time.Minute, zerolog.Nop())
+	ctx := context.Background()
+
+	_, err = svc.Submit(ctx, JobOwner{UserID: 1}, []PredictRequest{{Model: "logreg"}})
+	require.NoError(t, err)
+
+	// The reaper finds the job queued, but it is still waiting in the queue.
+	for i := 0; i < 3; i++ {
+		n, err := svc.Resume(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+	assert.Equal(t, int64(1), redisClient.LLen(ctx, predictionJobQueueKey).Val())
+}
+
+func TestPredictionJobService_ResumesFromSavedProgress(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	jobs := newMemoryJobRepo()
+	logs := &memoryLogRepo{}
+	svc := NewPredictionJobService(jobs, logs, NewScoringService(fakeVendorService{}, nil, nil, nil, zerolog.Nop()), nil, redisClient, 2, 0, time.Minute, zerolog.Nop())
+	ctx := context.Background()
+
+	// The first two items were scored before the previous worker stopped.
+	items, _ := json.Marshal([]PredictRequest{{Model: "logreg"}, {Model: "broken"}, {Model: "xgboost"}})
+	saved, _ := json.Marshal([]JobItemResult{
+		{Index: 0, Response: &PredictResponse{}},
+		{Index: 1, Error: "vendor API returned non-200 status"},
+	})
+	id := uuid.New()
+	require.NoError(t, jobs.save(id, []json.RawMessage{saved}))
+	jobs.saves = 0
+	jobs.jobs[id] = &db.PredictionJob{
+		ID:             id,
+		UserID:         1,
+		Status:         JobStatusRunning,
+		Items:          items,
+		TotalItems:     3,
+		ProcessedItems: 2,
+		FailedItems:    1,
+		LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	}
+
+	require.NoError(t, svc.Process(ctx, id))
+	// Only the third item was scored again, and only its result was saved.
+	require.Len(t, logs.logs, 1)
+	assert.Equal(t, 1, jobs.saves)
+
+	got, err := svc.Get(ctx, 1, id)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusCompleted, got.Status)
+	assert.Equal(t, 3, got.ProcessedItems)
+	assert.Equal(t, 1, got.FailedItems)
+
+	page, err := svc.Results(ctx, 1, id, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Results, 3)
+	assert.NotEmpty(t, page.Results[1].Error)
+	assert.Equal(t, "xgboost", page.Results[2].Response.Meta.ModelName)
+}
@@ -0,0 +1,519 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/rs/zerolog"
+	"github.com/sqlc-dev/pqtype"
+)
+
+const (
+	defaultReplayRate        = 10
+	defaultReplayBatchSize   = 100
+	defaultReplayLease       = 2 * time.Minute
+	defaultReplayReportLimit = 50
+	// MinReplayRate is the lowest rate a replay may be run at, in predictions
+	// per second.
+	MinReplayRate = 0.01
+	// MaxReplayReportLimit bounds the number of changed predictions listed by a
+	// replay report.
+	MaxReplayReportLimit = 1000
+)
+
+var (
+	ErrReplayNotFound = errors.New("replay run not found")
+	ErrInvalidReplay  = errors.New("invalid replay")
+)
+
+// ReplayParams selects the successful predictions requested in [From, To) to
+// re-score with TargetModel. SourceModel restricts the replay to predictions
+// of another model, and a RatePerSecond of 0 selects the default rate.
+type ReplayParams struct {
+	TargetModel   string    `json:"target_model"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	UserID        *int64    `json:"user_id,omitempty"`
+	APIKeyID      *int64    `json:"api_key_id,omitempty"`
+	SourceModel   string    `json:"source_model,omitempty"`
+	RatePerSecond float64   `json:"rate_per_second,omitempty"`
+}
+
+// ReplayRun describes the status of a replay. Replays share the statuses of
+// the prediction jobs.
+type ReplayRun struct {
+	ID int64 `json:"id"`
+	ReplayParams
+	Status         string     `json:"status"`
+	TotalItems     int        `json:"total_items"`
+	ProcessedItems int        `json:"processed_items"`
+	FailedItems    int        `json:"failed_items"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+}
+
+// ReplayComparison summarises how the replayed predictions of one original
+// model differ from the original ones. Score deltas are the replay score minus
+// the original score; NewlyFlagged counts the predictions that went from 0 to
+// 1 and NewlyCleared the reverse.
+type ReplayComparison struct {
+	OriginalModel     string  `json:"original_model"`
+	Total             int64   `json:"total"`
+	Errors            int64   `json:"errors"`
+	Agreements        int64   `json:"agreements"`
+	AgreementRate     float64 `json:"agreement_rate"`
+	NewlyFlagged      int64   `json:"newly_flagged"`
+	NewlyCleared      int64   `json:"newly_cleared"`
+	MeanScoreDelta    float64 `json:"mean_score_delta"`
+	MeanAbsScoreDelta float64 `json:"mean_abs_score_delta"`
+	P95AbsScoreDelta  float64 `json:"p95_abs_score_delta"`
+	MaxAbsScoreDelta  float64 `json:"max_abs_score_delta"`
+}
+
+// ReplayChange is one replayed prediction next to the original one.
+type ReplayChange struct {
+	InferenceLogID     int64     `json:"inference_log_id"`
+	RequestTime        time.Time `json:"request_time"`
+	OriginalModel      string    `json:"original_model"`
+	OriginalPrediction int       `json:"original_prediction"`
+	OriginalScore      float64   `json:"original_score"`
+	ReplayPrediction   int       `json:"replay_prediction"`
+	ReplayScore        float64   `json:"replay_score"`
+	ScoreDelta         float64   `json:"score_delta"`
+}
+
+// ReplayReport is the diff of a replay against the original responses. Changes
+// lists the predictions whose outcome changed first, then the largest score
+// changes.
+type ReplayReport struct {
+	Run         ReplayRun          `json:"run"`
+	Comparisons []ReplayComparison `json:"comparisons"`
+	Changes     []ReplayChange     `json:"changes"`
+}
+
+// ReplaySettings configures how replays are run. Each run sends at most its
+// rate of predictions per second, with up to Concurrency in flight, and records
+// its progress every BatchSize predictions, or more often if its rate would not
+// send them within half the Lease.
+type ReplaySettings struct {
+	DefaultRate float64
+	MaxRate     float64
+	Concurrency int
+	BatchSize   int32
+	Lease       time.Duration
+}
+
+// ReplayService re-scores logged predictions with another model, to compare it
+// with the model that served them before switching. The replayed predictions
+// are stored apart from the inference logs and do not go through the decision
+// policies or the fraud rules.
+//
+// Sensitive features are masked in the logs, so they are replayed masked.
+type ReplayService interface {
+	// Create queues a replay of the predictions matching params.
+	Create(ctx context.Context, createdBy *int64, params ReplayParams) (ReplayRun, error)
+	Get(ctx context.Context, id int64) (ReplayRun, error)
+	// List returns the latest replays first.
+	List(ctx context.Context, limit int) ([]ReplayRun, error)
+	// Report compares the predictions replayed so far with the original ones
+	// and lists up to limit of them.
+	Report(ctx context.Context, id int64, limit int) (ReplayReport, error)
+	// Process claims the run and replays its remaining predictions. If ctx is
+	// cancelled, the claim is released and the run resumes from its last
+	// recorded progress.
+	Process(ctx context.Context, id int64) error
+	// RunPending processes the queued runs and the runs whose worker lease has
+	// expired, one at a time, and returns the number of runs processed.
+	RunPending(ctx context.Context) (int, error)
+}
+
+type replayService struct {
+	replayRepo repo.ReplayRepository
+	vendorSvc  VendorService
+	settings   ReplaySettings
+	logger     zerolog.Logger
+}
+
+func NewReplayService(replayRepo repo.ReplayRepository, vendorSvc VendorService, settings ReplaySettings, logger zerolog.Logger) ReplayService {
+	if settings.DefaultRate <= 0 {
+		settings.DefaultRate = defaultReplayRate
+	}
+	if settings.MaxRate < settings.DefaultRate {
+		settings.MaxRate = settings.DefaultRate
+	}
+	if settings.Concurrency < 1 {
+		settings.Concurrency = 1
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = defaultReplayBatchSize
+	}
+	if settings.Lease <= 0 {
+		settings.Lease = defaultReplayLease
+	}
+	return &replayService{
+		replayRepo: replayRepo,
+		vendorSvc:  vendorSvc,
+		settings:   settings,
+		logger:     logger,
+	}
+}
+
+func (s *replayService) Create(ctx context.Context, createdBy *int64, params ReplayParams) (ReplayRun, error) {
+	if params.TargetModel == "" {
+		return ReplayRun{}, fmt.Errorf("%w: target_model is required", ErrInvalidReplay)
+	}
+	if !params.From.Before(params.To) {
+		return ReplayRun{}, fmt.Errorf("%w: from must be before to", ErrInvalidReplay)
+	}
+	if params.RatePerSecond == 0 {
+		params.RatePerSecond = s.settings.DefaultRate
+	}
+	if params.RatePerSecond < MinReplayRate || params.RatePerSecond > s.settings.MaxRate {
+		return ReplayRun{}, fmt.Errorf("%w: rate_per_second must be between %g and %g", ErrInvalidReplay, MinReplayRate, s.settings.MaxRate)
+	}
+	if err := s.vendorSvc.ValidateModel(ctx, params.TargetModel); err != nil {
+		var unknownErr *UnknownModelError
+		if errors.As(err, &unknownErr) {
+			return ReplayRun{}, fmt.Errorf("%w: %s", ErrInvalidReplay, unknownErr.Error())
+		}
+		return ReplayRun{}, err
+	}
+
+	filter := db.CountReplayLogsParams{
+		FromTime:    params.From,
+		ToTime:      params.To,
+		SourceModel: sql.NullString{String: params.SourceModel, Valid: params.SourceModel != ""},
+	}
+	if params.UserID != nil {
+		filter.UserID = sql.NullInt64{Int64: *params.UserID, Valid: true}
+	}
+	if params.APIKeyID != nil {
+		filter.ApiKeyID = sql.NullInt64{Int64: *params.APIKeyID, Valid: true}
+	}
+	total, err := s.replayRepo.CountReplayLogs(ctx, filter)
+	if err != nil {
+		return ReplayRun{}, err
+	}
+	if total == 0 {
+		return ReplayRun{}, fmt.Errorf("%w: no successful predictions match the filter", ErrInvalidReplay)
+	}
+
+	var creator sql.NullInt64
+	if createdBy != nil {
+		creator = sql.NullInt64{Int64: *createdBy, Valid: true}
+	}
+	row, err := s.replayRepo.CreateReplayRun(ctx, db.CreateReplayRunParams{
+		CreatedBy:     creator,
+		TargetModel:   params.TargetModel,
+		FromTime:      filter.FromTime,
+		ToTime:        filter.ToTime,
+		UserID:        filter.UserID,
+		ApiKeyID:      filter.ApiKeyID,
+		SourceModel:   filter.SourceModel,
+		RatePerSecond: params.RatePerSecond,
+		TotalItems:    int32(min(total, math.MaxInt32)),
+	})
+	if err != nil {
+		return ReplayRun{}, err
+	}
+	return replayRunFromRow(row), nil
+}
+
+func (s *replayService) Get(ctx context.Context, id int64) (ReplayRun, error) {
+	row, err := s.replayRepo.GetReplayRun(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ReplayRun{}, ErrReplayNotFound
+		}
+		return ReplayRun{}, err
+	}
+	return replayRunFromRow(row), nil
+}
+
+func (s *replayService) List(ctx context.Context, limit int) ([]ReplayRun, error) {
+	if limit <= 0 || limit > MaxReplayReportLimit {
+		limit = defaultReplayReportLimit
+	}
+	rows, err := s.replayRepo.ListReplayRuns(ctx, int32(limit))
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]ReplayRun, len(rows))
+	for i, row := range rows {
+		runs[i] = replayRunFromRow(row)
+	}
+	return runs, nil
+}
+
+func (s *replayService) Report(ctx context.Context, id int64, limit int) (ReplayReport, error) {
+	if limit < 0 || limit > MaxReplayReportLimit {
+		return ReplayReport{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidReplay, MaxReplayReportLimit)
+	}
+	if limit == 0 {
+		limit = defaultReplayReportLimit
+	}
+
+	run, err := s.Get(ctx, id)
+	if err != nil {
+		return ReplayReport{}, err
+	}
+	comparisons, err := s.replayRepo.ListReplayComparisons(ctx, id)
+	if err != nil {
+		return ReplayReport{}, err
+	}
+	changes, err := s.replayRepo.ListReplayChanges(ctx, id, int32(limit))
+	if err != nil {
+		return ReplayReport{}, err
+	}
+
+	report := ReplayReport{
+		Run:         run,
+		Comparisons: make([]ReplayComparison, len(comparisons)),
+		Changes:     make([]ReplayChange, len(changes)),
+	}
+	for i, row := range comparisons {
+		c := ReplayComparison{
+			OriginalModel:     row.OriginalModel,
+			Total:             row.Total,
+			Errors:            row.Errors,
+			Agreements:        row.Agreements,
+			NewlyFlagged:      row.NewlyFlagged,
+			NewlyCleared:      row.NewlyCleared,
+			MeanScoreDelta:    row.MeanScoreDelta,
+			MeanAbsScoreDelta: row.MeanAbsScoreDelta,
+			P95AbsScoreDelta:  row.P95AbsScoreDelta,
+			MaxAbsScoreDelta:  row.MaxAbsScoreDelta,
+		}
+		// Failed replays have nothing to agree with.
+		if scored := row.Total - row.Errors; scored > 0 {
+			c.AgreementRate = float64(row.Agreements) / float64(scored)
+		}
+		report.Comparisons[i] = c
+	}
+	for i, row := range changes {
+		report.Changes[i] = ReplayChange{
+			InferenceLogID:     row.InferenceLogID,
+			RequestTime:        row.RequestTime,
+			OriginalModel:      row.OriginalModel,
+			OriginalPrediction: int(row.OriginalPrediction),
+			OriginalScore:      row.OriginalScore,
+			ReplayPrediction:   int(row.ReplayPrediction),
+			ReplayScore:        row.ReplayScore,
+			ScoreDelta:         row.ReplayScore - row.OriginalScore,
+		}
+	}
+	return report, nil
+}
+
+func (s *replayService) Process(ctx context.Context, id int64) error {
+	run, err := s.replayRepo.ClaimReplayRun(ctx, id, time.Now().Add(s.settings.Lease))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already finished or actively processed by another worker.
+			return nil
+		}
+		return err
+	}
+
+	logger := s.logger.With().Int64("replay_id", id).Str("target_model", run.TargetModel).Logger()
+	logger.Info().Int64("after_log_id", run.LastLogID).Msg("processing replay")
+
+	// The model may have been unloaded since the run was created.
+	if err := s.vendorSvc.ValidateModel(ctx, run.TargetModel); err != nil {
+		var unknownErr *UnknownModelError
+		if !errors.As(err, &unknownErr) {
+			return s.release(ctx, id, err)
+		}
+		return errors.Join(err, s.replayRepo.FailReplayRun(ctx, id, unknownErr.Error()))
+	}
+
+	params := db.ListReplayLogsParams{
+		AfterID:     run.LastLogID,
+		FromTime:    run.FromTime,
+		ToTime:      run.ToTime,
+		UserID:      run.UserID,
+		ApiKeyID:    run.ApiKeyID,
+		SourceModel: run.SourceModel,
+		MaxRows:     s.replayBatchSize(run.RatePerSecond),
+	}
+	processed, failed := run.ProcessedItems, run.FailedItems
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / max(run.RatePerSecond, MinReplayRate)))
+	defer ticker.Stop()
+	sem := make(chan struct{}, s.settings.Concurrency)
+
+	for {
+		logs, err := s.replayRepo.ListReplayLogs(ctx, params)
+		if err != nil {
+			return s.release(ctx, id, err)
+		}
+		if len(logs) == 0 {
+			break
+		}
+
+		results := make([]db.InsertReplayResultParams, len(logs))
+		var wg sync.WaitGroup
+	send:
+		for i, item := range logs {
+			select {
+			case <-ctx.Done():
+				break send
+			case <-ticker.C:
+			}
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, item db.ListReplayLogsRow) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = s.replay(ctx, run.TargetModel, item)
+			}(i, item)
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			// The batch is replayed again when the run resumes.
+			return s.release(ctx, id, ctx.Err())
+		}
+
+		for _, result := range results {
+			if err := s.replayRepo.InsertReplayResult(ctx, result); err != nil {
+				return s.release(ctx, id, err)
+			}
+			processed++
+			if result.Error.Valid {
+				failed++
+			}
+		}
+		params.AfterID = logs[len(logs)-1].ID
+		if err := s.replayRepo.UpdateReplayRunProgress(ctx, db.UpdateReplayRunProgressParams{
+			ID:             id,
+			LastLogID:      params.AfterID,
+			ProcessedItems: processed,
+			FailedItems:    failed,
+			LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(s.settings.Lease), Valid: true},
+		}); err != nil {
+			return s.release(ctx, id, err)
+		}
+		if len(logs) < int(params.MaxRows) {
+			break
+		}
+	}
+
+	if err := s.replayRepo.CompleteReplayRun(ctx, id); err != nil {
+		return err
+	}
+	logger.Info().Int32("processed", processed).Int32("failed", failed).Msg("replay completed")
+	return nil
+}
+
+// replayBatchSize returns the number of predictions replayed between two
+// progress updates at rate, which renew the lease: at most the ones sent in half
+// the lease, so that a slow replay keeps it.
+func (s *replayService) replayBatchSize(rate float64) int32 {
+	perLease := int32(max(rate, MinReplayRate) * s.settings.Lease.Seconds() / 2)
+	return max(1, min(s.settings.BatchSize, perLease))
+}
+
+// replay scores the request of log with model. Explanations are not replayed.
+func (s *replayService) replay(ctx context.Context, model string, log db.ListReplayLogsRow) db.InsertReplayResultParams {
+	result := db.InsertReplayResultParams{
+		InferenceLogID:   log.ID,
+		RequestTime:      log.RequestTime,
+		OriginalResponse: log.ResponsePayload.RawMessage,
+	}
+
+	var req PredictRequest
+	if err := json.Unmarshal(log.RequestPayload, &req); err != nil {
+		result.Error = sql.NullString{String: "invalid logged request: " + err.Error(), Valid: true}
+		return result
+	}
+	req.Model = model
+	req.Explain = false
+
+	resp, err := s.vendorSvc.Predict(ctx, req)
+	if err != nil {
+		result.Error = sql.NullString{String: err.Error(), Valid: true}
+		return result
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		result.Error = sql.NullString{String: err.Error(), Valid: true}
+		return result
+	}
+	result.ReplayResponse = pqtype.NullRawMessage{RawMessage: payload, Valid: true}
+	return result
+}
+
+// release puts the run back in the queue after cause interrupted it, so that it
+// resumes from its last recorded progress.
+func (s *replayService) release(ctx context.Context, id int64, cause error) error {
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.replayRepo.ReleaseReplayRun(releaseCtx, id); err != nil {
+		return errors.Join(cause, err)
+	}
+	s.logger.Info().Int64("replay_id", id).Msg("released unfinished replay")
+	return cause
+}
+
+func (s *replayService) RunPending(ctx context.Context) (int, error) {
+	ids, err := s.replayRepo.ListResumableReplayRuns(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		if err := s.Process(ctx, id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func replayRunFromRow(row db.ReplayRun) ReplayRun {
+	run := ReplayRun{
+		ID: row.ID,
+		ReplayParams: ReplayParams{
+			TargetModel:   row.TargetModel,
+			From:          row.FromTime,
+			To:            row.ToTime,
+			SourceModel:   row.SourceModel.String,
+			RatePerSecond: row.RatePerSecond,
+		},
+		Status:         row.Status,
+		TotalItems:     int(row.TotalItems),
+		ProcessedItems: int(row.ProcessedItems),
+		FailedItems:    int(row.FailedItems),
+		Error:          row.Error.String,
+		CreatedAt:      row.CreatedAt,
+	}
+	if row.UserID.Valid {
+		userID := row.UserID.Int64
+		run.UserID = &userID
+	}
+	if row.ApiKeyID.Valid {
+		apiKeyID := row.ApiKeyID.Int64
+		run.APIKeyID = &apiKeyID
+	}
+	if row.StartedAt.Valid {
+		t := row.StartedAt.Time
+		run.StartedAt = &t
+	}
+	if row.CompletedAt.Valid {
+		t := row.CompletedAt.Time
+		run.CompletedAt = &t
+	}
+	return run
+}
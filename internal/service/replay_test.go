@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/rs/zerolog"
+	"github.com/sqlc-dev/pqtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryReplayRepo struct {
+	logs    []db.ListReplayLogsRow
+	runs    map[int64]*db.ReplayRun
+	results []db.InsertReplayResultParams
+}
+
+func newMemoryReplayRepo(logs ...db.ListReplayLogsRow) *memoryReplayRepo {
+	return &memoryReplayRepo{logs: logs, runs: map[int64]*db.ReplayRun{}}
+}
+
+func (r *memoryReplayRepo) CountReplayLogs(ctx context.Context, arg db.CountReplayLogsParams) (int64, error) {
+	return int64(len(r.logs)), nil
+}
+
+func (r *memoryReplayRepo) CreateReplayRun(ctx context.Context, arg db.CreateReplayRunParams) (db.ReplayRun, error) {
+	run := db.ReplayRun{
+		ID:            int64(len(r.runs) + 1),
+		CreatedBy:     arg.CreatedBy,
+		TargetModel:   arg.TargetModel,
+		FromTime:      arg.FromTime,
+		ToTime:        arg.ToTime,
+		SourceModel:   arg.SourceModel,
+		RatePerSecond: arg.RatePerSecond,
+		Status:        JobStatusQueued,
+		TotalItems:    arg.TotalItems,
+		CreatedAt:     time.Now(),
+	}
+	r.runs[run.ID] = &run
+	return run, nil
+}
+
+func (r *memoryReplayRepo) GetReplayRun(ctx context.Context, id int64) (db.ReplayRun, error) {
+	run, ok := r.runs[id]
+	if !ok {
+		return db.ReplayRun{}, sql.ErrNoRows
+	}
+	return *run, nil
+}
+
+func (r *memoryReplayRepo) ListReplayRuns(ctx context.Context, limit int32) ([]db.ReplayRun, error) {
+	return nil, nil
+}
+
+func (r *memoryReplayRepo) ClaimReplayRun(ctx context.Context, id int64, leaseExpiresAt time.Time) (db.ReplayRun, error) {
+	run, ok := r.runs[id]
+	if !ok || run.Status != JobStatusQueued {
+		return db.ReplayRun{}, sql.ErrNoRows
+	}
+	run.Status = JobStatusRunning
+	return *run, nil
+}
+
+func (r *memoryReplayRepo) ListReplayLogs(ctx context.Context, arg db.ListReplayLogsParams) ([]db.ListReplayLogsRow, error) {
+	var out []db.ListReplayLogsRow
+	for _, l := range r.logs {
+		if l.ID > arg.AfterID && len(out) < int(arg.MaxRows) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryReplayRepo) InsertReplayResult(ctx context.Context, arg db.InsertReplayResultParams) error {
+	r.results = append(r.results, arg)
+	return nil
+}
+
+func (r *memoryReplayRepo) UpdateReplayRunProgress(ctx context.Context, arg db.UpdateReplayRunProgressParams) error {
+	run := r.runs[arg.ID]
+	run.LastLogID = arg.LastLogID
+	run.ProcessedItems = arg.ProcessedItems
+	run.FailedItems = arg.FailedItems
+	return nil
+}
+
+func (r *memoryReplayRepo) CompleteReplayRun(ctx context.Context, id int64) error {
+	r.runs[id].Status = JobStatusCompleted
+	return nil
+}
+
+func (r *memoryReplayRepo) FailReplayRun(ctx context.Context, id int64, reason string) error {
+	r.runs[id].Status = JobStatusFailed
+	r.runs[id].Error = sql.NullString{String: reason, Valid: true}
+	return nil
+}
+
+func (r *memoryReplayRepo) ReleaseReplayRun(ctx context.Context, id int64) error {
+	r.runs[id].Status = JobStatusQueued
+	return nil
+}
+
+func (r *memoryReplayRepo) ListResumableReplayRuns(ctx context.Context) ([]int64, error) {
+	var ids []int64
+	for id, run := range r.runs {
+		if run.Status == JobStatusQueued {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memoryReplayRepo) ListReplayComparisons(ctx context.Context, runID int64) ([]db.ListReplayComparisonsRow, error) {
+	return []db.ListReplayComparisonsRow{{OriginalModel: "logreg", Total: 4, Errors: 1, Agreements: 2, NewlyFlagged: 1}}, nil
+}
+
+func (r *memoryReplayRepo) ListReplayChanges(ctx context.Context, runID int64, limit int32) ([]db.ListReplayChangesRow, error) {
+	return []db.ListReplayChangesRow{{InferenceLogID: 3, OriginalModel: "logreg", OriginalScore: 0.4, ReplayPrediction: 1, ReplayScore: 0.9}}, nil
+}
+
+// replayVendorService flags the requests with an amount above 100.
+type replayVendorService struct {
+	fakeVendorService
+	mu       sync.Mutex
+	requests []PredictRequest
+}
+
+func (v *replayVendorService) ValidateModel(ctx context.Context, model string) error {
+	if model != "xgboost" {
+		return &UnknownModelError{Model: model, Allowed: []string{"xgboost"}}
+	}
+	return nil
+}
+
+func (v *replayVendorService) Predict(ctx context.Context, req PredictRequest) (PredictResponse, error) {
+	v.mu.Lock()
+	v.requests = append(v.requests, req)
+	v.mu.Unlock()
+
+	var resp PredictResponse
+	resp.Meta.ModelName = req.Model
+	if amount, _ := req.Features["amount"].(float64); amount > 100 {
+		resp.Result.Prediction = 1
+		resp.Result.Score = 0.9
+	}
+	return resp, nil
+}
+
+func replayLog(id int64, request string) db.ListReplayLogsRow {
+	return db.ListReplayLogsRow{
+		ID:              id,
+		RequestTime:     time.Date(2026, 4, 2, 10, 0, 0, 0, time.UTC),
+		RequestPayload:  json.RawMessage(request),
+		ResponsePayload: pqtype.NullRawMessage{RawMessage: []byte(`{"meta":{"model_name":"logreg"},"result":{"prediction":0,"score":0.4}}`), Valid: true},
+	}
+}
+
+func TestReplayService_Process(t *testing.T) {
+	repo := newMemoryReplayRepo(
+		replayLog(1, `{"model":"logreg","features":{"amount":10.5}}`),
+		replayLog(2, `{"model":"logreg","features":{"amount":250.5},"explain":true}`),
+		replayLog(4, `not json`),
+		replayLog(7, `{"model":"logreg","features":{"amount":20.5}}`),
+		replayLog(9, `{"model":"logreg","features":{"amount":30.5}}`),
+	)
+	vendor := &replayVendorService{}
+	svc := NewReplayService(repo, vendor, ReplaySettings{DefaultRate: 1000, Concurrency: 2, BatchSize: 2}, zerolog.Nop())
+	ctx := context.Background()
+
+	run, err := svc.Create(ctx, nil, ReplayParams{
+		TargetModel: "xgboost",
+		From:        time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		To:          time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusQueued, run.Status)
+	assert.Equal(t, 5, run.TotalItems)
+	assert.Equal(t, float64(1000), run.RatePerSecond)
+
+	n, err := svc.RunPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	run, err = svc.Get(ctx, run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusCompleted, run.Status)
+	assert.Equal(t, 5, run.ProcessedItems)
+	assert.Equal(t, 1, run.FailedItems)
+	assert.Equal(t, int64(9), repo.runs[run.ID].LastLogID)
+
+	// Every logged request is sent to the target model, without explanations.
+	require.Len(t, vendor.requests, 4)
+	for _, req := range vendor.requests {
+		assert.Equal(t, "xgboost", req.Model)
+		assert.False(t, req.Explain)
+	}
+
+	require.Len(t, repo.results, 5)
+	byLog := map[int64]db.InsertReplayResultParams{}
+	for _, r := range repo.results {
+		byLog[r.InferenceLogID] = r
+	}
+	assert.True(t, byLog[4].Error.Valid)
+	assert.False(t, byLog[4].ReplayResponse.Valid)
+	assert.JSONEq(t, `{"meta":{"model_name":"logreg"},"result":{"prediction":0,"score":0.4}}`, string(byLog[2].OriginalResponse))
+	var replayed PredictResponse
+	require.NoError(t, json.Unmarshal(byLog[2].ReplayResponse.RawMessage, &replayed))
+	assert.Equal(t, 1, replayed.Result.Prediction)
+	assert.Equal(t, "xgboost", replayed.Meta.ModelName)
+}
+
+func TestReplayService_Resume(t *testing.T) {
+	repo := newMemoryReplayRepo(
+		replayLog(1, `{"model":"logreg","features":{"amount":10.5}}`),
+		replayLog(2, `{"model":"logreg","features":{"amount":20.5}}`),
+		replayLog(3, `{"model":"logreg","features":{"amount":30.5}}`),
+	)
+	vendor := &replayVendorService{}
+	svc := NewReplayService(repo, vendor, ReplaySettings{DefaultRate: 1000, BatchSize: 2}, zerolog.Nop())
+	ctx := context.Background()
+
+	run, err := svc.Create(ctx, nil, ReplayParams{TargetModel: "xgboost", From: time.Unix(0, 0), To: time.Now()})
+	require.NoError(t, err)
+	// An earlier attempt replayed the first batch.
+	repo.runs[run.ID].LastLogID = 2
+	repo.runs[run.ID].ProcessedItems = 2
+
+	require.NoError(t, svc.Process(ctx, run.ID))
+	require.Len(t, repo.results, 1)
+	assert.Equal(t, int64(3), repo.results[0].InferenceLogID)
+	assert.Equal(t, int32(3), repo.runs[run.ID].ProcessedItems)
+
+	// A finished run is not processed again.
+	require.NoError(t, svc.Process(ctx, run.ID))
+	assert.Len(t, vendor.requests, 1)
+}
+
+func TestReplayService_CreateValidation(t *testing.T) {
+	svc := NewReplayService(newMemoryReplayRepo(replayLog(1, `{}`)), &replayVendorService{}, ReplaySettings{MaxRate: 50}, zerolog.Nop())
+	ctx := context.Background()
+	from, to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, params := range []ReplayParams{
+		{From: from, To: to},
+		{TargetModel: "xgboost", From: to, To: from},
+		{TargetModel: "xgboost", From: from, To: to, RatePerSecond: 500},
+		{TargetModel: "xgboost", From: from, To: to, RatePerSecond: 1e-12},
+		{TargetModel: "unknown", From: from, To: to},
+	} {
+		_, err := svc.Create(ctx, nil, params)
+		assert.ErrorIs(t, err, ErrInvalidReplay)
+	}
+
+	_, err := NewReplayService(newMemoryReplayRepo(), &replayVendorService{}, ReplaySettings{}, zerolog.Nop()).
+		Create(ctx, nil, ReplayParams{TargetModel: "xgboost", From: from, To: to})
+	assert.ErrorIs(t, err, ErrInvalidReplay)
+}
+
+func TestReplayService_BatchSize(t *testing.T) {
+	svc := NewReplayService(newMemoryReplayRepo(), &replayVendorService{}, ReplaySettings{BatchSize: 100, Lease: 2 * time.Minute}, zerolog.Nop()).(*replayService)
+
+	assert.Equal(t, int32(100), svc.replayBatchSize(10))
+	// Slow replays record their progress, and renew the lease, more often.
+	assert.Equal(t, int32(6), svc.replayBatchSize(0.1))
+	assert.Equal(t, int32(1), svc.replayBatchSize(MinReplayRate))
+}
+
+func TestReplayService_Report(t *testing.T) {
+	repo := newMemoryReplayRepo(replayLog(1, `{}`))
+	svc := NewReplayService(repo, &replayVendorService{}, ReplaySettings{}, zerolog.Nop())
+	ctx := context.Background()
+
+	_, err := svc.Report(ctx, 1, 0)
+	assert.ErrorIs(t, err, ErrReplayNotFound)
+
+	run, err := svc.Create(ctx, nil, ReplayParams{TargetModel: "xgboost", From: time.Unix(0, 0), To: time.Now()})
+	require.NoError(t, err)
+	_, err = svc.Report(ctx, run.ID, MaxReplayReportLimit+1)
+	assert.ErrorIs(t, err, ErrInvalidReplay)
+
+	report, err := svc.Report(ctx, run.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, report.Comparisons, 1)
+	// The agreement rate leaves out the failed replays.
+	assert.InDelta(t, 2.0/3.0, report.Comparisons[0].AgreementRate, 1e-9)
+	require.Len(t, report.Changes, 1)
+	assert.InDelta(t, 0.5, report.Changes[0].ScoreDelta, 1e-9)
+}
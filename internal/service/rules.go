@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
+)
+
+// RuleStage selects when a fraud rule runs relative to the model.
+type RuleStage string
+
+const (
+	// RuleStagePre rules see the features only and short-circuit the model
+	// when they fire.
+	RuleStagePre RuleStage = "pre"
+	// RuleStagePost rules also see score, prediction, threshold and decision
+	// and override the decision of the policy when they fire.
+	RuleStagePost RuleStage = "post"
+)
+
+// ruleCacheTTL is how long an instance keeps its compiled rules. A rule edited
+// on one instance is evaluated by the others once their copy expires.
+const ruleCacheTTL = 30 * time.Second
+
+// ruleLoadTimeout bounds a rule query. The query is shared by every caller
+// waiting on it, so it does not run under the context of the first one.
+const ruleLoadTimeout = 5 * time.Second
+
+var (
+	ErrFraudRuleNotFound = errors.New("fraud rule not found")
+	ErrFraudRuleExists   = errors.New("fraud rule name already exists")
+	ErrInvalidFraudRule  = errors.New("invalid fraud rule")
+)
+
+// FraudRule is a hard business rule expressed over the request features and,
+// for post-model rules, the model result. Every change bumps Version.
+type FraudRule struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Stage      RuleStage `json:"stage"`
+	Expression string    `json:"expression"`
+	Decision   Decision  `json:"decision"`
+	ReasonCode string    `json:"reason_code"`
+	Priority   int32     `json:"priority"`
+	Enabled    bool      `json:"enabled"`
+	Version    int32     `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FraudRuleInput holds the editable fields of a fraud rule. The name of an
+// existing rule cannot be changed.
+type FraudRuleInput struct {
+	Name       string
+	Stage      RuleStage
+	Expression string
+	Decision   Decision
+	ReasonCode string
+	Priority   int32
+	Enabled    bool
+}
+
+// FiredRule records a rule that matched a request.
+type FiredRule struct {
+	RuleID     int64     `json:"rule_id"`
+	Name       string    `json:"name"`
+	Version    int32     `json:"version"`
+	Stage      RuleStage `json:"stage"`
+	Decision   Decision  `json:"decision"`
+	ReasonCode string    `json:"reason_code"`
+}
+
+type RuleService interface {
+	List(ctx context.Context) ([]FraudRule, error)
+	Create(ctx context.Context, input FraudRuleInput) (FraudRule, error)
+	Update(ctx context.Context, id int64, input FraudRuleInput) (FraudRule, error)
+	Delete(ctx context.Context, id int64) error
+	// Evaluate runs the enabled rules of stage against env in priority order
+	// and returns every rule that fired.
+	Evaluate(ctx context.Context, stage RuleStage, env map[string]interface{}) []FiredRule
+}
+
+type compiledRule struct {
+	rule    FraudRule
+	program *vm.Program
+}
+
+type ruleService struct {
+	ruleRepo repo.FraudRuleRepository
+	logger   zerolog.Logger
+
+	// loads makes concurrent callers share one query when the cache is
+	// stale. generation is bumped by every change, so that a load that
+	// started before it is not cached.
+	loads      singleflight.Group
+	mu         sync.Mutex
+	rules      []compiledRule
+	loadedAt   time.Time
+	generation uint64
+}
+
+func NewRuleService(ruleRepo repo.FraudRuleRepository, logger zerolog.Logger) RuleService {
+	return &ruleService{ruleRepo: ruleRepo, logger: logger}
+}
+
+func (s *ruleService) List(ctx context.Context) ([]FraudRule, error) {
+	rows, err := s.ruleRepo.ListFraudRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]FraudRule, len(rows))
+	for i, row := range rows {
+		rules[i] = toFraudRule(row)
+	}
+	return rules, nil
+}
+
+func (s *ruleService) Create(ctx context.Context, input FraudRuleInput) (FraudRule, error) {
+	if input.Name == "" {
+		return FraudRule{}, fmt.Errorf("%w: name is required", ErrInvalidFraudRule)
+	}
+	if err := validateFraudRule(input); err != nil {
+		return FraudRule{}, err
+	}
+
+	row, err := s.ruleRepo.CreateFraudRule(ctx, db.CreateFraudRuleParams{
+		Name:       input.Name,
+		Stage:      string(input.Stage),
+		Expression: input.Expression,
+		Decision:   string(input.Decision),
+		ReasonCode: input.ReasonCode,
+		Priority:   input.Priority,
+		Enabled:    input.Enabled,
+	})
+	if err != nil {
+		if errors.Is(err, repo.ErrFraudRuleExists) {
+			return FraudRule{}, ErrFraudRuleExists
+		}
+		return FraudRule{}, err
+	}
+	s.invalidate()
+	return toFraudRule(row), nil
+}
+
+func (s *ruleService) Update(ctx context.Context, id int64, input FraudRuleInput) (FraudRule, error) {
+	if err := validateFraudRule(input); err != nil {
+		return FraudRule{}, err
+	}
+
+	row, err := s.ruleRepo.UpdateFraudRule(ctx, db.UpdateFraudRuleParams{
+		ID:         id,
+		Stage:      string(input.Stage),
+		Expression: input.Expression,
+		Decision:   string(input.Decision),
+		ReasonCode: input.ReasonCode,
+		Priority:   input.Priority,
+		Enabled:    input.Enabled,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return FraudRule{}, ErrFraudRuleNotFound
+		}
+		return FraudRule{}, err
+	}
+	s.invalidate()
+	return toFraudRule(row), nil
+}
+
+func (s *ruleService) Delete(ctx context.Context, id int64) error {
+	if err := s.ruleRepo.DeleteFraudRule(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// Evaluate never fails the request: if the rules cannot be loaded before ctx
+// is done the last loaded set is used, and a rule whose expression errors is skipped.
+func (s *ruleService) Evaluate(ctx context.Context, stage RuleStage, env map[string]interface{}) []FiredRule {
+	var fired []FiredRule
+	for _, c := range s.load(ctx) {
+		if c.rule.Stage != stage || !c.rule.Enabled {
+			continue
+		}
+		out, err := expr.Run(c.program, env)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("rule", c.rule.Name).Msg("fraud rule evaluation failed")
+			continue
+		}
+		if matched, _ := out.(bool); matched {
+			fired = append(fired, FiredRule{
+				RuleID:     c.rule.ID,
+				Name:       c.rule.Name,
+				Version:    c.rule.Version,
+				Stage:      c.rule.Stage,
+				Decision:   c.rule.Decision,
+				ReasonCode: c.rule.ReasonCode,
+			})
+		}
+	}
+	return fired
+}
+
+func (s *ruleService) load(ctx context.Context) []compiledRule {
+	s.mu.Lock()
+	rules, generation := s.rules, s.generation
+	fresh := !s.loadedAt.IsZero() && time.Since(s.loadedAt) < ruleCacheTTL
+	s.mu.Unlock()
+	if fresh {
+		return rules
+	}
+
+	loaded := s.loads.DoChan("rules", func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ruleLoadTimeout)
+		defer cancel()
+		return s.fetch(ctx, generation), nil
+	})
+	select {
+	case res := <-loaded:
+		return res.Val.([]compiledRule)
+	case <-ctx.Done():
+		return rules
+	}
+}
+
+// fetch queries and compiles the rules and caches them unless they changed
+// since generation. If the query fails, the last loaded rules are returned.
+func (s *ruleService) fetch(ctx context.Context, generation uint64) []compiledRule {
+	rows, err := s.ruleRepo.ListFraudRules(ctx)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to load fraud rules")
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.rules
+	}
+
+	rules := make([]compiledRule, 0, len(rows))
+	for _, row := range rows {
+		program, err := compileRule(row.Expression)
+		if err != nil {
+			s.logger.Error().Err(err).Str("rule", row.Name).Msg("failed to compile fraud rule")
+			continue
+		}
+		rules = append(rules, compiledRule{rule: toFraudRule(row), program: program})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = rules
+	if s.generation == generation {
+		s.loadedAt = time.Now()
+	}
+	return rules
+}
+
+func (s *ruleService) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.generation++
+	s.mu.Unlock()
+}
+
+// RuleEnv builds the variables visible to rule expressions: every feature by
+// name, the features map itself and the model. When resp is not nil the model
+// result is added as score, prediction, threshold and decision.
+func RuleEnv(req PredictRequest, resp *PredictResponse) map[string]interface{} {
+	env := make(map[string]interface{}, len(req.Features)+6)
+	for k, v := range req.Features {
+		env[k] = v
+	}
+	env["features"] = req.Features
+	env["model"] = req.Model
+	if resp != nil {
+		env["score"] = resp.Result.Score
+		env["prediction"] = resp.Result.Prediction
+		env["threshold"] = resp.Result.Threshold
+		env["decision"] = string(resp.Result.Decision)
+	}
+	return env
+}
+
+func compileRule(expression string) (*vm.Program, error) {
+	return expr.Compile(expression, expr.AsBool(), expr.AllowUndefinedVariables())
+}
+
+func validateFraudRule(input FraudRuleInput) error {
+	if input.Stage != RuleStagePre && input.Stage != RuleStagePost {
+		return fmt.Errorf("%w: stage must be one of [pre post]", ErrInvalidFraudRule)
+	}
+	switch input.Decision {
+	case DecisionApprove, DecisionReview, DecisionDecline:
+	default:
+		return fmt.Errorf("%w: decision must be one of [approve review decline]", ErrInvalidFraudRule)
+	}
+	if input.ReasonCode == "" {
+		return fmt.Errorf("%w: reason_code is required", ErrInvalidFraudRule)
+	}
+	if _, err := compileRule(input.Expression); err != nil {
+		return fmt.Errorf("%w: expression: %v", ErrInvalidFraudRule, err)
+	}
+	return nil
+}
+
+func toFraudRule(row db.FraudRule) FraudRule {
+	return FraudRule{
+		ID:         row.ID,
+		Name:       row.Name,
+		Stage:      RuleStage(row.Stage),
+		Expression: row.Expression,
+		Decision:   Decision(row.Decision),
+		ReasonCode: row.ReasonCode,
+		Priority:   row.Priority,
+		Enabled:    row.Enabled,
+		Version:    row.Version,
+		CreatedAt:  row.CreatedAt,
+		UpdatedAt:  row.UpdatedAt,
+	}
+}
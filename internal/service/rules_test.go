@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryRuleRepo struct {
+	rules []db.FraudRule
+}
+
+func (r *memoryRuleRepo) CreateFraudRule(ctx context.Context, arg db.CreateFraudRuleParams) (db.FraudRule, error) {
+	rule := db.FraudRule{
+		ID:         int64(len(r.rules) + 1),
+		Name:       arg.Name,
+		Stage:      arg.Stage,
+		Expression: arg.Expression,
+		Decision:   arg.Decision,
+		ReasonCode: arg.ReasonCode,
+		Priority:   arg.Priority,
+		Enabled:    arg.Enabled,
+		Version:    1,
+	}
+	r.rules = append(r.rules, rule)
+	return rule, nil
+}
+
+func (r *memoryRuleRepo) ListFraudRules(ctx context.Context) ([]db.FraudRule, error) {
+	return r.rules, nil
+}
+
+func (r *memoryRuleRepo) UpdateFraudRule(ctx context.Context, arg db.UpdateFraudRuleParams) (db.FraudRule, error) {
+	return db.FraudRule{}, nil
+}
+
+func (r *memoryRuleRepo) DeleteFraudRule(ctx context.Context, id int64) error {
+	return nil
+}
+
+// slowRuleRepo counts the rule queries, which take a while.
+type slowRuleRepo struct {
+	memoryRuleRepo
+	lists atomic.Int32
+}
+
+func (r *slowRuleRepo) ListFraudRules(ctx context.Context) ([]db.FraudRule, error) {
+	r.lists.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return r.memoryRuleRepo.ListFraudRules(ctx)
+}
+
+// ctxRuleRepo fails rule queries whose context is done before they finish.
+type ctxRuleRepo struct {
+	memoryRuleRepo
+}
+
+func (r *ctxRuleRepo) ListFraudRules(ctx context.Context) ([]db.FraudRule, error) {
+	select {
+	case <-time.After(50 * time.Millisecond):
+		return r.memoryRuleRepo.ListFraudRules(ctx)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type countingVendorService struct {
+	fakeVendorService
+	calls int
+}
+
+func (v *countingVendorService) Predict(ctx context.Context, req PredictRequest) (PredictResponse, error) {
+	v.calls++
+	var resp PredictResponse
+	resp.Meta.ModelName = req.Model
+	resp.Result.Score = 0.3
+	resp.Result.Threshold = 0.5
+	return resp, nil
+}
+
+func TestRuleService_Create(t *testing.T) {
+	svc := NewRuleService(&memoryRuleRepo{}, zerolog.Nop())
+
+	_, err := svc.Create(context.Background(), FraudRuleInput{Name: "bad", Stage: RuleStagePre, Expression: "amount >", Decision: DecisionDecline, ReasonCode: "X"})
+	assert.ErrorIs(t, err, ErrInvalidFraudRule)
+	_, err = svc.Create(context.Background(), FraudRuleInput{Name: "bad", Stage: "during", Expression: "true", Decision: DecisionDecline, ReasonCode: "X"})
+	assert.ErrorIs(t, err, ErrInvalidFraudRule)
+	_, err = svc.Create(context.Background(), FraudRuleInput{Name: "bad", Stage: RuleStagePre, Expression: "true", Decision: "block", ReasonCode: "X"})
+	assert.ErrorIs(t, err, ErrInvalidFraudRule)
+}
+
+func TestScoringService_Rules(t *testing.T) {
+	ctx := context.Background()
+	rules := NewRuleService(&memoryRuleRepo{}, zerolog.Nop())
+	for _, in := range []FraudRuleInput{
+		{Name: "blocked-merchant", Stage: RuleStagePre, Expression: `merchant_type in ["gambling", "crypto"]`, Decision: DecisionDecline, ReasonCode: "R001", Priority: 10, Enabled: true},
+		{Name: "large-new-device", Stage: RuleStagePost, Expression: `amount > 1000 && device_type == "new" && score > 0.2`, Decision: DecisionReview, ReasonCode: "R002", Priority: 20, Enabled: true},
+		{Name: "disabled", Stage: RuleStagePre, Expression: `true`, Decision: DecisionDecline, ReasonCode: "R003", Enabled: false},
+	} {
+		_, err := rules.Create(ctx, in)
+		require.NoError(t, err)
+	}
+
+	vendor := &countingVendorService{}
+	svc := NewScoringService(vendor, nil, rules, nil, zerolog.Nop())
+
+	// A pre-model rule decides without calling the vendor.
+	resp, err := svc.Score(ctx, 1, nil, PredictRequest{Model: "logreg", Features: map[string]interface{}{"merchant_type": "crypto", "amount": 5.0}})
+	require.NoError(t, err)
+	assert.Equal(t, 0, vendor.calls)
+	assert.Equal(t, RulesModel, resp.Meta.ModelName)
+	assert.Equal(t, ScoringPathRules, resp.ScoringPath())
+	assert.Equal(t, DecisionDecline, resp.Result.Decision)
+	assert.Equal(t, "R001", resp.Result.ReasonCode)
+	require.Len(t, resp.FiredRules(), 1)
+	assert.Equal(t, "blocked-merchant", resp.FiredRules()[0].Name)
+
+	// A post-model rule overrides the decision of the model threshold.
+	resp, err = svc.Score(ctx, 1, nil, PredictRequest{Model: "logreg", Features: map[string]interface{}{"merchant_type": "grocery", "amount": 2500.0, "device_type": "new"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, vendor.calls)
+	assert.Equal(t, DecisionReview, resp.Result.Decision)
+	assert.Equal(t, "R002", resp.Result.ReasonCode)
+	require.Len(t, resp.FiredRules(), 1)
+
+	// Nothing fires; the model threshold decides.
+	resp, err = svc.Score(ctx, 1, nil, PredictRequest{Model: "logreg", Features: map[string]interface{}{"merchant_type": "grocery", "amount": 20.0}})
+	require.NoError(t, err)
+	assert.Equal(t, DecisionApprove, resp.Result.Decision)
+	assert.Empty(t, resp.Result.ReasonCode)
+	assert.Empty(t, resp.FiredRules())
+}
+
+func TestRuleService_EvaluateLoadsOnce(t *testing.T) {
+	ctx := context.Background()
+	repo := &slowRuleRepo{}
+	rules := NewRuleService(repo, zerolog.Nop())
+	_, err := rules.Create(ctx, FraudRuleInput{Name: "blocked-merchant", Stage: RuleStagePre, Expression: `merchant_type == "crypto"`, Decision: DecisionDecline, ReasonCode: "R001", Enabled: true})
+	require.NoError(t, err)
+
+	// Concurrent requests on a cold cache share one query.
+	env := RuleEnv(PredictRequest{Features: map[string]interface{}{"merchant_type": "crypto"}}, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Len(t, rules.Evaluate(ctx, RuleStagePre, env), 1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), repo.lists.Load())
+
+	assert.Len(t, rules.Evaluate(ctx, RuleStagePre, env), 1)
+	assert.Equal(t, int32(1), repo.lists.Load())
+}
+
+func TestRuleService_EvaluateCanceledCallerDoesNotFailLoad(t *testing.T) {
+	ctx := context.Background()
+	rules := NewRuleService(&ctxRuleRepo{}, zerolog.Nop())
+	_, err := rules.Create(ctx, FraudRuleInput{Name: "blocked-merchant", Stage: RuleStagePre, Expression: `merchant_type == "crypto"`, Decision: DecisionDecline, ReasonCode: "R001", Enabled: true})
+	require.NoError(t, err)
+	env := RuleEnv(PredictRequest{Features: map[string]interface{}{"merchant_type": "crypto"}}, nil)
+
+	// The first caller gives up before the query finishes and gets the last
+	// loaded rules, while the caller sharing its query still gets the rules.
+	shortCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	done := make(chan []FiredRule)
+	go func() { done <- rules.Evaluate(shortCtx, RuleStagePre, env) }()
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Len(t, rules.Evaluate(ctx, RuleStagePre, env), 1)
+	assert.Empty(t, <-done)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+// RulesModel is reported as the model name when a pre-model rule decided a
+// request without calling the vendor.
+const RulesModel = "rules"
+
+// predictionErrorOutcome is the decision label of predictions that failed.
+const predictionErrorOutcome = "error"
+
+var (
+	predictionScore = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prediction_score",
+		Help:    "Distribution of model scores by model.",
+		Buckets: prometheus.LinearBuckets(0.05, 0.05, 20),
+	}, []string{"model"})
+	predictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "predictions_total",
+		Help: "Total number of scored predictions by model and final decision.",
+	}, []string{"model", "decision"})
+)
+
+// ScoringService runs the full decision pipeline for a prediction request.
+type ScoringService interface {
+	// Score adds the velocity features to req, then runs the pre-model rules,
+	// the vendor model, the decision policy of the caller and the post-model
+	// rules, in that order.
+	Score(ctx context.Context, userID int64, apiKeyID *int64, req PredictRequest) (PredictResponse, error)
+	// Validate checks the model and features of req against the vendor
+	// registry. While the registry cannot be loaded and a fallback is
+	// configured, requests are let through for the fallback to score.
+	Validate(ctx context.Context, req PredictRequest) error
+}
+
+type scoringService struct {
+	vendorSvc VendorService
+	policySvc DecisionPolicyService
+	ruleSvc   RuleService
+	velocity  VelocityStore
+	// lookupVelocity scores with the velocity features without recording
+	// the scored transactions.
+	lookupVelocity bool
+	fallback       *Fallback
+	logger         zerolog.Logger
+}
+
+// ScoringOption configures optional behaviour of the scoring service.
+type ScoringOption func(*scoringService)
+
+// WithFallback scores predictions with fallback while the vendor circuit
+// breaker is open or the vendor times out, instead of failing them. A nil
+// fallback disables it.
+func WithFallback(fallback *Fallback) ScoringOption {
+	return func(s *scoringService) {
+		s.fallback = fallback
+	}
+}
+
+// WithVelocityLookup scores with the velocity features of the recorded
+// transactions without recording the scored ones, for the prediction jobs,
+// whose items would otherwise count as live traffic.
+func WithVelocityLookup() ScoringOption {
+	return func(s *scoringService) {
+		s.lookupVelocity = true
+	}
+}
+
+// NewScoringService returns a ScoringService. policySvc, ruleSvc and velocity
+// are optional; without them the model threshold decides, no rules run and no
+// velocity features are added.
+func NewScoringService(vendorSvc VendorService, policySvc DecisionPolicyService, ruleSvc RuleService, velocity VelocityStore, logger zerolog.Logger, opts ...ScoringOption) ScoringService {
+	s := &scoringService{
+		vendorSvc: vendorSvc,
+		policySvc: policySvc,
+		ruleSvc:   ruleSvc,
+		velocity:  velocity,
+		logger:    logger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *scoringService) Score(ctx context.Context, userID int64, apiKeyID *int64, req PredictRequest) (PredictResponse, error) {
+	resp, err := s.score(ctx, userID, apiKeyID, req)
+	if err != nil {
+		predictionsTotal.WithLabelValues(req.Model, predictionErrorOutcome).Inc()
+		return resp, err
+	}
+
+	predictionsTotal.WithLabelValues(resp.Meta.ModelName, string(resp.Result.Decision)).Inc()
+	if path := resp.ScoringPath(); path != ScoringPathRules && path != ScoringPathFallbackRules {
+		predictionScore.WithLabelValues(resp.Meta.ModelName).Observe(resp.Result.Score)
+	}
+	return resp, nil
+}
+
+func (s *scoringService) Validate(ctx context.Context, req PredictRequest) error {
+	err := s.vendorSvc.ValidateModel(ctx, req.Model)
+	if err == nil {
+		err = s.vendorSvc.ValidateFeatures(ctx, req.Model, req.Features)
+	}
+	if err != nil && s.fallback != nil && vendorUnavailable(err) {
+		s.logger.Warn().Err(err).Str("model", req.Model).Msg("model registry unavailable, leaving validation to the fallback")
+		return nil
+	}
+	return err
+}
+
+func (s *scoringService) score(ctx context.Context, userID int64, apiKeyID *int64, req PredictRequest) (PredictResponse, error) {
+	// Velocity features are best effort: without Redis the model is scored on
+	// the client features alone.
+	if s.velocity != nil && req.Features != nil {
+		aggregate := s.velocity.Record
+		if s.lookupVelocity {
+			aggregate = s.velocity.Lookup
+		}
+		if err := aggregate(ctx, userID, apiKeyID, req.Features); err != nil {
+			s.logger.Warn().Err(err).Msg("failed to compute velocity features")
+		}
+	}
+
+	if s.ruleSvc != nil {
+		if fired := s.ruleSvc.Evaluate(ctx, RuleStagePre, RuleEnv(req, nil)); len(fired) > 0 {
+			s.logger.Info().Str("rule", fired[0].Name).Str("decision", string(fired[0].Decision)).Msg("pre-model rule decided request")
+			return ruleResponse(fired), nil
+		}
+	}
+
+	resp, err := s.vendorSvc.Predict(ctx, req)
+	if err != nil {
+		if s.fallback == nil || !vendorUnavailable(err) {
+			return PredictResponse{}, err
+		}
+		s.logger.Warn().Err(err).Str("model", req.Model).Str("mode", string(s.fallback.Mode())).Msg("vendor unavailable, scoring with fallback")
+		resp = s.fallback.Predict(req)
+		// Without a score, the policy and the post-model rules have nothing
+		// to decide on.
+		if s.fallback.Mode() == FallbackRules {
+			return resp, nil
+		}
+	}
+
+	if s.policySvc != nil {
+		s.policySvc.Apply(ctx, userID, apiKeyID, &resp)
+	} else {
+		resp.Result.Decision = DecisionPolicy{}.Decide(resp.Result.Score, resp.Result.Threshold)
+	}
+
+	if s.ruleSvc != nil {
+		if fired := s.ruleSvc.Evaluate(ctx, RuleStagePost, RuleEnv(req, &resp)); len(fired) > 0 {
+			resp.Result.Decision = fired[0].Decision
+			resp.Result.ReasonCode = fired[0].ReasonCode
+			resp.firedRules = fired
+		}
+	}
+
+	return resp, nil
+}
+
+// ruleResponse builds the response for a request decided by the first of the
+// fired pre-model rules.
+func ruleResponse(fired []FiredRule) PredictResponse {
+	var resp PredictResponse
+	resp.Meta.ModelName = RulesModel
+	resp.Meta.RequestID = uuid.New().String()
+	resp.Meta.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	resp.Result.Decision = fired[0].Decision
+	resp.Result.ReasonCode = fired[0].ReasonCode
+	if fired[0].Decision == DecisionDecline {
+		resp.Result.Prediction = 1
+	}
+	resp.firedRules = fired
+	resp.path = ScoringPathRules
+	return resp
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoringService_Metrics(t *testing.T) {
+	ctx := context.Background()
+	svc := NewScoringService(fakeVendorService{}, nil, nil, nil, zerolog.Nop())
+
+	resp, err := svc.Score(ctx, 1, nil, PredictRequest{Model: "scoring-metrics"})
+	require.NoError(t, err)
+	_, err = svc.Score(ctx, 1, nil, PredictRequest{Model: "scoring-metrics"})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, testutil.ToFloat64(predictionsTotal.WithLabelValues("scoring-metrics", string(resp.Result.Decision))))
+
+	errorsBefore := testutil.ToFloat64(predictionsTotal.WithLabelValues("broken", predictionErrorOutcome))
+	_, err = svc.Score(ctx, 1, nil, PredictRequest{Model: "broken"})
+	require.Error(t, err)
+	assert.Equal(t, errorsBefore+1, testutil.ToFloat64(predictionsTotal.WithLabelValues("broken", predictionErrorOutcome)))
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+	"github.com/sqlc-dev/pqtype"
+)
+
+var shadowPredictionsDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "shadow_predictions_dropped_total",
+	Help: "Number of predictions not scored by the challenger model because its calls were all busy.",
+})
+
+// ShadowResult is the outcome of scoring a request with the challenger model.
+type ShadowResult struct {
+	Model    string
+	Response *PredictResponse
+	Error    string
+}
+
+// ShadowComparison summarises how a challenger model agrees with the champion
+// over a time window.
+type ShadowComparison struct {
+	ChampionModel     string  `json:"champion_model"`
+	ChallengerModel   string  `json:"challenger_model"`
+	Total             int64   `json:"total"`
+	Agreements        int64   `json:"agreements"`
+	AgreementRate     float64 `json:"agreement_rate"`
+	MeanScoreDelta    float64 `json:"mean_score_delta"`
+	MeanAbsScoreDelta float64 `json:"mean_abs_score_delta"`
+	P95AbsScoreDelta  float64 `json:"p95_abs_score_delta"`
+	MaxAbsScoreDelta  float64 `json:"max_abs_score_delta"`
+}
+
+type ShadowService interface {
+	Compare(ctx context.Context, userID int64, from, to time.Time) ([]ShadowComparison, error)
+}
+
+type shadowService struct {
+	logRepo repo.InferenceLogRepository
+}
+
+func NewShadowService(logRepo repo.InferenceLogRepository) ShadowService {
+	return &shadowService{logRepo: logRepo}
+}
+
+func (s *shadowService) Compare(ctx context.Context, userID int64, from, to time.Time) ([]ShadowComparison, error) {
+	rows, err := s.logRepo.ListShadowComparisons(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	comparisons := make([]ShadowComparison, len(rows))
+	for i, row := range rows {
+		c := ShadowComparison{
+			ChampionModel:     row.ChampionModel,
+			ChallengerModel:   row.ChallengerModel,
+			Total:             row.Total,
+			Agreements:        row.Agreements,
+			MeanScoreDelta:    row.MeanScoreDelta,
+			MeanAbsScoreDelta: row.MeanAbsScoreDelta,
+			P95AbsScoreDelta:  row.P95AbsScoreDelta,
+			MaxAbsScoreDelta:  row.MaxAbsScoreDelta,
+		}
+		if row.Total > 0 {
+			c.AgreementRate = float64(row.Agreements) / float64(row.Total)
+		}
+		comparisons[i] = c
+	}
+	return comparisons, nil
+}
+
+// PersistShadow waits in the background for the challenger result of resp, if
+// any, and stores it next to the champion result in inference log logID.
+func PersistShadow(logRepo repo.InferenceLogRepository, logID int64, resp PredictResponse, logger zerolog.Logger) {
+	ch := resp.Shadow()
+	if ch == nil || logID == 0 {
+		return
+	}
+
+	go func() {
+		result := <-ch
+
+		params := db.UpdateInferenceLogShadowParams{
+			ID:          logID,
+			ShadowModel: sql.NullString{String: result.Model, Valid: true},
+		}
+		if result.Error != "" {
+			params.ShadowError = sql.NullString{String: result.Error, Valid: true}
+		} else if payload, err := json.Marshal(result.Response); err == nil {
+			params.ShadowResponsePayload = pqtype.NullRawMessage{RawMessage: payload, Valid: true}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := logRepo.UpdateInferenceLogShadow(ctx, params); err != nil {
+			logger.Error().Err(err).Int64("inference_log_id", logID).Msg("failed to log shadow inference")
+		}
+	}()
+}
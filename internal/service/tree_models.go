@@ -0,0 +1,411 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lightGBM decision_type bits, see LightGBM tree.h.
+const (
+	lightGBMCategoricalMask = 1
+	lightGBMDefaultLeftMask = 2
+	lightGBMMissingZero     = 1
+	lightGBMMissingNaN      = 2
+	lightGBMZeroThreshold   = 1e-35
+)
+
+// treeEnsemble is a sum of regression trees passed through a sigmoid, the
+// shape of binary classifiers trained with LightGBM and XGBoost.
+type treeEnsemble struct {
+	features []string
+	trees    []regressionTree
+	// baseMargin is added to the sum of the leaves; sigmoidScale multiplies
+	// the margin before the sigmoid.
+	baseMargin   float64
+	sigmoidScale float64
+	// xgboost selects the XGBoost semantics, where every node records the
+	// child taken by missing values and numbers go left when strictly below
+	// the threshold. LightGBM compares with <= and encodes missing value
+	// handling in the decision type.
+	xgboost bool
+}
+
+// regressionTree is a binary tree stored as parallel arrays. A negative child
+// c is the leaf ^c.
+type regressionTree struct {
+	feature      []int
+	threshold    []float64
+	decisionType []uint8
+	left         []int
+	right        []int
+	missing      []int
+	leaves       []float64
+}
+
+func (m *treeEnsemble) Score(features map[string]interface{}) float64 {
+	values := make([]float64, len(m.features))
+	for i, name := range m.features {
+		values[i] = treeFeatureValue(features[name])
+	}
+
+	margin := m.baseMargin
+	for i := range m.trees {
+		margin += m.trees[i].predict(values, m.xgboost)
+	}
+	return 1 / (1 + math.Exp(-m.sigmoidScale*margin))
+}
+
+func (m *treeEnsemble) Features() []string {
+	return m.features
+}
+
+// treeFeatureValue converts a request feature for the trees: numbers are used
+// as is, booleans as 0 or 1, anything else is missing.
+func treeFeatureValue(v interface{}) float64 {
+	switch b := v.(type) {
+	case bool:
+		if b {
+			return 1
+		}
+		return 0
+	}
+	if x, ok := toFloat(v); ok {
+		return x
+	}
+	return math.NaN()
+}
+
+func (t *regressionTree) predict(values []float64, xgboost bool) float64 {
+	if len(t.feature) == 0 {
+		return t.leaves[0]
+	}
+	node := 0
+	for node >= 0 {
+		x := values[t.feature[node]]
+		switch {
+		case xgboost && math.IsNaN(x):
+			node = t.missing[node]
+		case xgboost && x < t.threshold[node]:
+			node = t.left[node]
+		case xgboost:
+			node = t.right[node]
+		default:
+			node = t.lightGBMChild(node, x)
+		}
+	}
+	return t.leaves[^node]
+}
+
+// lightGBMChild mirrors NumericalDecision of LightGBM.
+func (t *regressionTree) lightGBMChild(node int, x float64) int {
+	missingType := (t.decisionType[node] >> 2) & 3
+	if math.IsNaN(x) && missingType != lightGBMMissingNaN {
+		x = 0
+	}
+	if (missingType == lightGBMMissingZero && math.Abs(x) <= lightGBMZeroThreshold) || (missingType == lightGBMMissingNaN && math.IsNaN(x)) {
+		if t.decisionType[node]&lightGBMDefaultLeftMask != 0 {
+			return t.left[node]
+		}
+		return t.right[node]
+	}
+	if x <= t.threshold[node] {
+		return t.left[node]
+	}
+	return t.right[node]
+}
+
+// parseLightGBMModel parses a binary classifier saved with
+// Booster.save_model in the LightGBM text format. Categorical splits and
+// multiclass models are not supported.
+func parseLightGBMModel(data []byte) (*treeEnsemble, error) {
+	header := map[string]string{}
+	var trees []map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "end of trees" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "Tree":
+			trees = append(trees, map[string]string{})
+		case len(trees) > 0:
+			trees[len(trees)-1][key] = value
+		default:
+			header[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	m := &treeEnsemble{sigmoidScale: 1}
+	if n := header["num_class"]; n != "" && n != "1" {
+		return nil, fmt.Errorf("multiclass models are not supported")
+	}
+	objective := strings.Fields(header["objective"])
+	if len(objective) == 0 || (objective[0] != "binary" && objective[0] != "cross_entropy") {
+		return nil, fmt.Errorf("objective %q is not a binary classifier", header["objective"])
+	}
+	for _, param := range objective[1:] {
+		if v, ok := strings.CutPrefix(param, "sigmoid:"); ok {
+			scale, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid objective %q", header["objective"])
+			}
+			m.sigmoidScale = scale
+		}
+	}
+	m.features = strings.Fields(header["feature_names"])
+	if len(m.features) == 0 {
+		return nil, fmt.Errorf("no feature_names")
+	}
+
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("no trees")
+	}
+	for i, fields := range trees {
+		t, err := lightGBMTree(fields, len(m.features))
+		if err != nil {
+			return nil, fmt.Errorf("tree %d: %w", i, err)
+		}
+		m.trees = append(m.trees, t)
+	}
+	return m, nil
+}
+
+func lightGBMTree(fields map[string]string, numFeatures int) (regressionTree, error) {
+	var t regressionTree
+	var err error
+	if fields["num_cat"] != "" && fields["num_cat"] != "0" {
+		return t, fmt.Errorf("categorical splits are not supported")
+	}
+	if t.leaves, err = parseFloats(fields["leaf_value"]); err != nil {
+		return t, fmt.Errorf("leaf_value: %w", err)
+	}
+	numLeaves, err := strconv.Atoi(fields["num_leaves"])
+	if err != nil || numLeaves < 1 || len(t.leaves) != numLeaves {
+		return t, fmt.Errorf("invalid num_leaves")
+	}
+	if numLeaves == 1 {
+		return t, nil
+	}
+
+	if t.feature, err = parseInts(fields["split_feature"]); err != nil {
+		return t, fmt.Errorf("split_feature: %w", err)
+	}
+	if t.threshold, err = parseFloats(fields["threshold"]); err != nil {
+		return t, fmt.Errorf("threshold: %w", err)
+	}
+	decisionTypes, err := parseInts(fields["decision_type"])
+	if err != nil {
+		return t, fmt.Errorf("decision_type: %w", err)
+	}
+	if t.left, err = parseInts(fields["left_child"]); err != nil {
+		return t, fmt.Errorf("left_child: %w", err)
+	}
+	if t.right, err = parseInts(fields["right_child"]); err != nil {
+		return t, fmt.Errorf("right_child: %w", err)
+	}
+
+	nodes := numLeaves - 1
+	if len(t.feature) != nodes || len(t.threshold) != nodes || len(decisionTypes) != nodes || len(t.left) != nodes || len(t.right) != nodes {
+		return t, fmt.Errorf("expected %d internal nodes", nodes)
+	}
+	t.decisionType = make([]uint8, nodes)
+	for i, d := range decisionTypes {
+		if d&lightGBMCategoricalMask != 0 {
+			return t, fmt.Errorf("categorical splits are not supported")
+		}
+		t.decisionType[i] = uint8(d)
+	}
+	return t, checkTree(t, numFeatures)
+}
+
+// xgboostNode is a node of an XGBoost JSON dump.
+type xgboostNode struct {
+	NodeID         int           `json:"nodeid"`
+	Split          string        `json:"split"`
+	SplitCondition *float64      `json:"split_condition"`
+	Yes            int           `json:"yes"`
+	No             int           `json:"no"`
+	Missing        int           `json:"missing"`
+	Leaf           *float64      `json:"leaf"`
+	Children       []xgboostNode `json:"children"`
+}
+
+// parseXGBoostModel parses the trees of a binary:logistic booster dumped with
+// Booster.dump_model(path, dump_format="json"). Splits must use feature names.
+// The dump does not include the base score of the booster, so it is passed
+// in.
+func parseXGBoostModel(data []byte, baseScore float64) (*treeEnsemble, error) {
+	var roots []xgboostNode
+	if err := json.Unmarshal(data, &roots); err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no trees")
+	}
+	if baseScore <= 0 || baseScore >= 1 {
+		return nil, fmt.Errorf("base score must be between 0 and 1")
+	}
+
+	m := &treeEnsemble{
+		baseMargin:   math.Log(baseScore / (1 - baseScore)),
+		sigmoidScale: 1,
+		xgboost:      true,
+	}
+	featureIndex := map[string]int{}
+	for i := range roots {
+		t, err := xgboostTree(&roots[i], featureIndex)
+		if err != nil {
+			return nil, fmt.Errorf("tree %d: %w", i, err)
+		}
+		m.trees = append(m.trees, t)
+	}
+
+	m.features = make([]string, len(featureIndex))
+	for name, i := range featureIndex {
+		m.features[i] = name
+	}
+	return m, nil
+}
+
+// xgboostTree renumbers the nodes of root so that internal nodes come first,
+// as checkTree expects.
+func xgboostTree(root *xgboostNode, featureIndex map[string]int) (regressionTree, error) {
+	var t regressionTree
+	if root.Leaf != nil {
+		t.leaves = []float64{*root.Leaf}
+		return t, nil
+	}
+
+	byID := map[int]*xgboostNode{}
+	var collect func(n *xgboostNode)
+	collect = func(n *xgboostNode) {
+		byID[n.NodeID] = n
+		for i := range n.Children {
+			collect(&n.Children[i])
+		}
+	}
+	collect(root)
+
+	ids := make([]int, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	index := map[int]int{}
+	var internal, leaves int
+	for _, id := range ids {
+		if byID[id].Leaf != nil {
+			index[id] = ^leaves
+			leaves++
+		} else {
+			index[id] = internal
+			internal++
+		}
+	}
+
+	child := func(id int) (int, error) {
+		i, ok := index[id]
+		if !ok {
+			return 0, fmt.Errorf("unknown node %d", id)
+		}
+		return i, nil
+	}
+
+	t.feature = make([]int, internal)
+	t.threshold = make([]float64, internal)
+	t.left = make([]int, internal)
+	t.right = make([]int, internal)
+	t.missing = make([]int, internal)
+	t.leaves = make([]float64, leaves)
+	for _, id := range ids {
+		n := byID[id]
+		i := index[id]
+		if n.Leaf != nil {
+			t.leaves[^i] = *n.Leaf
+			continue
+		}
+		if n.SplitCondition == nil {
+			return t, fmt.Errorf("node %d: indicator splits are not supported", id)
+		}
+		f, ok := featureIndex[n.Split]
+		if !ok {
+			f = len(featureIndex)
+			featureIndex[n.Split] = f
+		}
+		t.feature[i] = f
+		t.threshold[i] = *n.SplitCondition
+		var err error
+		if t.left[i], err = child(n.Yes); err != nil {
+			return t, err
+		}
+		if t.right[i], err = child(n.No); err != nil {
+			return t, err
+		}
+		if t.missing[i], err = child(n.Missing); err != nil {
+			return t, err
+		}
+	}
+	return t, checkTree(t, len(featureIndex))
+}
+
+// checkTree verifies that the references of t are in range, so that predict
+// cannot panic. Children must come after their parent, which holds for both
+// LightGBM and XGBoost and rules out cycles.
+func checkTree(t regressionTree, numFeatures int) error {
+	valid := func(parent, c int) bool {
+		if c < 0 {
+			return ^c < len(t.leaves)
+		}
+		return c > parent && c < len(t.feature)
+	}
+	for i := range t.feature {
+		if t.feature[i] < 0 || t.feature[i] >= numFeatures {
+			return fmt.Errorf("node %d: invalid feature", i)
+		}
+		if !valid(i, t.left[i]) || !valid(i, t.right[i]) || (t.missing != nil && !valid(i, t.missing[i])) {
+			return fmt.Errorf("node %d: invalid child", i)
+		}
+	}
+	return nil
+}
+
+func parseFloats(s string) ([]float64, error) {
+	fields := strings.Fields(s)
+	values := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	fields := strings.Fields(s)
+	values := make([]int, len(fields))
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLightGBMModel has two trees: amount <= 100.5 scores -1, larger amounts
+// score 0.5 or 2 depending on is_new_device, and a constant tree adds 0.25. A
+// missing amount takes the right branch (missing type NaN, default right).
+const testLightGBMModel = `tree
+version=v3
+num_class=1
+num_tree_per_iteration=1
+label_index=0
+max_feature_idx=1
+objective=binary sigmoid:1
+feature_names=amount is_new_device
+feature_infos=[0:1000] [0:1]
+tree_sizes=300 120
+
+Tree=0
+num_leaves=3
+num_cat=0
+split_feature=0 1
+split_gain=10 5
+threshold=100.5 0.5
+decision_type=8 2
+left_child=-1 -2
+right_child=1 -3
+leaf_value=-1 0.5 2
+leaf_weight=1 1 1
+leaf_count=10 10 10
+internal_value=0 0
+internal_weight=0 0
+internal_count=30 20
+is_linear=0
+shrinkage=1
+
+
+Tree=1
+num_leaves=1
+num_cat=0
+split_feature=
+split_gain=
+threshold=
+decision_type=
+left_child=
+right_child=
+leaf_value=0.25
+leaf_weight=
+leaf_count=
+internal_value=
+internal_weight=
+internal_count=
+is_linear=0
+shrinkage=1
+
+
+end of trees
+
+feature_importances:
+amount=1
+is_new_device=1
+
+parameters:
+[boosting: gbdt]
+end of parameters
+`
+
+// testXGBoostModel mirrors testLightGBMModel, except that a missing amount
+// takes the "no" branch and XGBoost compares with <.
+const testXGBoostModel = `[
+  { "nodeid": 0, "depth": 0, "split": "amount", "split_condition": 100.5, "yes": 1, "no": 2, "missing": 2, "children": [
+    { "nodeid": 1, "leaf": -1 },
+    { "nodeid": 2, "depth": 1, "split": "is_new_device", "split_condition": 0.5, "yes": 3, "no": 4, "missing": 3, "children": [
+      { "nodeid": 3, "leaf": 0.5 },
+      { "nodeid": 4, "leaf": 2 }
+    ]}
+  ]},
+  { "nodeid": 0, "leaf": 0.25 }
+]`
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func TestParseLightGBMModel(t *testing.T) {
+	m, err := parseLightGBMModel([]byte(testLightGBMModel))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"amount", "is_new_device"}, m.Features())
+	require.Len(t, m.trees, 2)
+
+	assert.InDelta(t, sigmoid(-0.75), m.Score(map[string]interface{}{"amount": 50.0}), 1e-9)
+	assert.InDelta(t, sigmoid(-0.75), m.Score(map[string]interface{}{"amount": 100.5}), 1e-9)
+	assert.InDelta(t, sigmoid(0.75), m.Score(map[string]interface{}{"amount": 500.0, "is_new_device": false}), 1e-9)
+	assert.InDelta(t, sigmoid(2.25), m.Score(map[string]interface{}{"amount": 500, "is_new_device": true}), 1e-9)
+	// Missing amount goes right; a missing device counts as 0.
+	assert.InDelta(t, sigmoid(2.25), m.Score(map[string]interface{}{"is_new_device": 1.0}), 1e-9)
+	assert.InDelta(t, sigmoid(0.75), m.Score(map[string]interface{}{"amount": "n/a"}), 1e-9)
+
+	for name, model := range map[string]string{
+		"multiclass":  "num_class=3\nobjective=multiclass num_class:3\nfeature_names=a\nTree=0\nnum_leaves=1\nleaf_value=1\n",
+		"regression":  "objective=regression\nfeature_names=a\nTree=0\nnum_leaves=1\nleaf_value=1\n",
+		"no trees":    "objective=binary sigmoid:1\nfeature_names=a\n",
+		"categorical": "objective=binary sigmoid:1\nfeature_names=a\nTree=0\nnum_leaves=2\nnum_cat=1\nsplit_feature=0\nthreshold=0\ndecision_type=1\nleft_child=-1\nright_child=-2\nleaf_value=1 2\n",
+		"bad feature": "objective=binary sigmoid:1\nfeature_names=a\nTree=0\nnum_leaves=2\nsplit_feature=1\nthreshold=0\ndecision_type=0\nleft_child=-1\nright_child=-2\nleaf_value=1 2\n",
+		"bad child":   "objective=binary sigmoid:1\nfeature_names=a\nTree=0\nnum_leaves=2\nsplit_feature=0\nthreshold=0\ndecision_type=0\nleft_child=0\nright_child=-2\nleaf_value=1 2\n",
+	} {
+		_, err := parseLightGBMModel([]byte(model))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseXGBoostModel(t *testing.T) {
+	m, err := parseXGBoostModel([]byte(testXGBoostModel), 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"amount", "is_new_device"}, m.Features())
+
+	assert.InDelta(t, sigmoid(-0.75), m.Score(map[string]interface{}{"amount": 50.0}), 1e-9)
+	assert.InDelta(t, sigmoid(0.75), m.Score(map[string]interface{}{"amount": 100.5, "is_new_device": false}), 1e-9)
+	assert.InDelta(t, sigmoid(2.25), m.Score(map[string]interface{}{"amount": 500.0, "is_new_device": true}), 1e-9)
+	// Missing values follow the missing branch.
+	assert.InDelta(t, sigmoid(0.75), m.Score(map[string]interface{}{}), 1e-9)
+
+	m, err = parseXGBoostModel([]byte(testXGBoostModel), 0.2)
+	require.NoError(t, err)
+	assert.InDelta(t, sigmoid(math.Log(0.25)-0.75), m.Score(map[string]interface{}{"amount": 50.0}), 1e-9)
+
+	_, err = parseXGBoostModel([]byte(testXGBoostModel), 1)
+	assert.Error(t, err)
+	_, err = parseXGBoostModel([]byte(`[]`), 0.5)
+	assert.Error(t, err)
+	_, err = parseXGBoostModel([]byte(`[{"nodeid": 0, "split": "a", "split_condition": 1, "yes": 1, "no": 7, "missing": 1, "children": [{"nodeid": 1, "leaf": 1}]}]`), 0.5)
+	assert.Error(t, err)
+}
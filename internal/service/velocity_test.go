@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVelocityStore_Record(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	store, err := NewVelocityStore(redisClient, []VelocityFeature{
+		{Name: "device_txn_count_10m", Keys: []string{VelocityIdentityKey, "device_type"}, Window: 10 * time.Minute, Aggregate: VelocityCount},
+		{Name: "merchant_amount_sum_1h", Keys: []string{VelocityIdentityKey, "merchant_type"}, Window: time.Hour, Aggregate: VelocitySum, Field: "amount"},
+	})
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.(*redisVelocityStore).now = func() time.Time { return now }
+
+	ctx := context.Background()
+	keyID := int64(7)
+	record := func(apiKeyID *int64, features map[string]interface{}) map[string]interface{} {
+		require.NoError(t, store.Record(ctx, 1, apiKeyID, features))
+		return features
+	}
+
+	features := record(&keyID, map[string]interface{}{"device_type": "mobile", "merchant_type": "grocery", "amount": 10.5})
+	assert.Equal(t, int64(1), features["device_txn_count_10m"])
+	assert.Equal(t, 10.5, features["merchant_amount_sum_1h"])
+
+	now = now.Add(5 * time.Minute)
+	features = record(&keyID, map[string]interface{}{"device_type": "mobile", "merchant_type": "grocery", "amount": int64(4)})
+	assert.Equal(t, int64(2), features["device_txn_count_10m"])
+	assert.Equal(t, 14.5, features["merchant_amount_sum_1h"])
+
+	// Windows are partitioned by caller and by the key features.
+	features = record(nil, map[string]interface{}{"device_type": "mobile", "merchant_type": "travel", "amount": 1.0})
+	assert.Equal(t, int64(1), features["device_txn_count_10m"])
+	assert.Equal(t, 1.0, features["merchant_amount_sum_1h"])
+
+	// Transactions older than the window no longer count.
+	now = now.Add(6 * time.Minute)
+	features = record(&keyID, map[string]interface{}{"device_type": "mobile", "merchant_type": "grocery", "amount": 1.0})
+	assert.Equal(t, int64(2), features["device_txn_count_10m"])
+	assert.Equal(t, 15.5, features["merchant_amount_sum_1h"])
+
+	// A window whose key feature is missing is skipped.
+	features = record(&keyID, map[string]interface{}{"merchant_type": "grocery"})
+	assert.NotContains(t, features, "device_txn_count_10m")
+	assert.NotContains(t, features, "merchant_amount_sum_1h")
+
+	assert.Equal(t, []string{"device_txn_count_10m", "merchant_amount_sum_1h"}, store.Names())
+}
+
+func TestVelocityStore_Lookup(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	store, err := NewVelocityStore(redisClient, []VelocityFeature{
+		{Name: "device_txn_count_10m", Keys: []string{VelocityIdentityKey, "device_type"}, Window: 10 * time.Minute, Aggregate: VelocityCount},
+		{Name: "merchant_amount_sum_1h", Keys: []string{VelocityIdentityKey, "merchant_type"}, Window: time.Hour, Aggregate: VelocitySum, Field: "amount"},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, store.Record(ctx, 1, nil, map[string]interface{}{"device_type": "mobile", "merchant_type": "grocery", "amount": 10.5}))
+
+	// A looked up transaction counts as if it was recorded, but is not.
+	for i := 0; i < 2; i++ {
+		features := map[string]interface{}{"device_type": "mobile", "merchant_type": "grocery", "amount": 2.0}
+		require.NoError(t, store.Lookup(ctx, 1, nil, features))
+		assert.Equal(t, int64(2), features["device_txn_count_10m"])
+		assert.Equal(t, 12.5, features["merchant_amount_sum_1h"])
+	}
+
+	features := map[string]interface{}{"device_type": "mobile", "merchant_type": "grocery", "amount": 1.0}
+	require.NoError(t, store.Record(ctx, 1, nil, features))
+	assert.Equal(t, int64(2), features["device_txn_count_10m"])
+	assert.Equal(t, 11.5, features["merchant_amount_sum_1h"])
+}
+
+func TestVelocityStore_BoundedBuckets(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	store, err := NewVelocityStore(redisClient, []VelocityFeature{
+		{Name: "txn_count_1m", Keys: []string{VelocityIdentityKey}, Window: time.Minute, Aggregate: VelocityCount},
+	})
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.(*redisVelocityStore).now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// A transaction every 100ms for 3 minutes keeps one field per bucket of
+	// the window, not one per transaction.
+	var features map[string]interface{}
+	for i := 0; i < 1800; i++ {
+		features = map[string]interface{}{}
+		require.NoError(t, store.Record(ctx, 1, nil, features))
+		now = now.Add(100 * time.Millisecond)
+	}
+	assert.Equal(t, int64(600), features["txn_count_1m"])
+	fields, err := redisClient.HLen(ctx, "velocity_buckets:txn_count_1m:user:1").Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, fields, int64(velocityBuckets))
+}
+
+func TestNewVelocityStore_Invalid(t *testing.T) {
+	_, err := NewVelocityStore(nil, []VelocityFeature{{Name: "x", Keys: []string{"device_type"}, Window: time.Minute, Aggregate: "avg"}})
+	assert.Error(t, err)
+
+	_, err = NewVelocityStore(nil, []VelocityFeature{{Name: "x", Keys: []string{"device_type"}, Window: time.Minute, Aggregate: VelocitySum}})
+	assert.Error(t, err)
+}
@@ -2,7 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/jules-labs/go-api-prod-template/internal/clients"
 	"github.com/rs/zerolog"
@@ -12,18 +16,109 @@ type VendorService interface {
 	Ping(ctx context.Context) (string, error)
 	ListModels(ctx context.Context) ([]Model, error)
 	Predict(ctx context.Context, req PredictRequest) (PredictResponse, error)
+	// ValidateModel returns an *UnknownModelError if model is not currently
+	// loaded by the vendor.
+	ValidateModel(ctx context.Context, model string) error
+	// ValidateFeatures returns a *FeatureValidationError if features do not
+	// match the signature inputs of model.
+	ValidateFeatures(ctx context.Context, model string, features map[string]interface{}) error
 }
 
 type vendorService struct {
 	client *clients.ThirdPartyClient
 	logger zerolog.Logger
+
+	registry         *modelRegistry
+	modelRegistryTTL time.Duration
+
+	shadowModel   string
+	shadowClient  *clients.ThirdPartyClient
+	shadowTimeout time.Duration
+	shadowSem     chan struct{}
+
+	ensembleStrategy EnsembleStrategy
+	ensembleWeights  map[string]float64
+
+	derivedFeatures map[string]bool
+
+	explain       ExplainSettings
+	explainClient *clients.ThirdPartyClient
+	explainSem    chan struct{}
+
+	local *LocalRuntime
+
+	cache PredictionCache
+}
+
+// VendorOption configures optional behaviour of the vendor service.
+type VendorOption func(*vendorService)
+
+// WithShadowModel scores every prediction with the challenger model in the
+// background. The client-facing response always comes from the requested
+// (champion) model; the challenger result is exposed through
+// PredictResponse.Shadow.
+//
+// Challenger calls go through client, whose circuit breaker is separate from
+// the champion's, and at most concurrency of them run at once. Predictions
+// made while they are all busy are not shadowed.
+func WithShadowModel(model string, client *clients.ThirdPartyClient, timeout time.Duration, concurrency int) VendorOption {
+	return func(s *vendorService) {
+		if concurrency < 1 {
+			concurrency = 1
+		}
+		s.shadowModel = model
+		s.shadowClient = client
+		s.shadowTimeout = timeout
+		s.shadowSem = make(chan struct{}, concurrency)
+	}
+}
+
+// WithModelRegistryTTL sets how long the cached list of loaded vendor models
+// is considered fresh.
+func WithModelRegistryTTL(ttl time.Duration) VendorOption {
+	return func(s *vendorService) {
+		s.modelRegistryTTL = ttl
+	}
 }
 
-func NewVendorService(client *clients.ThirdPartyClient, logger zerolog.Logger) VendorService {
-	return &vendorService{
+// WithDerivedFeatures marks features that are computed server side, such as
+// velocity features. They are not required from clients by ValidateFeatures.
+func WithDerivedFeatures(names ...string) VendorOption {
+	return func(s *vendorService) {
+		s.derivedFeatures = make(map[string]bool, len(names))
+		for _, name := range names {
+			s.derivedFeatures[name] = true
+		}
+	}
+}
+
+// WithLocalRuntime evaluates the models of runtime in process instead of
+// calling the vendor. They are listed and validated like vendor models and
+// replace vendor models of the same type.
+func WithLocalRuntime(runtime *LocalRuntime) VendorOption {
+	return func(s *vendorService) {
+		s.local = runtime
+	}
+}
+
+// WithPredictionCache serves repeated vendor predictions of the same features
+// from cache. Local models and explained requests are not cached.
+func WithPredictionCache(cache PredictionCache) VendorOption {
+	return func(s *vendorService) {
+		s.cache = cache
+	}
+}
+
+func NewVendorService(client *clients.ThirdPartyClient, logger zerolog.Logger, opts ...VendorOption) VendorService {
+	s := &vendorService{
 		client: client,
 		logger: logger,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.registry = newModelRegistry(client, s.modelRegistryTTL, logger)
+	return s
 }
 
 func (s *vendorService) Ping(ctx context.Context) (string, error) {
@@ -42,8 +137,11 @@ type Model struct {
 
 // PredictRequest contains the input for a prediction.
 type PredictRequest struct {
-	Model    string                 `json:"model" validate:"required,oneof=logreg lightgbm xgboost"`
+	Model    string                 `json:"model" validate:"required"`
 	Features map[string]interface{} `json:"features" validate:"required"`
+	// Explain adds the feature contributions and reason codes of the score to
+	// the response.
+	Explain bool `json:"explain,omitempty"`
 }
 
 // PredictResponse is the subset of the vendor response we expose to clients.
@@ -54,37 +152,170 @@ type PredictResponse struct {
 		RequestID string  `json:"request_id"`
 		Timestamp string  `json:"timestamp"`
 		LatencyMs float64 `json:"latency_ms"`
+		// PolicyID and PolicyVersion identify the decision policy applied to
+		// the result. PolicyID is 0 when the model threshold was used.
+		PolicyID      int64 `json:"policy_id,omitempty"`
+		PolicyVersion int32 `json:"policy_version"`
+		// InferenceID is the inference log entry of the prediction, used to
+		// attach feedback to it.
+		InferenceID int64 `json:"inference_id,omitempty"`
+		// Degraded is set when the vendor was unavailable and the prediction
+		// was scored by the local fallback.
+		Degraded bool `json:"degraded,omitempty"`
+		// Cached is set when the vendor prediction came from the prediction
+		// cache.
+		Cached bool `json:"cached,omitempty"`
 	} `json:"meta"`
 	Result struct {
-		Prediction int     `json:"prediction"`
-		Score      float64 `json:"score"`
-		Threshold  float64 `json:"threshold"`
+		Prediction int      `json:"prediction"`
+		Score      float64  `json:"score"`
+		Threshold  float64  `json:"threshold"`
+		Decision   Decision `json:"decision,omitempty"`
+		// ReasonCode is set when a fraud rule made the decision.
+		ReasonCode string `json:"reason_code,omitempty"`
+		// Members holds the individual model results for model "ensemble".
+		Members []EnsembleMember `json:"members,omitempty"`
+		// Explanation is only set for explained requests.
+		Explanation *Explanation `json:"explanation,omitempty"`
 	} `json:"result"`
+
+	shadow     <-chan ShadowResult
+	firedRules []FiredRule
+	path       ScoringPath
+}
+
+// Shadow returns a channel that delivers the challenger result when shadow
+// scoring is enabled, or nil otherwise. The channel receives exactly one value.
+func (r PredictResponse) Shadow() <-chan ShadowResult {
+	return r.shadow
 }
 
+// FiredRules returns the fraud rules that matched the request. They are kept
+// out of the client response and recorded in the inference log instead.
+func (r PredictResponse) FiredRules() []FiredRule {
+	return r.firedRules
+}
+
+// ScoringPath returns how the prediction was scored. Like the fired rules, it is
+// recorded in the inference log rather than sent to the client.
+func (r PredictResponse) ScoringPath() ScoringPath {
+	if r.path == "" {
+		return ScoringPathVendor
+	}
+	return r.path
+}
+
+// ListModels returns the models loaded by the vendor from the cached registry,
+// and the local models.
 func (s *vendorService) ListModels(ctx context.Context) ([]Model, error) {
-	version, err := s.client.Version(ctx)
-	if err != nil {
-		return nil, err
+	return s.models(ctx)
+}
+
+func (s *vendorService) ValidateModel(ctx context.Context, model string) error {
+	if s.local.Has(model) {
+		return nil
 	}
+	err := s.registry.Validate(ctx, model)
+	var unknown *UnknownModelError
+	if errors.As(err, &unknown) {
+		for _, m := range s.local.Models() {
+			if !slices.Contains(unknown.Allowed, m.ModelType) {
+				unknown.Allowed = append(unknown.Allowed, m.ModelType)
+			}
+		}
+		sort.Strings(unknown.Allowed)
+	}
+	return err
+}
 
-	models := make([]Model, 0, len(version.LoadedModels))
-	for modelType, m := range version.LoadedModels {
-		models = append(models, Model{
-			ModelType:       modelType,
-			Name:            m.Name,
-			Version:         m.Version,
-			Stage:           m.Stage,
-			RunID:           m.RunID,
-			SignatureInputs: m.SignatureInputs,
-		})
+// models merges the vendor and local models, sorted by model type. Local
+// models are still listed while the vendor registry is unavailable.
+func (s *vendorService) models(ctx context.Context) ([]Model, error) {
+	local := s.local.Models()
+	models, err := s.registry.Models(ctx)
+	if err != nil {
+		if len(local) == 0 {
+			return nil, err
+		}
+		s.logger.Warn().Err(err).Msg("model registry unavailable, listing local models only")
+		return local, nil
+	}
+	if len(local) == 0 {
+		return models, nil
 	}
 
-	sort.Slice(models, func(i, j int) bool {
-		return models[i].ModelType < models[j].ModelType
+	merged := append([]Model(nil), local...)
+	for _, m := range models {
+		if !s.local.Has(m.ModelType) {
+			merged = append(merged, m)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ModelType < merged[j].ModelType
 	})
+	return merged, nil
+}
+
+// predictModel scores req with the local runtime if it serves the model, and
+// with the vendor through client otherwise. cached reports whether the vendor
+// prediction came from the prediction cache.
+func (s *vendorService) predictModel(ctx context.Context, client *clients.ThirdPartyClient, req clients.PredictRequest) (resp *clients.PredictResponse, cached bool, err error) {
+	if s.local.Has(req.Model) {
+		resp, err = s.local.Predict(req)
+		return resp, false, err
+	}
 
-	return models, nil
+	var runID string
+	if s.cache != nil && !req.Explain {
+		runID = s.runID(ctx, req.Model)
+	}
+	if runID == "" {
+		resp, err = client.Predict(ctx, req)
+		return resp, false, err
+	}
+
+	// Derived features such as velocity counts change with every request, so
+	// the prediction is cached by the client features alone.
+	features := s.clientFeatures(req.Features)
+	if resp, ok := s.cache.Get(ctx, req.Model, runID, features); ok {
+		return resp, true, nil
+	}
+	resp, err = client.Predict(ctx, req)
+	// A response of another run means that the vendor deployed a new model
+	// that the registry has not seen yet.
+	if err == nil && resp.Meta.RunID == runID {
+		s.cache.Set(ctx, req.Model, runID, features, resp)
+	}
+	return resp, false, err
+}
+
+// clientFeatures returns features without the derived features.
+func (s *vendorService) clientFeatures(features map[string]interface{}) map[string]interface{} {
+	if len(s.derivedFeatures) == 0 {
+		return features
+	}
+	client := make(map[string]interface{}, len(features))
+	for name, value := range features {
+		if !s.derivedFeatures[name] {
+			client[name] = value
+		}
+	}
+	return client
+}
+
+// runID returns the run ID of the vendor model from the registry, or "" if it
+// is unknown.
+func (s *vendorService) runID(ctx context.Context, model string) string {
+	models, err := s.registry.Models(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, m := range models {
+		if m.ModelType == model {
+			return m.RunID
+		}
+	}
+	return ""
 }
 
 // Predict calls the vendor predict endpoint and maps the response.
@@ -93,17 +324,84 @@ func (s *vendorService) Predict(ctx context.Context, req PredictRequest) (Predic
 
 	ensureDecimal(req.Features)
 
-	vendorReq := clients.PredictRequest{
-		Model:    req.Model,
-		Features: req.Features,
+	var resp PredictResponse
+	if req.Model == EnsembleModel {
+		ensembleResp, err := s.predictEnsemble(ctx, req.Features)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("ensemble predict request failed")
+			return PredictResponse{}, err
+		}
+		resp = ensembleResp
+	} else {
+		vendorReq := clients.PredictRequest{
+			Model:    req.Model,
+			Features: req.Features,
+			Explain:  req.Explain,
+		}
+
+		vendorResp, cached, err := s.predictModel(ctx, s.client, vendorReq)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("predict request failed")
+			return PredictResponse{}, err
+		}
+		resp = mapPredictResponse(vendorResp)
+		resp.Meta.Cached = cached
+		if req.Explain {
+			resp.Result.Explanation = s.explainPrediction(ctx, req, vendorResp)
+		}
+	}
+
+	if s.shadowModel != "" && s.shadowModel != req.Model {
+		resp.shadow = s.predictShadow(ctx, req.Features)
 	}
 
-	vendorResp, err := s.client.Predict(ctx, vendorReq)
-	if err != nil {
-		s.logger.Error().Err(err).Msg("predict request failed")
-		return PredictResponse{}, err
+	s.logger.Info().
+		Str("model", resp.Meta.ModelName).
+		Int("prediction", resp.Result.Prediction).
+		Float64("score", resp.Result.Score).
+		Msg("predict response")
+
+	return resp, nil
+}
+
+// predictShadow scores features with the challenger model in the background.
+// It is detached from ctx cancellation so that it can outlive the request. It
+// returns nil, and the prediction is not shadowed, if the challenger calls
+// are all busy.
+func (s *vendorService) predictShadow(ctx context.Context, features map[string]interface{}) <-chan ShadowResult {
+	select {
+	case s.shadowSem <- struct{}{}:
+	default:
+		shadowPredictionsDropped.Inc()
+		return nil
 	}
 
+	shadowFeatures := make(map[string]interface{}, len(features))
+	for k, v := range features {
+		shadowFeatures[k] = v
+	}
+
+	ch := make(chan ShadowResult, 1)
+	go func() {
+		defer func() { <-s.shadowSem }()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.shadowTimeout)
+		defer cancel()
+
+		result := ShadowResult{Model: s.shadowModel}
+		vendorResp, _, err := s.predictModel(ctx, s.shadowClient, clients.PredictRequest{Model: s.shadowModel, Features: shadowFeatures})
+		if err != nil {
+			s.logger.Warn().Err(err).Str("model", s.shadowModel).Msg("shadow predict request failed")
+			result.Error = err.Error()
+		} else {
+			resp := mapPredictResponse(vendorResp)
+			result.Response = &resp
+		}
+		ch <- result
+	}()
+	return ch
+}
+
+func mapPredictResponse(vendorResp *clients.PredictResponse) PredictResponse {
 	var resp PredictResponse
 	resp.Meta.ModelName = vendorResp.Meta.ModelName
 	resp.Meta.RunID = vendorResp.Meta.RunID
@@ -113,14 +411,7 @@ func (s *vendorService) Predict(ctx context.Context, req PredictRequest) (Predic
 	resp.Result.Prediction = vendorResp.Result.Prediction
 	resp.Result.Score = vendorResp.Result.Score
 	resp.Result.Threshold = vendorResp.Result.Threshold
-
-	s.logger.Info().
-		Str("model", resp.Meta.ModelName).
-		Int("prediction", resp.Result.Prediction).
-		Float64("score", resp.Result.Score).
-		Msg("predict response")
-
-	return resp, nil
+	return resp
 }
 
 // ensureDecimal ensures that the amount field in features has a decimal part
@@ -147,3 +438,18 @@ func ensureDecimal(features map[string]interface{}) {
 		}
 	}
 }
+
+// MaskSensitiveFeatures returns a copy of features with personal data redacted
+// so that it can be safely persisted in the inference log.
+func MaskSensitiveFeatures(data map[string]interface{}) map[string]interface{} {
+	masked := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		lower := strings.ToLower(k)
+		if strings.Contains(lower, "name") || strings.Contains(lower, "email") || strings.Contains(lower, "phone") || strings.Contains(lower, "password") {
+			masked[k] = "[REDACTED]"
+		} else {
+			masked[k] = v
+		}
+	}
+	return masked
+}
@@ -2,9 +2,11 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/jules-labs/go-api-prod-template/internal/clients"
 	"github.com/rs/zerolog"
@@ -70,3 +72,82 @@ func TestVendorService_Predict(t *testing.T) {
 	assert.Equal(t, 0.5, resp.Result.Threshold)
 	assert.Equal(t, "121e6c15715c420b8f0b9139d75fd30d", resp.Meta.RunID)
 }
+
+func TestVendorService_PredictShadow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body clients.PredictRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if body.Model == "xgboost" {
+			_, _ = w.Write([]byte(`{"meta":{"model_name":"FraudDetector-xgboost","run_id":"challenger"},"result":{"prediction":0,"score":0.2,"threshold":0.5}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"meta":{"model_name":"FraudDetector-logistic_regression","run_id":"champion"},"result":{"prediction":1,"score":0.9,"threshold":0.5}}`))
+	}))
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	shadowClient := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop(), clients.WithCircuitBreakerName("shadow-test"))
+	svc := NewVendorService(client, zerolog.Nop(), WithShadowModel("xgboost", shadowClient, time.Second, 1))
+
+	resp, err := svc.Predict(context.Background(), PredictRequest{
+		Model:    "logreg",
+		Features: map[string]interface{}{"amount": 10.5},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "champion", resp.Meta.RunID)
+
+	ch := resp.Shadow()
+	require.NotNil(t, ch)
+	shadow := <-ch
+	assert.Equal(t, "xgboost", shadow.Model)
+	require.NotNil(t, shadow.Response)
+	assert.Equal(t, "challenger", shadow.Response.Meta.RunID)
+	assert.Equal(t, 0.2, shadow.Response.Result.Score)
+
+	// The challenger is not scored when it is the requested model.
+	resp, err = svc.Predict(context.Background(), PredictRequest{
+		Model:    "xgboost",
+		Features: map[string]interface{}{"amount": 10.5},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp.Shadow())
+}
+
+func TestVendorService_PredictShadowDropsWhenBusy(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body clients.PredictRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if body.Model == "xgboost" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"meta":{"model_name":"FraudDetector-logistic_regression"},"result":{"prediction":0,"score":0.2,"threshold":0.5}}`))
+	}))
+	defer server.Close()
+
+	client := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop())
+	shadowClient := clients.NewThirdPartyClient(server.URL, "", zerolog.Nop(), clients.WithCircuitBreakerName("shadow-busy-test"))
+	svc := NewVendorService(client, zerolog.Nop(), WithShadowModel("xgboost", shadowClient, time.Second, 1))
+	predict := func() PredictResponse {
+		t.Helper()
+		resp, err := svc.Predict(context.Background(), PredictRequest{Model: "logreg", Features: map[string]interface{}{"amount": 10.5}})
+		require.NoError(t, err)
+		return resp
+	}
+
+	// The only challenger call is busy, so the second prediction is not
+	// shadowed.
+	first := predict()
+	require.NotNil(t, first.Shadow())
+	assert.Nil(t, predict().Shadow())
+
+	close(release)
+	<-first.Shadow()
+	require.Eventually(t, func() bool {
+		return predict().Shadow() != nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/rs/zerolog"
+)
+
+// WebhookEvent is the type of an event sent to webhook endpoints.
+type WebhookEvent string
+
+const (
+	WebhookPredictionFlagged WebhookEvent = "prediction.flagged"
+	WebhookCaseOpened        WebhookEvent = "case.opened"
+	WebhookCaseAssigned      WebhookEvent = "case.assigned"
+	WebhookCaseResolved      WebhookEvent = "case.resolved"
+)
+
+// Delivery states of the webhook outbox.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+var (
+	// ErrWebhookNotFound is returned when the endpoint or delivery does not
+	// exist or belongs to another user.
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrWebhookForbidden = errors.New("not allowed to register webhooks for this API key")
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+	// ErrWebhookInFlight is returned when redelivering a delivery that a
+	// dispatcher is sending.
+	ErrWebhookInFlight = errors.New("webhook delivery is being sent")
+)
+
+// WebhookEndpoint receives the events of one API key. Secret signs the
+// requests and is only returned when the endpoint is created.
+type WebhookEndpoint struct {
+	ID        int64     `json:"id"`
+	APIKeyID  int64     `json:"api_key_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event queued for one endpoint.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	EndpointID     int64           `json:"endpoint_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      WebhookEvent    `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int32          `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// webhookEnvelope is the body of every webhook request.
+type webhookEnvelope struct {
+	ID        uuid.UUID    `json:"id"`
+	Type      WebhookEvent `json:"type"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      interface{}  `json:"data"`
+}
+
+// WebhookSettings configures delivery. Failed deliveries are retried after
+// RetryBase, doubling up to RetryMax, and are dead after MaxAttempts.
+type WebhookSettings struct {
+	MaxAttempts int
+	RetryBase   time.Duration
+	RetryMax    time.Duration
+	BatchSize   int32
+	// Lease is how long a claimed delivery is hidden from other dispatchers.
+	Lease time.Duration
+	// Concurrency is how many deliveries of a batch are sent at once.
+	Concurrency int
+	// Timeout is the timeout of one delivery, used to size batches so that
+	// they are sent before their lease expires.
+	Timeout time.Duration
+}
+
+type WebhookService interface {
+	CreateEndpoint(ctx context.Context, userID, apiKeyID int64, endpointURL string) (WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context, userID int64) ([]WebhookEndpoint, error)
+	DeleteEndpoint(ctx context.Context, userID, id int64) error
+	// ListDeliveries returns the deliveries of an endpoint created in
+	// [from, to), in every status if status is empty.
+	ListDeliveries(ctx context.Context, userID, endpointID int64, from, to time.Time, status string) ([]WebhookDelivery, error)
+	// Redeliver queues a delivery again, including dead and delivered ones.
+	Redeliver(ctx context.Context, userID, id int64) (WebhookDelivery, error)
+	// Enqueue adds event to the outbox of every endpoint of apiKeyID.
+	Enqueue(ctx context.Context, apiKeyID int64, event WebhookEvent, data interface{}) error
+	// Dispatch sends the deliveries due at now and returns how many it tried.
+	Dispatch(ctx context.Context, now time.Time) (int, error)
+}
+
+type webhookService struct {
+	webhookRepo repo.WebhookRepository
+	apiKeyRepo  repo.APIKeyRepository
+	client      *clients.WebhookClient
+	settings    WebhookSettings
+	logger      zerolog.Logger
+}
+
+func NewWebhookService(webhookRepo repo.WebhookRepository, apiKeyRepo repo.APIKeyRepository, client *clients.WebhookClient, settings WebhookSettings, logger zerolog.Logger) WebhookService {
+	if settings.Concurrency < 1 {
+		settings.Concurrency = 1
+	}
+	if limit := maxWebhookBatch(settings); settings.BatchSize > limit {
+		logger.Warn().Int32("batch_size", settings.BatchSize).Int32("max", limit).Msg("webhook batch size cut down to fit the lease")
+		settings.BatchSize = limit
+	}
+	return &webhookService{
+		webhookRepo: webhookRepo,
+		apiKeyRepo:  apiKeyRepo,
+		client:      client,
+		settings:    settings,
+		logger:      logger,
+	}
+}
+
+func (s *webhookService) CreateEndpoint(ctx context.Context, userID, apiKeyID int64, endpointURL string) (WebhookEndpoint, error) {
+	if err := clients.ValidateWebhookURL(endpointURL); err != nil {
+		return WebhookEndpoint{}, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	keys, err := s.apiKeyRepo.ListAPIKeysByUser(ctx, userID)
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+	owned := false
+	for _, k := range keys {
+		if k.ID == apiKeyID {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		return WebhookEndpoint{}, ErrWebhookForbidden
+	}
+
+	secret, err := generateRandomKey(32)
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+
+	row, err := s.webhookRepo.CreateWebhookEndpoint(ctx, db.CreateWebhookEndpointParams{
+		UserID:   userID,
+		ApiKeyID: apiKeyID,
+		Url:      endpointURL,
+		Secret:   secret,
+	})
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+
+	endpoint := toWebhookEndpoint(row)
+	endpoint.Secret = row.Secret
+	return endpoint, nil
+}
+
+func (s *webhookService) ListEndpoints(ctx context.Context, userID int64) ([]WebhookEndpoint, error) {
+	rows, err := s.webhookRepo.ListWebhookEndpoints(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]WebhookEndpoint, len(rows))
+	for i, row := range rows {
+		endpoints[i] = toWebhookEndpoint(row)
+	}
+	return endpoints, nil
+}
+
+func (s *webhookService) DeleteEndpoint(ctx context.Context, userID, id int64) error {
+	return s.webhookRepo.DeleteWebhookEndpoint(ctx, id, userID)
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, userID, endpointID int64, from, to time.Time, status string) ([]WebhookDelivery, error) {
+	switch status {
+	case "", WebhookDeliveryPending, WebhookDeliveryDelivered, WebhookDeliveryDead:
+	default:
+		return nil, fmt.Errorf("%w: status must be one of [pending delivered dead]", ErrInvalidWebhook)
+	}
+
+	rows, err := s.webhookRepo.ListWebhookDeliveries(ctx, endpointID, userID, from, to, status)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]WebhookDelivery, len(rows))
+	for i, row := range rows {
+		deliveries[i] = toWebhookDelivery(row)
+	}
+	return deliveries, nil
+}
+
+// Redeliver leaves deliveries under an active lease alone: the dispatcher that
+// holds it would send them a second time.
+func (s *webhookService) Redeliver(ctx context.Context, userID, id int64) (WebhookDelivery, error) {
+	row, err := s.webhookRepo.RedeliverWebhookDelivery(ctx, id, userID)
+	if err == nil {
+		return toWebhookDelivery(row), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return WebhookDelivery{}, err
+	}
+
+	// The delivery exists, so it was skipped for its lease.
+	if _, err := s.webhookRepo.GetWebhookDeliveryLease(ctx, id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WebhookDelivery{}, ErrWebhookNotFound
+		}
+		return WebhookDelivery{}, err
+	}
+	return WebhookDelivery{}, ErrWebhookInFlight
+}
+
+func (s *webhookService) Enqueue(ctx context.Context, apiKeyID int64, event WebhookEvent, data interface{}) error {
+	envelope := webhookEnvelope{
+		ID:        uuid.New(),
+		Type:      event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return s.webhookRepo.EnqueueWebhookDeliveries(ctx, db.EnqueueWebhookDeliveriesParams{
+		EventID:   envelope.ID,
+		EventType: string(event),
+		Payload:   payload,
+		ApiKeyID:  apiKeyID,
+	})
+}
+
+// Dispatch keeps claiming batches until fewer than a full batch is due. The
+// deliveries of a batch are sent Concurrency at a time.
+func (s *webhookService) Dispatch(ctx context.Context, now time.Time) (int, error) {
+	var attempted int
+	for {
+		rows, err := s.webhookRepo.ClaimWebhookDeliveries(ctx, now.Add(s.settings.Lease), s.settings.BatchSize)
+		if err != nil {
+			return attempted, err
+		}
+
+		n, err := s.deliverBatch(ctx, rows)
+		attempted += n
+		if err != nil {
+			return attempted, err
+		}
+
+		if int32(len(rows)) < s.settings.BatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// deliverBatch sends rows and returns how many it tried, stopping at the first
+// outcome that could not be stored. Unsent deliveries are picked up again once
+// their lease expires.
+func (s *webhookService) deliverBatch(ctx context.Context, rows []db.ClaimWebhookDeliveriesRow) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		attempted int
+		firstErr  error
+	)
+	sem := make(chan struct{}, s.settings.Concurrency)
+	for _, row := range rows {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(row db.ClaimWebhookDeliveriesRow) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := s.deliver(ctx, row)
+			mu.Lock()
+			defer mu.Unlock()
+			attempted++
+			if err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}(row)
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return attempted, firstErr
+}
+
+// deliver sends one delivery and records the outcome. It only returns an
+// error if the outcome could not be stored.
+func (s *webhookService) deliver(ctx context.Context, row db.ClaimWebhookDeliveriesRow) error {
+	status, err := s.client.Deliver(ctx, row.Url, row.Secret, row.ID, row.EventType, row.Payload)
+	if err == nil {
+		return s.webhookRepo.MarkWebhookDelivered(ctx, row.ID, status)
+	}
+
+	attempts := int(row.Attempts) + 1
+	params := db.ScheduleWebhookRetryParams{
+		ID:             row.ID,
+		Status:         WebhookDeliveryPending,
+		NextAttemptAt:  time.Now().Add(webhookBackoff(s.settings.RetryBase, s.settings.RetryMax, attempts)),
+		LastStatusCode: sql.NullInt32{Int32: int32(status), Valid: status != 0},
+		LastError:      sql.NullString{String: err.Error(), Valid: true},
+	}
+	if attempts >= s.settings.MaxAttempts {
+		params.Status = WebhookDeliveryDead
+		s.logger.Warn().Err(err).Int64("delivery_id", row.ID).Int("attempts", attempts).Msg("webhook delivery is dead")
+	}
+	return s.webhookRepo.ScheduleWebhookRetry(ctx, params)
+}
+
+// maxWebhookBatch is the largest batch that is sent in half the lease when
+// every delivery takes the full timeout.
+func maxWebhookBatch(settings WebhookSettings) int32 {
+	if settings.Timeout <= 0 || settings.Lease <= 0 {
+		return settings.BatchSize
+	}
+	rounds := int32(settings.Lease / 2 / settings.Timeout)
+	if rounds < 1 {
+		rounds = 1
+	}
+	return rounds * int32(settings.Concurrency)
+}
+
+// webhookBackoff is the delay before the retry that follows the given number
+// of attempts: base, 2*base, 4*base, ... capped at max.
+func webhookBackoff(base, max time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+func toWebhookEndpoint(row db.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:        row.ID,
+		APIKeyID:  row.ApiKeyID,
+		URL:       row.Url,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+func toWebhookDelivery(row db.WebhookDelivery) WebhookDelivery {
+	d := WebhookDelivery{
+		ID:            row.ID,
+		EndpointID:    row.EndpointID,
+		EventID:       row.EventID,
+		EventType:     WebhookEvent(row.EventType),
+		Payload:       row.Payload,
+		Status:        row.Status,
+		Attempts:      row.Attempts,
+		NextAttemptAt: row.NextAttemptAt,
+		LastError:     row.LastError.String,
+		CreatedAt:     row.CreatedAt,
+	}
+	if row.LastStatusCode.Valid {
+		d.LastStatusCode = &row.LastStatusCode.Int32
+	}
+	if row.DeliveredAt.Valid {
+		d.DeliveredAt = &row.DeliveredAt.Time
+	}
+	return d
+}
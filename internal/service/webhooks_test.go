@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/clients"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryWebhookRepo leases the pending deliveries that are due at now.
+type memoryWebhookRepo struct {
+	mu         sync.Mutex
+	endpoints  []db.WebhookEndpoint
+	deliveries []db.WebhookDelivery
+	now        time.Time
+}
+
+func (r *memoryWebhookRepo) CreateWebhookEndpoint(ctx context.Context, arg db.CreateWebhookEndpointParams) (db.WebhookEndpoint, error) {
+	e := db.WebhookEndpoint{ID: int64(len(r.endpoints) + 1), UserID: arg.UserID, ApiKeyID: arg.ApiKeyID, Url: arg.Url, Secret: arg.Secret}
+	r.endpoints = append(r.endpoints, e)
+	return e, nil
+}
+
+func (r *memoryWebhookRepo) ListWebhookEndpoints(ctx context.Context, userID int64) ([]db.WebhookEndpoint, error) {
+	var rows []db.WebhookEndpoint
+	for _, e := range r.endpoints {
+		if e.UserID == userID {
+			rows = append(rows, e)
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryWebhookRepo) DeleteWebhookEndpoint(ctx context.Context, id, userID int64) error {
+	return nil
+}
+
+func (r *memoryWebhookRepo) EnqueueWebhookDeliveries(ctx context.Context, arg db.EnqueueWebhookDeliveriesParams) error {
+	for _, e := range r.endpoints {
+		if e.ApiKeyID == arg.ApiKeyID {
+			r.deliveries = append(r.deliveries, db.WebhookDelivery{
+				ID:            int64(len(r.deliveries) + 1),
+				EndpointID:    e.ID,
+				EventID:       arg.EventID,
+				EventType:     arg.EventType,
+				Payload:       arg.Payload,
+				Status:        WebhookDeliveryPending,
+				NextAttemptAt: r.now,
+			})
+		}
+	}
+	return nil
+}
+
+func (r *memoryWebhookRepo) endpoint(id int64) db.WebhookEndpoint {
+	for _, e := range r.endpoints {
+		if e.ID == id {
+			return e
+		}
+	}
+	return db.WebhookEndpoint{}
+}
+
+func (r *memoryWebhookRepo) ClaimWebhookDeliveries(ctx context.Context, leaseUntil time.Time, maxRows int32) ([]db.ClaimWebhookDeliveriesRow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rows []db.ClaimWebhookDeliveriesRow
+	for i := range r.deliveries {
+		d := &r.deliveries[i]
+		if d.Status == WebhookDeliveryPending && !d.NextAttemptAt.After(r.now) && int32(len(rows)) < maxRows {
+			d.NextAttemptAt = leaseUntil
+			d.LeasedUntil = sql.NullTime{Time: leaseUntil, Valid: true}
+			e := r.endpoint(d.EndpointID)
+			rows = append(rows, db.ClaimWebhookDeliveriesRow{
+				ID:        d.ID,
+				EventID:   d.EventID,
+				EventType: d.EventType,
+				Payload:   d.Payload,
+				Attempts:  d.Attempts,
+				Url:       e.Url,
+				Secret:    e.Secret,
+			})
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryWebhookRepo) MarkWebhookDelivered(ctx context.Context, id int64, statusCode int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := &r.deliveries[id-1]
+	d.LeasedUntil = sql.NullTime{}
+	d.Status = WebhookDeliveryDelivered
+	d.Attempts++
+	d.LastStatusCode = sql.NullInt32{Int32: int32(statusCode), Valid: true}
+	return nil
+}
+
+func (r *memoryWebhookRepo) ScheduleWebhookRetry(ctx context.Context, arg db.ScheduleWebhookRetryParams) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := &r.deliveries[arg.ID-1]
+	d.LeasedUntil = sql.NullTime{}
+	d.Status = arg.Status
+	d.Attempts++
+	d.NextAttemptAt = arg.NextAttemptAt
+	d.LastStatusCode = arg.LastStatusCode
+	d.LastError = arg.LastError
+	return nil
+}
+
+func (r *memoryWebhookRepo) ListWebhookDeliveries(ctx context.Context, endpointID, userID int64, from, to time.Time, status string) ([]db.WebhookDelivery, error) {
+	var rows []db.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d.EndpointID == endpointID && r.endpoint(endpointID).UserID == userID && (status == "" || d.Status == status) {
+			rows = append(rows, d)
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryWebhookRepo) RedeliverWebhookDelivery(ctx context.Context, id, userID int64) (db.WebhookDelivery, error) {
+	if id < 1 || id > int64(len(r.deliveries)) || r.endpoint(r.deliveries[id-1].EndpointID).UserID != userID {
+		return db.WebhookDelivery{}, sql.ErrNoRows
+	}
+	d := &r.deliveries[id-1]
+	if d.LeasedUntil.Valid && d.LeasedUntil.Time.After(r.now) {
+		return db.WebhookDelivery{}, sql.ErrNoRows
+	}
+	d.Status = WebhookDeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = r.now
+	return *d, nil
+}
+
+func (r *memoryWebhookRepo) GetWebhookDeliveryLease(ctx context.Context, id, userID int64) (sql.NullTime, error) {
+	if id < 1 || id > int64(len(r.deliveries)) || r.endpoint(r.deliveries[id-1].EndpointID).UserID != userID {
+		return sql.NullTime{}, sql.ErrNoRows
+	}
+	return r.deliveries[id-1].LeasedUntil, nil
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhookBackoff(30*time.Second, time.Hour, 1))
+	assert.Equal(t, 60*time.Second, webhookBackoff(30*time.Second, time.Hour, 2))
+	assert.Equal(t, 4*time.Minute, webhookBackoff(30*time.Second, time.Hour, 4))
+	assert.Equal(t, time.Hour, webhookBackoff(30*time.Second, time.Hour, 20))
+}
+
+func TestMaxWebhookBatch(t *testing.T) {
+	settings := WebhookSettings{BatchSize: 100, Lease: time.Minute, Timeout: 5 * time.Second, Concurrency: 10}
+	assert.Equal(t, int32(60), maxWebhookBatch(settings))
+
+	// A timeout longer than half the lease still sends one round per batch.
+	settings.Timeout = time.Minute
+	assert.Equal(t, int32(10), maxWebhookBatch(settings))
+
+	svc := NewWebhookService(&memoryWebhookRepo{}, nil, nil, WebhookSettings{BatchSize: 100, Lease: time.Minute, Timeout: 5 * time.Second}, zerolog.Nop())
+	assert.Equal(t, int32(6), svc.(*webhookService).settings.BatchSize)
+}
+
+func TestWebhookService_CreateEndpoint(t *testing.T) {
+	repo := &memoryWebhookRepo{}
+	svc := NewWebhookService(repo, &memoryAPIKeyRepo{keys: map[int64]int64{7: 1}}, nil, WebhookSettings{}, zerolog.Nop())
+	ctx := context.Background()
+
+	_, err := svc.CreateEndpoint(ctx, 1, 7, "ftp://example.com/hook")
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+	// Only https endpoints on public addresses are accepted.
+	for _, endpoint := range []string{"http://example.com/hook", "https://169.254.169.254/hook", "https://10.0.0.5/hook"} {
+		_, err = svc.CreateEndpoint(ctx, 1, 7, endpoint)
+		assert.ErrorIs(t, err, ErrInvalidWebhook, endpoint)
+	}
+	_, err = svc.CreateEndpoint(ctx, 2, 7, "https://example.com/hook")
+	assert.ErrorIs(t, err, ErrWebhookForbidden)
+
+	endpoint, err := svc.CreateEndpoint(ctx, 1, 7, "https://example.com/hook")
+	require.NoError(t, err)
+	assert.NotEmpty(t, endpoint.Secret)
+
+	// The secret is not returned again.
+	endpoints, err := svc.ListEndpoints(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	assert.Empty(t, endpoints[0].Secret)
+}
+
+func TestWebhookService_Dispatch(t *testing.T) {
+	failures := 0
+	var received webhookEnvelope
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	repo := &memoryWebhookRepo{now: now}
+	client := clients.NewWebhookClient(time.Second, zerolog.Nop(), clients.WithInsecureWebhookTargets())
+	svc := NewWebhookService(repo, &memoryAPIKeyRepo{keys: map[int64]int64{7: 1}}, client, WebhookSettings{
+		MaxAttempts: 2,
+		RetryBase:   time.Minute,
+		RetryMax:    time.Hour,
+		BatchSize:   10,
+		Lease:       time.Minute,
+	}, zerolog.Nop())
+	ctx := context.Background()
+
+	// The test server is plain http on loopback, which CreateEndpoint refuses.
+	endpoint, err := repo.CreateWebhookEndpoint(ctx, db.CreateWebhookEndpointParams{UserID: 1, ApiKeyID: 7, Url: server.URL, Secret: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, svc.Enqueue(ctx, 7, WebhookCaseOpened, map[string]int{"case_id": 3}))
+	// Events of other API keys are not delivered to the endpoint.
+	require.NoError(t, svc.Enqueue(ctx, 8, WebhookCaseOpened, map[string]int{"case_id": 4}))
+
+	// The first failure is retried after the base delay.
+	failures = 2
+	n, err := svc.Dispatch(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	d := repo.deliveries[0]
+	assert.Equal(t, WebhookDeliveryPending, d.Status)
+	assert.Equal(t, int32(http.StatusServiceUnavailable), d.LastStatusCode.Int32)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), d.NextAttemptAt, 5*time.Second)
+
+	// Nothing is due before then.
+	n, err = svc.Dispatch(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// The second failure exhausts the attempts.
+	repo.now = d.NextAttemptAt
+	_, err = svc.Dispatch(ctx, repo.now)
+	require.NoError(t, err)
+	dead, err := svc.ListDeliveries(ctx, 1, endpoint.ID, now, now, WebhookDeliveryDead)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, int32(2), dead[0].Attempts)
+
+	// Redelivery resets the attempts and the next dispatch succeeds.
+	_, err = svc.Redeliver(ctx, 2, dead[0].ID)
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+	_, err = svc.Redeliver(ctx, 1, dead[0].ID)
+	require.NoError(t, err)
+	_, err = svc.Dispatch(ctx, repo.now)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookDeliveryDelivered, repo.deliveries[0].Status)
+	assert.Equal(t, WebhookCaseOpened, received.Type)
+	assert.Equal(t, repo.deliveries[0].EventID, received.ID)
+
+	_, err = svc.ListDeliveries(ctx, 1, endpoint.ID, now, now, "failed")
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+}
+
+func TestWebhookService_DispatchConcurrently(t *testing.T) {
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	repo := &memoryWebhookRepo{now: now}
+	client := clients.NewWebhookClient(time.Second, zerolog.Nop(), clients.WithInsecureWebhookTargets())
+	svc := NewWebhookService(repo, &memoryAPIKeyRepo{keys: map[int64]int64{7: 1}}, client, WebhookSettings{
+		MaxAttempts: 2,
+		RetryBase:   time.Minute,
+		RetryMax:    time.Hour,
+		BatchSize:   8,
+		Lease:       time.Minute,
+		Concurrency: 4,
+		Timeout:     time.Second,
+	}, zerolog.Nop())
+	ctx := context.Background()
+
+	_, err := repo.CreateWebhookEndpoint(ctx, db.CreateWebhookEndpointParams{UserID: 1, ApiKeyID: 7, Url: server.URL, Secret: "secret"})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, svc.Enqueue(ctx, 7, WebhookCaseOpened, map[string]int{"case_id": i}))
+	}
+
+	n, err := svc.Dispatch(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&peak))
+	for _, d := range repo.deliveries {
+		assert.Equal(t, WebhookDeliveryDelivered, d.Status)
+		assert.False(t, d.LeasedUntil.Valid)
+	}
+}
+
+func TestWebhookService_RedeliverSkipsLeasedDeliveries(t *testing.T) {
+	now := time.Now()
+	repo := &memoryWebhookRepo{now: now}
+	svc := NewWebhookService(repo, &memoryAPIKeyRepo{keys: map[int64]int64{7: 1}}, nil, WebhookSettings{BatchSize: 10, Lease: time.Minute}, zerolog.Nop())
+	ctx := context.Background()
+
+	_, err := repo.CreateWebhookEndpoint(ctx, db.CreateWebhookEndpointParams{UserID: 1, ApiKeyID: 7, Url: "https://example.com/hook", Secret: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, svc.Enqueue(ctx, 7, WebhookCaseOpened, map[string]int{"case_id": 3}))
+
+	// A dispatcher claims the delivery and is sending it.
+	rows, err := repo.ClaimWebhookDeliveries(ctx, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+
+	_, err = svc.Redeliver(ctx, 1, rows[0].ID)
+	assert.ErrorIs(t, err, ErrWebhookInFlight)
+	_, err = svc.Redeliver(ctx, 1, 99)
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+
+	// Once the lease has expired the delivery can be queued again.
+	repo.now = now.Add(2 * time.Minute)
+	d, err := svc.Redeliver(ctx, 1, rows[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookDeliveryPending, d.Status)
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/repo"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+	"github.com/rs/zerolog"
+)
+
+const maxBatchBodyBytes = 8 << 20 // 8MB
+
+// batchPredictTimeout bounds the scoring of a batch so that the response is
+// written before the server write timeout. Items not scored by then are
+// reported with status 504.
+const batchPredictTimeout = 8 * time.Second
+
+type batchPredictRequest struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+type batchPredictItem struct {
+	Index    int                      `json:"index"`
+	Status   int                      `json:"status"`
+	Response *service.PredictResponse `json:"response,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+	Problems []service.FeatureProblem `json:"problems,omitempty"`
+}
+
+type batchPredictSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+type batchPredictResponse struct {
+	Results []batchPredictItem  `json:"results"`
+	Summary batchPredictSummary `json:"summary"`
+}
+
+// BatchPredictHandler scores every item of a batch through the vendor service
+// with at most concurrency calls in flight. Each item is validated, logged and
+// reported on its own, and the batch is charged against limit once per item,
+// or explainCost times per explained item. Batches costing more than the
+// caller's limit per window could never be charged and are rejected as
+// invalid.
+func BatchPredictHandler(scoringSvc service.ScoringService, caseSvc service.CaseService, logRepo repo.InferenceLogRepository, limit *app_middleware.RateLimit, explainCost, maxItems, concurrency int, logger zerolog.Logger) http.HandlerFunc {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		bodyReader := http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+		bodyBytes, err := io.ReadAll(bodyReader)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				response.RespondWithError(w, http.StatusRequestEntityTooLarge, "payload too large")
+				return
+			}
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		var req batchPredictRequest
+		if err := json.Unmarshal(bodyBytes, &req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if len(req.Items) == 0 {
+			response.RespondWithError(w, http.StatusBadRequest, "validation failed: items is required")
+			return
+		}
+		if maxItems > 0 && len(req.Items) > maxItems {
+			response.RespondWithError(w, http.StatusBadRequest, "validation failed: items must contain at most "+strconv.Itoa(maxItems)+" entries")
+			return
+		}
+
+		if limit != nil {
+			units := len(req.Items)
+			for _, item := range req.Items {
+				if explainCost > 1 && explainRequested(item) {
+					units += explainCost - 1
+				}
+			}
+			if perWindow := limit.Limit(identity); units > perWindow {
+				if units == len(req.Items) {
+					response.RespondWithError(w, http.StatusBadRequest, "validation failed: items must contain at most "+strconv.Itoa(perWindow)+" entries, the rate limit of the caller")
+				} else {
+					response.RespondWithError(w, http.StatusBadRequest, "validation failed: items cost "+strconv.Itoa(units)+" units with their explanations, more than the rate limit of the caller ("+strconv.Itoa(perWindow)+")")
+				}
+				return
+			}
+			if !limit.Allow(w, r, units) {
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), batchPredictTimeout)
+		defer cancel()
+
+		results := make([]batchPredictItem, len(req.Items))
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+
+		for i, item := range req.Items {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				results[i] = batchPredictItem{Index: i, Status: http.StatusGatewayTimeout, Error: "batch deadline exceeded"}
+				continue
+			}
+
+			wg.Add(1)
+			go func(i int, item json.RawMessage) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				outcome := predictPayload(ctx, scoringSvc, caseSvc, logRepo, identity, item, time.Now(), logger)
+				results[i] = batchPredictItem{Index: i, Status: outcome.status}
+				if outcome.status == http.StatusOK {
+					resp := outcome.resp
+					results[i].Response = &resp
+				} else {
+					results[i].Error = outcome.errMsg
+					results[i].Problems = outcome.problems
+				}
+			}(i, item)
+		}
+		wg.Wait()
+
+		summary := batchPredictSummary{Total: len(results)}
+		for _, res := range results {
+			if res.Status == http.StatusOK {
+				summary.Succeeded++
+			} else {
+				summary.Failed++
+			}
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, batchPredictResponse{Results: results, Summary: summary})
+	}
+}
@@ -0,0 +1,252 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+type stubVendorService struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *stubVendorService) Ping(ctx context.Context) (string, error) {
+	return "pong", nil
+}
+
+func (s *stubVendorService) ListModels(ctx context.Context) ([]service.Model, error) {
+	return nil, nil
+}
+
+func (s *stubVendorService) ValidateModel(ctx context.Context, model string) error {
+	if model == "unknown" {
+		return &service.UnknownModelError{Model: model, Allowed: []string{"ensemble", "logreg"}}
+	}
+	return nil
+}
+
+func (s *stubVendorService) ValidateFeatures(ctx context.Context, model string, features map[string]interface{}) error {
+	if _, ok := features["amount"]; !ok {
+		return &service.FeatureValidationError{Model: model, Problems: []service.FeatureProblem{
+			{Feature: "amount", Problem: service.FeatureMissing, Expected: "number"},
+		}}
+	}
+	return nil
+}
+
+func (s *stubVendorService) Predict(ctx context.Context, req service.PredictRequest) (service.PredictResponse, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+
+	if req.Features["merchant_type"] == "broken" {
+		return service.PredictResponse{}, errors.New("vendor API returned non-200 status")
+	}
+	if req.Features["merchant_type"] == "unavailable" {
+		return service.PredictResponse{}, context.DeadlineExceeded
+	}
+
+	var resp service.PredictResponse
+	resp.Meta.ModelName = req.Model
+	resp.Result.Score = 0.9
+	resp.Result.Prediction = 1
+	return resp, nil
+}
+
+type stubInferenceLogRepo struct {
+	mu   sync.Mutex
+	logs []db.CreateInferenceLogParams
+}
+
+func (s *stubInferenceLogRepo) CreateInferenceLog(ctx context.Context, arg db.CreateInferenceLogParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, arg)
+	return int64(len(s.logs)), nil
+}
+
+func (s *stubInferenceLogRepo) UpdateInferenceLogShadow(ctx context.Context, arg db.UpdateInferenceLogShadowParams) error {
+	return nil
+}
+
+func (s *stubInferenceLogRepo) AfterInferenceLogWritten(ctx context.Context, id int64, fn func(ctx context.Context)) {
+	fn(ctx)
+}
+
+func (s *stubInferenceLogRepo) ListShadowComparisons(ctx context.Context, userID int64, from, to time.Time) ([]db.ListShadowComparisonsRow, error) {
+	return nil, nil
+}
+
+func (s *stubInferenceLogRepo) GetInferenceLog(ctx context.Context, id, userID int64, apiKeyID *int64) (db.InferenceLog, error) {
+	return db.InferenceLog{}, sql.ErrNoRows
+}
+
+func (s *stubInferenceLogRepo) ListInferenceLogs(ctx context.Context, arg db.ListInferenceLogsParams) ([]db.InferenceLog, error) {
+	return nil, nil
+}
+
+func newBatchRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+	keyID := int64(7)
+	rate := 5
+	req := httptest.NewRequest(http.MethodPost, "/v1/fraud/predict/batch", strings.NewReader(body))
+	identity := app_middleware.Identity{UserID: 1, APIKeyID: &keyID, RateRPM: &rate}
+	return req.WithContext(app_middleware.WithIdentity(req.Context(), identity))
+}
+
+func TestBatchPredictHandler(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	vendor := &stubVendorService{}
+	logs := &stubInferenceLogRepo{}
+	limit := app_middleware.NewRateLimit(client, "/v1/fraud/predict", 5, time.Minute)
+	handler := BatchPredictHandler(service.NewScoringService(vendor, nil, nil, nil, zerolog.Nop()), nil, logs, limit, 0, 10, 2, zerolog.Nop())
+
+	body := `{"items":[
+		{"model":"logreg","features":{"transaction_id":1,"amount":10.5,"merchant_type":"grocery","device_type":"mobile"}},
+		{"model":"unknown","features":{"transaction_id":2,"amount":10.5,"merchant_type":"grocery","device_type":"mobile"}},
+		{"model":"xgboost","features":{"transaction_id":3,"amount":10.5,"merchant_type":"broken","device_type":"mobile"}}
+	]}`
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, body))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp batchPredictResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if len(resp.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(resp.Results))
+	}
+	wantStatus := []int{http.StatusOK, http.StatusBadRequest, http.StatusBadGateway}
+	for i, res := range resp.Results {
+		if res.Index != i {
+			t.Fatalf("result %d has index %d", i, res.Index)
+		}
+		if res.Status != wantStatus[i] {
+			t.Fatalf("result %d: expected status %d, got %d", i, wantStatus[i], res.Status)
+		}
+	}
+	if resp.Results[0].Response == nil || resp.Results[0].Response.Meta.ModelName != "logreg" {
+		t.Fatalf("expected first item to carry the vendor response")
+	}
+	if resp.Summary.Succeeded != 1 || resp.Summary.Failed != 2 {
+		t.Fatalf("unexpected summary: %+v", resp.Summary)
+	}
+	if vendor.calls != 2 {
+		t.Fatalf("expected 2 vendor calls, got %d", vendor.calls)
+	}
+	if len(logs.logs) != 3 {
+		t.Fatalf("expected 3 inference logs, got %d", len(logs.logs))
+	}
+	if got := rr.Header().Get("X-RateLimit-Remaining"); got != "2" {
+		t.Fatalf("expected 2 remaining requests, got %q", got)
+	}
+
+	// A batch larger than the remaining budget is rejected as a whole.
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, body))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rr.Code)
+	}
+	if vendor.calls != 2 {
+		t.Fatalf("expected rejected batch not to reach the vendor")
+	}
+}
+
+func TestBatchPredictHandler_LargerThanRateLimit(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	vendor := &stubVendorService{}
+	limit := app_middleware.NewRateLimit(client, "/v1/fraud/predict", 5, time.Minute)
+	handler := BatchPredictHandler(service.NewScoringService(vendor, nil, nil, nil, zerolog.Nop()), nil, &stubInferenceLogRepo{}, limit, 0, 10, 2, zerolog.Nop())
+
+	// The API key of newBatchRequest has a rate of 5 per window.
+	item := `{"model":"logreg","features":{"amount":10.5}}`
+	body := `{"items":[` + strings.Repeat(item+",", 5) + item + `]}`
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, body))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if vendor.calls != 0 {
+		t.Fatalf("expected rejected batch not to reach the vendor")
+	}
+
+	// The budget was not charged.
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, `{"items":[`+item+`]}`))
+	if got := rr.Header().Get("X-RateLimit-Remaining"); rr.Code != http.StatusOK || got != "4" {
+		t.Fatalf("expected status 200 with 4 remaining, got %d with %q", rr.Code, got)
+	}
+}
+
+func TestBatchPredictHandler_ExplainCost(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	vendor := &stubVendorService{}
+	limit := app_middleware.NewRateLimit(client, "/v1/fraud/predict", 5, time.Minute)
+	handler := BatchPredictHandler(service.NewScoringService(vendor, nil, nil, nil, zerolog.Nop()), nil, &stubInferenceLogRepo{}, limit, 3, 10, 2, zerolog.Nop())
+
+	item := `{"model":"logreg","features":{"amount":10.5}}`
+	explained := `{"model":"logreg","features":{"amount":10.5},"explain":true}`
+
+	// Two explained items cost 6 units, more than the rate of 5 per window.
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, `{"items":[`+explained+`,`+explained+`]}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// An explained item costs 3 units and a plain one 1.
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, `{"items":[`+item+`,`+explained+`]}`))
+	if got := rr.Header().Get("X-RateLimit-Remaining"); rr.Code != http.StatusOK || got != "1" {
+		t.Fatalf("expected status 200 with 1 remaining, got %d with %q", rr.Code, got)
+	}
+}
+
+func TestBatchPredictHandler_TooManyItems(t *testing.T) {
+	handler := BatchPredictHandler(nil, nil, &stubInferenceLogRepo{}, nil, 0, 1, 1, zerolog.Nop())
+
+	body := `{"items":[{"model":"logreg","features":{}},{"model":"logreg","features":{}}]}`
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, body))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,184 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+const defaultCaseWindow = 30 * 24 * time.Hour
+
+type assignCaseRequest struct {
+	Assignee string `json:"assignee"`
+}
+
+type caseCommentRequest struct {
+	Body string `json:"body"`
+}
+
+type resolveCaseRequest struct {
+	Resolution string `json:"resolution"`
+	Comment    string `json:"comment"`
+}
+
+func respondWithCaseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCase):
+		response.RespondWithError(w, http.StatusBadRequest, "validation failed: "+err.Error())
+	case errors.Is(err, service.ErrCaseNotFound):
+		response.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrCaseResolved):
+		response.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// caseRequest returns the caller and the case ID of the URL, or writes the
+// error response and returns false.
+func caseRequest(w http.ResponseWriter, r *http.Request) (app_middleware.Identity, int64, bool) {
+	identity, ok := app_middleware.IdentityFrom(r.Context())
+	if !ok {
+		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+		return app_middleware.Identity{}, 0, false
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid case id")
+		return app_middleware.Identity{}, 0, false
+	}
+	return identity, id, true
+}
+
+// ListCasesHandler lists the caller's cases created in the requested time
+// range, optionally filtered by status and assignee.
+func ListCasesHandler(caseSvc service.CaseService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		from, to, err := parseTimeRange(r, defaultCaseWindow)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		cases, err := caseSvc.List(r.Context(), identity.UserID, service.CaseFilter{
+			From:     from,
+			To:       to,
+			Status:   service.CaseStatus(r.URL.Query().Get("status")),
+			Assignee: r.URL.Query().Get("assignee"),
+		})
+		if err != nil {
+			respondWithCaseError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"from":  from,
+			"to":    to,
+			"cases": cases,
+		})
+	}
+}
+
+func GetCaseHandler(caseSvc service.CaseService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, id, ok := caseRequest(w, r)
+		if !ok {
+			return
+		}
+
+		c, err := caseSvc.Get(r.Context(), identity.UserID, id)
+		if err != nil {
+			respondWithCaseError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, c)
+	}
+}
+
+// AssignCaseHandler sets the analyst working on a case. An empty assignee
+// unassigns it.
+func AssignCaseHandler(caseSvc service.CaseService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, id, ok := caseRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req assignCaseRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		c, err := caseSvc.Assign(r.Context(), identity.UserID, id, req.Assignee)
+		if err != nil {
+			respondWithCaseError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, c)
+	}
+}
+
+func CommentCaseHandler(caseSvc service.CaseService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, id, ok := caseRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req caseCommentRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		comment, err := caseSvc.Comment(r.Context(), identity.UserID, id, req.Body)
+		if err != nil {
+			respondWithCaseError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusCreated, comment)
+	}
+}
+
+// ResolveCaseHandler closes a case as fraud or legit, which also labels the
+// prediction of the case.
+func ResolveCaseHandler(caseSvc service.CaseService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, id, ok := caseRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req resolveCaseRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		c, err := caseSvc.Resolve(r.Context(), identity.UserID, id, service.FeedbackLabel(req.Resolution), req.Comment)
+		if err != nil {
+			respondWithCaseError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, c)
+	}
+}
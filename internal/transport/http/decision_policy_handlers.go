@@ -0,0 +1,148 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+type createDecisionPolicyRequest struct {
+	Plan             string  `json:"plan"`
+	APIKeyID         *int64  `json:"api_key_id"`
+	ReviewThreshold  float64 `json:"review_threshold"`
+	DeclineThreshold float64 `json:"decline_threshold"`
+}
+
+type updateDecisionPolicyRequest struct {
+	ReviewThreshold  float64 `json:"review_threshold"`
+	DeclineThreshold float64 `json:"decline_threshold"`
+}
+
+func policyCaller(identity app_middleware.Identity) service.PolicyCaller {
+	return service.PolicyCaller{UserID: identity.UserID, Plan: identity.Plan}
+}
+
+func respondWithPolicyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidDecisionPolicy):
+		response.RespondWithError(w, http.StatusBadRequest, "validation failed: "+err.Error())
+	case errors.Is(err, service.ErrDecisionPolicyForbidden):
+		response.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrDecisionPolicyNotFound):
+		response.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrDecisionPolicyExists):
+		response.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func ListDecisionPoliciesHandler(policySvc service.DecisionPolicyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		policies, err := policySvc.List(r.Context(), policyCaller(identity))
+		if err != nil {
+			respondWithPolicyError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"policies": policies})
+	}
+}
+
+// CreateDecisionPolicyHandler creates a policy for either a plan (admins only)
+// or one of the caller's API keys.
+func CreateDecisionPolicyHandler(policySvc service.DecisionPolicyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		var req createDecisionPolicyRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		policy, err := policySvc.Create(r.Context(), policyCaller(identity), service.DecisionPolicyInput{
+			Plan:             req.Plan,
+			APIKeyID:         req.APIKeyID,
+			ReviewThreshold:  req.ReviewThreshold,
+			DeclineThreshold: req.DeclineThreshold,
+		})
+		if err != nil {
+			respondWithPolicyError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusCreated, policy)
+	}
+}
+
+// UpdateDecisionPolicyHandler replaces the thresholds of a policy and bumps
+// its version.
+func UpdateDecisionPolicyHandler(policySvc service.DecisionPolicyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid policy id")
+			return
+		}
+
+		var req updateDecisionPolicyRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		policy, err := policySvc.Update(r.Context(), policyCaller(identity), id, req.ReviewThreshold, req.DeclineThreshold)
+		if err != nil {
+			respondWithPolicyError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, policy)
+	}
+}
+
+func DeleteDecisionPolicyHandler(policySvc service.DecisionPolicyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid policy id")
+			return
+		}
+
+		if err := policySvc.Delete(r.Context(), policyCaller(identity), id); err != nil {
+			respondWithPolicyError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
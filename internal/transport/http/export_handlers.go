@@ -0,0 +1,93 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+	"github.com/rs/zerolog"
+)
+
+// exportResponseWriter remembers whether the export started, after which
+// errors can no longer be reported in the response.
+type exportResponseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *exportResponseWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// ExportInferenceLogsHandler streams the caller's successful predictions,
+// joined with their feedback labels, as a CSV, NDJSON or Parquet file. API key
+// callers only export the predictions of their key. The route is mounted
+// outside the request timeout: the export is bounded by timeout instead, and
+// stops when the client goes away.
+func ExportInferenceLogsHandler(exportSvc service.ExportService, timeout time.Duration, logger zerolog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		from, to, err := parseTimeRange(r, defaultInferenceLogWindow)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		format, err := service.ParseExportFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			respondWithInferenceLogError(w, err)
+			return
+		}
+
+		filter := service.ExportFilter{
+			From:     from,
+			To:       to,
+			UserID:   &identity.UserID,
+			APIKeyID: identity.APIKeyID,
+			Model:    r.URL.Query().Get("model"),
+		}
+		if v := r.URL.Query().Get("api_key_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				response.RespondWithError(w, http.StatusBadRequest, "invalid api_key_id")
+				return
+			}
+			if identity.APIKeyID != nil && *identity.APIKeyID != id {
+				respondWithInferenceLogError(w, service.ErrInferenceLogForbidden)
+				return
+			}
+			filter.APIKeyID = &id
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			logger.Debug().Err(err).Msg("failed to extend export write deadline")
+		}
+
+		filename := fmt.Sprintf("inference_logs_%s_%s.%s", from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z"), format)
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+		ew := &exportResponseWriter{ResponseWriter: w}
+		n, err := exportSvc.Export(ctx, ew, format, filter)
+		if err != nil {
+			if !ew.started {
+				w.Header().Del("Content-Disposition")
+				respondWithInferenceLogError(w, err)
+				return
+			}
+			logger.Error().Err(err).Int64("user_id", identity.UserID).Int("rows", n).Msg("inference log export aborted")
+		}
+	}
+}
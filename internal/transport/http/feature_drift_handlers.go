@@ -0,0 +1,35 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+const defaultDriftWindow = 7 * 24 * time.Hour
+
+// FeatureDriftHandler lists the drift snapshots computed in the requested time
+// range, optionally filtered by the "feature" query parameter.
+func FeatureDriftHandler(driftSvc service.FeatureDriftService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseTimeRange(r, defaultDriftWindow)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		snapshots, err := driftSvc.List(r.Context(), from, to, r.URL.Query().Get("feature"))
+		if err != nil {
+			response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"from":      from,
+			"to":        to,
+			"snapshots": snapshots,
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+type feedbackRequest struct {
+	InferenceID   int64       `json:"inference_id"`
+	TransactionID interface{} `json:"transaction_id"`
+	Label         string      `json:"label"`
+	LabelSource   string      `json:"label_source"`
+	LabeledAt     *time.Time  `json:"labeled_at"`
+}
+
+type batchFeedbackRequest struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+type batchFeedbackItem struct {
+	Index    int               `json:"index"`
+	Status   int               `json:"status"`
+	Feedback *service.Feedback `json:"feedback,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type batchFeedbackResponse struct {
+	Results []batchFeedbackItem `json:"results"`
+	Summary batchPredictSummary `json:"summary"`
+}
+
+// decodeFeedbackRequest parses a single feedback payload. transaction_id may
+// be a JSON string or number, matching the predict features.
+func decodeFeedbackRequest(data []byte) (service.FeedbackInput, error) {
+	var req feedbackRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		return service.FeedbackInput{}, err
+	}
+
+	input := service.FeedbackInput{
+		InferenceID: req.InferenceID,
+		Label:       service.FeedbackLabel(req.Label),
+		LabelSource: req.LabelSource,
+	}
+	if req.TransactionID != nil {
+		input.TransactionID = fmt.Sprint(req.TransactionID)
+	}
+	if req.LabeledAt != nil {
+		input.LabeledAt = *req.LabeledAt
+	}
+	return input, nil
+}
+
+func feedbackErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidFeedback):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrPredictionNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// FeedbackHandler attaches a ground-truth label to one of the caller's
+// predictions, identified by inference_id or transaction_id.
+func FeedbackHandler(feedbackSvc service.FeedbackService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		bodyBytes, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		input, err := decodeFeedbackRequest(bodyBytes)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		feedback, err := feedbackSvc.Record(r.Context(), identity.UserID, identity.APIKeyID, input)
+		if err != nil {
+			msg := err.Error()
+			if errors.Is(err, service.ErrInvalidFeedback) {
+				msg = "validation failed: " + msg
+			}
+			response.RespondWithError(w, feedbackErrorStatus(err), msg)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, feedback)
+	}
+}
+
+// BatchFeedbackHandler records up to maxItems labels, reporting the outcome of
+// each item on its own.
+func BatchFeedbackHandler(feedbackSvc service.FeedbackService, maxItems int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		bodyBytes, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				response.RespondWithError(w, http.StatusRequestEntityTooLarge, "payload too large")
+				return
+			}
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		var req batchFeedbackRequest
+		if err := json.Unmarshal(bodyBytes, &req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if len(req.Items) == 0 {
+			response.RespondWithError(w, http.StatusBadRequest, "validation failed: items is required")
+			return
+		}
+		if maxItems > 0 && len(req.Items) > maxItems {
+			response.RespondWithError(w, http.StatusBadRequest, "validation failed: items must contain at most "+strconv.Itoa(maxItems)+" entries")
+			return
+		}
+
+		results := make([]batchFeedbackItem, len(req.Items))
+		summary := batchPredictSummary{Total: len(req.Items)}
+		for i, item := range req.Items {
+			results[i] = batchFeedbackItem{Index: i, Status: http.StatusOK}
+
+			input, err := decodeFeedbackRequest(item)
+			if err != nil {
+				results[i].Status = http.StatusBadRequest
+				results[i].Error = "invalid request body"
+				summary.Failed++
+				continue
+			}
+			feedback, err := feedbackSvc.Record(r.Context(), identity.UserID, identity.APIKeyID, input)
+			if err != nil {
+				results[i].Status = feedbackErrorStatus(err)
+				results[i].Error = err.Error()
+				summary.Failed++
+				continue
+			}
+			results[i].Feedback = &feedback
+			summary.Succeeded++
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, batchFeedbackResponse{Results: results, Summary: summary})
+	}
+}
@@ -1,11 +1,14 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"reflect"
@@ -15,14 +18,12 @@ import (
 
 	chi "github.com/go-chi/chi/v5"
 	validator "github.com/go-playground/validator/v10"
-	"github.com/jules-labs/go-api-prod-template/internal/db"
 	"github.com/jules-labs/go-api-prod-template/internal/repo"
 	"github.com/jules-labs/go-api-prod-template/internal/service"
 	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
 	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
 	redis "github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
-	"github.com/sqlc-dev/pqtype"
 )
 
 var validate = validator.New()
@@ -65,6 +66,33 @@ func validationErrorMessage(err error) string {
 
 const maxBodyBytes = 1 << 20 // 1MB
 
+// parseTimeRange reads the optional RFC 3339 "from" and "to" query parameters.
+// "to" defaults to now and "from" defaults to defaultWindow before "to".
+func parseTimeRange(r *http.Request, defaultWindow time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid to: must be an RFC 3339 timestamp")
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultWindow)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid from: must be an RFC 3339 timestamp")
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("invalid time range: from must be before to")
+	}
+	return from, to, nil
+}
+
 func HealthzHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("ok"))
@@ -136,19 +164,6 @@ func maskAPIKey(key string) string {
 	return key[:prefixLen] + strings.Repeat("*", maskedLen) + key[len(key)-suffixLen:]
 }
 
-func maskSensitiveData(data map[string]interface{}) map[string]interface{} {
-	masked := make(map[string]interface{}, len(data))
-	for k, v := range data {
-		lower := strings.ToLower(k)
-		if strings.Contains(lower, "name") || strings.Contains(lower, "email") || strings.Contains(lower, "phone") || strings.Contains(lower, "password") {
-			masked[k] = "[REDACTED]"
-		} else {
-			masked[k] = v
-		}
-	}
-	return masked
-}
-
 func APIKeyHandler(apiKeySvc service.APIKeyService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		identity, ok := app_middleware.IdentityFrom(r.Context())
@@ -297,50 +312,192 @@ func ListModelsHandler(vendorSvc service.VendorService) http.HandlerFunc {
 	}
 }
 
-func saveInferenceLog(ctx context.Context, logRepo repo.InferenceLogRepository, identity app_middleware.Identity, reqPayload, respPayload []byte, errMsg string, reqTime, respTime time.Time, logger zerolog.Logger) {
-	var apiKeyID sql.NullInt64
-	if identity.APIKeyID != nil {
-		apiKeyID = sql.NullInt64{Int64: *identity.APIKeyID, Valid: true}
+func saveInferenceLog(ctx context.Context, logRepo repo.InferenceLogRepository, identity app_middleware.Identity, reqPayload []byte, resp *service.PredictResponse, errMsg string, reqTime, respTime time.Time, logger zerolog.Logger) int64 {
+	params := service.NewInferenceLogParams(identity.UserID, identity.APIKeyID, reqPayload, resp, errMsg, reqTime, respTime)
+	id, err := logRepo.CreateInferenceLog(ctx, params)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to log inference")
+		return 0
 	}
+	return id
+}
 
-	var respRaw pqtype.NullRawMessage
-	if respPayload != nil {
-		respRaw = pqtype.NullRawMessage{RawMessage: respPayload, Valid: true}
+// explainRequested reports whether a predict payload asks for an
+// explanation. Invalid payloads are reported later, when they are decoded.
+func explainRequested(bodyBytes []byte) bool {
+	var req struct {
+		Explain bool `json:"explain"`
 	}
+	_ = json.Unmarshal(bodyBytes, &req)
+	return req.Explain
+}
 
-	var errStr sql.NullString
-	if errMsg != "" {
-		errStr = sql.NullString{String: errMsg, Valid: true}
+type predictRequest struct {
+	Model    string                 `json:"model" validate:"required"`
+	Features map[string]interface{} `json:"features" validate:"required"`
+	Explain  bool                   `json:"explain"`
+}
+
+// predictOutcome is the result of scoring a single predict payload.
+type predictOutcome struct {
+	status   int
+	resp     service.PredictResponse
+	errMsg   string
+	problems []service.FeatureProblem
+}
+
+// decodePredictRequest parses and validates a raw predict payload. On failure it
+// returns the error message to report and the payload to record in the
+// inference log.
+func decodePredictRequest(bodyBytes []byte) (service.PredictRequest, []byte, string) {
+	var req predictRequest
+	dec := json.NewDecoder(bytes.NewReader(bodyBytes))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		return service.PredictRequest{}, bodyBytes, "invalid request body"
 	}
+	normalizeNumbers(req.Features)
 
-	params := db.CreateInferenceLogParams{
-		UserID:          identity.UserID,
-		ApiKeyID:        apiKeyID,
-		RequestPayload:  reqPayload,
-		ResponsePayload: respRaw,
-		Error:           errStr,
-		RequestTime:     reqTime,
-		ResponseTime:    respTime,
+	if err := validate.Struct(req); err != nil {
+		sanitizedReqBytes, _ := json.Marshal(service.PredictRequest{Model: req.Model, Features: service.MaskSensitiveFeatures(req.Features), Explain: req.Explain})
+		return service.PredictRequest{}, sanitizedReqBytes, "validation failed: " + validationErrorMessage(err)
 	}
 
-	if err := logRepo.CreateInferenceLog(ctx, params); err != nil {
-		logger.Error().Err(err).Msg("failed to log inference")
+	return service.PredictRequest{Model: req.Model, Features: req.Features, Explain: req.Explain}, nil, ""
+}
+
+// normalizeNumbers converts json.Number feature values to int64 when they are
+// integral, keeping large identifiers exact, and to float64 otherwise.
+func normalizeNumbers(features map[string]interface{}) {
+	for k, v := range features {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if i, err := n.Int64(); err == nil {
+			features[k] = i
+		} else if f, err := n.Float64(); err == nil {
+			features[k] = f
+		}
 	}
 }
 
-type predictFeatures struct {
-	TransactionID int64   `json:"transaction_id" validate:"required"`
-	Amount        float64 `json:"amount" validate:"required"`
-	MerchantType  string  `json:"merchant_type" validate:"required"`
-	DeviceType    string  `json:"device_type" validate:"required"`
+// validatePrediction checks the model and features of req against the vendor
+// registry. It returns false and the outcome to report if req is rejected.
+func validatePrediction(ctx context.Context, scoringSvc service.ScoringService, req service.PredictRequest) (predictOutcome, bool) {
+	err := scoringSvc.Validate(ctx, req)
+	if err == nil {
+		return predictOutcome{}, true
+	}
+
+	var unknownErr *service.UnknownModelError
+	var featureErr *service.FeatureValidationError
+	switch {
+	case errors.As(err, &unknownErr):
+		return predictOutcome{status: http.StatusBadRequest, errMsg: "validation failed: " + unknownErr.Error()}, false
+	case errors.As(err, &featureErr):
+		return predictOutcome{status: http.StatusUnprocessableEntity, errMsg: "validation failed: " + featureErr.Error(), problems: featureErr.Problems}, false
+	default:
+		return predictOutcome{status: http.StatusBadGateway, errMsg: "model registry unavailable: " + err.Error()}, false
+	}
 }
 
-type predictRequest struct {
-	Model    string          `json:"model" validate:"required,oneof=logreg lightgbm xgboost"`
-	Features predictFeatures `json:"features" validate:"required"`
+// respondWithOutcomeError writes a failed outcome, including any feature
+// problems, prefixing the message with prefix.
+func respondWithOutcomeError(w http.ResponseWriter, outcome predictOutcome, prefix string) {
+	if len(outcome.problems) == 0 {
+		response.RespondWithError(w, outcome.status, prefix+outcome.errMsg)
+		return
+	}
+	response.RespondWithJSON(w, outcome.status, map[string]interface{}{
+		"error":    prefix + outcome.errMsg,
+		"problems": outcome.problems,
+	})
+}
+
+// predictPayload validates a raw predict payload, scores it through the vendor
+// service and records the attempt in the inference log. Flagged predictions
+// are sent to review when caseSvc is set.
+func predictPayload(ctx context.Context, scoringSvc service.ScoringService, caseSvc service.CaseService, logRepo repo.InferenceLogRepository, identity app_middleware.Identity, bodyBytes []byte, reqTime time.Time, logger zerolog.Logger) predictOutcome {
+	serviceReq, logPayload, errMsg := decodePredictRequest(bodyBytes)
+	if errMsg != "" {
+		respTime := time.Now()
+		saveInferenceLog(ctx, logRepo, identity, logPayload, nil, errMsg, reqTime, respTime, logger)
+		return predictOutcome{status: http.StatusBadRequest, errMsg: errMsg}
+	}
+
+	if outcome, ok := validatePrediction(ctx, scoringSvc, serviceReq); !ok {
+		sanitizedReqBytes, _ := json.Marshal(service.PredictRequest{Model: serviceReq.Model, Features: service.MaskSensitiveFeatures(serviceReq.Features), Explain: serviceReq.Explain})
+		saveInferenceLog(ctx, logRepo, identity, sanitizedReqBytes, nil, outcome.errMsg, reqTime, time.Now(), logger)
+		return outcome
+	}
+
+	resp, err := scoringSvc.Score(ctx, identity.UserID, identity.APIKeyID, serviceReq)
+	respTime := time.Now()
+
+	sanitizedReqBytes, _ := json.Marshal(service.PredictRequest{Model: serviceReq.Model, Features: service.MaskSensitiveFeatures(serviceReq.Features), Explain: serviceReq.Explain})
+	var loggedResp *service.PredictResponse
+	if err == nil {
+		loggedResp = &resp
+	}
+
+	if err != nil {
+		errMsg = err.Error()
+	}
+	logID := saveInferenceLog(ctx, logRepo, identity, sanitizedReqBytes, loggedResp, errMsg, reqTime, respTime, logger)
+
+	if err != nil {
+		return predictOutcome{status: http.StatusBadGateway, errMsg: errMsg}
+	}
+
+	service.PersistShadow(logRepo, logID, resp, logger)
+	if caseSvc != nil && logID != 0 {
+		caseResp := resp
+		logRepo.AfterInferenceLogWritten(ctx, logID, func(ctx context.Context) {
+			if err := caseSvc.Open(ctx, logID, caseResp); err != nil {
+				logger.Error().Err(err).Int64("inference_log_id", logID).Msg("failed to open review case")
+			}
+		})
+	}
+	resp.Meta.InferenceID = logID
+
+	return predictOutcome{status: http.StatusOK, resp: resp}
 }
 
-func PredictHandler(vendorSvc service.VendorService, logRepo repo.InferenceLogRepository, logger zerolog.Logger) http.HandlerFunc {
+// idempotencyKey returns the key under which a predict call is deduplicated:
+// the Idempotency-Key header if set, otherwise features.transaction_id. Keys
+// are scoped to the API key, or the user for JWT callers. It returns "" if the
+// request carries neither.
+func idempotencyKey(r *http.Request, identity app_middleware.Identity, bodyBytes []byte) string {
+	scope := "user:" + strconv.FormatInt(identity.UserID, 10)
+	if identity.APIKeyID != nil {
+		scope = "key:" + strconv.FormatInt(*identity.APIKeyID, 10)
+	}
+
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		return scope + ":header:" + key
+	}
+
+	var req struct {
+		Features struct {
+			TransactionID interface{} `json:"transaction_id"`
+		} `json:"features"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(bodyBytes))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil || req.Features.TransactionID == nil {
+		return ""
+	}
+	return scope + ":txn:" + fmt.Sprint(req.Features.TransactionID)
+}
+
+// PredictHandler scores a single prediction. When idempotencySvc is set, a
+// repeated Idempotency-Key or transaction_id returns the stored response
+// without calling the vendor or writing another inference log, if the body is
+// the same. The rate limiter of the route charges one unit per request;
+// explained requests are charged explainCost-1 more units against limit, which
+// must share its budget, for the extra vendor calls of explanations.
+func PredictHandler(scoringSvc service.ScoringService, idempotencySvc service.IdempotencyService, caseSvc service.CaseService, logRepo repo.InferenceLogRepository, limit *app_middleware.RateLimit, explainCost int, logger zerolog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		identity, ok := app_middleware.IdentityFrom(r.Context())
 		if !ok {
@@ -365,58 +522,50 @@ func PredictHandler(vendorSvc service.VendorService, logRepo repo.InferenceLogRe
 			return
 		}
 
-		var req predictRequest
-		if err := json.Unmarshal(bodyBytes, &req); err != nil {
-			respTime := time.Now()
-			saveInferenceLog(r.Context(), logRepo, identity, bodyBytes, nil, "invalid request body", reqTime, respTime, logger)
-			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
-			return
-		}
-
-		if err := validate.Struct(req); err != nil {
-			respTime := time.Now()
-			featuresMap := map[string]interface{}{
-				"transaction_id": req.Features.TransactionID,
-				"amount":         req.Features.Amount,
-				"merchant_type":  req.Features.MerchantType,
-				"device_type":    req.Features.DeviceType,
+		if limit != nil && explainCost > 1 && explainRequested(bodyBytes) {
+			if !limit.Allow(w, r, explainCost-1) {
+				return
 			}
-			sanitizedReqBytes, _ := json.Marshal(service.PredictRequest{Model: req.Model, Features: maskSensitiveData(featuresMap)})
-			msg := validationErrorMessage(err)
-			saveInferenceLog(r.Context(), logRepo, identity, sanitizedReqBytes, nil, "validation failed: "+msg, reqTime, respTime, logger)
-			response.RespondWithError(w, http.StatusBadRequest, "validation failed: "+msg)
-			return
 		}
 
-		featuresMap := map[string]interface{}{
-			"transaction_id": req.Features.TransactionID,
-			"amount":         req.Features.Amount,
-			"merchant_type":  req.Features.MerchantType,
-			"device_type":    req.Features.DeviceType,
+		var outcome predictOutcome
+		key := ""
+		if idempotencySvc != nil {
+			key = idempotencyKey(r, identity, bodyBytes)
 		}
-
-		serviceReq := service.PredictRequest{Model: req.Model, Features: featuresMap}
-
-		resp, err := vendorSvc.Predict(r.Context(), serviceReq)
-		respTime := time.Now()
-
-		sanitizedReqBytes, _ := json.Marshal(service.PredictRequest{Model: serviceReq.Model, Features: maskSensitiveData(serviceReq.Features)})
-		var respBytes []byte
-		if err == nil {
-			respBytes, _ = json.Marshal(resp)
-		}
-
-		errMsg := ""
-		if err != nil {
-			errMsg = err.Error()
+		if key == "" {
+			outcome = predictPayload(r.Context(), scoringSvc, caseSvc, logRepo, identity, bodyBytes, reqTime, logger)
+		} else {
+			fingerprint := sha256.Sum256(bodyBytes)
+			resp, replayed, err := idempotencySvc.Do(r.Context(), key, hex.EncodeToString(fingerprint[:]), func() (service.PredictResponse, bool) {
+				outcome = predictPayload(r.Context(), scoringSvc, caseSvc, logRepo, identity, bodyBytes, reqTime, logger)
+				// Degraded responses are not stored, so that a retry once the
+				// vendor is back gets a model score.
+				return outcome.resp, outcome.status == http.StatusOK && !outcome.resp.Meta.Degraded
+			})
+			if errors.Is(err, service.ErrIdempotencyInProgress) {
+				response.RespondWithError(w, http.StatusConflict, err.Error())
+				return
+			}
+			if errors.Is(err, service.ErrIdempotencyMismatch) {
+				response.RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			if err != nil {
+				response.RespondWithError(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+			if replayed {
+				w.Header().Set("Idempotent-Replayed", "true")
+				outcome = predictOutcome{status: http.StatusOK, resp: resp}
+			}
 		}
-		saveInferenceLog(r.Context(), logRepo, identity, sanitizedReqBytes, respBytes, errMsg, reqTime, respTime, logger)
 
-		if err != nil {
-			response.RespondWithError(w, http.StatusBadGateway, err.Error())
+		if outcome.status != http.StatusOK {
+			respondWithOutcomeError(w, outcome, "")
 			return
 		}
 
-		response.RespondWithJSON(w, http.StatusOK, resp)
+		response.RespondWithJSON(w, http.StatusOK, outcome.resp)
 	}
 }
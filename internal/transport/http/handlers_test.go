@@ -2,15 +2,21 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	miniredis "github.com/alicebob/miniredis/v2"
 	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/jules-labs/go-api-prod-template/internal/db"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
 	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
 )
 
 type stubAPIKeyService struct{}
@@ -96,3 +102,138 @@ func TestAPIKeyHandler_PayloadTooLarge(t *testing.T) {
 		t.Fatalf("expected status %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
 	}
 }
+
+func TestPredictHandler_FeatureValidation(t *testing.T) {
+	vendor := &stubVendorService{}
+	handler := PredictHandler(service.NewScoringService(vendor, nil, nil, nil, zerolog.Nop()), nil, nil, &stubInferenceLogRepo{}, nil, 0, zerolog.Nop())
+
+	body := `{"model":"logreg","features":{"transaction_id":1,"merchant_type":"grocery","device_type":"mobile"}}`
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, body))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Error    string                   `json:"error"`
+		Problems []service.FeatureProblem `json:"problems"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Problems) != 1 || resp.Problems[0].Feature != "amount" || resp.Problems[0].Problem != service.FeatureMissing {
+		t.Fatalf("unexpected problems: %+v", resp.Problems)
+	}
+	if vendor.calls != 0 {
+		t.Fatalf("expected invalid features not to reach the vendor")
+	}
+}
+
+func TestPredictHandler_Idempotency(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	vendor := &stubVendorService{}
+	logs := &stubInferenceLogRepo{}
+	idempotency := service.NewIdempotencyService(client, time.Hour, time.Second, zerolog.Nop())
+	handler := PredictHandler(service.NewScoringService(vendor, nil, nil, nil, zerolog.Nop()), idempotency, nil, logs, nil, 0, zerolog.Nop())
+
+	body := `{"model":"logreg","features":{"transaction_id":42,"amount":10.5,"merchant_type":"grocery","device_type":"mobile"}}`
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newBatchRequest(t, body))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if replayed := rr.Header().Get("Idempotent-Replayed") == "true"; replayed != (i > 0) {
+			t.Fatalf("request %d: unexpected Idempotent-Replayed header %q", i, rr.Header().Get("Idempotent-Replayed"))
+		}
+	}
+	if vendor.calls != 1 || len(logs.logs) != 1 {
+		t.Fatalf("expected the retry to be served from the store, got %d vendor calls and %d logs", vendor.calls, len(logs.logs))
+	}
+
+	// The same transaction_id with another body is refused.
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, `{"model":"logreg","features":{"transaction_id":42,"amount":99.5,"merchant_type":"grocery","device_type":"mobile"}}`))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// An Idempotency-Key header takes precedence over transaction_id.
+	req := newBatchRequest(t, body)
+	req.Header.Set("Idempotency-Key", "retry-1")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected a new key to be scored, got %d", rr.Code)
+	}
+	if vendor.calls != 2 {
+		t.Fatalf("expected 2 vendor calls, got %d", vendor.calls)
+	}
+}
+
+func TestPredictHandler_IdempotencySkipsDegraded(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	fallback, err := service.NewFallback(service.FallbackSettings{Mode: service.FallbackRules, Decision: service.DecisionReview})
+	if err != nil {
+		t.Fatalf("could not create fallback: %v", err)
+	}
+	vendor := &stubVendorService{}
+	idempotency := service.NewIdempotencyService(client, time.Hour, time.Second, zerolog.Nop())
+	handler := PredictHandler(service.NewScoringService(vendor, nil, nil, nil, zerolog.Nop(), service.WithFallback(fallback)), idempotency, nil, &stubInferenceLogRepo{}, nil, 0, zerolog.Nop())
+
+	body := `{"model":"logreg","features":{"transaction_id":7,"amount":10.5,"merchant_type":"unavailable","device_type":"mobile"}}`
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newBatchRequest(t, body))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("request %d: expected the degraded response not to be replayed", i)
+		}
+	}
+	if vendor.calls != 2 {
+		t.Fatalf("expected every retry to reach the vendor, got %d calls", vendor.calls)
+	}
+}
+
+func TestPredictHandler_ExplainCost(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	vendor := &stubVendorService{}
+	limit := app_middleware.NewRateLimit(client, "/v1/fraud/predict", 5, time.Minute)
+	handler := PredictHandler(service.NewScoringService(vendor, nil, nil, nil, zerolog.Nop()), nil, nil, &stubInferenceLogRepo{}, limit, 3, zerolog.Nop())
+
+	// The route limiter charges the first unit; an explained prediction is
+	// charged 2 more.
+	body := `{"model":"logreg","features":{"amount":10.5},"explain":true}`
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, body))
+	if got := rr.Header().Get("X-RateLimit-Remaining"); rr.Code != http.StatusOK || got != "3" {
+		t.Fatalf("expected status 200 with 3 remaining, got %d with %q", rr.Code, got)
+	}
+
+	// Plain predictions are not charged by the handler.
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newBatchRequest(t, `{"model":"logreg","features":{"amount":10.5}}`))
+	if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != "" {
+		t.Fatalf("expected status 200 without a charge, got %d with %q", rr.Code, rr.Header().Get("X-RateLimit-Remaining"))
+	}
+}
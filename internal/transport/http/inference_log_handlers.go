@@ -0,0 +1,144 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+const defaultInferenceLogWindow = 7 * 24 * time.Hour
+
+func respondWithInferenceLogError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidLogFilter):
+		response.RespondWithError(w, http.StatusBadRequest, "validation failed: "+err.Error())
+	case errors.Is(err, service.ErrInferenceLogForbidden):
+		response.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrInferenceLogNotFound):
+		response.RespondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// parseLogFilter reads the optional filters of the log listing.
+func parseLogFilter(r *http.Request) (service.InferenceLogFilter, error) {
+	from, to, err := parseTimeRange(r, defaultInferenceLogWindow)
+	if err != nil {
+		return service.InferenceLogFilter{}, err
+	}
+
+	q := r.URL.Query()
+	filter := service.InferenceLogFilter{
+		From:   from,
+		To:     to,
+		Model:  q.Get("model"),
+		Status: q.Get("status"),
+	}
+	if v := q.Get("api_key_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return service.InferenceLogFilter{}, errors.New("invalid api_key_id")
+		}
+		filter.APIKeyID = &id
+	}
+	if v := q.Get("prediction"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return service.InferenceLogFilter{}, errors.New("invalid prediction")
+		}
+		filter.Prediction = &p
+	}
+	if filter.MinScore, err = floatParam(r, "min_score"); err != nil {
+		return service.InferenceLogFilter{}, err
+	}
+	if filter.MaxScore, err = floatParam(r, "max_score"); err != nil {
+		return service.InferenceLogFilter{}, err
+	}
+	if v := q.Get("cursor"); v != "" {
+		if filter.Cursor, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return service.InferenceLogFilter{}, errors.New("invalid cursor")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			return service.InferenceLogFilter{}, errors.New("invalid limit")
+		}
+	}
+	return filter, nil
+}
+
+// floatParam returns the optional float query parameter name.
+func floatParam(r *http.Request, name string) (*float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &f, nil
+}
+
+// ListInferenceLogsHandler pages through the caller's prediction history,
+// newest first. API key callers only see the predictions of their key.
+func ListInferenceLogsHandler(logSvc service.InferenceLogService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		filter, err := parseLogFilter(r)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		page, err := logSvc.List(r.Context(), identity.UserID, identity.APIKeyID, filter)
+		if err != nil {
+			respondWithInferenceLogError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"from":        filter.From,
+			"to":          filter.To,
+			"items":       page.Items,
+			"next_cursor": page.NextCursor,
+		})
+	}
+}
+
+func GetInferenceLogHandler(logSvc service.InferenceLogService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid inference log id")
+			return
+		}
+
+		l, err := logSvc.Get(r.Context(), identity.UserID, identity.APIKeyID, id)
+		if err != nil {
+			respondWithInferenceLogError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, l)
+	}
+}
@@ -0,0 +1,163 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+const maxJobBodyBytes = 32 << 20 // 32MB
+
+// SubmitPredictionJobHandler validates every item of the request up front and
+// queues them as a single asynchronous prediction job. The job is charged
+// against quota once per item; the workers pace the scoring, so jobs do not
+// spend the predict rate limit.
+func SubmitPredictionJobHandler(jobSvc service.PredictionJobService, scoringSvc service.ScoringService, quota *app_middleware.RateLimit, maxItems int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		bodyReader := http.MaxBytesReader(w, r.Body, maxJobBodyBytes)
+		bodyBytes, err := io.ReadAll(bodyReader)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				response.RespondWithError(w, http.StatusRequestEntityTooLarge, "payload too large")
+				return
+			}
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		var req batchPredictRequest
+		if err := json.Unmarshal(bodyBytes, &req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if len(req.Items) == 0 {
+			response.RespondWithError(w, http.StatusBadRequest, "validation failed: items is required")
+			return
+		}
+		if maxItems > 0 && len(req.Items) > maxItems {
+			response.RespondWithError(w, http.StatusBadRequest, "validation failed: items must contain at most "+strconv.Itoa(maxItems)+" entries")
+			return
+		}
+
+		items := make([]service.PredictRequest, len(req.Items))
+		for i, raw := range req.Items {
+			item, _, errMsg := decodePredictRequest(raw)
+			if errMsg != "" {
+				response.RespondWithError(w, http.StatusBadRequest, "items["+strconv.Itoa(i)+"]: "+errMsg)
+				return
+			}
+			if outcome, ok := validatePrediction(r.Context(), scoringSvc, item); !ok {
+				respondWithOutcomeError(w, outcome, "items["+strconv.Itoa(i)+"]: ")
+				return
+			}
+			items[i] = item
+		}
+
+		if quota != nil && !quota.Allow(w, r, len(items)) {
+			return
+		}
+
+		job, err := jobSvc.Submit(r.Context(), service.JobOwner{UserID: identity.UserID, APIKeyID: identity.APIKeyID}, items)
+		if err != nil {
+			response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Location", "/v1/fraud/jobs/"+job.ID.String())
+		response.RespondWithJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func GetPredictionJobHandler(jobSvc service.PredictionJobService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid job id")
+			return
+		}
+
+		job, err := jobSvc.Get(r.Context(), identity.UserID, jobID)
+		if err != nil {
+			if errors.Is(err, service.ErrJobNotFound) {
+				response.RespondWithError(w, http.StatusNotFound, "job not found")
+				return
+			}
+			response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, job)
+	}
+}
+
+// GetPredictionJobResultsHandler returns the results of a finished job one
+// page at a time, in item order. cursor is the next_cursor of the previous
+// page.
+func GetPredictionJobResultsHandler(jobSvc service.PredictionJobService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid job id")
+			return
+		}
+
+		var cursor, limit int
+		if v := r.URL.Query().Get("cursor"); v != "" {
+			if cursor, err = strconv.Atoi(v); err != nil {
+				response.RespondWithError(w, http.StatusBadRequest, "invalid cursor")
+				return
+			}
+		}
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil {
+				response.RespondWithError(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+		}
+
+		page, err := jobSvc.Results(r.Context(), identity.UserID, jobID, cursor, limit)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidJobResultPage):
+				response.RespondWithError(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, service.ErrJobNotFound):
+				response.RespondWithError(w, http.StatusNotFound, "job not found")
+			case errors.Is(err, service.ErrJobNotFinished):
+				response.RespondWithError(w, http.StatusConflict, "job not finished")
+			default:
+				response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, page)
+	}
+}
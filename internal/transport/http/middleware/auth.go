@@ -27,3 +27,8 @@ func IdentityFrom(ctx context.Context) (Identity, bool) {
 	id, ok := v.(Identity)
 	return id, ok
 }
+
+// WithIdentity returns a copy of ctx carrying the given Identity.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, ctxKeyIdentity, identity)
+}
@@ -38,3 +38,22 @@ func AuthEither(apiKeyAuth, jwtAuth func(http.Handler) http.Handler) func(http.H
 		finalAuthCheck,
 	)
 }
+
+// RequirePlan rejects requests whose identity is not on the given plan. It must
+// run after an auth middleware.
+func RequirePlan(plan string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := IdentityFrom(r.Context())
+			if !ok {
+				response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			if identity.Plan != plan {
+				response.RespondWithError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
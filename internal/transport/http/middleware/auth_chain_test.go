@@ -63,3 +63,22 @@ func TestFinalAuthCheck(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, rr.Code)
 	})
 }
+
+func TestRequirePlan(t *testing.T) {
+	handler := RequirePlan("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for plan, want := range map[string]int{"admin": http.StatusOK, "free": http.StatusForbidden} {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req = req.WithContext(WithIdentity(req.Context(), Identity{UserID: 1, Plan: plan}))
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, want, rr.Code, "plan %s", plan)
+	}
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -10,68 +10,133 @@ import (
 	redis "github.com/redis/go-redis/v9"
 )
 
-// RateLimiter enforces a rate limit for the given endpoint on a per-identity basis.
-// For JWT-authenticated requests, the provided jwtLimit is used. For API key requests
-// the limit is taken from the identity's RateRPM value. Limits are tracked in Redis
-// to ensure consistent enforcement across distributed instances.
-func RateLimiter(redisClient *redis.Client, endpoint string, jwtLimit int, window time.Duration) func(http.Handler) http.Handler {
+// RateLimit tracks a per-identity quota for an endpoint in Redis. It backs the
+// RateLimiter middleware and can also be used directly by handlers that need to
+// charge more than one unit for a single HTTP call, such as batch endpoints.
+type RateLimit struct {
+	redisClient *redis.Client
+	endpoint    string
+	jwtLimit    int
+	window      time.Duration
+	script      *redis.Script
+	// quota applies jwtLimit to API keys too, ignoring their RateRPM.
+	quota bool
+}
+
+// NewRateLimit creates a RateLimit for the given endpoint. For JWT-authenticated
+// requests, the provided jwtLimit is used. For API key requests the limit is
+// taken from the identity's RateRPM value.
+func NewRateLimit(redisClient *redis.Client, endpoint string, jwtLimit int, window time.Duration) *RateLimit {
+	// The script returns the count and whether it exceeds the limit in ARGV[3].
+	// Rejected multi-unit charges are refunded in the same call, so that
+	// concurrent callers never see them.
 	script := redis.NewScript(`
-local current = redis.call("INCR", KEYS[1])
-if tonumber(current) == 1 then
+local n = tonumber(ARGV[2])
+local current = redis.call("INCRBY", KEYS[1], n)
+if current == n then
     redis.call("EXPIRE", KEYS[1], ARGV[1])
 end
-return current
+local exceeded = 0
+if current > tonumber(ARGV[3]) then
+    exceeded = 1
+    if n > 1 then
+        current = redis.call("DECRBY", KEYS[1], n)
+    end
+end
+return {current, exceeded}
 `)
 
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			identity, ok := IdentityFrom(r.Context())
-			if !ok {
-				// This should not happen if auth middleware is properly configured
-				response.RespondWithError(w, http.StatusInternalServerError, "identity not found in context")
-				return
-			}
+	return &RateLimit{
+		redisClient: redisClient,
+		endpoint:    endpoint,
+		jwtLimit:    jwtLimit,
+		window:      window,
+		script:      script,
+	}
+}
 
-			limit := jwtLimit
-			identifier := fmt.Sprintf("user:%d", identity.UserID)
-			if identity.APIKeyID != nil {
-				identifier = fmt.Sprintf("apikey:%d", *identity.APIKeyID)
-				if identity.RateRPM != nil {
-					limit = *identity.RateRPM
-				}
-			}
+// NewQuota creates a RateLimit that allows limit units per window to every
+// identity, whatever the RateRPM of its API key. It backs budgets that are not
+// requests per minute, such as the items of prediction jobs per day.
+func NewQuota(redisClient *redis.Client, endpoint string, limit int, window time.Duration) *RateLimit {
+	l := NewRateLimit(redisClient, endpoint, limit, window)
+	l.quota = true
+	return l
+}
 
-			now := time.Now().UTC()
-			windowStart := now.Truncate(window).Unix()
-			key := fmt.Sprintf("ratelimit:%s:%s:%d", identifier, endpoint, windowStart)
+// Allow charges n units against the caller's quota and sets the rate limit
+// headers. If the quota is exhausted or the check fails, it writes the error
+// response and returns false. Rejected multi-unit charges are refunded so that
+// an oversized batch does not consume the remaining budget.
+func (l *RateLimit) Allow(w http.ResponseWriter, r *http.Request, n int) bool {
+	identity, ok := IdentityFrom(r.Context())
+	if !ok {
+		// This should not happen if auth middleware is properly configured
+		response.RespondWithError(w, http.StatusInternalServerError, "identity not found in context")
+		return false
+	}
 
-			current, err := script.Run(r.Context(), redisClient, []string{key}, int(window.Seconds())).Int()
-			if err != nil {
-				response.RespondWithError(w, http.StatusInternalServerError, "rate limit check failed")
-				return
-			}
+	limit := l.Limit(identity)
+	identifier := fmt.Sprintf("user:%d", identity.UserID)
+	if identity.APIKeyID != nil {
+		identifier = fmt.Sprintf("apikey:%d", *identity.APIKeyID)
+	}
 
-			ttl, err := redisClient.TTL(r.Context(), key).Result()
-			if err != nil {
-				response.RespondWithError(w, http.StatusInternalServerError, "rate limit ttl failed")
-				return
-			}
+	now := time.Now().UTC()
+	windowStart := now.Truncate(l.window).Unix()
+	key := fmt.Sprintf("ratelimit:%s:%s:%d", identifier, l.endpoint, windowStart)
 
-			remaining := limit - current
-			if remaining < 0 {
-				remaining = 0
-			}
+	res, err := l.script.Run(r.Context(), l.redisClient, []string{key}, int(l.window.Seconds()), n, limit).Int64Slice()
+	if err != nil || len(res) != 2 {
+		response.RespondWithError(w, http.StatusInternalServerError, "rate limit check failed")
+		return false
+	}
+	current, exceeded := int(res[0]), res[1] == 1
+
+	ttl, err := l.redisClient.TTL(r.Context(), key).Result()
+	if err != nil {
+		response.RespondWithError(w, http.StatusInternalServerError, "rate limit ttl failed")
+		return false
+	}
+
+	remaining := limit - current
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(ttl.Seconds()), 10))
+
+	if exceeded {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(ttl.Seconds()), 10))
+		response.RespondWithError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return false
+	}
+
+	return true
+}
 
-			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
-			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
-			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(ttl.Seconds()), 10))
+// Limit returns the number of units identity may spend per window.
+func (l *RateLimit) Limit(identity Identity) int {
+	if identity.APIKeyID != nil && identity.RateRPM != nil && !l.quota {
+		return *identity.RateRPM
+	}
+	return l.jwtLimit
+}
 
-			if current > limit {
-				w.Header().Set("Retry-After", strconv.FormatInt(int64(ttl.Seconds()), 10))
-				response.RespondWithError(w, http.StatusTooManyRequests, "rate limit exceeded")
+// RateLimiter enforces a rate limit for the given endpoint on a per-identity basis.
+// For JWT-authenticated requests, the provided jwtLimit is used. For API key requests
+// the limit is taken from the identity's RateRPM value. Limits are tracked in Redis
+// to ensure consistent enforcement across distributed instances.
+func RateLimiter(redisClient *redis.Client, endpoint string, jwtLimit int, window time.Duration) func(http.Handler) http.Handler {
+	limit := NewRateLimit(redisClient, endpoint, jwtLimit, window)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limit.Allow(w, r, 1) {
 				return
 			}
-
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -90,3 +90,73 @@ func TestRateLimiterAPIKey(t *testing.T) {
 		t.Fatalf("expected status 429, got %d", rr.Code)
 	}
 }
+
+func TestRateLimitAllowMultipleUnits(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	limit := NewRateLimit(client, "/v1/fraud/predict", 5, time.Minute)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/fraud/predict/batch", nil)
+	req = req.WithContext(WithIdentity(req.Context(), Identity{UserID: 1}))
+
+	rr := httptest.NewRecorder()
+	if !limit.Allow(rr, req, 4) {
+		t.Fatalf("expected batch of 4 to be allowed")
+	}
+	if got := rr.Header().Get("X-RateLimit-Remaining"); got != "1" {
+		t.Fatalf("expected 1 remaining, got %q", got)
+	}
+
+	// A batch that does not fit is rejected and refunded.
+	rr = httptest.NewRecorder()
+	if limit.Allow(rr, req, 3) {
+		t.Fatalf("expected batch of 3 to be rejected")
+	}
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("X-RateLimit-Remaining"); got != "1" {
+		t.Fatalf("expected the refunded unit to be reported, got %q", got)
+	}
+
+	rr = httptest.NewRecorder()
+	if !limit.Allow(rr, req, 1) {
+		t.Fatalf("expected the remaining unit to still be available")
+	}
+}
+
+func TestQuotaIgnoresAPIKeyRate(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	quota := NewQuota(client, "/v1/fraud/jobs", 1000, 24*time.Hour)
+
+	keyID := int64(10)
+	rate := 60
+	req := httptest.NewRequest(http.MethodPost, "/v1/fraud/jobs", nil)
+	req = req.WithContext(WithIdentity(req.Context(), Identity{UserID: 1, APIKeyID: &keyID, RateRPM: &rate}))
+
+	rr := httptest.NewRecorder()
+	if !quota.Allow(rr, req, 500) {
+		t.Fatalf("expected 500 items to fit the quota despite the API key rate")
+	}
+	if got := rr.Header().Get("X-RateLimit-Limit"); got != "1000" {
+		t.Fatalf("expected limit 1000, got %q", got)
+	}
+
+	// The quota does not spend the predict budget of the key.
+	limit := NewRateLimit(client, "/v1/fraud/predict", 5, time.Minute)
+	rr = httptest.NewRecorder()
+	if !limit.Allow(rr, req, 60) {
+		t.Fatalf("expected the predict budget to be untouched")
+	}
+}
@@ -0,0 +1,35 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+const defaultModelMetricsWindow = 30 * 24 * time.Hour
+
+// ModelMetricsHandler lists the performance of each model run per time
+// bucket, optionally filtered by the "model" query parameter.
+func ModelMetricsHandler(metricsSvc service.ModelMetricsService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseTimeRange(r, defaultModelMetricsWindow)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		metrics, err := metricsSvc.List(r.Context(), from, to, r.URL.Query().Get("model"))
+		if err != nil {
+			response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"from":    from,
+			"to":      to,
+			"metrics": metrics,
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+func respondWithReplayError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidReplay):
+		response.RespondWithError(w, http.StatusBadRequest, "validation failed: "+err.Error())
+	case errors.Is(err, service.ErrReplayNotFound):
+		response.RespondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// replayID returns the ID of the URL, or writes the error response and returns
+// false.
+func replayID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid replay id")
+		return 0, false
+	}
+	return id, true
+}
+
+// queryLimit parses the optional limit query parameter, 0 when absent.
+func queryLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid limit")
+		return 0, false
+	}
+	return limit, true
+}
+
+// CreateReplayHandler queues a replay of the logged predictions matching the
+// request against another model. The replay runs in the background.
+func CreateReplayHandler(replaySvc service.ReplayService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		var req service.ReplayParams
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		run, err := replaySvc.Create(r.Context(), &identity.UserID, req)
+		if err != nil {
+			respondWithReplayError(w, err)
+			return
+		}
+
+		w.Header().Set("Location", "/v1/replays/"+strconv.FormatInt(run.ID, 10))
+		response.RespondWithJSON(w, http.StatusAccepted, run)
+	}
+}
+
+func ListReplaysHandler(replaySvc service.ReplayService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := queryLimit(w, r)
+		if !ok {
+			return
+		}
+
+		runs, err := replaySvc.List(r.Context(), limit)
+		if err != nil {
+			respondWithReplayError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"replays": runs})
+	}
+}
+
+func GetReplayHandler(replaySvc service.ReplayService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := replayID(w, r)
+		if !ok {
+			return
+		}
+
+		run, err := replaySvc.Get(r.Context(), id)
+		if err != nil {
+			respondWithReplayError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, run)
+	}
+}
+
+// GetReplayReportHandler compares the predictions replayed so far with the
+// original ones, so the report of a running replay is partial.
+func GetReplayReportHandler(replaySvc service.ReplayService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := replayID(w, r)
+		if !ok {
+			return
+		}
+		limit, ok := queryLimit(w, r)
+		if !ok {
+			return
+		}
+
+		report, err := replaySvc.Report(r.Context(), id, limit)
+		if err != nil {
+			respondWithReplayError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, report)
+	}
+}
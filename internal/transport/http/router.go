@@ -27,6 +27,20 @@ func NewRouter(
 	apiKeySvc service.APIKeyService,
 	vendorSvc service.VendorService,
 	authSvc service.AuthService,
+	jobSvc service.PredictionJobService,
+	shadowSvc service.ShadowService,
+	policySvc service.DecisionPolicyService,
+	ruleSvc service.RuleService,
+	scoringSvc service.ScoringService,
+	idempotencySvc service.IdempotencyService,
+	feedbackSvc service.FeedbackService,
+	metricsSvc service.ModelMetricsService,
+	driftSvc service.FeatureDriftService,
+	caseSvc service.CaseService,
+	webhookSvc service.WebhookService,
+	logSvc service.InferenceLogService,
+	exportSvc service.ExportService,
+	replaySvc service.ReplayService,
 	jwtSecret []byte,
 	logger zerolog.Logger,
 ) http.Handler {
@@ -38,68 +52,140 @@ func NewRouter(
 	r.Use(app_middleware.Logger(logger))
 	r.Use(middleware.Recoverer)
 	r.Use(app_middleware.CORS(cfg.CORSAllowedOrigins))
-	r.Use(middleware.Timeout(15 * time.Second))
-
-	// Observability
-	r.Handle("/metrics", promhttp.Handler())
-	if cfg.Debug {
-		r.Mount("/debug", middleware.Profiler())
-	}
-
-	// Health/readiness
-	r.HandleFunc("/healthz", HealthzHandler)
-	r.HandleFunc("/readyz", ReadinessHandler(db, redisClient))
-
-	// Docs
-	r.Get("/swagger/*", func(w http.ResponseWriter, r *http.Request) {
-		// Placeholder for swagger
-		http.ServeFile(w, r, "api/openapi.yaml")
-	})
 
-	// API v1
-	r.Route("/v1", func(v1 chi.Router) {
-		// Auth
-		jwtAuth := app_middleware.JWTAuth(jwtSecret, userRepo)
-		v1.Route("/auth", func(auth chi.Router) {
-			auth.Post("/sign-up", SignUpHandler(authSvc))
-			auth.Post("/sign-in", SignInHandler(authSvc))
-
-			auth.Group(func(g chi.Router) {
-				g.Use(jwtAuth)
-				g.Get("/me", MeHandler(profileSvc))
-			})
+	jwtAuth := app_middleware.JWTAuth(jwtSecret, userRepo)
+	vendorAuth := app_middleware.AuthEither(
+		app_middleware.APIKeyAuth(apiKeyRepo, userRepo),
+		jwtAuth,
+	)
+
+	// Exports stream for longer than the request timeout and are bounded by
+	// their own deadline instead.
+	r.With(vendorAuth).Get("/v1/inference/logs/export", ExportInferenceLogsHandler(exportSvc, cfg.ExportTimeout, logger))
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(15 * time.Second))
+
+		// Observability
+		r.Handle("/metrics", promhttp.Handler())
+		if cfg.Debug {
+			r.Mount("/debug", middleware.Profiler())
+		}
+
+		// Health/readiness
+		r.HandleFunc("/healthz", HealthzHandler)
+		r.HandleFunc("/readyz", ReadinessHandler(db, redisClient))
+
+		// Docs
+		r.Get("/swagger/*", func(w http.ResponseWriter, r *http.Request) {
+			// Placeholder for swagger
+			http.ServeFile(w, r, "api/openapi.yaml")
 		})
 
-		v1.Route("/apikeys", func(r chi.Router) {
-			r.Use(jwtAuth)
-			r.Get("/", ListAPIKeysHandler(apiKeySvc))
-			r.Post("/", APIKeyHandler(apiKeySvc))
-			r.Delete("/{id}", DeleteAPIKeyHandler(apiKeySvc))
-		})
+		// API v1
+		r.Route("/v1", func(v1 chi.Router) {
+			// Auth
+			v1.Route("/auth", func(auth chi.Router) {
+				auth.Post("/sign-up", SignUpHandler(authSvc))
+				auth.Post("/sign-in", SignInHandler(authSvc))
+
+				auth.Group(func(g chi.Router) {
+					g.Use(jwtAuth)
+					g.Get("/me", MeHandler(profileSvc))
+				})
+			})
 
-		vendorAuth := app_middleware.AuthEither(
-			app_middleware.APIKeyAuth(apiKeyRepo, userRepo),
-			jwtAuth,
-		)
+			v1.Route("/apikeys", func(r chi.Router) {
+				r.Use(jwtAuth)
+				r.Get("/", ListAPIKeysHandler(apiKeySvc))
+				r.Post("/", APIKeyHandler(apiKeySvc))
+				r.Delete("/{id}", DeleteAPIKeyHandler(apiKeySvc))
+			})
 
-		v1.Route("/vendor", func(r chi.Router) {
-			r.Use(vendorAuth)
-			r.Get("/ping", VendorPingHandler(vendorSvc))
-		})
+			v1.Route("/decision-policies", func(r chi.Router) {
+				r.Use(jwtAuth)
+				r.Get("/", ListDecisionPoliciesHandler(policySvc))
+				r.Post("/", CreateDecisionPolicyHandler(policySvc))
+				r.Put("/{id}", UpdateDecisionPolicyHandler(policySvc))
+				r.Delete("/{id}", DeleteDecisionPolicyHandler(policySvc))
+			})
 
-		modelsLimiter := app_middleware.RateLimiter(redisClient, "/v1/inference/models", cfg.PredictRateLimit, cfg.PredictRateWindow)
-		predictLimiter := app_middleware.RateLimiter(redisClient, "/v1/inference/predict", cfg.PredictRateLimit, cfg.PredictRateWindow)
-		fraudPredictLimiter := app_middleware.RateLimiter(redisClient, "/v1/fraud/predict", cfg.PredictRateLimit, cfg.PredictRateWindow)
+			v1.Route("/rules", func(r chi.Router) {
+				r.Use(jwtAuth)
+				r.Use(app_middleware.RequirePlan(service.AdminPlan))
+				r.Get("/", ListFraudRulesHandler(ruleSvc))
+				r.Post("/", CreateFraudRuleHandler(ruleSvc))
+				r.Put("/{id}", UpdateFraudRuleHandler(ruleSvc))
+				r.Delete("/{id}", DeleteFraudRuleHandler(ruleSvc))
+			})
 
-		v1.Route("/inference", func(r chi.Router) {
-			r.Use(vendorAuth)
-			r.With(modelsLimiter).Get("/models", ListModelsHandler(vendorSvc))
-			r.With(predictLimiter).With(jwtAuth).Post("/predict", PredictHandler(vendorSvc, logRepo, logger))
-		})
+			// Replays re-score every tenant's traffic.
+			v1.Route("/replays", func(r chi.Router) {
+				r.Use(jwtAuth)
+				r.Use(app_middleware.RequirePlan(service.AdminPlan))
+				r.Get("/", ListReplaysHandler(replaySvc))
+				r.Post("/", CreateReplayHandler(replaySvc))
+				r.Get("/{id}", GetReplayHandler(replaySvc))
+				r.Get("/{id}/report", GetReplayReportHandler(replaySvc))
+			})
 
-		v1.Route("/fraud", func(r chi.Router) {
-			r.Use(app_middleware.APIKeyAuth(apiKeyRepo, userRepo))
-			r.With(fraudPredictLimiter).Post("/predict", PredictHandler(vendorSvc, logRepo, logger))
+			v1.Route("/cases", func(r chi.Router) {
+				r.Use(jwtAuth)
+				r.Get("/", ListCasesHandler(caseSvc))
+				r.Get("/{id}", GetCaseHandler(caseSvc))
+				r.Post("/{id}/assign", AssignCaseHandler(caseSvc))
+				r.Post("/{id}/comments", CommentCaseHandler(caseSvc))
+				r.Post("/{id}/resolve", ResolveCaseHandler(caseSvc))
+			})
+
+			v1.Route("/webhooks", func(r chi.Router) {
+				r.Use(jwtAuth)
+				r.Get("/", ListWebhooksHandler(webhookSvc))
+				r.Post("/", CreateWebhookHandler(webhookSvc))
+				r.Delete("/{id}", DeleteWebhookHandler(webhookSvc))
+				r.Get("/{id}/deliveries", ListWebhookDeliveriesHandler(webhookSvc))
+				r.Post("/deliveries/{id}/redeliver", RedeliverWebhookHandler(webhookSvc))
+			})
+
+			v1.Route("/vendor", func(r chi.Router) {
+				r.Use(vendorAuth)
+				r.Get("/ping", VendorPingHandler(vendorSvc))
+			})
+
+			modelsLimiter := app_middleware.RateLimiter(redisClient, "/v1/inference/models", cfg.PredictRateLimit, cfg.PredictRateWindow)
+			predictLimiter := app_middleware.RateLimiter(redisClient, "/v1/inference/predict", cfg.PredictRateLimit, cfg.PredictRateWindow)
+			fraudPredictLimiter := app_middleware.RateLimiter(redisClient, "/v1/fraud/predict", cfg.PredictRateLimit, cfg.PredictRateWindow)
+			// Batch items and the explanations of predictions share the
+			// single-predict budget of their route and are charged by handlers.
+			predictLimit := app_middleware.NewRateLimit(redisClient, "/v1/inference/predict", cfg.PredictRateLimit, cfg.PredictRateWindow)
+			fraudPredictLimit := app_middleware.NewRateLimit(redisClient, "/v1/fraud/predict", cfg.PredictRateLimit, cfg.PredictRateWindow)
+			// Job items are paced by the workers and have a daily budget of their own.
+			jobQuota := app_middleware.NewQuota(redisClient, "/v1/fraud/jobs", cfg.PredictionJobDailyItems, 24*time.Hour)
+
+			v1.Route("/inference", func(r chi.Router) {
+				r.Use(vendorAuth)
+				r.With(modelsLimiter).Get("/models", ListModelsHandler(vendorSvc))
+				r.With(predictLimiter).With(jwtAuth).Post("/predict", PredictHandler(scoringSvc, idempotencySvc, caseSvc, logRepo, predictLimit, cfg.ExplainRateCost, logger))
+				r.Get("/shadow/comparison", ShadowComparisonHandler(shadowSvc))
+				r.Get("/logs", ListInferenceLogsHandler(logSvc))
+				r.Get("/logs/{id}", GetInferenceLogHandler(logSvc))
+			})
+
+			v1.Route("/fraud", func(r chi.Router) {
+				r.Use(app_middleware.APIKeyAuth(apiKeyRepo, userRepo))
+				r.With(fraudPredictLimiter).Post("/predict", PredictHandler(scoringSvc, idempotencySvc, caseSvc, logRepo, fraudPredictLimit, cfg.ExplainRateCost, logger))
+				r.Post("/predict/batch", BatchPredictHandler(scoringSvc, caseSvc, logRepo, fraudPredictLimit, cfg.ExplainRateCost, cfg.PredictBatchMaxItems, cfg.PredictBatchConcurrency, logger))
+
+				r.Post("/feedback", FeedbackHandler(feedbackSvc))
+				r.Post("/feedback/batch", BatchFeedbackHandler(feedbackSvc, cfg.FeedbackBatchMaxItems))
+				// Metrics and drift span every tenant's predictions.
+				r.With(app_middleware.RequirePlan(service.AdminPlan)).Get("/metrics/models", ModelMetricsHandler(metricsSvc))
+				r.With(app_middleware.RequirePlan(service.AdminPlan)).Get("/drift", FeatureDriftHandler(driftSvc))
+
+				r.Post("/jobs", SubmitPredictionJobHandler(jobSvc, scoringSvc, jobQuota, cfg.PredictionJobMaxItems))
+				r.Get("/jobs/{id}", GetPredictionJobHandler(jobSvc))
+				r.Get("/jobs/{id}/results", GetPredictionJobResultsHandler(jobSvc))
+			})
 		})
 	})
 
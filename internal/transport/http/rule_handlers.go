@@ -0,0 +1,123 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+type fraudRuleRequest struct {
+	Name       string            `json:"name"`
+	Stage      service.RuleStage `json:"stage"`
+	Expression string            `json:"expression"`
+	Decision   service.Decision  `json:"decision"`
+	ReasonCode string            `json:"reason_code"`
+	Priority   *int32            `json:"priority"`
+	Enabled    *bool             `json:"enabled"`
+}
+
+func (req fraudRuleRequest) input() service.FraudRuleInput {
+	input := service.FraudRuleInput{
+		Name:       req.Name,
+		Stage:      req.Stage,
+		Expression: req.Expression,
+		Decision:   req.Decision,
+		ReasonCode: req.ReasonCode,
+		Priority:   100,
+		Enabled:    true,
+	}
+	if req.Priority != nil {
+		input.Priority = *req.Priority
+	}
+	if req.Enabled != nil {
+		input.Enabled = *req.Enabled
+	}
+	return input
+}
+
+func respondWithRuleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidFraudRule):
+		response.RespondWithError(w, http.StatusBadRequest, "validation failed: "+err.Error())
+	case errors.Is(err, service.ErrFraudRuleNotFound):
+		response.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrFraudRuleExists):
+		response.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func ListFraudRulesHandler(ruleSvc service.RuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := ruleSvc.List(r.Context())
+		if err != nil {
+			respondWithRuleError(w, err)
+			return
+		}
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"rules": rules})
+	}
+}
+
+func CreateFraudRuleHandler(ruleSvc service.RuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req fraudRuleRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		rule, err := ruleSvc.Create(r.Context(), req.input())
+		if err != nil {
+			respondWithRuleError(w, err)
+			return
+		}
+		response.RespondWithJSON(w, http.StatusCreated, rule)
+	}
+}
+
+// UpdateFraudRuleHandler replaces a rule and bumps its version. The rule name
+// cannot be changed.
+func UpdateFraudRuleHandler(ruleSvc service.RuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid rule id")
+			return
+		}
+
+		var req fraudRuleRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		rule, err := ruleSvc.Update(r.Context(), id, req.input())
+		if err != nil {
+			respondWithRuleError(w, err)
+			return
+		}
+		response.RespondWithJSON(w, http.StatusOK, rule)
+	}
+}
+
+func DeleteFraudRuleHandler(ruleSvc service.RuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid rule id")
+			return
+		}
+
+		if err := ruleSvc.Delete(r.Context(), id); err != nil {
+			respondWithRuleError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
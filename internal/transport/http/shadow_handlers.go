@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+const defaultComparisonWindow = 24 * time.Hour
+
+// ShadowComparisonHandler reports how the shadow (challenger) model agreed with
+// the champion for the caller's predictions in the requested time range.
+func ShadowComparisonHandler(shadowSvc service.ShadowService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		from, to, err := parseTimeRange(r, defaultComparisonWindow)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		comparisons, err := shadowSvc.Compare(r.Context(), identity.UserID, from, to)
+		if err != nil {
+			response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"from":        from,
+			"to":          to,
+			"comparisons": comparisons,
+		})
+	}
+}
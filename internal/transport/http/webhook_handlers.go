@@ -0,0 +1,161 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/jules-labs/go-api-prod-template/internal/service"
+	app_middleware "github.com/jules-labs/go-api-prod-template/internal/transport/http/middleware"
+	"github.com/jules-labs/go-api-prod-template/internal/transport/http/response"
+)
+
+const defaultWebhookDeliveryWindow = 7 * 24 * time.Hour
+
+type createWebhookRequest struct {
+	APIKeyID int64  `json:"api_key_id"`
+	URL      string `json:"url"`
+}
+
+func respondWithWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhook):
+		response.RespondWithError(w, http.StatusBadRequest, "validation failed: "+err.Error())
+	case errors.Is(err, service.ErrWebhookForbidden):
+		response.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrWebhookNotFound):
+		response.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrWebhookInFlight):
+		response.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		response.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// webhookRequest returns the caller and the ID of the URL, or writes the error
+// response and returns false.
+func webhookRequest(w http.ResponseWriter, r *http.Request) (app_middleware.Identity, int64, bool) {
+	identity, ok := app_middleware.IdentityFrom(r.Context())
+	if !ok {
+		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+		return app_middleware.Identity{}, 0, false
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid webhook id")
+		return app_middleware.Identity{}, 0, false
+	}
+	return identity, id, true
+}
+
+func ListWebhooksHandler(webhookSvc service.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		endpoints, err := webhookSvc.ListEndpoints(r.Context(), identity.UserID)
+		if err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"webhooks": endpoints})
+	}
+}
+
+// CreateWebhookHandler registers an endpoint for one of the caller's API keys.
+// The signing secret is only returned in this response.
+func CreateWebhookHandler(webhookSvc service.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := app_middleware.IdentityFrom(r.Context())
+		if !ok {
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		var req createWebhookRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		endpoint, err := webhookSvc.CreateEndpoint(r.Context(), identity.UserID, req.APIKeyID, req.URL)
+		if err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusCreated, endpoint)
+	}
+}
+
+func DeleteWebhookHandler(webhookSvc service.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, id, ok := webhookRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := webhookSvc.DeleteEndpoint(r.Context(), identity.UserID, id); err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListWebhookDeliveriesHandler lists the deliveries of an endpoint created in
+// the requested time range, optionally filtered by status.
+func ListWebhookDeliveriesHandler(webhookSvc service.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, id, ok := webhookRequest(w, r)
+		if !ok {
+			return
+		}
+
+		from, to, err := parseTimeRange(r, defaultWebhookDeliveryWindow)
+		if err != nil {
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		deliveries, err := webhookSvc.ListDeliveries(r.Context(), identity.UserID, id, from, to, r.URL.Query().Get("status"))
+		if err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"from":       from,
+			"to":         to,
+			"deliveries": deliveries,
+		})
+	}
+}
+
+// RedeliverWebhookHandler queues a delivery to be sent again with a fresh
+// retry budget.
+func RedeliverWebhookHandler(webhookSvc service.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, id, ok := webhookRequest(w, r)
+		if !ok {
+			return
+		}
+
+		delivery, err := webhookSvc.Redeliver(r.Context(), identity.UserID, id)
+		if err != nil {
+			respondWithWebhookError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusAccepted, delivery)
+	}
+}
@@ -0,0 +1,2 @@
+-- 0006_add_prediction_jobs_table.down.sql
+DROP TABLE IF EXISTS prediction_jobs;
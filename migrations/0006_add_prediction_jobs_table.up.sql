@@ -0,0 +1,21 @@
+-- 0006_add_prediction_jobs_table.up.sql
+CREATE TABLE prediction_jobs (
+  id UUID PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  api_key_id BIGINT REFERENCES api_keys(id) ON DELETE SET NULL,
+  status TEXT NOT NULL DEFAULT 'queued',
+  items JSONB NOT NULL,
+  results JSONB,
+  total_items INT NOT NULL,
+  processed_items INT NOT NULL DEFAULT 0,
+  failed_items INT NOT NULL DEFAULT 0,
+  error TEXT,
+  lease_expires_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  started_at TIMESTAMPTZ,
+  completed_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON prediction_jobs (user_id);
+CREATE INDEX ON prediction_jobs (status);
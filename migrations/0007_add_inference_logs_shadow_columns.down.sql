@@ -0,0 +1,5 @@
+-- 0007_add_inference_logs_shadow_columns.down.sql
+ALTER TABLE inference_logs
+  DROP COLUMN IF EXISTS shadow_error,
+  DROP COLUMN IF EXISTS shadow_response_payload,
+  DROP COLUMN IF EXISTS shadow_model;
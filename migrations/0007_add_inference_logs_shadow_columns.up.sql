@@ -0,0 +1,7 @@
+-- 0007_add_inference_logs_shadow_columns.up.sql
+ALTER TABLE inference_logs
+  ADD COLUMN shadow_model TEXT,
+  ADD COLUMN shadow_response_payload JSONB,
+  ADD COLUMN shadow_error TEXT;
+
+CREATE INDEX ON inference_logs (user_id, shadow_model) WHERE shadow_model IS NOT NULL;
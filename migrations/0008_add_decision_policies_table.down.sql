@@ -0,0 +1,7 @@
+-- 0008_add_decision_policies_table.down.sql
+ALTER TABLE inference_logs
+  DROP COLUMN IF EXISTS policy_version,
+  DROP COLUMN IF EXISTS policy_id,
+  DROP COLUMN IF EXISTS decision;
+
+DROP TABLE IF EXISTS decision_policies;
@@ -0,0 +1,21 @@
+-- 0008_add_decision_policies_table.up.sql
+CREATE TABLE decision_policies (
+  id BIGSERIAL PRIMARY KEY,
+  plan TEXT,
+  api_key_id BIGINT REFERENCES api_keys(id) ON DELETE CASCADE,
+  review_threshold DOUBLE PRECISION NOT NULL,
+  decline_threshold DOUBLE PRECISION NOT NULL,
+  version INT NOT NULL DEFAULT 1,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (num_nonnulls(plan, api_key_id) = 1),
+  CHECK (0 <= review_threshold AND review_threshold <= decline_threshold AND decline_threshold <= 1)
+);
+
+CREATE UNIQUE INDEX ON decision_policies (plan) WHERE plan IS NOT NULL;
+CREATE UNIQUE INDEX ON decision_policies (api_key_id) WHERE api_key_id IS NOT NULL;
+
+ALTER TABLE inference_logs
+  ADD COLUMN decision TEXT,
+  ADD COLUMN policy_id BIGINT,
+  ADD COLUMN policy_version INT;
@@ -0,0 +1,4 @@
+-- 0009_add_fraud_rules_table.down.sql
+ALTER TABLE inference_logs DROP COLUMN IF EXISTS fired_rules;
+
+DROP TABLE IF EXISTS fraud_rules;
@@ -0,0 +1,16 @@
+-- 0009_add_fraud_rules_table.up.sql
+CREATE TABLE fraud_rules (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT UNIQUE NOT NULL,
+  stage TEXT NOT NULL CHECK (stage IN ('pre', 'post')),
+  expression TEXT NOT NULL,
+  decision TEXT NOT NULL CHECK (decision IN ('approve', 'review', 'decline')),
+  reason_code TEXT NOT NULL,
+  priority INT NOT NULL DEFAULT 100,
+  enabled BOOLEAN NOT NULL DEFAULT true,
+  version INT NOT NULL DEFAULT 1,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE inference_logs ADD COLUMN fired_rules JSONB;
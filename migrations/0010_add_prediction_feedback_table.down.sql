@@ -0,0 +1,4 @@
+-- 0010_add_prediction_feedback_table.down.sql
+DROP INDEX IF EXISTS inference_logs_transaction_id_idx;
+
+DROP TABLE IF EXISTS prediction_feedback;
@@ -0,0 +1,17 @@
+-- 0010_add_prediction_feedback_table.up.sql
+CREATE TABLE prediction_feedback (
+  id BIGSERIAL PRIMARY KEY,
+  inference_log_id BIGINT NOT NULL REFERENCES inference_logs(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  api_key_id BIGINT REFERENCES api_keys(id) ON DELETE SET NULL,
+  label TEXT NOT NULL CHECK (label IN ('fraud', 'legit')),
+  label_source TEXT NOT NULL,
+  labeled_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX ON prediction_feedback (inference_log_id);
+CREATE INDEX ON prediction_feedback (user_id);
+
+CREATE INDEX inference_logs_transaction_id_idx ON inference_logs (user_id, (request_payload->'features'->>'transaction_id'));
@@ -0,0 +1,2 @@
+-- 0011_add_model_metrics_table.down.sql
+DROP TABLE IF EXISTS model_metrics;
@@ -0,0 +1,22 @@
+-- 0011_add_model_metrics_table.up.sql
+CREATE TABLE model_metrics (
+  model_name TEXT NOT NULL,
+  run_id TEXT NOT NULL,
+  bucket_start TIMESTAMPTZ NOT NULL,
+  bucket_end TIMESTAMPTZ NOT NULL,
+  total BIGINT NOT NULL,
+  positives BIGINT NOT NULL,
+  true_positives BIGINT NOT NULL,
+  false_positives BIGINT NOT NULL,
+  true_negatives BIGINT NOT NULL,
+  false_negatives BIGINT NOT NULL,
+  precision DOUBLE PRECISION,
+  recall DOUBLE PRECISION,
+  false_positive_rate DOUBLE PRECISION,
+  auc DOUBLE PRECISION,
+  calibration_error DOUBLE PRECISION,
+  computed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (model_name, run_id, bucket_start)
+);
+
+CREATE INDEX ON model_metrics (bucket_start);
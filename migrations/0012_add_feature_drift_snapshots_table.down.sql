@@ -0,0 +1,2 @@
+-- 0012_add_feature_drift_snapshots_table.down.sql
+DROP TABLE IF EXISTS feature_drift_snapshots;
@@ -0,0 +1,19 @@
+-- 0012_add_feature_drift_snapshots_table.up.sql
+CREATE TABLE feature_drift_snapshots (
+  id BIGSERIAL PRIMARY KEY,
+  feature TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  reference_from TIMESTAMPTZ NOT NULL,
+  reference_to TIMESTAMPTZ NOT NULL,
+  recent_from TIMESTAMPTZ NOT NULL,
+  recent_to TIMESTAMPTZ NOT NULL,
+  reference_count BIGINT NOT NULL,
+  recent_count BIGINT NOT NULL,
+  psi DOUBLE PRECISION NOT NULL,
+  ks DOUBLE PRECISION,
+  drifted BOOLEAN NOT NULL,
+  computed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON feature_drift_snapshots (computed_at);
+CREATE INDEX ON feature_drift_snapshots (feature, computed_at);
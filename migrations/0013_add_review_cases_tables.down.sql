@@ -0,0 +1,3 @@
+-- 0013_add_review_cases_tables.down.sql
+DROP TABLE IF EXISTS review_case_comments;
+DROP TABLE IF EXISTS review_cases;
@@ -0,0 +1,32 @@
+-- 0013_add_review_cases_tables.up.sql
+CREATE TABLE review_cases (
+  id BIGSERIAL PRIMARY KEY,
+  inference_log_id BIGINT NOT NULL REFERENCES inference_logs(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  api_key_id BIGINT REFERENCES api_keys(id) ON DELETE SET NULL,
+  transaction_id TEXT,
+  model_name TEXT NOT NULL,
+  score DOUBLE PRECISION NOT NULL,
+  decision TEXT NOT NULL,
+  reason TEXT NOT NULL CHECK (reason IN ('flagged', 'review')),
+  status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+  assignee TEXT,
+  resolution TEXT CHECK (resolution IN ('fraud', 'legit')),
+  resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  resolved_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX ON review_cases (inference_log_id);
+CREATE INDEX ON review_cases (user_id, created_at);
+
+CREATE TABLE review_case_comments (
+  id BIGSERIAL PRIMARY KEY,
+  case_id BIGINT NOT NULL REFERENCES review_cases(id) ON DELETE CASCADE,
+  author_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON review_case_comments (case_id, created_at);
@@ -0,0 +1,3 @@
+-- 0014_add_webhooks_tables.down.sql
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_endpoints;
@@ -0,0 +1,33 @@
+-- 0014_add_webhooks_tables.up.sql
+CREATE TABLE webhook_endpoints (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  api_key_id BIGINT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON webhook_endpoints (user_id);
+CREATE INDEX ON webhook_endpoints (api_key_id);
+
+-- webhook_deliveries is the outbox of webhook events, one row per event and
+-- endpoint.
+CREATE TABLE webhook_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+  event_id UUID NOT NULL,
+  event_type TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_status_code INT,
+  last_error TEXT,
+  delivered_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX ON webhook_deliveries (endpoint_id, created_at);
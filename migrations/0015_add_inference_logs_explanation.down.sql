@@ -0,0 +1,2 @@
+-- 0015_add_inference_logs_explanation.down.sql
+ALTER TABLE inference_logs DROP COLUMN IF EXISTS explanation;
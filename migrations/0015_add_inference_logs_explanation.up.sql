@@ -0,0 +1,2 @@
+-- 0015_add_inference_logs_explanation.up.sql
+ALTER TABLE inference_logs ADD COLUMN explanation JSONB;
@@ -0,0 +1,2 @@
+-- 0016_add_inference_logs_keyset_index.down.sql
+DROP INDEX IF EXISTS inference_logs_user_id_id_idx;
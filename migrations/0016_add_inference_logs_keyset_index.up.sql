@@ -0,0 +1,2 @@
+-- 0016_add_inference_logs_keyset_index.up.sql
+CREATE INDEX inference_logs_user_id_id_idx ON inference_logs (user_id, id DESC);
@@ -0,0 +1,48 @@
+-- 0017_partition_inference_logs.down.sql
+-- Archived partitions are not restored.
+ALTER TABLE inference_logs RENAME TO inference_logs_partitioned;
+ALTER INDEX inference_logs_pkey RENAME TO inference_logs_partitioned_pkey;
+ALTER SEQUENCE inference_logs_id_seq OWNED BY NONE;
+
+CREATE TABLE inference_logs (
+  id BIGINT PRIMARY KEY DEFAULT nextval('inference_logs_id_seq'),
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  api_key_id BIGINT REFERENCES api_keys(id) ON DELETE SET NULL,
+  request_payload JSONB NOT NULL,
+  response_payload JSONB,
+  error TEXT,
+  request_time TIMESTAMPTZ NOT NULL,
+  response_time TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  shadow_model TEXT,
+  shadow_response_payload JSONB,
+  shadow_error TEXT,
+  decision TEXT,
+  policy_id BIGINT,
+  policy_version INT,
+  fired_rules JSONB,
+  explanation JSONB
+);
+
+INSERT INTO inference_logs SELECT * FROM inference_logs_partitioned;
+DROP TABLE inference_logs_partitioned;
+ALTER SEQUENCE inference_logs_id_seq OWNED BY inference_logs.id;
+
+DROP FUNCTION IF EXISTS create_inference_logs_partition(DATE);
+DROP FUNCTION IF EXISTS retire_inference_logs_partition(TEXT, BOOLEAN);
+DROP SCHEMA IF EXISTS inference_logs_archive CASCADE;
+
+CREATE INDEX ON inference_logs (user_id);
+CREATE INDEX ON inference_logs (api_key_id);
+CREATE INDEX ON inference_logs (user_id, shadow_model) WHERE shadow_model IS NOT NULL;
+CREATE INDEX inference_logs_transaction_id_idx ON inference_logs (user_id, (request_payload->'features'->>'transaction_id'));
+CREATE INDEX inference_logs_user_id_id_idx ON inference_logs (user_id, id DESC);
+
+DELETE FROM prediction_feedback f WHERE NOT EXISTS (SELECT 1 FROM inference_logs l WHERE l.id = f.inference_log_id);
+DELETE FROM review_cases c WHERE NOT EXISTS (SELECT 1 FROM inference_logs l WHERE l.id = c.inference_log_id);
+ALTER TABLE prediction_feedback
+  ADD CONSTRAINT prediction_feedback_inference_log_id_fkey
+  FOREIGN KEY (inference_log_id) REFERENCES inference_logs(id) ON DELETE CASCADE;
+ALTER TABLE review_cases
+  ADD CONSTRAINT review_cases_inference_log_id_fkey
+  FOREIGN KEY (inference_log_id) REFERENCES inference_logs(id) ON DELETE CASCADE;
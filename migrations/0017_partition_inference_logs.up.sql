@@ -0,0 +1,103 @@
+-- 0017_partition_inference_logs.up.sql
+-- inference_logs is range-partitioned by the month of request_time (UTC).
+-- The primary key has to include the partition key, so prediction_feedback and
+-- review_cases no longer reference the logs by foreign key; their rows are
+-- removed with the logs by retire_inference_logs_partition and the retention
+-- deletes instead.
+ALTER TABLE prediction_feedback DROP CONSTRAINT IF EXISTS prediction_feedback_inference_log_id_fkey;
+ALTER TABLE review_cases DROP CONSTRAINT IF EXISTS review_cases_inference_log_id_fkey;
+
+ALTER TABLE inference_logs RENAME TO inference_logs_legacy;
+ALTER INDEX inference_logs_pkey RENAME TO inference_logs_legacy_pkey;
+ALTER SEQUENCE inference_logs_id_seq OWNED BY NONE;
+
+CREATE TABLE inference_logs (
+  id BIGINT NOT NULL DEFAULT nextval('inference_logs_id_seq'),
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  api_key_id BIGINT REFERENCES api_keys(id) ON DELETE SET NULL,
+  request_payload JSONB NOT NULL,
+  response_payload JSONB,
+  error TEXT,
+  request_time TIMESTAMPTZ NOT NULL,
+  response_time TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  shadow_model TEXT,
+  shadow_response_payload JSONB,
+  shadow_error TEXT,
+  decision TEXT,
+  policy_id BIGINT,
+  policy_version INT,
+  fired_rules JSONB,
+  explanation JSONB,
+  PRIMARY KEY (id, request_time)
+) PARTITION BY RANGE (request_time);
+
+-- Retired partitions are moved here when archiving instead of being dropped.
+CREATE SCHEMA IF NOT EXISTS inference_logs_archive;
+
+-- create_inference_logs_partition creates the partition of the month of
+-- month_start, named inference_logs_yYYYYmMM, unless it exists. Partition
+-- changes take an advisory lock as every API instance runs the maintainer.
+CREATE FUNCTION create_inference_logs_partition(month_start DATE) RETURNS TEXT AS $$
+DECLARE
+  partition_name TEXT := format('inference_logs_y%sm%s', to_char(month_start, 'YYYY'), to_char(month_start, 'MM'));
+  range_start TIMESTAMPTZ := date_trunc('month', month_start::timestamp) AT TIME ZONE 'UTC';
+  range_end TIMESTAMPTZ := (date_trunc('month', month_start::timestamp) + interval '1 month') AT TIME ZONE 'UTC';
+BEGIN
+  PERFORM pg_advisory_xact_lock(hashtext('inference_logs_partitions'));
+  EXECUTE format(
+    'CREATE TABLE IF NOT EXISTS %I PARTITION OF inference_logs FOR VALUES FROM (%L) TO (%L)',
+    partition_name, range_start, range_end
+  );
+  RETURN partition_name;
+END;
+$$ LANGUAGE plpgsql;
+
+-- retire_inference_logs_partition detaches a partition and either moves it to
+-- the inference_logs_archive schema, keeping its feedback and review cases, or
+-- drops it with them. Partitions retired concurrently are skipped.
+CREATE FUNCTION retire_inference_logs_partition(partition_name TEXT, archive BOOLEAN) RETURNS VOID AS $$
+BEGIN
+  PERFORM pg_advisory_xact_lock(hashtext('inference_logs_partitions'));
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_inherits
+    WHERE inhrelid = to_regclass(quote_ident(partition_name)) AND inhparent = 'inference_logs'::regclass
+  ) THEN
+    RETURN;
+  END IF;
+  EXECUTE format('ALTER TABLE inference_logs DETACH PARTITION %I', partition_name);
+  IF archive THEN
+    EXECUTE format('ALTER TABLE %I SET SCHEMA inference_logs_archive', partition_name);
+  ELSE
+    EXECUTE format('DELETE FROM prediction_feedback WHERE inference_log_id IN (SELECT id FROM %I)', partition_name);
+    EXECUTE format('DELETE FROM review_cases WHERE inference_log_id IN (SELECT id FROM %I)', partition_name);
+    EXECUTE format('DROP TABLE %I', partition_name);
+  END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Partitions for every month with logs, up to three months ahead.
+DO $$
+DECLARE
+  month_start DATE;
+BEGIN
+  FOR month_start IN
+    SELECT generate_series(
+      date_trunc('month', COALESCE((SELECT min(request_time) FROM inference_logs_legacy), now()) AT TIME ZONE 'UTC'),
+      date_trunc('month', GREATEST((SELECT max(request_time) FROM inference_logs_legacy), now()) AT TIME ZONE 'UTC') + interval '3 months',
+      interval '1 month'
+    )::date
+  LOOP
+    PERFORM create_inference_logs_partition(month_start);
+  END LOOP;
+END $$;
+
+INSERT INTO inference_logs SELECT * FROM inference_logs_legacy;
+DROP TABLE inference_logs_legacy;
+ALTER SEQUENCE inference_logs_id_seq OWNED BY inference_logs.id;
+
+CREATE INDEX ON inference_logs (user_id);
+CREATE INDEX ON inference_logs (api_key_id);
+CREATE INDEX ON inference_logs (user_id, shadow_model) WHERE shadow_model IS NOT NULL;
+CREATE INDEX inference_logs_transaction_id_idx ON inference_logs (user_id, (request_payload->'features'->>'transaction_id'));
+CREATE INDEX inference_logs_user_id_id_idx ON inference_logs (user_id, id DESC);
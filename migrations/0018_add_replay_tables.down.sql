@@ -0,0 +1,3 @@
+-- 0018_add_replay_tables.down.sql
+DROP TABLE IF EXISTS replay_results;
+DROP TABLE IF EXISTS replay_runs;
@@ -0,0 +1,42 @@
+-- 0018_add_replay_tables.up.sql
+-- A replay run re-scores the successful predictions matching its filter with
+-- target_model. last_log_id is the id of the last replayed log, from which an
+-- interrupted run resumes.
+CREATE TABLE replay_runs (
+  id BIGSERIAL PRIMARY KEY,
+  created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  target_model TEXT NOT NULL,
+  from_time TIMESTAMPTZ NOT NULL,
+  to_time TIMESTAMPTZ NOT NULL,
+  user_id BIGINT,
+  api_key_id BIGINT,
+  source_model TEXT,
+  rate_per_second DOUBLE PRECISION NOT NULL,
+  status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'completed', 'failed')),
+  total_items INT NOT NULL,
+  processed_items INT NOT NULL DEFAULT 0,
+  failed_items INT NOT NULL DEFAULT 0,
+  last_log_id BIGINT NOT NULL DEFAULT 0,
+  error TEXT,
+  lease_expires_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  started_at TIMESTAMPTZ,
+  completed_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON replay_runs (status);
+
+-- The original response is copied so that the report outlives the retention
+-- of the inference logs. inference_log_id has no foreign key as inference_logs
+-- is partitioned.
+CREATE TABLE replay_results (
+  run_id BIGINT NOT NULL REFERENCES replay_runs(id) ON DELETE CASCADE,
+  inference_log_id BIGINT NOT NULL,
+  request_time TIMESTAMPTZ NOT NULL,
+  original_response JSONB NOT NULL,
+  replay_response JSONB,
+  error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (run_id, inference_log_id)
+);
@@ -0,0 +1,2 @@
+-- 0019_add_inference_log_scoring_path.down.sql
+ALTER TABLE inference_logs DROP COLUMN IF EXISTS scoring_path;
@@ -0,0 +1,5 @@
+-- 0019_add_inference_log_scoring_path.up.sql
+-- scoring_path records how a prediction was scored: by the vendor model, by a
+-- pre-model rule or by the local fallback while the vendor was unavailable.
+-- It is NULL for failed predictions and logs written before this migration.
+ALTER TABLE inference_logs ADD COLUMN scoring_path TEXT;
@@ -0,0 +1,2 @@
+-- 0020_add_webhook_delivery_lease.down.sql
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS leased_until;
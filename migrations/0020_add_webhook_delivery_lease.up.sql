@@ -0,0 +1,4 @@
+-- 0020_add_webhook_delivery_lease.up.sql
+-- leased_until is set while a dispatcher is sending a delivery, so that a
+-- claimed delivery can be told apart from one waiting for its next retry.
+ALTER TABLE webhook_deliveries ADD COLUMN leased_until TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+-- 0021_add_fraud_rule_versions.down.sql
+DROP TABLE IF EXISTS fraud_rule_versions;
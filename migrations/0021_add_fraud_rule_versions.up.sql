@@ -0,0 +1,21 @@
+-- 0021_add_fraud_rule_versions.up.sql
+-- Every version of every fraud rule, so that the fired rules recorded in the
+-- inference logs can be resolved. Versions of deleted rules are kept, so
+-- rule_id does not reference fraud_rules.
+CREATE TABLE fraud_rule_versions (
+  rule_id BIGINT NOT NULL,
+  version INT NOT NULL,
+  name TEXT NOT NULL,
+  stage TEXT NOT NULL,
+  expression TEXT NOT NULL,
+  decision TEXT NOT NULL,
+  reason_code TEXT NOT NULL,
+  priority INT NOT NULL,
+  enabled BOOLEAN NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (rule_id, version)
+);
+
+INSERT INTO fraud_rule_versions (rule_id, version, name, stage, expression, decision, reason_code, priority, enabled, created_at)
+SELECT id, version, name, stage, expression, decision, reason_code, priority, enabled, updated_at
+FROM fraud_rules;
@@ -0,0 +1,2 @@
+-- 0022_add_feature_drift_snapshot_window_index.down.sql
+DROP INDEX IF EXISTS feature_drift_snapshots_feature_recent_to_key;
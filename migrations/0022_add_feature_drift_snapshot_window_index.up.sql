@@ -0,0 +1,8 @@
+-- 0022_add_feature_drift_snapshot_window_index.up.sql
+-- Instances computing the drift of the same window update one snapshot per
+-- feature. Earlier duplicates keep the latest snapshot.
+DELETE FROM feature_drift_snapshots s
+USING feature_drift_snapshots newer
+WHERE s.feature = newer.feature AND s.recent_to = newer.recent_to AND s.id < newer.id;
+
+CREATE UNIQUE INDEX feature_drift_snapshots_feature_recent_to_key ON feature_drift_snapshots (feature, recent_to);
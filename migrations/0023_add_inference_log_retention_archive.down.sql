@@ -0,0 +1,3 @@
+-- 0023_add_inference_log_retention_archive.down.sql
+DROP TABLE IF EXISTS inference_logs_archive.expired_inference_logs;
+DROP INDEX IF EXISTS inference_logs_request_time_idx;
@@ -0,0 +1,8 @@
+-- 0023_add_inference_log_retention_archive.up.sql
+-- The retention finds expired logs by request_time across the partitions.
+CREATE INDEX ON inference_logs (request_time);
+
+-- Logs expired row by row are moved here when archiving, as retired
+-- partitions are moved to the inference_logs_archive schema. Columns added to
+-- inference_logs must be added here too.
+CREATE TABLE inference_logs_archive.expired_inference_logs (LIKE inference_logs);
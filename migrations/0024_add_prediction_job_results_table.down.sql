@@ -0,0 +1,11 @@
+-- 0024_add_prediction_job_results_table.down.sql
+ALTER TABLE prediction_jobs ADD COLUMN results JSONB;
+
+UPDATE prediction_jobs j
+SET results = (
+  SELECT jsonb_agg(jsonb_strip_nulls(jsonb_build_object('index', r.item_index, 'response', r.response, 'error', r.error)) ORDER BY r.item_index)
+  FROM prediction_job_results r
+  WHERE r.job_id = j.id
+);
+
+DROP TABLE IF EXISTS prediction_job_results;
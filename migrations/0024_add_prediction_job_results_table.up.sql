@@ -0,0 +1,18 @@
+-- 0024_add_prediction_job_results_table.up.sql
+-- Job results are stored one row per item instead of as one document on the
+-- job, so saving progress only writes the newly finished items and large
+-- jobs are read back page by page.
+CREATE TABLE prediction_job_results (
+  job_id UUID NOT NULL REFERENCES prediction_jobs(id) ON DELETE CASCADE,
+  item_index INT NOT NULL,
+  response JSONB,
+  error TEXT,
+  PRIMARY KEY (job_id, item_index)
+);
+
+INSERT INTO prediction_job_results (job_id, item_index, response, error)
+SELECT j.id, r.index, r.response, r.error
+FROM prediction_jobs j, jsonb_to_recordset(j.results) AS r("index" INT, response JSONB, error TEXT)
+WHERE j.results IS NOT NULL;
+
+ALTER TABLE prediction_jobs DROP COLUMN results;